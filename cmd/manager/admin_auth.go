@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Authentication modes of the admin endpoints.
+const (
+	adminAuthNone       = "none"
+	adminAuthToken      = "token"
+	adminAuthKubernetes = "kubernetes"
+)
+
+// How long TokenReview and SubjectAccessReview decisions are reused.
+const (
+	adminAuthAllowTTL = time.Minute
+	adminAuthDenyTTL  = 10 * time.Second
+)
+
+// adminAuthConfig selects how requests to the admin endpoints of the metrics listener are
+// authenticated. In token mode the bearer token must equal Token or the content of TokenFile,
+// which is read on every request so that a rotated Secret is picked up.
+type adminAuthConfig struct {
+	Mode      string
+	Token     string
+	TokenFile string
+}
+
+type adminAuthResponse struct {
+	Message string `json:"message"`
+}
+
+type adminAuthDecision struct {
+	status  int
+	message string
+	expires time.Time
+}
+
+// adminAuthenticator guards the admin endpoints. In kubernetes mode bearer tokens are
+// authenticated with a TokenReview and the request is authorized with a SubjectAccessReview for
+// the non-resource URL of the endpoint, with the lowercase HTTP method as verb, as the API server
+// does for its own non-resource URLs.
+type adminAuthenticator struct {
+	cfg    adminAuthConfig
+	client kubernetes.Interface
+	log    logr.Logger
+	now    func() time.Time
+
+	mu        sync.Mutex
+	decisions map[string]adminAuthDecision
+}
+
+func newAdminAuthenticator(cfg adminAuthConfig, client kubernetes.Interface, log logr.Logger) *adminAuthenticator {
+	return &adminAuthenticator{cfg: cfg, client: client, log: log, now: time.Now, decisions: make(map[string]adminAuthDecision)}
+}
+
+// Wrap returns h guarded by the configured authentication.
+func (a *adminAuthenticator) Wrap(h http.Handler) http.Handler {
+	if a.cfg.Mode == "" || a.cfg.Mode == adminAuthNone {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := bearerToken(r)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="k8s-copycat"`)
+			a.deny(w, r, http.StatusUnauthorized, "bearer token required")
+			return
+		}
+		status, message := a.authorize(r.Context(), token, strings.ToLower(r.Method), r.URL.Path)
+		if status != http.StatusOK {
+			if status == http.StatusUnauthorized {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="k8s-copycat", error="invalid_token"`)
+			}
+			a.deny(w, r, status, message)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+func (a *adminAuthenticator) authorize(ctx context.Context, token, verb, path string) (int, string) {
+	if a.cfg.Mode == adminAuthToken {
+		expected, err := a.expectedToken()
+		if err != nil {
+			a.log.Error(err, "read admin token")
+			return http.StatusInternalServerError, "admin token unavailable"
+		}
+		if expected == "" || subtle.ConstantTimeCompare([]byte(token), []byte(expected)) != 1 {
+			return http.StatusUnauthorized, "invalid bearer token"
+		}
+		return http.StatusOK, ""
+	}
+
+	sum := sha256.Sum256([]byte(token))
+	key := hex.EncodeToString(sum[:]) + "|" + verb + "|" + path
+	now := a.now()
+	a.mu.Lock()
+	if decision, ok := a.decisions[key]; ok && now.Before(decision.expires) {
+		a.mu.Unlock()
+		return decision.status, decision.message
+	}
+	a.mu.Unlock()
+
+	status, message, err := a.review(ctx, token, verb, path)
+	if err != nil {
+		// Review failures are not cached, the next request asks the API server again.
+		a.log.Error(err, "review admin request", "verb", verb, "path", path)
+		return http.StatusInternalServerError, "authorization unavailable"
+	}
+	ttl := adminAuthDenyTTL
+	if status == http.StatusOK {
+		ttl = adminAuthAllowTTL
+	}
+	a.mu.Lock()
+	for k, decision := range a.decisions {
+		if !now.Before(decision.expires) {
+			delete(a.decisions, k)
+		}
+	}
+	a.decisions[key] = adminAuthDecision{status: status, message: message, expires: now.Add(ttl)}
+	a.mu.Unlock()
+	return status, message
+}
+
+func (a *adminAuthenticator) review(ctx context.Context, token, verb, path string) (int, string, error) {
+	tr, err := a.client.AuthenticationV1().TokenReviews().Create(ctx, &authenticationv1.TokenReview{
+		Spec: authenticationv1.TokenReviewSpec{Token: token},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return 0, "", fmt.Errorf("create token review: %w", err)
+	}
+	if !tr.Status.Authenticated {
+		return http.StatusUnauthorized, "invalid bearer token", nil
+	}
+	user := tr.Status.User
+	extra := make(map[string]authorizationv1.ExtraValue, len(user.Extra))
+	for k, v := range user.Extra {
+		extra[k] = authorizationv1.ExtraValue(v)
+	}
+	sar, err := a.client.AuthorizationV1().SubjectAccessReviews().Create(ctx, &authorizationv1.SubjectAccessReview{
+		Spec: authorizationv1.SubjectAccessReviewSpec{
+			User:                  user.Username,
+			UID:                   user.UID,
+			Groups:                user.Groups,
+			Extra:                 extra,
+			NonResourceAttributes: &authorizationv1.NonResourceAttributes{Path: path, Verb: verb},
+		},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return 0, "", fmt.Errorf("create subject access review: %w", err)
+	}
+	if !sar.Status.Allowed {
+		return http.StatusForbidden, fmt.Sprintf("user %s may not %s %s", user.Username, verb, path), nil
+	}
+	return http.StatusOK, "", nil
+}
+
+func (a *adminAuthenticator) expectedToken() (string, error) {
+	if a.cfg.TokenFile == "" {
+		return a.cfg.Token, nil
+	}
+	b, err := os.ReadFile(a.cfg.TokenFile)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+func (a *adminAuthenticator) deny(w http.ResponseWriter, r *http.Request, status int, message string) {
+	a.log.V(1).Info("rejected admin request", "method", r.Method, "path", r.URL.Path, "status", status, "reason", message)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(adminAuthResponse{Message: message}); err != nil {
+		a.log.Error(err, "encode admin auth response")
+	}
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-logr/logr/testr"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+var okHandler = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+	w.WriteHeader(http.StatusOK)
+})
+
+func serveAdmin(h http.Handler, method, path, token string) int {
+	req := httptest.NewRequest(method, path, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+func TestAdminAuthToken(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("s3cret\n"), 0o600); err != nil {
+		t.Fatalf("write token: %v", err)
+	}
+	h := newAdminAuthenticator(adminAuthConfig{Mode: adminAuthToken, TokenFile: tokenFile}, nil, testr.New(t)).Wrap(okHandler)
+
+	if code := serveAdmin(h, http.MethodPost, "/force-reconcile", ""); code != http.StatusUnauthorized {
+		t.Fatalf("expected request without token to be rejected, got %d", code)
+	}
+	if code := serveAdmin(h, http.MethodPost, "/force-reconcile", "wrong"); code != http.StatusUnauthorized {
+		t.Fatalf("expected wrong token to be rejected, got %d", code)
+	}
+	if code := serveAdmin(h, http.MethodPost, "/force-reconcile", "s3cret"); code != http.StatusOK {
+		t.Fatalf("expected token from file to be accepted, got %d", code)
+	}
+
+	// A rotated Secret is picked up without a restart.
+	if err := os.WriteFile(tokenFile, []byte("rotated"), 0o600); err != nil {
+		t.Fatalf("write token: %v", err)
+	}
+	if code := serveAdmin(h, http.MethodPost, "/force-reconcile", "s3cret"); code != http.StatusUnauthorized {
+		t.Fatalf("expected previous token to be rejected after rotation, got %d", code)
+	}
+}
+
+func TestAdminAuthKubernetes(t *testing.T) {
+	client := fake.NewClientset()
+	reviews := 0
+	client.PrependReactor("create", "tokenreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		reviews++
+		tr := action.(k8stesting.CreateAction).GetObject().(*authenticationv1.TokenReview)
+		if tr.Spec.Token == "operator" || tr.Spec.Token == "viewer" {
+			tr.Status = authenticationv1.TokenReviewStatus{Authenticated: true, User: authenticationv1.UserInfo{Username: tr.Spec.Token, Groups: []string{"system:authenticated"}}}
+		}
+		return true, tr, nil
+	})
+	var attributes []authorizationv1.NonResourceAttributes
+	client.PrependReactor("create", "subjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		sar := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SubjectAccessReview)
+		attributes = append(attributes, *sar.Spec.NonResourceAttributes)
+		sar.Status.Allowed = sar.Spec.User == "operator" || sar.Spec.NonResourceAttributes.Verb == "get"
+		return true, sar, nil
+	})
+	h := newAdminAuthenticator(adminAuthConfig{Mode: adminAuthKubernetes}, client, testr.New(t)).Wrap(okHandler)
+
+	if code := serveAdmin(h, http.MethodPost, "/force-reconcile", "unknown"); code != http.StatusUnauthorized {
+		t.Fatalf("expected unauthenticated token to be rejected, got %d", code)
+	}
+	if code := serveAdmin(h, http.MethodPost, "/force-reconcile", "viewer"); code != http.StatusForbidden {
+		t.Fatalf("expected viewer to be forbidden from POST, got %d", code)
+	}
+	if code := serveAdmin(h, http.MethodGet, "/images", "viewer"); code != http.StatusOK {
+		t.Fatalf("expected viewer to GET the inventory, got %d", code)
+	}
+	for range 2 {
+		if code := serveAdmin(h, http.MethodPost, "/force-reconcile", "operator"); code != http.StatusOK {
+			t.Fatalf("expected operator to POST, got %d", code)
+		}
+	}
+	if reviews != 4 {
+		t.Fatalf("expected the decision for operator to be cached, got %d token reviews", reviews)
+	}
+	if last := attributes[len(attributes)-1]; last.Path != "/force-reconcile" || last.Verb != "post" {
+		t.Fatalf("unexpected non-resource attributes: %+v", last)
+	}
+}
+
+func TestAdminAuthNone(t *testing.T) {
+	h := newAdminAuthenticator(adminAuthConfig{Mode: adminAuthNone}, nil, testr.New(t)).Wrap(okHandler)
+	if code := serveAdmin(h, http.MethodPost, "/force-reconcile", ""); code != http.StatusOK {
+		t.Fatalf("expected requests to pass without authentication, got %d", code)
+	}
+}
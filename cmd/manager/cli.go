@@ -0,0 +1,397 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"go.uber.org/zap/zapcore"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+
+	"github.com/matzegebbe/k8s-copycat/internal/config"
+	"github.com/matzegebbe/k8s-copycat/internal/controllers"
+	"github.com/matzegebbe/k8s-copycat/internal/mirror"
+	"github.com/matzegebbe/k8s-copycat/pkg/util"
+)
+
+// Exit codes of the subcommands.
+const (
+	exitOK     = 0
+	exitFailed = 1
+	exitUsage  = 2
+)
+
+// Output formats of the subcommands.
+const (
+	outputText = "text"
+	outputJSON = "json"
+)
+
+// subcommands run a single task with the configuration of the manager instead of starting it, so
+// that configurations can be tested and single images fixed from a laptop or a Job.
+var subcommands = map[string]func(args []string, stdout, stderr io.Writer) int{
+	"mirror":  runMirrorCommand,
+	"verify":  runVerifyCommand,
+	"explain": runExplainCommand,
+	"scan":    runScanCommand,
+}
+
+// command holds the flags shared by the subcommands.
+type command struct {
+	flags      *flag.FlagSet
+	stderr     io.Writer
+	configPath string
+	namespace  string
+	platforms  string
+	output     string
+	dryRun     bool
+	dryPull    bool
+	zapOpts    zap.Options
+}
+
+func newCommand(name, usage string, stderr io.Writer) *command {
+	c := &command{flags: flag.NewFlagSet(name, flag.ContinueOnError), stderr: stderr}
+	c.flags.SetOutput(stderr)
+	c.flags.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: copycat %s\n\nFlags:\n", usage)
+		c.flags.PrintDefaults()
+	}
+	c.flags.StringVar(&c.configPath, "config", os.Getenv("CONFIG_PATH"), "path of the config file (defaults to CONFIG_PATH or "+config.FilePath+")")
+	c.flags.StringVar(&c.namespace, "namespace", "", "namespace the images run in, used for repoPrefix placeholders and namespace rules")
+	c.flags.StringVar(&c.platforms, "platform", "", "comma-separated platforms such as linux/amd64 that replace mirrorPlatforms")
+	c.flags.StringVar(&c.output, "o", outputText, "output format: text or json")
+	c.zapOpts.BindFlags(c.flags)
+	return c
+}
+
+// parse parses args, which may mix flags and images, and returns the images.
+func (c *command) parse(args []string) ([]string, error) {
+	images, err := c.parseArgs(args)
+	if err != nil {
+		return nil, err
+	}
+	if len(images) == 0 {
+		return nil, errors.New("at least one image is required")
+	}
+	for _, image := range images {
+		if _, err := name.ParseReference(image, name.WeakValidation); err != nil {
+			return nil, fmt.Errorf("invalid image %q: %w", image, err)
+		}
+	}
+	return images, nil
+}
+
+// parseArgs parses args, which may mix flags and positional arguments, validates the shared
+// flags and returns the positional arguments.
+func (c *command) parseArgs(args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := c.flags.Parse(args); err != nil {
+			return nil, err
+		}
+		args = c.flags.Args()
+		if len(args) == 0 {
+			break
+		}
+		positional = append(positional, strings.TrimSpace(args[0]))
+		args = args[1:]
+	}
+	if c.output != outputText && c.output != outputJSON {
+		return nil, fmt.Errorf("unknown output format %q", c.output)
+	}
+	if err := mirror.ValidatePlatforms(c.meta().Platforms); err != nil {
+		return nil, fmt.Errorf("invalid platforms: %w", err)
+	}
+	return positional, nil
+}
+
+func (c *command) meta() mirror.Metadata {
+	return mirror.Metadata{Namespace: strings.TrimSpace(c.namespace), Platforms: splitQueryValues([]string{c.platforms})}
+}
+
+// pusher resolves the configuration like the manager does and builds its pusher. Logs go to
+// stderr so that stdout only carries results.
+func (c *command) pusher(ctx context.Context) (runtimeConfig, mirror.Pusher, error) {
+	fileCfg, cfgFound, err := loadConfigFileFrom(c.configPath)
+	if err != nil {
+		return runtimeConfig{}, nil, err
+	}
+	opts := c.zapOpts
+	configureJSONLogging(&opts)
+	opts.DestWriter = c.stderr
+	if opts.Level == nil {
+		if levelStr := strings.TrimSpace(fileCfg.LogLevel); levelStr != "" {
+			lvl, err := zapcore.ParseLevel(strings.ToLower(levelStr))
+			if err != nil {
+				return runtimeConfig{}, nil, fmt.Errorf("invalid log level %q: %w", fileCfg.LogLevel, err)
+			}
+			opts.Level = lvl
+		}
+	}
+	logger := zap.New(zap.UseFlagOptions(&opts))
+
+	cfg, err := loadRuntimeConfig(ctx, c.dryRun, c.dryPull, fileCfg, cfgFound)
+	if err != nil {
+		return runtimeConfig{}, nil, fmt.Errorf("resolve configuration: %w", err)
+	}
+	// The state store and layer cache belong to the manager; a one-shot run checks the registries.
+	bandwidth := mirror.NewBandwidthLimiter(cfg.BandwidthLimits, logger.WithName("mirror"))
+	return cfg, newPusher(cfg, logger.WithName("mirror"), mirror.WithBandwidthLimiter(bandwidth)), nil
+}
+
+func (c *command) fail(err error) int {
+	fmt.Fprintf(c.stderr, "error: %v\n", err)
+	return exitFailed
+}
+
+func (c *command) usageError(err error) int {
+	if !errors.Is(err, flag.ErrHelp) {
+		fmt.Fprintf(c.stderr, "error: %v\n", err)
+		c.flags.Usage()
+	}
+	return exitUsage
+}
+
+// runMirrorCommand mirrors the images and reports their targets. It fails when any image fails.
+func runMirrorCommand(args []string, stdout, stderr io.Writer) int {
+	c := newCommand("mirror", "mirror [flags] <image>...", stderr)
+	c.flags.BoolVar(&c.dryRun, "dry-run", false, "simulate image push without actually pushing")
+	c.flags.BoolVar(&c.dryPull, "dry-pull", false, "simulate image pull without contacting the source registry")
+	images, err := c.parse(args)
+	if err != nil {
+		return c.usageError(err)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	_, pusher, err := c.pusher(ctx)
+	if err != nil {
+		return c.fail(err)
+	}
+
+	inventory, _ := pusher.(mirror.ImageInventory)
+	meta := c.meta()
+	// No Pod reports the digest of these images, so tags are pulled by tag like static images.
+	digestPull := false
+	meta.DigestPull = &digestPull
+	results := make([]mirrorImageResult, 0, len(images))
+	code := exitOK
+	for _, image := range images {
+		result := mirrorImageResult{Image: image, State: jobSucceeded}
+		if err := pusher.Mirror(ctx, image, meta); err != nil {
+			result.State = jobFailed
+			result.Error = err.Error()
+			code = exitFailed
+		}
+		if inventory != nil {
+			if record, ok := inventory.ImageFor(image, meta); ok {
+				result.Target, result.TargetDigest, result.Status = record.Target, record.TargetDigest, record.Status
+			}
+		}
+		results = append(results, result)
+	}
+
+	if c.output == outputJSON {
+		return c.writeJSON(stdout, results, code)
+	}
+	w := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "IMAGE\tSTATUS\tTARGET\tDETAIL")
+	for _, r := range results {
+		status, detail := r.Status, r.TargetDigest
+		if r.State == jobFailed {
+			status, detail = jobFailed, r.Error
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", r.Image, orDash(status), orDash(r.Target), orDash(detail))
+	}
+	return c.flush(w, code)
+}
+
+type verifyResult struct {
+	mirror.Verification
+	Error string `json:"error,omitempty"`
+}
+
+// runVerifyCommand compares the digests of the images at their source and their target. It fails
+// when any target is missing or differs from its source.
+func runVerifyCommand(args []string, stdout, stderr io.Writer) int {
+	c := newCommand("verify", "verify [flags] <image>...", stderr)
+	images, err := c.parse(args)
+	if err != nil {
+		return c.usageError(err)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	_, pusher, err := c.pusher(ctx)
+	if err != nil {
+		return c.fail(err)
+	}
+	inspector, ok := pusher.(mirror.Inspector)
+	if !ok {
+		return c.fail(errors.New("the pusher cannot verify images"))
+	}
+
+	meta := c.meta()
+	results := make([]verifyResult, 0, len(images))
+	code := exitOK
+	for _, image := range images {
+		v, err := inspector.Verify(ctx, image, meta)
+		result := verifyResult{Verification: v}
+		if err != nil {
+			result.Status = "error"
+			result.Error = err.Error()
+		}
+		switch result.Status {
+		case mirror.VerifyMatch, mirror.VerifyPlatformSubset, mirror.VerifyExcluded:
+		default:
+			code = exitFailed
+		}
+		results = append(results, result)
+	}
+
+	if c.output == outputJSON {
+		return c.writeJSON(stdout, results, code)
+	}
+	w := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "IMAGE\tSTATUS\tTARGET\tSOURCE DIGEST\tTARGET DIGEST")
+	for _, r := range results {
+		targetDigest := r.TargetDigest
+		if r.Error != "" {
+			targetDigest = r.Error
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", r.Source, r.Status, orDash(r.Target), orDash(r.SourceDigest), orDash(targetDigest))
+	}
+	return c.flush(w, code)
+}
+
+// explanation is the target of an image together with every rule that applies to it.
+type explanation struct {
+	mirror.Resolution
+	Namespace           string            `json:"namespace,omitempty"`
+	NamespaceExcludedBy string            `json:"namespaceExcludedBy,omitempty"`
+	NamespaceSelector   string            `json:"namespaceSelector,omitempty"`
+	PathMap             *util.PathMapping `json:"pathMap,omitempty"`
+}
+
+// runExplainCommand prints the target of the images and the rules that lead to it without
+// contacting a registry.
+func runExplainCommand(args []string, stdout, stderr io.Writer) int {
+	c := newCommand("explain", "explain [flags] <image>...", stderr)
+	images, err := c.parse(args)
+	if err != nil {
+		return c.usageError(err)
+	}
+	cfg, pusher, err := c.pusher(context.Background())
+	if err != nil {
+		return c.fail(err)
+	}
+	inspector, ok := pusher.(mirror.Inspector)
+	if !ok {
+		return c.fail(errors.New("the pusher cannot explain images"))
+	}
+
+	meta := c.meta()
+	results := make([]explanation, 0, len(images))
+	for _, image := range images {
+		res, err := inspector.Resolve(image, meta)
+		if err != nil {
+			return c.fail(fmt.Errorf("explain %s: %w", image, err))
+		}
+		e := explanation{Resolution: res, Namespace: meta.Namespace, NamespaceSelector: selectorString(cfg.Selectors.Namespaces)}
+		if meta.Namespace != "" {
+			e.NamespaceExcludedBy = controllers.NamespaceExclusion(cfg.AllowedNS, cfg.SkipCfg, meta.Namespace)
+		}
+		if m, ok := util.MatchPathMapping(cfg.PathMap, res.SourceRepository); ok && res.ExcludedBy == "" {
+			e.PathMap = &m
+		}
+		results = append(results, e)
+	}
+
+	if c.output == outputJSON {
+		return c.writeJSON(stdout, results, exitOK)
+	}
+	w := tabwriter.NewWriter(stdout, 0, 4, 1, ' ', 0)
+	for i, e := range results {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		writeExplanation(w, e)
+	}
+	return c.flush(w, exitOK)
+}
+
+func writeExplanation(w io.Writer, e explanation) {
+	fmt.Fprintf(w, "image:\t%s\n", e.Source)
+	fmt.Fprintf(w, "source:\t%s/%s\n", e.SourceRegistry, e.SourceRepository)
+	if e.Namespace != "" {
+		switch e.NamespaceExcludedBy {
+		case "":
+			fmt.Fprintf(w, "namespace:\t%s (included)\n", e.Namespace)
+		case "skipNamespaces":
+			fmt.Fprintf(w, "namespace:\t%s (skipped by skipNamespaces, workloads here are not mirrored)\n", e.Namespace)
+		default:
+			fmt.Fprintf(w, "namespace:\t%s (not matched by includeNamespaces, workloads here are not mirrored)\n", e.Namespace)
+		}
+	}
+	if e.NamespaceSelector != "" {
+		fmt.Fprintf(w, "namespaceSelector:\t%s (not evaluated)\n", e.NamespaceSelector)
+	}
+	if e.ExcludedBy != "" {
+		fmt.Fprintf(w, "excluded:\t%s (excludeRegistries, the image is not mirrored)\n", e.ExcludedBy)
+		return
+	}
+	if e.PathMap != nil {
+		kind := "prefix"
+		if e.PathMap.Regex {
+			kind = "regex"
+		}
+		fmt.Fprintf(w, "pathMap:\t%s -> %s (%s rule %q -> %q)\n", e.SourceRepository, e.Repository, kind, e.PathMap.From, e.PathMap.To)
+	} else {
+		fmt.Fprintf(w, "pathMap:\tno rule matched\n")
+	}
+	fmt.Fprintf(w, "repoPrefix:\t%s\n", orDash(e.RepoPrefix))
+	fmt.Fprintf(w, "target:\t%s\n", e.Target)
+	switch {
+	case e.DigestPullIgnored:
+		fmt.Fprintf(w, "digestPull:\tenabled, but the tag is listed in digestPullIgnoredTags\n")
+	case e.DigestPull:
+		fmt.Fprintf(w, "digestPull:\tenabled, the digest reported by the Pod is mirrored\n")
+	default:
+		fmt.Fprintf(w, "digestPull:\tdisabled\n")
+	}
+	if len(e.Platforms) > 0 {
+		fmt.Fprintf(w, "platforms:\t%s\n", strings.Join(e.Platforms, ", "))
+	} else {
+		fmt.Fprintf(w, "platforms:\tall platforms of the source\n")
+	}
+}
+
+func (c *command) writeJSON(stdout io.Writer, v any, code int) int {
+	enc := json.NewEncoder(stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return c.fail(fmt.Errorf("encode output: %w", err))
+	}
+	return code
+}
+
+func (c *command) flush(w *tabwriter.Writer, code int) int {
+	if err := w.Flush(); err != nil {
+		return c.fail(fmt.Errorf("write output: %w", err))
+	}
+	return code
+}
+
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+// writeCommandConfig writes a config file for the subcommands and clears env overrides.
+func writeCommandConfig(t *testing.T, content string) string {
+	t.Helper()
+	for _, key := range []string{"CONFIG_PATH", "TARGET_KIND", "TARGET_REGISTRY", "TARGET_REPO_PREFIX", "TARGET_INSECURE", "DRY_RUN", "DRY_PULL", "INCLUDE_NAMESPACES", "SKIP_NAMESPACES", "EXCLUDE_REGISTRIES"} {
+		t.Setenv(key, "")
+	}
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	return path
+}
+
+func TestCommandParseMixesFlagsAndImages(t *testing.T) {
+	c := newCommand("explain", "explain", io.Discard)
+	images, err := c.parse([]string{"nginx:1.27", "--namespace", "team-a", "redis:7", "--platform", "linux/arm64,amd64"})
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if !reflect.DeepEqual(images, []string{"nginx:1.27", "redis:7"}) {
+		t.Fatalf("unexpected images %v", images)
+	}
+	meta := c.meta()
+	if meta.Namespace != "team-a" || !reflect.DeepEqual(meta.Platforms, []string{"linux/arm64", "amd64"}) {
+		t.Fatalf("unexpected metadata %+v", meta)
+	}
+
+	var stderr bytes.Buffer
+	if code := runExplainCommand([]string{"--namespace", "team-a"}, io.Discard, &stderr); code != exitUsage {
+		t.Fatalf("expected usage error without images, got %d", code)
+	}
+	if !strings.Contains(stderr.String(), "at least one image is required") {
+		t.Fatalf("expected missing image error, got %q", stderr.String())
+	}
+	if code := runVerifyCommand([]string{"nginx:1.27", "-o", "yaml"}, io.Discard, io.Discard); code != exitUsage {
+		t.Fatalf("expected usage error for unknown output format, got %d", code)
+	}
+}
+
+func TestRunExplainCommand(t *testing.T) {
+	path := writeCommandConfig(t, `targetKind: docker
+docker:
+  registry: mirror.example.com
+  repoPrefix: $namespace
+includeNamespaces: ["team-*"]
+skipNamespaces: ["team-legacy"]
+excludeRegistries: ["registry.k8s.io"]
+pathMap:
+  - from: library/
+    to: hub/
+`)
+
+	var stdout, stderr bytes.Buffer
+	code := runExplainCommand([]string{"nginx:1.27", "--namespace", "team-legacy", "--config", path}, &stdout, &stderr)
+	if code != exitOK {
+		t.Fatalf("expected success, got %d: %s", code, stderr.String())
+	}
+	for _, want := range []string{
+		"mirror.example.com/team-legacy/hub/nginx:1.27",
+		"skipped by skipNamespaces",
+		`library/nginx -> hub/nginx (prefix rule "library/" -> "hub/")`,
+		"all platforms of the source",
+	} {
+		if !strings.Contains(stdout.String(), want) {
+			t.Fatalf("expected output to contain %q, got:\n%s", want, stdout.String())
+		}
+	}
+
+	stdout.Reset()
+	code = runExplainCommand([]string{"-o", "json", "--config", path, "registry.k8s.io/pause:3.10"}, &stdout, &stderr)
+	if code != exitOK {
+		t.Fatalf("expected success, got %d: %s", code, stderr.String())
+	}
+	var results []explanation
+	if err := json.Unmarshal(stdout.Bytes(), &results); err != nil {
+		t.Fatalf("decode output: %v", err)
+	}
+	if len(results) != 1 || results[0].ExcludedBy != "registry.k8s.io" || results[0].Target != "" || results[0].PathMap != nil {
+		t.Fatalf("unexpected explanation %+v", results)
+	}
+}
+
+func TestRunMirrorAndVerifyCommands(t *testing.T) {
+	server := httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+	t.Cleanup(server.Close)
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatalf("random image: %v", err)
+	}
+	source := host + "/upstream/app:1.0"
+	ref, err := name.ParseReference(source)
+	if err != nil {
+		t.Fatalf("parse source: %v", err)
+	}
+	if err := remote.Write(ref, img); err != nil {
+		t.Fatalf("push source image: %v", err)
+	}
+	// Digest pull has no Pod digest to use, so the mirror command still pulls the tag.
+	path := writeCommandConfig(t, "targetKind: docker\ndocker:\n  registry: "+host+"\n  repoPrefix: copies\n  insecure: true\ndigestPull: true\n")
+	t.Setenv("DIGEST_PULL", "")
+
+	var stdout, stderr bytes.Buffer
+	if code := runVerifyCommand([]string{"--config", path, source}, &stdout, &stderr); code != exitFailed {
+		t.Fatalf("expected verify to fail before mirroring, got %d: %s", code, stderr.String())
+	}
+	if !strings.Contains(stdout.String(), "missing") {
+		t.Fatalf("expected missing target, got:\n%s", stdout.String())
+	}
+
+	stdout.Reset()
+	if code := runMirrorCommand([]string{"--config", path, "-o", "json", source}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("expected mirror to succeed, got %d: %s", code, stderr.String())
+	}
+	var mirrored []mirrorImageResult
+	if err := json.Unmarshal(stdout.Bytes(), &mirrored); err != nil {
+		t.Fatalf("decode mirror output: %v", err)
+	}
+	if len(mirrored) != 1 || mirrored[0].Target != host+"/copies/upstream/app:1.0" || mirrored[0].State != jobSucceeded {
+		t.Fatalf("unexpected mirror results %+v", mirrored)
+	}
+
+	stdout.Reset()
+	if code := runVerifyCommand([]string{source, "--config", path, "-o", "json"}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("expected verify to succeed after mirroring, got %d: %s", code, stderr.String())
+	}
+	var verified []verifyResult
+	if err := json.Unmarshal(stdout.Bytes(), &verified); err != nil {
+		t.Fatalf("decode verify output: %v", err)
+	}
+	digest, err := img.Digest()
+	if err != nil {
+		t.Fatalf("digest: %v", err)
+	}
+	if len(verified) != 1 || verified[0].Status != "match" || verified[0].TargetDigest != digest.String() {
+		t.Fatalf("unexpected verify results %+v", verified)
+	}
+}
@@ -2,15 +2,26 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/go-logr/logr"
+	"github.com/google/go-containerregistry/pkg/name"
+
+	"github.com/matzegebbe/k8s-copycat/internal/controllers"
+	"github.com/matzegebbe/k8s-copycat/internal/mirror"
 )
 
 type cooldownResetter interface {
-	ResetCooldown() (cleared int, cooldownEnabled bool)
+	ResetCooldowns(sel mirror.CooldownSelector) (cleared int, cooldownEnabled bool, err error)
 }
 
 type cooldownResetResponse struct {
@@ -42,6 +53,14 @@ func (h *cooldownHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Content-Type", "application/json")
 
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		if err := json.NewEncoder(w).Encode(cooldownResetResponse{Message: "method not allowed, use POST"}); err != nil {
+			h.log.Error(err, "encode cooldown reset response")
+		}
+		return
+	}
 	if resetter == nil {
 		resp := cooldownResetResponse{Message: "cooldown reset service not ready"}
 		if err := json.NewEncoder(w).Encode(resp); err != nil {
@@ -50,7 +69,17 @@ func (h *cooldownHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	cleared, enabled := resetter.ResetCooldown()
+	// Without target or registry every cooldown is cleared.
+	query := r.URL.Query()
+	sel := mirror.CooldownSelector{Target: query.Get("target"), Registry: query.Get("registry")}
+	cleared, enabled, err := resetter.ResetCooldowns(sel)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		if err := json.NewEncoder(w).Encode(cooldownResetResponse{Message: err.Error()}); err != nil {
+			h.log.Error(err, "encode cooldown reset response")
+		}
+		return
+	}
 
 	response := cooldownResetResponse{
 		Reset:          enabled && cleared > 0,
@@ -65,33 +94,139 @@ func (h *cooldownHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		response.Message = "failure cooldown reset"
 	}
 
-	h.log.Info("processed cooldown reset request", "method", r.Method, "clearedTargets", cleared, "cooldownEnabled", enabled)
+	h.log.Info("processed cooldown reset request", "method", r.Method, "target", sel.Target, "registry", sel.Registry, "clearedTargets", cleared, "cooldownEnabled", enabled)
 
 	if err := json.NewEncoder(w).Encode(response); err != nil {
 		h.log.Error(err, "encode cooldown reset response")
 	}
 }
 
+type cooldownLister interface {
+	Cooldowns() []mirror.CooldownEntry
+}
+
+type cooldownListResponse struct {
+	Items   []mirror.CooldownEntry `json:"items"`
+	Total   int                    `json:"total"`
+	Message string                 `json:"message,omitempty"`
+}
+
+// cooldownsHandler serves GET /cooldowns, which lists the targets in failure cooldown. The target
+// and registry parameters select entries the same way as a reset does.
+type cooldownsHandler struct {
+	log    logr.Logger
+	mu     sync.RWMutex
+	source cooldownLister
+}
+
+func newCooldownsHandler(log logr.Logger) *cooldownsHandler {
+	return &cooldownsHandler{log: log}
+}
+
+func (h *cooldownsHandler) SetSource(source cooldownLister) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.source = source
+}
+
+func (h *cooldownsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mu.RLock()
+	source := h.source
+	h.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		h.encode(w, cooldownListResponse{Message: "method not allowed"})
+		return
+	}
+	if source == nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		h.encode(w, cooldownListResponse{Message: "cooldown service not ready"})
+		return
+	}
+
+	query := r.URL.Query()
+	sel := mirror.CooldownSelector{Target: query.Get("target"), Registry: query.Get("registry")}
+	items, err := sel.Filter(source.Cooldowns())
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		h.encode(w, cooldownListResponse{Message: err.Error()})
+		return
+	}
+	if items == nil {
+		items = []mirror.CooldownEntry{}
+	}
+	h.encode(w, cooldownListResponse{Items: items, Total: len(items)})
+}
+
+func (h *cooldownsHandler) encode(w http.ResponseWriter, v any) {
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		h.log.Error(err, "encode cooldowns response")
+	}
+}
+
+// States of force reconcile and mirror jobs.
+const (
+	jobRunning   = "running"
+	jobSucceeded = "succeeded"
+	jobFailed    = "failed"
+	jobCancelled = "cancelled"
+)
+
+// maxFinishedForceJobs bounds how many finished force reconcile jobs can still be polled.
+const maxFinishedForceJobs = 20
+
 type forceReconcilable interface {
-	ForceReconcile(ctx context.Context) (workloads int, images int, err error)
+	ValidateScope(scope controllers.ForceReconcileScope) error
+	ReconcileScope(ctx context.Context, scope controllers.ForceReconcileScope, progress controllers.ForceReconcileProgress) (workloads int, images int, err error)
+}
+
+type forceReconcileJob struct {
+	ID         string                          `json:"id"`
+	State      string                          `json:"state"`
+	Scope      controllers.ForceReconcileScope `json:"scope"`
+	StartedAt  time.Time                       `json:"startedAt"`
+	FinishedAt time.Time                       `json:"finishedAt,omitzero"`
+	Workloads  int                             `json:"workloadsProcessed"`
+	Images     int                             `json:"imagesMirrored"`
+	Error      string                          `json:"error,omitempty"`
+
+	cancel context.CancelFunc
+	done   chan struct{}
 }
 
 type forceReconcileResponse struct {
-	Triggered bool   `json:"triggered"`
-	Success   bool   `json:"success"`
-	Workloads int    `json:"workloadsProcessed"`
-	Images    int    `json:"imagesMirrored"`
-	Message   string `json:"message"`
+	Triggered bool               `json:"triggered"`
+	Success   bool               `json:"success"`
+	Workloads int                `json:"workloadsProcessed"`
+	Images    int                `json:"imagesMirrored"`
+	Message   string             `json:"message"`
+	Job       *forceReconcileJob `json:"job,omitempty"`
 }
 
+type forceReconcileListResponse struct {
+	Jobs []forceReconcileJob `json:"jobs"`
+}
+
+// forceReconcileHandler runs force reconciles as background jobs. POST /force-reconcile starts a
+// job, optionally scoped by namespace, resource, image and failed, and returns its ID; with
+// wait=true it responds once the job has finished. GET /force-reconcile lists the jobs,
+// GET /force-reconcile/{id} reports the progress of one and DELETE /force-reconcile/{id} cancels
+// it. Only one job runs at a time.
 type forceReconcileHandler struct {
 	log        logr.Logger
 	mu         sync.RWMutex
 	reconciler forceReconcilable
+	jobs       map[string]*forceReconcileJob
+	order      []string
+	running    *forceReconcileJob
 }
 
 func newForceReconcileHandler(log logr.Logger) *forceReconcileHandler {
-	return &forceReconcileHandler{log: log}
+	return &forceReconcileHandler{log: log, jobs: make(map[string]*forceReconcileJob)}
 }
 
 func (h *forceReconcileHandler) SetReconciler(reconciler forceReconcilable) {
@@ -101,39 +236,880 @@ func (h *forceReconcileHandler) SetReconciler(reconciler forceReconcilable) {
 }
 
 func (h *forceReconcileHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/force-reconcile"), "/")
+	switch {
+	case id == "" && r.Method == http.MethodPost:
+		h.submit(w, r)
+	case id == "" && (r.Method == http.MethodGet || r.Method == http.MethodHead):
+		h.encode(w, h.list())
+	case id != "" && (r.Method == http.MethodGet || r.Method == http.MethodHead):
+		job, ok := h.job(id)
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			h.encode(w, forceReconcileResponse{Message: "unknown force reconcile job"})
+			return
+		}
+		h.encode(w, jobResponse(job))
+	case id != "" && r.Method == http.MethodDelete:
+		h.cancel(w, id)
+	default:
+		if id == "" {
+			w.Header().Set("Allow", "GET, HEAD, POST")
+		} else {
+			w.Header().Set("Allow", "GET, HEAD, DELETE")
+		}
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		h.encode(w, forceReconcileResponse{Message: "method not allowed"})
+	}
+}
+
+func (h *forceReconcileHandler) submit(w http.ResponseWriter, r *http.Request) {
 	h.mu.RLock()
 	reconciler := h.reconciler
 	h.mu.RUnlock()
+	if reconciler == nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		h.encode(w, forceReconcileResponse{Message: "force reconcile service not ready"})
+		return
+	}
+
+	query := r.URL.Query()
+	scope := controllers.ForceReconcileScope{
+		Namespaces: splitQueryValues(query["namespace"]),
+		Resources:  splitQueryValues(query["resource"]),
+		Image:      strings.TrimSpace(query.Get("image")),
+	}
+	var err error
+	if raw := strings.TrimSpace(query.Get("failed")); raw != "" {
+		if scope.FailedOnly, err = strconv.ParseBool(raw); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			h.encode(w, forceReconcileResponse{Message: "failed must be true or false"})
+			return
+		}
+	}
+	wait := false
+	if raw := strings.TrimSpace(query.Get("wait")); raw != "" {
+		if wait, err = strconv.ParseBool(raw); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			h.encode(w, forceReconcileResponse{Message: "wait must be true or false"})
+			return
+		}
+	}
+	if err := reconciler.ValidateScope(scope); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		h.encode(w, forceReconcileResponse{Message: "invalid scope: " + err.Error()})
+		return
+	}
+
+	job, started := h.start(reconciler, scope)
+	if !started {
+		w.WriteHeader(http.StatusConflict)
+		resp := jobResponse(job)
+		resp.Message = "force reconcile already running"
+		h.encode(w, resp)
+		return
+	}
+	w.Header().Set("Location", "/force-reconcile/"+job.ID)
+	if !wait {
+		w.WriteHeader(http.StatusAccepted)
+		h.encode(w, jobResponse(job))
+		return
+	}
+	select {
+	case <-job.done:
+	case <-r.Context().Done():
+		return
+	}
+	finished, _ := h.job(job.ID)
+	h.encode(w, jobResponse(finished))
+}
+
+// start runs a job for scope unless one is running already, which is returned instead.
+func (h *forceReconcileHandler) start(reconciler forceReconcilable, scope controllers.ForceReconcileScope) (forceReconcileJob, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.running != nil {
+		return *h.running, false
+	}
+	// The job outlives the request that started it.
+	ctx, cancel := context.WithCancel(context.Background())
+	job := &forceReconcileJob{
+		ID:        newJobID(),
+		State:     jobRunning,
+		Scope:     scope,
+		StartedAt: time.Now(),
+		cancel:    cancel,
+		done:      make(chan struct{}),
+	}
+	h.jobs[job.ID] = job
+	h.order = append(h.order, job.ID)
+	h.running = job
+	h.log.Info("started force reconcile job", "job", job.ID, "scope", scope)
 
+	go func() {
+		defer cancel()
+		workloads, images, err := reconciler.ReconcileScope(logr.NewContext(ctx, h.log.WithValues("job", job.ID)), scope, func(workloads, images int) {
+			h.mu.Lock()
+			job.Workloads, job.Images = workloads, images
+			h.mu.Unlock()
+		})
+		h.finish(job, workloads, images, err)
+	}()
+	return *job, true
+}
+
+func (h *forceReconcileHandler) finish(job *forceReconcileJob, workloads, images int, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	job.Workloads, job.Images = workloads, images
+	job.FinishedAt = time.Now()
+	switch {
+	case err == nil:
+		job.State = jobSucceeded
+		h.log.Info("finished force reconcile job", "job", job.ID, "workloadsProcessed", workloads, "imagesMirrored", images)
+	case errors.Is(err, context.Canceled):
+		job.State = jobCancelled
+		h.log.Info("cancelled force reconcile job", "job", job.ID, "workloadsProcessed", workloads, "imagesMirrored", images)
+	default:
+		job.State = jobFailed
+		job.Error = err.Error()
+		h.log.Error(err, "force reconcile job failed", "job", job.ID, "workloadsProcessed", workloads, "imagesMirrored", images)
+	}
+	h.running = nil
+	close(job.done)
+
+	for len(h.order) > maxFinishedForceJobs {
+		delete(h.jobs, h.order[0])
+		h.order = h.order[1:]
+	}
+}
+
+func (h *forceReconcileHandler) cancel(w http.ResponseWriter, id string) {
+	h.mu.Lock()
+	job, ok := h.jobs[id]
+	var snapshot forceReconcileJob
+	if ok {
+		snapshot = *job
+		if job.State == jobRunning {
+			job.cancel()
+		}
+	}
+	h.mu.Unlock()
+
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		h.encode(w, forceReconcileResponse{Message: "unknown force reconcile job"})
+		return
+	}
+	resp := jobResponse(snapshot)
+	if snapshot.State != jobRunning {
+		w.WriteHeader(http.StatusConflict)
+		resp.Message = "force reconcile job already finished"
+		h.encode(w, resp)
+		return
+	}
+	h.log.Info("cancelling force reconcile job", "job", id)
+	w.WriteHeader(http.StatusAccepted)
+	resp.Message = "force reconcile cancellation requested"
+	h.encode(w, resp)
+}
+
+func (h *forceReconcileHandler) job(id string) (forceReconcileJob, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	job, ok := h.jobs[id]
+	if !ok {
+		return forceReconcileJob{}, false
+	}
+	return *job, true
+}
+
+// list returns the jobs, most recent first.
+func (h *forceReconcileHandler) list() forceReconcileListResponse {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	resp := forceReconcileListResponse{Jobs: make([]forceReconcileJob, 0, len(h.order))}
+	for i := len(h.order) - 1; i >= 0; i-- {
+		resp.Jobs = append(resp.Jobs, *h.jobs[h.order[i]])
+	}
+	return resp
+}
+
+func (h *forceReconcileHandler) encode(w http.ResponseWriter, v any) {
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		h.log.Error(err, "encode force reconcile response")
+	}
+}
+
+func jobResponse(job forceReconcileJob) forceReconcileResponse {
+	resp := forceReconcileResponse{
+		Triggered: true,
+		Success:   job.State == jobSucceeded,
+		Workloads: job.Workloads,
+		Images:    job.Images,
+		Job:       &job,
+	}
+	switch job.State {
+	case jobRunning:
+		resp.Message = "force reconcile running"
+	case jobSucceeded:
+		resp.Message = "force reconcile completed"
+	case jobCancelled:
+		resp.Message = "force reconcile cancelled"
+	default:
+		resp.Message = "force reconcile failed: " + job.Error
+	}
+	return resp
+}
+
+func newJobID() string {
+	var b [8]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// splitQueryValues splits repeated and comma-separated query values.
+func splitQueryValues(values []string) []string {
+	var out []string
+	for _, value := range values {
+		for _, part := range strings.Split(value, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				out = append(out, part)
+			}
+		}
+	}
+	return out
+}
+
+// Limits of POST /mirror.
+const (
+	maxMirrorRequestImages = 100
+	maxMirrorRequestBytes  = 1 << 20
+	maxFinishedMirrorJobs  = 100
+)
+
+// errPendingDigest reports an image that digest pull skipped because no Pod reported its digest.
+const errPendingDigest = "digest pull needs a digest reference; the image was not mirrored"
+
+type imageMirrorer interface {
+	Mirror(ctx context.Context, sourceImage string, meta mirror.Metadata) error
+}
+
+type mirrorRequest struct {
+	Images     []string `json:"images"`
+	Namespace  string   `json:"namespace,omitempty"`
+	Platforms  []string `json:"platforms,omitempty"`
+	DigestPull *bool    `json:"digestPull,omitempty"`
+	Async      bool     `json:"async,omitempty"`
+}
+
+// mirrorImageResult is the outcome of one image of a mirror request. Target, TargetDigest and
+// Status come from the image inventory.
+type mirrorImageResult struct {
+	Image        string `json:"image"`
+	State        string `json:"state"`
+	Target       string `json:"target,omitempty"`
+	TargetDigest string `json:"targetDigest,omitempty"`
+	Status       string `json:"status,omitempty"`
+	Error        string `json:"error,omitempty"`
+}
+
+type mirrorResponse struct {
+	ID         string              `json:"id,omitempty"`
+	State      string              `json:"state,omitempty"`
+	Success    bool                `json:"success"`
+	Message    string              `json:"message"`
+	StartedAt  time.Time           `json:"startedAt,omitzero"`
+	FinishedAt time.Time           `json:"finishedAt,omitzero"`
+	Results    []mirrorImageResult `json:"results,omitempty"`
+}
+
+type mirrorJob struct {
+	mirrorResponse
+	done chan struct{}
+}
+
+// mirrorHandler serves POST /mirror, which mirrors the listed image references through the
+// pusher like images found in workloads. The request waits for every image unless async is
+// set; GET /mirror/{id} reports the results of a request.
+type mirrorHandler struct {
+	log      logr.Logger
+	mu       sync.RWMutex
+	ctx      context.Context
+	mirrorer imageMirrorer
+	jobs     map[string]*mirrorJob
+	order    []string
+}
+
+func newMirrorHandler(log logr.Logger) *mirrorHandler {
+	return &mirrorHandler{log: log, jobs: make(map[string]*mirrorJob)}
+}
+
+// SetMirrorer makes the handler mirror through mirrorer until ctx is cancelled, which also cancels
+// the mirrors of running requests. A nil mirrorer makes the handler unavailable.
+func (h *mirrorHandler) SetMirrorer(ctx context.Context, mirrorer imageMirrorer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.ctx = ctx
+	h.mirrorer = mirrorer
+}
+
+func (h *mirrorHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	if reconciler == nil {
-		resp := forceReconcileResponse{Message: "force reconcile service not ready"}
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/mirror"), "/")
+	switch {
+	case id == "" && r.Method == http.MethodPost:
+		h.submit(w, r)
+	case id != "" && (r.Method == http.MethodGet || r.Method == http.MethodHead):
+		h.mu.RLock()
+		job, ok := h.jobs[id]
+		var resp mirrorResponse
+		if ok {
+			resp = job.snapshot()
+		}
+		h.mu.RUnlock()
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			h.encode(w, mirrorResponse{Message: "unknown mirror request"})
+			return
+		}
+		h.encode(w, resp)
+	default:
+		if id == "" {
+			w.Header().Set("Allow", "POST")
+		} else {
+			w.Header().Set("Allow", "GET, HEAD")
+		}
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		h.encode(w, mirrorResponse{Message: "method not allowed"})
+	}
+}
+
+func (h *mirrorHandler) submit(w http.ResponseWriter, r *http.Request) {
+	h.mu.RLock()
+	ctx, mirrorer := h.ctx, h.mirrorer
+	h.mu.RUnlock()
+	if mirrorer == nil || ctx.Err() != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		h.encode(w, mirrorResponse{Message: "mirror service not ready"})
+		return
+	}
+
+	var req mirrorRequest
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxMirrorRequestBytes))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		h.encode(w, mirrorResponse{Message: "invalid request: " + err.Error()})
+		return
+	}
+	images := make([]string, 0, len(req.Images))
+	seen := make(map[string]struct{}, len(req.Images))
+	for _, image := range req.Images {
+		image = strings.TrimSpace(image)
+		if _, dup := seen[image]; dup || image == "" {
+			continue
+		}
+		seen[image] = struct{}{}
+		images = append(images, image)
+	}
+	if msg := validateMirrorRequest(images, req.Platforms); msg != "" {
+		w.WriteHeader(http.StatusBadRequest)
+		h.encode(w, mirrorResponse{Message: msg})
+		return
+	}
+
+	meta := mirror.Metadata{Namespace: strings.TrimSpace(req.Namespace), Platforms: req.Platforms, DigestPull: req.DigestPull}
+	if meta.DigestPull == nil {
+		// Requested images are not tied to a Pod, so there is no digest to pin to unless the
+		// reference carries one.
+		digestPull := false
+		meta.DigestPull = &digestPull
+	}
+	job := h.start(ctx, mirrorer, images, meta)
+	w.Header().Set("Location", "/mirror/"+job.ID)
+	if req.Async {
+		h.mu.RLock()
+		resp := job.snapshot()
+		h.mu.RUnlock()
+		w.WriteHeader(http.StatusAccepted)
+		h.encode(w, resp)
+		return
+	}
+	select {
+	case <-job.done:
+	case <-r.Context().Done():
+		return
+	}
+	h.mu.RLock()
+	resp := job.snapshot()
+	h.mu.RUnlock()
+	if !resp.Success {
+		w.WriteHeader(http.StatusBadGateway)
+	}
+	h.encode(w, resp)
+}
+
+func validateMirrorRequest(images, platforms []string) string {
+	if len(images) == 0 {
+		return "at least one image is required"
+	}
+	if len(images) > maxMirrorRequestImages {
+		return "at most " + strconv.Itoa(maxMirrorRequestImages) + " images can be mirrored per request"
+	}
+	for _, image := range images {
+		if _, err := name.ParseReference(image, name.WeakValidation); err != nil {
+			return "invalid image " + strconv.Quote(image) + ": " + err.Error()
+		}
+	}
+	if err := mirror.ValidatePlatforms(platforms); err != nil {
+		return "invalid platforms: " + err.Error()
+	}
+	return ""
+}
+
+// start mirrors images concurrently; the mirror queue bounds how many are pulled at once. The
+// mirrors outlive a request that stops waiting for them, but not ctx.
+func (h *mirrorHandler) start(ctx context.Context, mirrorer imageMirrorer, images []string, meta mirror.Metadata) *mirrorJob {
+	job := &mirrorJob{
+		mirrorResponse: mirrorResponse{
+			ID:        newJobID(),
+			State:     jobRunning,
+			StartedAt: time.Now(),
+			Results:   make([]mirrorImageResult, len(images)),
+		},
+		done: make(chan struct{}),
+	}
+	for i, image := range images {
+		job.Results[i] = mirrorImageResult{Image: image, State: jobRunning}
+	}
+
+	h.mu.Lock()
+	h.jobs[job.ID] = job
+	h.order = append(h.order, job.ID)
+	if excess := len(h.order) - maxFinishedMirrorJobs; excess > 0 {
+		// Drop the oldest finished requests; running ones are kept until they finish.
+		kept := h.order[:0]
+		for _, id := range h.order {
+			if excess > 0 && h.jobs[id].State != jobRunning {
+				delete(h.jobs, id)
+				excess--
+				continue
+			}
+			kept = append(kept, id)
+		}
+		h.order = kept
+	}
+	h.mu.Unlock()
+	h.log.Info("started mirror request", "request", job.ID, "images", images, "namespace", meta.Namespace, "platforms", meta.Platforms)
+
+	inventory, _ := mirrorer.(mirror.ImageInventory)
+	ctx = logr.NewContext(ctx, h.log.WithValues("request", job.ID))
+	var wg sync.WaitGroup
+	for i, image := range images {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := mirrorer.Mirror(ctx, image, meta)
+			result := mirrorImageResult{Image: image, State: jobSucceeded}
+			if err != nil {
+				result.State = jobFailed
+				result.Error = err.Error()
+			}
+			if inventory != nil {
+				if record, ok := inventory.ImageFor(image, meta); ok {
+					result.Target, result.TargetDigest, result.Status = record.Target, record.TargetDigest, record.Status
+				}
+			}
+			if err == nil && result.Status == mirror.ImagePendingDigest {
+				result.State = jobFailed
+				result.Error = errPendingDigest
+			}
+			h.mu.Lock()
+			job.Results[i] = result
+			h.mu.Unlock()
+		}()
+	}
+	go func() {
+		wg.Wait()
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		failed := 0
+		for _, result := range job.Results {
+			if result.State == jobFailed {
+				failed++
+			}
+		}
+		job.FinishedAt = time.Now()
+		job.State = jobSucceeded
+		job.Success = failed == 0
+		if failed > 0 {
+			job.State = jobFailed
+		}
+		h.log.Info("finished mirror request", "request", job.ID, "images", len(images), "failed", failed)
+		close(job.done)
+	}()
+	return job
+}
+
+// snapshot copies the job; callers must hold the handler lock.
+func (j *mirrorJob) snapshot() mirrorResponse {
+	resp := j.mirrorResponse
+	resp.Results = append([]mirrorImageResult(nil), j.Results...)
+	switch resp.State {
+	case jobRunning:
+		resp.Message = "mirror running"
+	case jobSucceeded:
+		resp.Message = "images mirrored"
+	default:
+		resp.Message = "some images could not be mirrored"
+	}
+	return resp
+}
+
+func (h *mirrorHandler) encode(w http.ResponseWriter, v any) {
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		h.log.Error(err, "encode mirror response")
+	}
+}
+
+type gcReportSource interface {
+	LastReport() (mirror.GCReport, bool)
+}
+
+type gcReportResponse struct {
+	Available bool             `json:"available"`
+	Message   string           `json:"message"`
+	Report    *mirror.GCReport `json:"report,omitempty"`
+}
+
+type gcReportHandler struct {
+	log    logr.Logger
+	mu     sync.RWMutex
+	source gcReportSource
+}
+
+func newGCReportHandler(log logr.Logger) *gcReportHandler {
+	return &gcReportHandler{log: log}
+}
+
+func (h *gcReportHandler) SetSource(source gcReportSource) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.source = source
+}
+
+func (h *gcReportHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mu.RLock()
+	source := h.source
+	h.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		if err := json.NewEncoder(w).Encode(gcReportResponse{Message: "method not allowed"}); err != nil {
+			h.log.Error(err, "encode gc report response")
+		}
+		return
+	}
+
+	if source == nil {
+		resp := gcReportResponse{Message: "garbage collection disabled"}
 		if err := json.NewEncoder(w).Encode(resp); err != nil {
-			h.log.Error(err, "encode force reconcile response")
+			h.log.Error(err, "encode gc report response")
 		}
 		return
 	}
 
-	workloads, images, err := reconciler.ForceReconcile(r.Context())
+	response := gcReportResponse{Message: "no garbage collection pass has run yet"}
+	if report, ok := source.LastReport(); ok {
+		response.Available = true
+		response.Report = &report
+		if report.DryRun {
+			response.Message = "dry run: listed images would be removed"
+		} else {
+			response.Message = "listed images were removed"
+		}
+	}
 
-	response := forceReconcileResponse{
-		Triggered: true,
-		Workloads: workloads,
-		Images:    images,
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		h.log.Error(err, "encode gc report response")
 	}
+}
 
-	if err != nil {
-		response.Success = false
-		response.Message = "force reconcile failed: " + err.Error()
-		h.log.Error(err, "processed force reconcile request", "method", r.Method, "workloadsProcessed", workloads, "imagesMirrored", images)
-	} else {
-		response.Success = true
-		response.Message = "force reconcile completed"
-		h.log.Info("processed force reconcile request", "method", r.Method, "workloadsProcessed", workloads, "imagesMirrored", images)
+type driftAuditor interface {
+	Trigger() (<-chan struct{}, bool)
+	Running() bool
+	LastReport() (mirror.DriftReport, bool)
+}
+
+type auditResponse struct {
+	Available bool                `json:"available"`
+	Running   bool                `json:"running"`
+	Message   string              `json:"message"`
+	Report    *mirror.DriftReport `json:"report,omitempty"`
+}
+
+// auditHandler serves GET /audit, which returns the report of the last drift audit, and
+// POST /audit, which starts an audit in the background; with wait=true it responds with the
+// report once the audit has finished.
+type auditHandler struct {
+	log     logr.Logger
+	mu      sync.RWMutex
+	auditor driftAuditor
+}
+
+func newAuditHandler(log logr.Logger) *auditHandler {
+	return &auditHandler{log: log}
+}
+
+func (h *auditHandler) SetAuditor(auditor driftAuditor) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.auditor = auditor
+}
+
+func (h *auditHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mu.RLock()
+	auditor := h.auditor
+	h.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead && r.Method != http.MethodPost {
+		w.Header().Set("Allow", "GET, HEAD, POST")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		h.encode(w, auditResponse{Message: "method not allowed"})
+		return
+	}
+	if auditor == nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		h.encode(w, auditResponse{Message: "drift audit service not ready"})
+		return
+	}
+	if r.Method != http.MethodPost {
+		h.encode(w, lastAudit(auditor))
+		return
+	}
+
+	wait := false
+	if raw := strings.TrimSpace(r.URL.Query().Get("wait")); raw != "" {
+		var err error
+		if wait, err = strconv.ParseBool(raw); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			h.encode(w, auditResponse{Message: "wait must be true or false"})
+			return
+		}
+	}
+	done, started := auditor.Trigger()
+	if started {
+		h.log.Info("started drift audit")
+	}
+	if !wait {
+		resp := lastAudit(auditor)
+		resp.Running = true
+		if started {
+			resp.Message = "drift audit started"
+			w.WriteHeader(http.StatusAccepted)
+		} else {
+			resp.Message = "drift audit already running"
+			w.WriteHeader(http.StatusConflict)
+		}
+		h.encode(w, resp)
+		return
+	}
+	select {
+	case <-done:
+	case <-r.Context().Done():
+		return
+	}
+	h.encode(w, lastAudit(auditor))
+}
+
+func lastAudit(auditor driftAuditor) auditResponse {
+	resp := auditResponse{Running: auditor.Running(), Message: "no drift audit has run yet"}
+	if report, ok := auditor.LastReport(); ok {
+		resp.Available = true
+		resp.Report = &report
+		resp.Message = "drift audit finished"
+		for status, n := range report.Summary {
+			if status != mirror.DriftInSync && n > 0 {
+				resp.Message = "drift audit found images out of sync with their mirror"
+				break
+			}
+		}
 	}
+	return resp
+}
+
+func (h *auditHandler) encode(w http.ResponseWriter, v any) {
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		h.log.Error(err, "encode audit response")
+	}
+}
+
+// Pagination limits of GET /images.
+const (
+	defaultImagePageSize = 100
+	maxImagePageSize     = 1000
+)
+
+type imageListResponse struct {
+	Items    []mirror.ImageRecord `json:"items"`
+	Total    int                  `json:"total"`
+	Continue string               `json:"continue,omitempty"`
+	Message  string               `json:"message,omitempty"`
+}
+
+type imageResponse struct {
+	Found   bool                 `json:"found"`
+	Message string               `json:"message,omitempty"`
+	Images  []mirror.ImageRecord `json:"images,omitempty"`
+}
+
+// imagesHandler serves GET /images, which lists the known images page by page, and
+// GET /images/{ref} for the targets of a single source reference.
+type imagesHandler struct {
+	log    logr.Logger
+	mu     sync.RWMutex
+	source mirror.ImageInventory
+}
+
+func newImagesHandler(log logr.Logger) *imagesHandler {
+	return &imagesHandler{log: log}
+}
 
-	if encodeErr := json.NewEncoder(w).Encode(response); encodeErr != nil {
-		h.log.Error(encodeErr, "encode force reconcile response")
+func (h *imagesHandler) SetSource(source mirror.ImageInventory) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.source = source
+}
+
+func (h *imagesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mu.RLock()
+	source := h.source
+	h.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		h.encode(w, imageListResponse{Message: "method not allowed"})
+		return
+	}
+	if source == nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		h.encode(w, imageListResponse{Message: "image inventory not ready"})
+		return
+	}
+
+	if ref := strings.Trim(strings.TrimPrefix(r.URL.Path, "/images"), "/"); ref != "" {
+		records := source.Image(ref)
+		if len(records) == 0 {
+			w.WriteHeader(http.StatusNotFound)
+			h.encode(w, imageResponse{Message: "image has not been requested by any workload since startup"})
+			return
+		}
+		h.encode(w, imageResponse{Found: true, Images: records})
+		return
+	}
+
+	query := r.URL.Query()
+	limit := defaultImagePageSize
+	if raw := strings.TrimSpace(query.Get("limit")); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed <= 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			h.encode(w, imageListResponse{Message: "limit must be a positive number"})
+			return
+		}
+		limit = min(parsed, maxImagePageSize)
+	}
+	filter := newImageFilter(query)
+	after := query.Get("continue")
+
+	response := imageListResponse{Items: []mirror.ImageRecord{}}
+	for _, record := range source.Images() {
+		if !filter.matches(record) {
+			continue
+		}
+		response.Total++
+		// Records are sorted by source and target, so the last record of a page continues the
+		// listing even when images were added in the meantime.
+		if after != "" && imagePageKey(record) <= after {
+			continue
+		}
+		if len(response.Items) == limit {
+			response.Continue = imagePageKey(response.Items[len(response.Items)-1])
+			continue
+		}
+		response.Items = append(response.Items, record)
+	}
+	h.encode(w, response)
+}
+
+// imagePageKey orders records like the inventory sorts them: a space sorts before every character
+// of a reference.
+func imagePageKey(record mirror.ImageRecord) string {
+	return record.Source + " " + record.Target
+}
+
+func (h *imagesHandler) encode(w http.ResponseWriter, v any) {
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		h.log.Error(err, "encode images response")
+	}
+}
+
+// imageFilter selects images by status, by the namespace or name of a referencing workload and
+// by a substring of the source or target reference. Empty fields match everything.
+type imageFilter struct {
+	statuses  map[string]struct{}
+	namespace string
+	workload  string
+	search    string
+}
+
+func newImageFilter(query url.Values) imageFilter {
+	f := imageFilter{
+		namespace: strings.TrimSpace(query.Get("namespace")),
+		workload:  strings.TrimSpace(query.Get("workload")),
+		search:    strings.ToLower(strings.TrimSpace(query.Get("search"))),
+	}
+	for _, value := range query["status"] {
+		for _, status := range strings.Split(value, ",") {
+			if status = strings.ToLower(strings.TrimSpace(status)); status != "" {
+				if f.statuses == nil {
+					f.statuses = make(map[string]struct{})
+				}
+				f.statuses[status] = struct{}{}
+			}
+		}
+	}
+	return f
+}
+
+func (f imageFilter) matches(record mirror.ImageRecord) bool {
+	if f.statuses != nil {
+		if _, ok := f.statuses[record.Status]; !ok {
+			return false
+		}
+	}
+	if f.search != "" && !strings.Contains(strings.ToLower(record.Source), f.search) && !strings.Contains(strings.ToLower(record.Target), f.search) {
+		return false
+	}
+	if f.namespace == "" && f.workload == "" {
+		return true
+	}
+	for _, w := range record.Workloads {
+		if (f.namespace == "" || w.Namespace == f.namespace) && (f.workload == "" || w.Name == f.workload) {
+			return true
+		}
 	}
+	return false
 }
@@ -4,30 +4,76 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"io"
+	"log"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/go-logr/logr/testr"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+
+	"github.com/matzegebbe/k8s-copycat/internal/controllers"
+	"github.com/matzegebbe/k8s-copycat/internal/mirror"
 )
 
 type fakeResetter struct {
 	cleared int
 	enabled bool
+	sel     *mirror.CooldownSelector
+}
+
+func (f fakeResetter) ResetCooldowns(sel mirror.CooldownSelector) (int, bool, error) {
+	if f.sel != nil {
+		*f.sel = sel
+	}
+	if _, err := sel.Filter(nil); err != nil {
+		return 0, f.enabled, err
+	}
+	return f.cleared, f.enabled, nil
 }
 
-func (f fakeResetter) ResetCooldown() (int, bool) {
-	return f.cleared, f.enabled
+type fakeCooldowns []mirror.CooldownEntry
+
+func (f fakeCooldowns) Cooldowns() []mirror.CooldownEntry {
+	return f
 }
 
 type fakeForceReconciler struct {
 	workloads int
 	images    int
 	err       error
+	invalid   error
+	// block, if set, keeps the reconcile running until it is closed or the job is cancelled.
+	block chan struct{}
+	scope *controllers.ForceReconcileScope
+}
+
+func (f fakeForceReconciler) ValidateScope(controllers.ForceReconcileScope) error {
+	return f.invalid
 }
 
-func (f fakeForceReconciler) ForceReconcile(context.Context) (int, int, error) {
+func (f fakeForceReconciler) ReconcileScope(ctx context.Context, scope controllers.ForceReconcileScope, progress controllers.ForceReconcileProgress) (int, int, error) {
+	if f.scope != nil {
+		*f.scope = scope
+	}
+	progress(1, 1)
+	if f.block != nil {
+		select {
+		case <-f.block:
+		case <-ctx.Done():
+			return 1, 1, ctx.Err()
+		}
+	}
 	return f.workloads, f.images, f.err
 }
 
@@ -56,11 +102,69 @@ func TestCooldownResetHandler(t *testing.T) {
 	}
 }
 
+func TestCooldownResetHandlerSelectsTargets(t *testing.T) {
+	var sel mirror.CooldownSelector
+	handler := newCooldownHandler(testr.New(t))
+	handler.SetResetter(fakeResetter{cleared: 1, enabled: true, sel: &sel})
+
+	req := httptest.NewRequest(http.MethodPost, "/reset-cooldown?registry=ghcr.io&target=*/app:*", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d", rec.Code)
+	}
+	if sel.Registry != "ghcr.io" || sel.Target != "*/app:*" {
+		t.Fatalf("unexpected selector: %+v", sel)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/reset-cooldown?target=/[/", nil)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected invalid pattern to be rejected, got %d", rec.Code)
+	}
+}
+
+func TestCooldownsHandler(t *testing.T) {
+	handler := newCooldownsHandler(testr.New(t))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/cooldowns", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 before the pusher is ready, got %d", rec.Code)
+	}
+
+	handler.SetSource(fakeCooldowns{
+		{Target: "registry.example.com/ghcr/app:1", SourceRegistry: "ghcr.io", LastError: "unauthorized"},
+		{Target: "registry.example.com/library/nginx:1.25", SourceRegistry: "docker.io"},
+	})
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/cooldowns?registry=ghcr.io", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d", rec.Code)
+	}
+	var resp cooldownListResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if resp.Total != 1 || resp.Items[0].LastError != "unauthorized" {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/cooldowns", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected POST to be rejected, got %d", rec.Code)
+	}
+}
+
 func TestForceReconcileHandler(t *testing.T) {
 	handler := newForceReconcileHandler(testr.New(t))
 	handler.SetReconciler(fakeForceReconciler{workloads: 5, images: 12})
 
-	req := httptest.NewRequest(http.MethodPost, "/force-reconcile", nil)
+	req := httptest.NewRequest(http.MethodPost, "/force-reconcile?wait=true", nil)
 	rec := httptest.NewRecorder()
 
 	handler.ServeHTTP(rec, req)
@@ -85,7 +189,7 @@ func TestForceReconcileHandlerFailure(t *testing.T) {
 	handler := newForceReconcileHandler(testr.New(t))
 	handler.SetReconciler(fakeForceReconciler{workloads: 1, images: 0, err: errors.New("boom")})
 
-	req := httptest.NewRequest(http.MethodGet, "/force-reconcile", nil)
+	req := httptest.NewRequest(http.MethodPost, "/force-reconcile?wait=true", nil)
 	rec := httptest.NewRecorder()
 
 	handler.ServeHTTP(rec, req)
@@ -102,7 +206,7 @@ func TestForceReconcileHandlerFailure(t *testing.T) {
 func TestForceReconcileHandlerNotReady(t *testing.T) {
 	handler := newForceReconcileHandler(testr.New(t))
 
-	req := httptest.NewRequest(http.MethodGet, "/force-reconcile", nil)
+	req := httptest.NewRequest(http.MethodPost, "/force-reconcile", nil)
 	rec := httptest.NewRecorder()
 
 	handler.ServeHTTP(rec, req)
@@ -116,11 +220,331 @@ func TestForceReconcileHandlerNotReady(t *testing.T) {
 	}
 }
 
+func serveForceReconcile(t *testing.T, handler http.Handler, method, target string) (int, forceReconcileResponse) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(method, target, nil))
+	var resp forceReconcileResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	return rec.Code, resp
+}
+
+func TestForceReconcileHandlerRunsScopedJobs(t *testing.T) {
+	var scope controllers.ForceReconcileScope
+	block := make(chan struct{})
+	handler := newForceReconcileHandler(testr.New(t))
+	handler.SetReconciler(fakeForceReconciler{workloads: 4, images: 7, block: block, scope: &scope})
+
+	code, resp := serveForceReconcile(t, handler, http.MethodPost, "/force-reconcile?namespace=apps,team-*&resource=deployments&image=nginx:*&failed=true")
+	if code != http.StatusAccepted || resp.Job == nil || resp.Job.State != jobRunning {
+		t.Fatalf("expected running job, got %d %+v", code, resp)
+	}
+	id := resp.Job.ID
+	want := controllers.ForceReconcileScope{Namespaces: []string{"apps", "team-*"}, Resources: []string{"deployments"}, Image: "nginx:*", FailedOnly: true}
+	if !reflect.DeepEqual(resp.Job.Scope, want) {
+		t.Fatalf("unexpected scope: %+v", resp.Job.Scope)
+	}
+
+	code, resp = serveForceReconcile(t, handler, http.MethodPost, "/force-reconcile")
+	if code != http.StatusConflict || resp.Job == nil || resp.Job.ID != id {
+		t.Fatalf("expected second job to be rejected while %s runs, got %d %+v", id, code, resp)
+	}
+
+	close(block)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		code, resp = serveForceReconcile(t, handler, http.MethodGet, "/force-reconcile/"+id)
+		if code != http.StatusOK {
+			t.Fatalf("unexpected status polling job: %d", code)
+		}
+		if resp.Job.State != jobRunning || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !resp.Success || resp.Job.State != jobSucceeded || resp.Workloads != 4 || resp.Images != 7 || resp.Job.FinishedAt.IsZero() {
+		t.Fatalf("expected finished job, got %+v", resp)
+	}
+	if !reflect.DeepEqual(scope, want) {
+		t.Fatalf("expected scope to reach the reconciler, got %+v", scope)
+	}
+
+	if code, _ := serveForceReconcile(t, handler, http.MethodGet, "/force-reconcile/unknown"); code != http.StatusNotFound {
+		t.Fatalf("expected unknown job to be reported, got %d", code)
+	}
+}
+
+func TestForceReconcileHandlerCancelsJobs(t *testing.T) {
+	handler := newForceReconcileHandler(testr.New(t))
+	handler.SetReconciler(fakeForceReconciler{block: make(chan struct{})})
+
+	_, resp := serveForceReconcile(t, handler, http.MethodPost, "/force-reconcile")
+	id := resp.Job.ID
+	if code, _ := serveForceReconcile(t, handler, http.MethodDelete, "/force-reconcile/"+id); code != http.StatusAccepted {
+		t.Fatalf("expected cancellation to be accepted, got %d", code)
+	}
+
+	job, _ := handler.job(id)
+	<-job.done
+	code, resp := serveForceReconcile(t, handler, http.MethodGet, "/force-reconcile/"+id)
+	if code != http.StatusOK || resp.Job.State != jobCancelled || resp.Success {
+		t.Fatalf("expected cancelled job, got %d %+v", code, resp)
+	}
+	if code, _ := serveForceReconcile(t, handler, http.MethodDelete, "/force-reconcile/"+id); code != http.StatusConflict {
+		t.Fatalf("expected finished job not to be cancelled again, got %d", code)
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/force-reconcile", nil))
+	var list forceReconcileListResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil {
+		t.Fatalf("decode list: %v", err)
+	}
+	if len(list.Jobs) != 1 || list.Jobs[0].ID != id {
+		t.Fatalf("unexpected job list: %+v", list)
+	}
+}
+
+func TestForceReconcileHandlerRejectsInvalidScope(t *testing.T) {
+	handler := newForceReconcileHandler(testr.New(t))
+	handler.SetReconciler(fakeForceReconciler{invalid: errors.New(`resources: "widgets" is not watched`)})
+
+	code, resp := serveForceReconcile(t, handler, http.MethodPost, "/force-reconcile?resource=widgets")
+	if code != http.StatusBadRequest || resp.Triggered || !strings.Contains(resp.Message, "widgets") {
+		t.Fatalf("expected invalid scope to be rejected, got %d %+v", code, resp)
+	}
+	if code, _ := serveForceReconcile(t, handler, http.MethodPost, "/force-reconcile?failed=maybe"); code != http.StatusBadRequest {
+		t.Fatalf("expected invalid failed flag to be rejected, got %d", code)
+	}
+}
+
+// fakeMirrorer fails the images in failing and records the metadata of every request.
+type fakeMirrorer struct {
+	mu      sync.Mutex
+	failing map[string]bool
+	metas   []mirror.Metadata
+}
+
+func (f *fakeMirrorer) Mirror(_ context.Context, src string, meta mirror.Metadata) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.metas = append(f.metas, meta)
+	if f.failing[src] {
+		return errors.New("unauthorized")
+	}
+	return nil
+}
+
+func (*fakeMirrorer) Images() []mirror.ImageRecord { return nil }
+
+func (f *fakeMirrorer) Image(ref string) []mirror.ImageRecord {
+	record, _ := f.ImageFor(ref, mirror.Metadata{})
+	return []mirror.ImageRecord{record}
+}
+
+func (*fakeMirrorer) ImageFor(ref string, _ mirror.Metadata) (mirror.ImageRecord, bool) {
+	return mirror.ImageRecord{Source: ref, Target: "registry.example.com/" + ref, Status: mirror.ImageMirrored}, true
+}
+
+func serveMirror(t *testing.T, handler http.Handler, method, target, body string) (int, mirrorResponse) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(method, target, strings.NewReader(body)))
+	var resp mirrorResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	return rec.Code, resp
+}
+
+func TestMirrorHandlerMirrorsImages(t *testing.T) {
+	mirrorer := &fakeMirrorer{failing: map[string]bool{"ghcr.io/acme/private:1": true}}
+	handler := newMirrorHandler(testr.New(t))
+	handler.SetMirrorer(context.Background(), mirrorer)
+
+	code, resp := serveMirror(t, handler, http.MethodPost, "/mirror", `{"images":["nginx:1.27","nginx:1.27"],"namespace":"ci","platforms":["linux/arm64"],"digestPull":false}`)
+	if code != http.StatusOK || !resp.Success || resp.State != jobSucceeded || len(resp.Results) != 1 {
+		t.Fatalf("expected one mirrored image, got %d %+v", code, resp)
+	}
+	result := resp.Results[0]
+	if result.State != jobSucceeded || result.Status != mirror.ImageMirrored || result.Target != "registry.example.com/nginx:1.27" {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	meta := mirrorer.metas[0]
+	if meta.Namespace != "ci" || !reflect.DeepEqual(meta.Platforms, []string{"linux/arm64"}) || meta.DigestPull == nil || *meta.DigestPull {
+		t.Fatalf("expected request metadata to reach the pusher, got %+v", meta)
+	}
+
+	code, resp = serveMirror(t, handler, http.MethodPost, "/mirror", `{"images":["nginx:1.27","ghcr.io/acme/private:1"]}`)
+	if code != http.StatusBadGateway || resp.Success || len(resp.Results) != 2 {
+		t.Fatalf("expected failed request, got %d %+v", code, resp)
+	}
+	if resp.Results[0].State != jobSucceeded || resp.Results[1].State != jobFailed || resp.Results[1].Error != "unauthorized" {
+		t.Fatalf("unexpected results: %+v", resp.Results)
+	}
+
+	code, resp = serveMirror(t, handler, http.MethodGet, "/mirror/"+resp.ID, "")
+	if code != http.StatusOK || resp.State != jobFailed {
+		t.Fatalf("expected finished request to be polled, got %d %+v", code, resp)
+	}
+}
+
+func TestMirrorHandlerAsync(t *testing.T) {
+	handler := newMirrorHandler(testr.New(t))
+	handler.SetMirrorer(context.Background(), &fakeMirrorer{})
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/mirror", strings.NewReader(`{"images":["nginx:1.27"],"async":true}`)))
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("expected async request to be accepted, got %d", rec.Code)
+	}
+	var resp mirrorResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if location := rec.Header().Get("Location"); location != "/mirror/"+resp.ID {
+		t.Fatalf("unexpected location %q for request %s", location, resp.ID)
+	}
+
+	handler.mu.RLock()
+	job := handler.jobs[resp.ID]
+	handler.mu.RUnlock()
+	<-job.done
+	if _, resp = serveMirror(t, handler, http.MethodGet, "/mirror/"+resp.ID, ""); !resp.Success || resp.Results[0].State != jobSucceeded {
+		t.Fatalf("expected async request to finish, got %+v", resp)
+	}
+}
+
+func TestMirrorHandlerMirrorsTagsWithDigestPull(t *testing.T) {
+	server := httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+	t.Cleanup(server.Close)
+	host := strings.TrimPrefix(server.URL, "http://")
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatalf("random image: %v", err)
+	}
+	source := host + "/upstream/app:1.0"
+	ref, err := name.ParseReference(source)
+	if err != nil {
+		t.Fatalf("parse source: %v", err)
+	}
+	if err := remote.Write(ref, img); err != nil {
+		t.Fatalf("push source image: %v", err)
+	}
+	target, err := name.ParseReference(host + "/copies/upstream/app:1.0")
+	if err != nil {
+		t.Fatalf("parse target: %v", err)
+	}
+	path := writeCommandConfig(t, "targetKind: docker\ndocker:\n  registry: "+host+"\n  repoPrefix: copies\n  insecure: true\ndigestPull: true\n")
+	t.Setenv("DIGEST_PULL", "")
+	fileCfg, found, err := loadConfigFileFrom(path)
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	cfg, err := loadRuntimeConfig(context.Background(), false, false, fileCfg, found)
+	if err != nil {
+		t.Fatalf("resolve config: %v", err)
+	}
+	handler := newMirrorHandler(testr.New(t))
+	handler.SetMirrorer(context.Background(), newPusher(cfg, testr.New(t)))
+
+	code, resp := serveMirror(t, handler, http.MethodPost, "/mirror", `{"images":["`+source+`"]}`)
+	if code != http.StatusOK || !resp.Success || resp.Results[0].Status != mirror.ImageMirrored {
+		t.Fatalf("expected the tag to be mirrored without a Pod digest, got %d %+v", code, resp)
+	}
+	if _, err := remote.Head(target); err != nil {
+		t.Fatalf("expected the target to exist: %v", err)
+	}
+
+	code, resp = serveMirror(t, handler, http.MethodPost, "/mirror", `{"images":["`+host+`/upstream/app:2.0"],"digestPull":true}`)
+	if code != http.StatusBadGateway || resp.Success || resp.Results[0].State != jobFailed || resp.Results[0].Error != errPendingDigest {
+		t.Fatalf("expected a tag waiting for its digest to fail, got %d %+v", code, resp)
+	}
+}
+
+// blockingMirrorer mirrors nothing until ctx is cancelled.
+type blockingMirrorer struct{}
+
+func (blockingMirrorer) Mirror(ctx context.Context, _ string, _ mirror.Metadata) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestMirrorHandlerCancelsRequestsWithItsContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	handler := newMirrorHandler(testr.New(t))
+	handler.SetMirrorer(ctx, blockingMirrorer{})
+
+	code, resp := serveMirror(t, handler, http.MethodPost, "/mirror", `{"images":["nginx:1.27"],"async":true}`)
+	if code != http.StatusAccepted {
+		t.Fatalf("expected async request to be accepted, got %d", code)
+	}
+	handler.mu.RLock()
+	job := handler.jobs[resp.ID]
+	handler.mu.RUnlock()
+	cancel()
+	<-job.done
+	if _, resp = serveMirror(t, handler, http.MethodGet, "/mirror/"+resp.ID, ""); resp.State != jobFailed || resp.Results[0].Error != context.Canceled.Error() {
+		t.Fatalf("expected the shutdown to cancel the mirror, got %+v", resp)
+	}
+	if code, _ := serveMirror(t, handler, http.MethodPost, "/mirror", `{"images":["nginx:1.27"]}`); code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 after shutdown, got %d", code)
+	}
+}
+
+func TestMirrorHandlerPrunesFinishedRequestsPastRunningOnes(t *testing.T) {
+	handler := newMirrorHandler(testr.New(t))
+	handler.jobs["stuck"] = &mirrorJob{mirrorResponse: mirrorResponse{ID: "stuck", State: jobRunning}}
+	handler.order = append(handler.order, "stuck")
+	for i := range maxFinishedMirrorJobs {
+		id := "done-" + strconv.Itoa(i)
+		handler.jobs[id] = &mirrorJob{mirrorResponse: mirrorResponse{ID: id, State: jobSucceeded}}
+		handler.order = append(handler.order, id)
+	}
+
+	job := handler.start(context.Background(), &fakeMirrorer{}, []string{"nginx:1.27"}, mirror.Metadata{})
+	<-job.done
+	handler.mu.RLock()
+	defer handler.mu.RUnlock()
+	if len(handler.order) != maxFinishedMirrorJobs || len(handler.jobs) != maxFinishedMirrorJobs {
+		t.Fatalf("expected %d requests to be kept, got %d (%d jobs)", maxFinishedMirrorJobs, len(handler.order), len(handler.jobs))
+	}
+	if _, ok := handler.jobs["stuck"]; !ok {
+		t.Fatalf("expected the running request to be kept")
+	}
+	if _, ok := handler.jobs["done-1"]; ok {
+		t.Fatalf("expected the oldest finished requests to be pruned")
+	}
+}
+
+func TestMirrorHandlerRejectsInvalidRequests(t *testing.T) {
+	handler := newMirrorHandler(testr.New(t))
+	if code, _ := serveMirror(t, handler, http.MethodPost, "/mirror", `{"images":["nginx:1.27"]}`); code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 before the pusher is ready, got %d", code)
+	}
+	handler.SetMirrorer(context.Background(), &fakeMirrorer{})
+	for _, body := range []string{
+		`{"images":[]}`,
+		`{"images":["Not A Reference!"]}`,
+		`{"images":["nginx:1.27"],"platforms":["linux/"]}`,
+		`{"images":["nginx:1.27"],"unknown":true}`,
+	} {
+		if code, resp := serveMirror(t, handler, http.MethodPost, "/mirror", body); code != http.StatusBadRequest {
+			t.Fatalf("expected %s to be rejected, got %d %+v", body, code, resp)
+		}
+	}
+	if code, _ := serveMirror(t, handler, http.MethodGet, "/mirror", ""); code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected GET /mirror to be rejected, got %d", code)
+	}
+}
+
 func TestCooldownResetHandlerDisabled(t *testing.T) {
 	handler := newCooldownHandler(testr.New(t))
 	handler.SetResetter(fakeResetter{cleared: 0, enabled: false})
 
-	req := httptest.NewRequest(http.MethodGet, "/reset-cooldown", nil)
+	req := httptest.NewRequest(http.MethodPost, "/reset-cooldown", nil)
 	rec := httptest.NewRecorder()
 
 	handler.ServeHTTP(rec, req)
@@ -134,10 +558,21 @@ func TestCooldownResetHandlerDisabled(t *testing.T) {
 	}
 }
 
+func TestCooldownResetHandlerRequiresPost(t *testing.T) {
+	handler := newCooldownHandler(testr.New(t))
+	handler.SetResetter(fakeResetter{cleared: 3, enabled: true})
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/reset-cooldown", nil))
+	if rec.Code != http.StatusMethodNotAllowed || rec.Header().Get("Allow") != "POST" {
+		t.Fatalf("expected GET to be rejected, got %d", rec.Code)
+	}
+}
+
 func TestCooldownResetHandlerNotReady(t *testing.T) {
 	handler := newCooldownHandler(testr.New(t))
 
-	req := httptest.NewRequest(http.MethodGet, "/reset-cooldown", nil)
+	req := httptest.NewRequest(http.MethodPost, "/reset-cooldown", nil)
 	rec := httptest.NewRecorder()
 
 	handler.ServeHTTP(rec, req)
@@ -150,3 +585,238 @@ func TestCooldownResetHandlerNotReady(t *testing.T) {
 		t.Fatalf("unexpected response: %+v", resp)
 	}
 }
+
+type fakeGCReportSource struct {
+	report mirror.GCReport
+	ok     bool
+}
+
+func (f fakeGCReportSource) LastReport() (mirror.GCReport, bool) {
+	return f.report, f.ok
+}
+
+func TestGCReportHandler(t *testing.T) {
+	handler := newGCReportHandler(testr.New(t))
+
+	serve := func() gcReportResponse {
+		req := httptest.NewRequest(http.MethodGet, "/gc-report", nil)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("unexpected status: %d", rec.Code)
+		}
+		var resp gcReportResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode response: %v", err)
+		}
+		return resp
+	}
+
+	if resp := serve(); resp.Available || resp.Message != "garbage collection disabled" {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+
+	handler.SetSource(fakeGCReportSource{})
+	if resp := serve(); resp.Available || resp.Message != "no garbage collection pass has run yet" {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+
+	handler.SetSource(fakeGCReportSource{ok: true, report: mirror.GCReport{
+		DryRun:  true,
+		Actions: []mirror.GCAction{{Repository: "mirrors/nginx", Digest: "sha256:old", Tags: []string{"1.24.0"}, Action: mirror.GCActionDelete}},
+	}})
+	resp := serve()
+	if !resp.Available || resp.Report == nil || len(resp.Report.Actions) != 1 || resp.Message != "dry run: listed images would be removed" {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/gc-report", nil))
+	if rec.Code != http.StatusMethodNotAllowed || rec.Header().Get("Allow") != "GET, HEAD" {
+		t.Fatalf("expected POST to be rejected, got %d with Allow %q", rec.Code, rec.Header().Get("Allow"))
+	}
+}
+
+type fakeDriftAuditor struct {
+	mu      sync.Mutex
+	running bool
+	done    chan struct{}
+	report  *mirror.DriftReport
+	// instant finishes triggered audits right away with the last report.
+	instant bool
+}
+
+func (f *fakeDriftAuditor) Trigger() (<-chan struct{}, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.running {
+		return f.done, false
+	}
+	f.running, f.done = true, make(chan struct{})
+	if f.instant {
+		f.running = false
+		close(f.done)
+	}
+	return f.done, true
+}
+
+func (f *fakeDriftAuditor) finish(report mirror.DriftReport) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.running, f.report = false, &report
+	close(f.done)
+}
+
+func (f *fakeDriftAuditor) Running() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.running
+}
+
+func (f *fakeDriftAuditor) LastReport() (mirror.DriftReport, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.report == nil {
+		return mirror.DriftReport{}, false
+	}
+	return *f.report, true
+}
+
+func TestAuditHandler(t *testing.T) {
+	handler := newAuditHandler(testr.New(t))
+
+	serve := func(method, target string, want int) auditResponse {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(method, target, nil))
+		if rec.Code != want {
+			t.Fatalf("%s %s: expected status %d, got %d: %s", method, target, want, rec.Code, rec.Body.String())
+		}
+		var resp auditResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode response: %v", err)
+		}
+		return resp
+	}
+
+	serve(http.MethodGet, "/audit", http.StatusServiceUnavailable)
+
+	auditor := &fakeDriftAuditor{}
+	handler.SetAuditor(auditor)
+	if resp := serve(http.MethodGet, "/audit", http.StatusOK); resp.Available || resp.Running || resp.Message != "no drift audit has run yet" {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+	serve(http.MethodDelete, "/audit", http.StatusMethodNotAllowed)
+	serve(http.MethodPost, "/audit?wait=maybe", http.StatusBadRequest)
+	if resp := serve(http.MethodPost, "/audit", http.StatusAccepted); !resp.Running || resp.Message != "drift audit started" {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+	if resp := serve(http.MethodPost, "/audit", http.StatusConflict); !resp.Running || resp.Message != "drift audit already running" {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+
+	auditor.finish(mirror.DriftReport{
+		Summary: map[string]int{mirror.DriftInSync: 1, mirror.DriftMissing: 1},
+		Images:  []mirror.DriftImage{{Drift: mirror.Drift{Source: "nginx:1.27", Status: mirror.DriftMissing}}},
+	})
+	auditor.mu.Lock()
+	auditor.instant = true
+	auditor.mu.Unlock()
+	resp := serve(http.MethodPost, "/audit?wait=true", http.StatusOK)
+	if !resp.Available || resp.Running || resp.Report == nil || len(resp.Report.Images) != 1 || resp.Message != "drift audit found images out of sync with their mirror" {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+}
+
+type fakeInventory []mirror.ImageRecord
+
+func (f fakeInventory) Images() []mirror.ImageRecord { return f }
+
+func (f fakeInventory) Image(ref string) []mirror.ImageRecord {
+	var records []mirror.ImageRecord
+	for _, record := range f {
+		if record.Source == ref {
+			records = append(records, record)
+		}
+	}
+	return records
+}
+
+func (f fakeInventory) ImageFor(ref string, _ mirror.Metadata) (mirror.ImageRecord, bool) {
+	if records := f.Image(ref); len(records) > 0 {
+		return records[0], true
+	}
+	return mirror.ImageRecord{}, false
+}
+
+func TestImagesHandlerPaginatesAndFilters(t *testing.T) {
+	handler := newImagesHandler(testr.New(t))
+	handler.SetSource(fakeInventory{
+		{Source: "a.io/one:1", Status: mirror.ImageMirrored, Workloads: []mirror.WorkloadReference{{Namespace: "apps", Name: "web"}}},
+		{Source: "a.io/two:1", Status: mirror.ImageCooldown, Workloads: []mirror.WorkloadReference{{Namespace: "apps", Name: "api"}}},
+		{Source: "b.io/three:1", Target: "r.io/apps/three:1", Status: mirror.ImageMirrored, Workloads: []mirror.WorkloadReference{{Namespace: "apps", Name: "api"}}},
+		{Source: "b.io/three:1", Target: "r.io/other/three:1", Status: mirror.ImageMirrored, Workloads: []mirror.WorkloadReference{{Namespace: "apps", Name: "cron"}}},
+		{Source: "b.io/four:1", Status: mirror.ImageMirrored, Workloads: []mirror.WorkloadReference{{Namespace: "other", Name: "api"}}},
+	})
+
+	list := func(query string) imageListResponse {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/images"+query, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("unexpected status for %q: %d", query, rec.Code)
+		}
+		var resp imageListResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode response: %v", err)
+		}
+		return resp
+	}
+
+	page := list("?namespace=apps&limit=3")
+	if page.Total != 4 || len(page.Items) != 3 || page.Continue != "b.io/three:1 r.io/apps/three:1" {
+		t.Fatalf("unexpected first page: %+v", page)
+	}
+	page = list("?namespace=apps&limit=3&continue=" + url.QueryEscape(page.Continue))
+	if page.Total != 4 || len(page.Items) != 1 || page.Items[0].Target != "r.io/other/three:1" || page.Continue != "" {
+		t.Fatalf("unexpected second page: %+v", page)
+	}
+	page = list("?status=cooldown,failed")
+	if page.Total != 1 || page.Items[0].Source != "a.io/two:1" {
+		t.Fatalf("unexpected status filter result: %+v", page)
+	}
+	page = list("?workload=api&search=b.io")
+	if page.Total != 2 {
+		t.Fatalf("unexpected workload filter result: %+v", page)
+	}
+}
+
+func TestImagesHandlerReturnsEveryTargetOfAnImage(t *testing.T) {
+	handler := newImagesHandler(testr.New(t))
+	handler.SetSource(fakeInventory{
+		{Source: "a.io/one@sha256:abc", Target: "r.io/apps/one@sha256:abc", Status: mirror.ImageMirrored},
+		{Source: "a.io/one@sha256:abc", Target: "r.io/jobs/one@sha256:abc", Status: mirror.ImageFailed},
+	})
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/images/a.io/one@sha256:abc", nil))
+	var resp imageResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if rec.Code != http.StatusOK || !resp.Found || len(resp.Images) != 2 || resp.Images[1].Status != mirror.ImageFailed {
+		t.Fatalf("unexpected response %d: %+v", rec.Code, resp)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/images/a.io/missing:1", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected not found, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/images", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected method not allowed, got %d", rec.Code)
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"net/http"
 	"os"
@@ -11,21 +12,28 @@ import (
 	appsv1 "k8s.io/api/apps/v1"
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/discovery/cached/memory"
 	"k8s.io/client-go/kubernetes"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/restmapper"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/metrics/server"
 
+	"github.com/go-logr/logr"
 	uberzap "go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 
 	"github.com/matzegebbe/k8s-copycat/internal/controllers"
 	"github.com/matzegebbe/k8s-copycat/internal/mirror"
+	"github.com/matzegebbe/k8s-copycat/internal/registry"
+	"github.com/matzegebbe/k8s-copycat/internal/tracing"
 	"github.com/matzegebbe/k8s-copycat/pkg/util"
 )
 
@@ -39,6 +47,12 @@ func init() {
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		if run, ok := subcommands[os.Args[1]]; ok {
+			os.Exit(run(os.Args[2:], os.Stdout, os.Stderr))
+		}
+	}
+
 	metricsAddr := envOrDefault("METRICS_ADDR", ":8080")
 	probeAddr := ":8081"
 	var enableLeaderElection bool
@@ -83,8 +97,22 @@ func main() {
 		os.Exit(1)
 	}
 
+	shutdownTracing, err := tracing.Setup(ctx, cfg.Tracing)
+	if err != nil {
+		logger.Error(err, "configure tracing failed 🙀")
+		os.Exit(1)
+	}
+	if cfg.Tracing.Enabled() {
+		logger.Info("exporting traces", "endpoint", cfg.Tracing.Endpoint, "protocol", cfg.Tracing.Protocol, "sampleRatio", cfg.Tracing.SampleRatio)
+	}
+
 	cooldownHTTPHandler := newCooldownHandler(logger.WithName("cooldown"))
+	cooldownsHTTPHandler := newCooldownsHandler(logger.WithName("cooldown"))
 	forceHTTPHandler := newForceReconcileHandler(logger.WithName("force-reconcile"))
+	gcReportHTTPHandler := newGCReportHandler(logger.WithName("gc-report"))
+	auditHTTPHandler := newAuditHandler(logger.WithName("audit"))
+	imagesHTTPHandler := newImagesHandler(logger.WithName("images"))
+	mirrorHTTPHandler := newMirrorHandler(logger.WithName("mirror-request"))
 
 	restCfg := ctrl.GetConfigOrDie()
 	kubeClient, err := kubernetes.NewForConfig(restCfg)
@@ -93,21 +121,47 @@ func main() {
 		os.Exit(1)
 	}
 
-	expandedNS, err := validateAndExpandNamespaces(ctx, logger.WithName("namespaces"), kubeClient, cfg.AllowedNS)
+	expandedNS, err := validateAndExpandNamespaces(ctx, logger.WithName("namespaces"), kubeClient, cfg.AllowedNS, cfg.Selectors.Namespaces)
 	if err != nil {
 		logger.Error(err, "validate configured namespaces failed 🙀")
 		os.Exit(1)
 	}
-	cfg.AllowedNS = expandedNS
+	trackNamespaces := controllers.NamespaceTrackingRequired(cfg.AllowedNS, cfg.Selectors.Namespaces)
+	if trackNamespaces {
+		// Keep the configured patterns so namespaces created or relabelled later are matched too.
+		logger.Info("tracking namespaces dynamically", "include", cfg.AllowedNS, "currentlyMatching", expandedNS)
+	} else {
+		cfg.AllowedNS = expandedNS
+	}
+
+	adminHandlers := map[string]http.Handler{
+		"/reset-cooldown":   cooldownHTTPHandler,
+		"/cooldowns":        cooldownsHTTPHandler,
+		"/force-reconcile":  forceHTTPHandler,
+		"/force-reconcile/": forceHTTPHandler,
+		"/gc-report":        gcReportHTTPHandler,
+		"/audit":            auditHTTPHandler,
+		"/images":           imagesHTTPHandler,
+		"/images/":          imagesHTTPHandler,
+		"/mirror":           mirrorHTTPHandler,
+		"/mirror/":          mirrorHTTPHandler,
+	}
+	adminAuth := newAdminAuthenticator(cfg.AdminAuth, kubeClient, logger.WithName("admin-auth"))
+	for path, handler := range adminHandlers {
+		adminHandlers[path] = adminAuth.Wrap(handler)
+	}
+	if cfg.AdminAuth.Mode == adminAuthNone {
+		logger.WithValues("severity", "warning").Info("⚠️ admin endpoints of the metrics listener are NOT authenticated; anyone who can reach it may mirror images, force reconciles and reset cooldowns. Set ADMIN_AUTH_MODE to token or kubernetes to protect them",
+			"address", metricsAddr, "mode", adminAuthNone)
+	} else {
+		logger.Info("authenticating admin endpoints", "mode", cfg.AdminAuth.Mode)
+	}
 
 	mgrOpts := ctrl.Options{
 		Scheme: scheme,
 		Metrics: server.Options{
-			BindAddress: metricsAddr,
-			ExtraHandlers: map[string]http.Handler{
-				"/reset-cooldown":  cooldownHTTPHandler,
-				"/force-reconcile": forceHTTPHandler,
-			},
+			BindAddress:   metricsAddr,
+			ExtraHandlers: adminHandlers,
 		},
 		HealthProbeBindAddress: probeAddr,
 		LeaderElection:         enableLeaderElection,
@@ -120,6 +174,8 @@ func main() {
 		logger.Info("configuring periodic full reconciliation", "interval", syncPeriod)
 	}
 	switch {
+	case trackNamespaces:
+		logger.Info("listing resources in all namespaces filtered by include configuration")
 	case len(cfg.AllowedNS) == 0:
 		logger.Info("no namespaces matched include configuration; controllers will not watch any namespaces")
 	case len(cfg.AllowedNS) == 1 && cfg.AllowedNS[0] == "*":
@@ -128,13 +184,23 @@ func main() {
 		logger.Info("listing resources in configured namespaces", "namespaces", cfg.AllowedNS)
 	}
 	cacheOpts := cache.Options{SyncPeriod: syncPeriodPtr}
-	if len(cfg.AllowedNS) != 0 && (len(cfg.AllowedNS) != 1 || cfg.AllowedNS[0] != "*") {
+	if !trackNamespaces && len(cfg.AllowedNS) != 0 && (len(cfg.AllowedNS) != 1 || cfg.AllowedNS[0] != "*") {
 		nsMap := make(map[string]cache.Config, len(cfg.AllowedNS))
 		for _, ns := range cfg.AllowedNS {
 			nsMap[ns] = cache.Config{}
 		}
 		cacheOpts.DefaultNamespaces = nsMap
 	}
+	mapper := restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(kubeClient.Discovery()))
+	byObject, err := controllers.CacheByObject(cfg.WatchResources, cfg.CustomResources, cfg.Selectors, mapper)
+	if err != nil {
+		logger.Error(err, "configure cache selectors failed 🙀")
+		os.Exit(1)
+	}
+	if len(byObject) > 0 {
+		logger.Info("restricting cached objects to label selectors", "namespaceSelector", selectorString(cfg.Selectors.Namespaces), "workloadSelector", selectorString(cfg.Selectors.Workloads))
+		cacheOpts.ByObject = byObject
+	}
 	mgrOpts.Cache = cacheOpts
 	mgr, err := ctrl.NewManager(restCfg, mgrOpts)
 	if err != nil {
@@ -142,34 +208,149 @@ func main() {
 		os.Exit(1)
 	}
 
-	transformer := util.NewRepoPathTransformer(cfg.PathMap)
-	pusher := mirror.NewPusher(
-		cfg.Target,
-		cfg.DryRun,
-		cfg.DryPull,
-		transformer,
-		logger.WithName("mirror"),
-		cfg.Keychain,
-		cfg.RequestTimeout,
-		cfg.FailureCooldown,
-		cfg.DigestPull,
-		cfg.DigestPullIgnoredTags,
-		cfg.IgnoreMissingPlatforms,
-		cfg.AllowDifferentDigestRepush,
-		cfg.ExcludedRegistries,
-		cfg.MirrorPlatforms,
-		mirror.RetryConfig{
-			Attempts: cfg.RegistryRetryAttempts,
-			Backoff:  cfg.RegistryRetryBackoff,
-		},
+	var (
+		tracker  *mirror.ReferenceTracker
+		recorder mirror.ReferenceRecorder
+	)
+	if cfg.GarbageCollection != nil {
+		tracker = mirror.NewReferenceTracker()
+		recorder = tracker
+	}
+	var stateCache *mirror.StateCache
+	if cfg.StateStore != nil {
+		var store mirror.StateStore
+		switch cfg.StateStore.Type {
+		case stateStoreConfigMap:
+			store = mirror.ConfigMapStateStore{Client: kubeClient, Namespace: cfg.StateStore.Namespace, Name: cfg.StateStore.Name}
+		case stateStoreFile:
+			store = mirror.FileStateStore{Path: cfg.StateStore.Path}
+		}
+		stateCache = mirror.NewStateCache(store, cfg.StateStore.TTL, cfg.StateStore.FlushInterval, logger.WithName("mirror"))
+		if err := mgr.Add(stateCache); err != nil {
+			logger.Error(err, "add state store failed 🙀")
+			os.Exit(1)
+		}
+		logger.Info("persisting mirror state", "type", cfg.StateStore.Type, "namespace", cfg.StateStore.Namespace, "name", cfg.StateStore.Name, "path", cfg.StateStore.Path, "ttl", cfg.StateStore.TTL)
+	}
+	var layerCache *mirror.LayerCache
+	if cfg.LayerCachePath != "" {
+		layerCache, err = mirror.NewLayerCache(cfg.LayerCachePath, cfg.LayerCacheMaxBytes, logger.WithName("mirror"))
+		if err != nil {
+			logger.Error(err, "configure layer cache failed 🙀")
+			os.Exit(1)
+		}
+		logger.Info("caching source layers on disk", "path", cfg.LayerCachePath, "maxBytes", cfg.LayerCacheMaxBytes, "cachedBytes", layerCache.Size())
+	}
+	bandwidth := mirror.NewBandwidthLimiter(cfg.BandwidthLimits, logger.WithName("mirror"))
+	if bandwidth != nil {
+		logger.Info("limiting registry bandwidth", "pullBytesPerSecond", cfg.BandwidthLimits.Default.Pull, "pushBytesPerSecond", cfg.BandwidthLimits.Default.Push, "registries", len(cfg.BandwidthLimits.Registries), "scheduleWindows", len(cfg.BandwidthLimits.Schedule))
+	}
+	pusher := newPusher(cfg, logger.WithName("mirror"),
+		mirror.WithReferenceRecorder(recorder),
+		mirror.WithStateCache(stateCache),
+		mirror.WithLayerCache(layerCache),
+		mirror.WithBandwidthLimiter(bandwidth),
 	)
-	forceReconciler, err := controllers.SetupAll(mgr, pusher, cfg.AllowedNS, cfg.SkipCfg, cfg.WatchResources, cfg.MaxConcurrentReconciles, cfg.CheckNodePlatform)
+	// Repository syncs mirror whole repositories, so they bypass upcoming version discovery.
+	syncPusher := pusher
+	if len(cfg.UpcomingVersions) > 0 {
+		pusher, err = mirror.NewUpcomingVersionPusher(pusher, cfg.UpcomingVersions, cfg.Keychain, cfg.RequestTimeout, logger.WithName("mirror"))
+		if err != nil {
+			logger.Error(err, "configure upcoming version mirroring failed 🙀")
+			os.Exit(1)
+		}
+		logger.Info("mirroring upcoming versions for matching images", "rules", len(cfg.UpcomingVersions))
+	}
+	// Every image goes through one queue so that workloads sharing an image share its mirror, and
+	// reconcile workers do not wait for pushes.
+	queue := mirror.NewMirrorQueue(pusher, cfg.MirrorWorkers, logger.WithName("mirror"))
+	if err := mgr.Add(queue); err != nil {
+		logger.Error(err, "add mirror queue failed 🙀")
+		os.Exit(1)
+	}
+	pusher = queue
+	forceReconciler, err := controllers.SetupAll(mgr, pusher, cfg.AllowedNS, cfg.SkipCfg, cfg.Selectors, cfg.WatchResources, cfg.CustomResources, cfg.MaxConcurrentReconciles, cfg.CheckNodePlatform)
 	if err != nil {
 		logger.Error(err, "setup controllers failed 🙀")
 		os.Exit(1)
 	}
+	if len(cfg.RepositorySync) > 0 {
+		syncer, err := mirror.NewRepositorySyncer(syncPusher, cfg.RepositorySync, cfg.Keychain, cfg.RequestTimeout, logger.WithName("mirror"))
+		if err != nil {
+			logger.Error(err, "configure repository sync failed 🙀")
+			os.Exit(1)
+		}
+		if err := mgr.Add(syncer); err != nil {
+			logger.Error(err, "add repository sync failed 🙀")
+			os.Exit(1)
+		}
+		logger.Info("syncing repositories", "repositories", len(cfg.RepositorySync))
+	}
+	var staticImages *mirror.StaticImageMirrorer
+	if len(cfg.StaticImages) > 0 {
+		staticImages = mirror.NewStaticImageMirrorer(pusher, cfg.StaticImages, cfg.ForceResync, logger.WithName("mirror"))
+		if err := mgr.Add(staticImages); err != nil {
+			logger.Error(err, "add static image mirroring failed 🙀")
+			os.Exit(1)
+		}
+		logger.Info("mirroring static images", "images", len(cfg.StaticImages))
+	}
+	if cfg.GarbageCollection != nil {
+		cleaner, _ := cfg.Target.(registry.Cleaner)
+		refresh := func(ctx context.Context) error {
+			// Re-mirror everything so that every reference still in use is recorded.
+			if _, _, err := forceReconciler.ForceReconcile(ctx); err != nil {
+				var mirrorErrs *controllers.MirrorErrors
+				if !errors.As(err, &mirrorErrs) {
+					return err
+				}
+			}
+			if staticImages != nil {
+				staticImages.MirrorAll(ctx)
+			}
+			return nil
+		}
+		collector, err := mirror.NewGarbageCollector(cleaner, tracker, refresh, stateCache.ForgetImages, *cfg.GarbageCollection, logger.WithName("mirror"))
+		if err != nil {
+			logger.Error(err, "configure garbage collection failed 🙀")
+			os.Exit(1)
+		}
+		if err := mgr.Add(collector); err != nil {
+			logger.Error(err, "add garbage collection failed 🙀")
+			os.Exit(1)
+		}
+		gcReportHTTPHandler.SetSource(collector)
+		logger.Info("collecting unreferenced images", "repositories", cfg.GarbageCollection.Repositories, "gracePeriod", cfg.GarbageCollection.GracePeriod, "interval", cfg.GarbageCollection.Interval, "dryRun", cfg.GarbageCollection.DryRun)
+	}
+	if checker, ok := syncPusher.(mirror.DriftChecker); ok {
+		auditor := mirror.NewDriftAuditor(checker, forceReconciler.WatchedImages, cfg.DriftAuditInterval, logger.WithName("mirror"))
+		if err := mgr.Add(auditor); err != nil {
+			logger.Error(err, "add drift audit failed 🙀")
+			os.Exit(1)
+		}
+		auditHTTPHandler.SetAuditor(auditor)
+		if cfg.DriftAuditInterval > 0 {
+			logger.Info("auditing mirrored images for drift", "interval", cfg.DriftAuditInterval)
+		}
+	}
 	cooldownHTTPHandler.SetResetter(pusher)
+	cooldownsHTTPHandler.SetSource(pusher)
+	if inventory, ok := syncPusher.(mirror.ImageInventory); ok {
+		imagesHTTPHandler.SetSource(inventory)
+	}
 	forceHTTPHandler.SetReconciler(forceReconciler)
+	// Only the leader works the mirror queue, so other replicas answer /mirror with 503. Requests
+	// are cancelled when the manager stops.
+	err = mgr.Add(manager.RunnableFunc(func(ctx context.Context) error {
+		mirrorHTTPHandler.SetMirrorer(ctx, pusher)
+		<-ctx.Done()
+		mirrorHTTPHandler.SetMirrorer(ctx, nil)
+		return nil
+	}))
+	if err != nil {
+		logger.Error(err, "add mirror endpoint failed 🙀")
+		os.Exit(1)
+	}
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
 		logger.Error(err, "healthz failed 🙀")
@@ -181,12 +362,44 @@ func main() {
 	}
 
 	logger.Info("starting copycat 😼")
-	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
-		logger.Error(err, "manager exited non-zero")
+	startErr := mgr.Start(ctrl.SetupSignalHandler())
+	// Flush the spans of mirrors that finished during shutdown.
+	flushCtx, cancelFlush := context.WithTimeout(ctx, 5*time.Second)
+	if err := shutdownTracing(flushCtx); err != nil {
+		logger.Error(err, "flush traces failed")
+	}
+	cancelFlush()
+	if startErr != nil {
+		logger.Error(startErr, "manager exited non-zero")
 		os.Exit(1)
 	}
 }
 
+// newPusher builds the pusher that mirrors images to the configured target.
+func newPusher(cfg runtimeConfig, logger logr.Logger, opts ...mirror.PusherOption) mirror.Pusher {
+	opts = append([]mirror.PusherOption{mirror.WithRetryConfig(mirror.RetryConfig{
+		Attempts: cfg.RegistryRetryAttempts,
+		Backoff:  cfg.RegistryRetryBackoff,
+	})}, opts...)
+	return mirror.NewPusher(
+		cfg.Target,
+		cfg.DryRun,
+		cfg.DryPull,
+		util.NewRepoPathTransformer(cfg.PathMap),
+		logger,
+		cfg.Keychain,
+		cfg.RequestTimeout,
+		cfg.FailureCooldown,
+		cfg.DigestPull,
+		cfg.DigestPullIgnoredTags,
+		cfg.IgnoreMissingPlatforms,
+		cfg.AllowDifferentDigestRepush,
+		cfg.ExcludedRegistries,
+		cfg.MirrorPlatforms,
+		opts...,
+	)
+}
+
 func configureJSONLogging(opts *zap.Options) {
 	opts.Development = false
 	opts.DestWriter = os.Stdout
@@ -204,6 +417,13 @@ func logStartupError(err error, msg string, keysAndValues ...any) {
 	zap.New(zap.UseFlagOptions(&opts)).Error(err, msg, keysAndValues...)
 }
 
+func selectorString(selector labels.Selector) string {
+	if selector == nil {
+		return ""
+	}
+	return selector.String()
+}
+
 func envOrDefault(key, fallback string) string {
 	value := strings.TrimSpace(os.Getenv(key))
 	if value == "" {
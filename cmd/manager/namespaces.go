@@ -9,27 +9,35 @@ import (
 
 	"github.com/go-logr/logr"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/client-go/kubernetes"
 )
 
-func validateAndExpandNamespaces(ctx context.Context, log logr.Logger, client kubernetes.Interface, selections []string) ([]string, error) {
-	if len(selections) == 0 {
-		return []string{"*"}, nil
-	}
-
+// validateAndExpandNamespaces resolves the configured namespace names and patterns against the
+// cluster. When a namespace selector is configured, only namespaces whose labels match it are kept,
+// and a "*" selection expands to every selected namespace.
+func validateAndExpandNamespaces(ctx context.Context, log logr.Logger, client kubernetes.Interface, selections []string, selector labels.Selector) ([]string, error) {
+	hasSelector := selector != nil && !selector.Empty()
 	normalized := make([]string, 0, len(selections))
 	for _, raw := range selections {
 		trimmed := strings.TrimSpace(raw)
 		if trimmed == "" {
 			continue
 		}
-		normalized = append(normalized, trimmed)
 		if trimmed == "*" {
-			return []string{"*"}, nil
+			if !hasSelector {
+				return []string{"*"}, nil
+			}
+			normalized = []string{"*"}
+			break
 		}
+		normalized = append(normalized, trimmed)
 	}
 	if len(normalized) == 0 {
-		return []string{"*"}, nil
+		if !hasSelector {
+			return []string{"*"}, nil
+		}
+		normalized = []string{"*"}
 	}
 
 	nsList, err := client.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
@@ -39,13 +47,18 @@ func validateAndExpandNamespaces(ctx context.Context, log logr.Logger, client ku
 
 	existing := make([]string, 0, len(nsList.Items))
 	existingSet := make(map[string]struct{}, len(nsList.Items))
+	selectedSet := make(map[string]struct{}, len(nsList.Items))
 	for _, item := range nsList.Items {
 		name := strings.TrimSpace(item.Name)
 		if name == "" {
 			continue
 		}
-		existing = append(existing, name)
 		existingSet[name] = struct{}{}
+		if hasSelector && !selector.Matches(labels.Set(item.Labels)) {
+			continue
+		}
+		existing = append(existing, name)
+		selectedSet[name] = struct{}{}
 	}
 
 	results := make(map[string]struct{}, len(normalized))
@@ -72,6 +85,10 @@ func validateAndExpandNamespaces(ctx context.Context, log logr.Logger, client ku
 			missing = append(missing, sel)
 			continue
 		}
+		if _, ok := selectedSet[sel]; !ok {
+			log.Info("configured namespace does not match namespace selector", "namespace", sel, "selector", selector.String())
+			continue
+		}
 		results[sel] = struct{}{}
 	}
 	if len(missing) > 0 {
@@ -2,11 +2,13 @@ package main
 
 import (
 	"context"
+	"reflect"
 	"testing"
 
 	"github.com/go-logr/logr/testr"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/client-go/kubernetes/fake"
 )
 
@@ -20,7 +22,7 @@ func TestValidateAndExpandNamespaces(t *testing.T) {
 	ctx := context.Background()
 	log := testr.New(t)
 
-	expanded, err := validateAndExpandNamespaces(ctx, log, client, []string{"default", "test-*"})
+	expanded, err := validateAndExpandNamespaces(ctx, log, client, []string{"default", "test-*"}, nil)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -34,7 +36,7 @@ func TestValidateAndExpandNamespaces(t *testing.T) {
 		}
 	}
 
-	expanded, err = validateAndExpandNamespaces(ctx, log, client, []string{"missing"})
+	expanded, err = validateAndExpandNamespaces(ctx, log, client, []string{"missing"}, nil)
 	if err == nil {
 		t.Fatalf("expected missing namespace to return error")
 	}
@@ -42,7 +44,7 @@ func TestValidateAndExpandNamespaces(t *testing.T) {
 		t.Fatalf("expected no expanded namespaces on error, got %#v", expanded)
 	}
 
-	expanded, err = validateAndExpandNamespaces(ctx, log, client, []string{"*"})
+	expanded, err = validateAndExpandNamespaces(ctx, log, client, []string{"*"}, nil)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -51,6 +53,35 @@ func TestValidateAndExpandNamespaces(t *testing.T) {
 	}
 }
 
+func TestValidateAndExpandNamespacesWithSelector(t *testing.T) {
+	client := fake.NewClientset(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default"}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "prod-a", Labels: map[string]string{"tier": "prod"}}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "prod-b", Labels: map[string]string{"tier": "prod"}}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "dev", Labels: map[string]string{"tier": "dev"}}},
+	)
+
+	ctx := context.Background()
+	log := testr.New(t)
+	selector := labels.SelectorFromSet(labels.Set{"tier": "prod"})
+
+	expanded, err := validateAndExpandNamespaces(ctx, log, client, []string{"*"}, selector)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []string{"prod-a", "prod-b"}; !reflect.DeepEqual(expanded, want) {
+		t.Fatalf("expected selector to expand wildcard to %v, got %v", want, expanded)
+	}
+
+	expanded, err = validateAndExpandNamespaces(ctx, log, client, []string{"dev", "prod-a"}, selector)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []string{"prod-a"}; !reflect.DeepEqual(expanded, want) {
+		t.Fatalf("expected unselected namespace to be dropped, got %v", expanded)
+	}
+}
+
 func TestMatchNamespacePatternInvalid(t *testing.T) {
 	if _, err := matchNamespacePattern("test-[", []string{"test-1"}); err == nil {
 		t.Fatalf("expected error for invalid pattern")
@@ -9,16 +9,26 @@ import (
 	"time"
 
 	"github.com/google/go-containerregistry/pkg/authn"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 
 	"github.com/matzegebbe/k8s-copycat/internal/config"
 	"github.com/matzegebbe/k8s-copycat/internal/controllers"
 	"github.com/matzegebbe/k8s-copycat/internal/mirror"
 	"github.com/matzegebbe/k8s-copycat/internal/registry"
+	"github.com/matzegebbe/k8s-copycat/internal/tracing"
 	"github.com/matzegebbe/k8s-copycat/pkg/util"
 )
 
 func loadConfigFile() (config.Config, bool, error) {
-	cfgPath := os.Getenv("CONFIG_PATH")
+	return loadConfigFileFrom(os.Getenv("CONFIG_PATH"))
+}
+
+// loadConfigFileFrom loads the config file at cfgPath, or at the default location when cfgPath is
+// empty.
+func loadConfigFileFrom(cfgPath string) (config.Config, bool, error) {
 	if cfgPath == "" {
 		cfgPath = config.FilePath
 	}
@@ -33,6 +43,7 @@ func loadConfigFile() (config.Config, bool, error) {
 type runtimeConfig struct {
 	AllowedNS                  []string
 	SkipCfg                    controllers.SkipConfig
+	Selectors                  controllers.SelectorConfig
 	ExcludedRegistries         []string
 	Target                     registry.Target
 	DryRun                     bool
@@ -50,10 +61,41 @@ type runtimeConfig struct {
 	MirrorPlatforms            []string
 	AllowDifferentDigestRepush bool
 	MaxConcurrentReconciles    int
+	MirrorWorkers              int
 	WatchResources             []controllers.ResourceType
+	CustomResources            []controllers.CustomResource
+	UpcomingVersions           []mirror.UpcomingVersionRule
+	RepositorySync             []mirror.RepositorySync
+	StaticImages               []string
+	GarbageCollection          *mirror.GarbageCollection
+	DriftAuditInterval         time.Duration
+	StateStore                 *stateStoreConfig
+	LayerCachePath             string
+	LayerCacheMaxBytes         int64
+	BandwidthLimits            mirror.BandwidthLimits
+	Tracing                    tracing.Config
+	AdminAuth                  adminAuthConfig
 	ForceResync                time.Duration
 }
 
+// stateStoreConfig describes where mirror state is persisted. The store itself is created in main
+// because the ConfigMap store needs a Kubernetes client.
+type stateStoreConfig struct {
+	Type          string
+	Namespace     string
+	Name          string
+	Path          string
+	TTL           time.Duration
+	FlushInterval time.Duration
+}
+
+const (
+	stateStoreConfigMap         = "configmap"
+	stateStoreFile              = "file"
+	defaultStateConfigMapName   = "k8s-copycat-state"
+	serviceAccountNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+)
+
 const defaultRequestTimeout = 5 * time.Minute
 const defaultMaxConcurrentReconciles = 2
 
@@ -68,6 +110,21 @@ func loadRuntimeConfig(ctx context.Context, dryRunFlag, dryPullFlag bool, fileCf
 		Jobs:         resolveList(os.Getenv("SKIP_JOBS"), fileCfg.SkipNames.Jobs),
 		CronJobs:     resolveList(os.Getenv("SKIP_CRONJOBS"), fileCfg.SkipNames.CronJobs),
 		Pods:         resolveList(os.Getenv("SKIP_PODS"), fileCfg.SkipNames.Pods),
+
+		ReplicaSets:            resolveList(os.Getenv("SKIP_REPLICASETS"), fileCfg.SkipNames.ReplicaSets),
+		ReplicationControllers: resolveList(os.Getenv("SKIP_REPLICATIONCONTROLLERS"), fileCfg.SkipNames.ReplicationControllers),
+		PodTemplates:           resolveList(os.Getenv("SKIP_PODTEMPLATES"), fileCfg.SkipNames.PodTemplates),
+	}
+	if err := skipCfg.Validate(); err != nil {
+		return runtimeConfig{}, fmt.Errorf("invalid skip configuration: %w", err)
+	}
+	namespaceSelector, err := resolveLabelSelector(os.Getenv("NAMESPACE_SELECTOR"), fileCfg.NamespaceSelector)
+	if err != nil {
+		return runtimeConfig{}, fmt.Errorf("parse namespace selector: %w", err)
+	}
+	workloadSelector, err := resolveLabelSelector(os.Getenv("WORKLOAD_SELECTOR"), fileCfg.WorkloadSelector)
+	if err != nil {
+		return runtimeConfig{}, fmt.Errorf("parse workload selector: %w", err)
 	}
 	excludedRegistries := resolveList(os.Getenv("EXCLUDE_REGISTRIES"), fileCfg.ExcludeRegistries)
 
@@ -81,6 +138,26 @@ func loadRuntimeConfig(ctx context.Context, dryRunFlag, dryPullFlag bool, fileCf
 		}
 	}
 
+	customResources := resolveCustomResources(fileCfg.CustomResources)
+	if err := controllers.ValidateCustomResources(customResources); err != nil {
+		return runtimeConfig{}, fmt.Errorf("invalid custom resources: %w", err)
+	}
+
+	upcomingVersions := resolveUpcomingVersions(fileCfg.UpcomingVersions)
+	if err := mirror.ValidateUpcomingVersionRules(upcomingVersions); err != nil {
+		return runtimeConfig{}, fmt.Errorf("invalid upcoming versions: %w", err)
+	}
+
+	repositorySync := resolveRepositorySync(fileCfg.RepositorySync)
+	if err := mirror.ValidateRepositorySyncs(repositorySync); err != nil {
+		return runtimeConfig{}, fmt.Errorf("invalid repository sync: %w", err)
+	}
+
+	staticImages := resolveList(os.Getenv("STATIC_IMAGES"), fileCfg.StaticImages)
+	if err := mirror.ValidateStaticImages(staticImages); err != nil {
+		return runtimeConfig{}, fmt.Errorf("invalid static images: %w", err)
+	}
+
 	targetKind := os.Getenv("TARGET_KIND")
 	if targetKind == "" && cfgFound {
 		targetKind = strings.ToLower(strings.TrimSpace(fileCfg.TargetKind))
@@ -89,10 +166,7 @@ func loadRuntimeConfig(ctx context.Context, dryRunFlag, dryPullFlag bool, fileCf
 		targetKind = "ecr"
 	}
 
-	var (
-		t   registry.Target
-		err error
-	)
+	var t registry.Target
 	switch targetKind {
 	case "ecr":
 		eAccount := fileCfg.ECR.AccountID
@@ -307,6 +381,23 @@ func loadRuntimeConfig(ctx context.Context, dryRunFlag, dryPullFlag bool, fileCf
 		maxConcurrent = *fileCfg.MaxConcurrentReconciles
 	}
 
+	mirrorWorkers := mirror.DefaultMirrorWorkers
+	if v := strings.TrimSpace(os.Getenv("MIRROR_WORKERS")); v != "" {
+		parsed, parseErr := strconv.Atoi(v)
+		if parseErr != nil {
+			return runtimeConfig{}, fmt.Errorf("parse mirror workers: %w", parseErr)
+		}
+		if parsed <= 0 {
+			return runtimeConfig{}, fmt.Errorf("mirror workers must be greater than zero")
+		}
+		mirrorWorkers = parsed
+	} else if fileCfg.MirrorWorkers != nil {
+		if *fileCfg.MirrorWorkers <= 0 {
+			return runtimeConfig{}, fmt.Errorf("mirrorWorkers in config must be greater than zero")
+		}
+		mirrorWorkers = *fileCfg.MirrorWorkers
+	}
+
 	forceResyncMinutes := strings.TrimSpace(os.Getenv("FORCE_RECONCILE_MINUTES"))
 	forceResync := time.Duration(0)
 	if forceResyncMinutes != "" {
@@ -319,9 +410,51 @@ func loadRuntimeConfig(ctx context.Context, dryRunFlag, dryPullFlag bool, fileCf
 		forceResync = durationFromMinutes(*fileCfg.ForceReconcileMinutes)
 	}
 
+	garbageCollection, err := resolveGarbageCollection(fileCfg.GarbageCollection, dryRun)
+	if err != nil {
+		return runtimeConfig{}, fmt.Errorf("invalid garbage collection: %w", err)
+	}
+
+	driftAuditInterval, err := resolveDriftAudit(os.Getenv("DRIFT_AUDIT_MINUTES"), fileCfg.DriftAudit)
+	if err != nil {
+		return runtimeConfig{}, fmt.Errorf("invalid drift audit: %w", err)
+	}
+
+	stateStore, err := resolveStateStore(fileCfg.StateStore)
+	if err != nil {
+		return runtimeConfig{}, fmt.Errorf("invalid state store: %w", err)
+	}
+
+	layerCachePath, layerCacheMaxBytes, err := resolveLayerCache(os.Getenv("LAYER_CACHE_PATH"), os.Getenv("LAYER_CACHE_MAX_SIZE_GB"), fileCfg.LayerCache)
+	if err != nil {
+		return runtimeConfig{}, fmt.Errorf("invalid layer cache: %w", err)
+	}
+
+	bandwidthLimits, err := resolveBandwidthLimits(os.Getenv("BANDWIDTH_PULL_LIMIT"), os.Getenv("BANDWIDTH_PUSH_LIMIT"), fileCfg.BandwidthLimits)
+	if err != nil {
+		return runtimeConfig{}, fmt.Errorf("invalid bandwidth limits: %w", err)
+	}
+
+	tracingCfg, err := resolveTracing(
+		firstEnv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "OTEL_EXPORTER_OTLP_ENDPOINT"),
+		firstEnv("OTEL_EXPORTER_OTLP_TRACES_PROTOCOL", "OTEL_EXPORTER_OTLP_PROTOCOL"),
+		firstEnv("OTEL_EXPORTER_OTLP_TRACES_INSECURE", "OTEL_EXPORTER_OTLP_INSECURE"),
+		os.Getenv("OTEL_TRACES_SAMPLER_ARG"),
+		fileCfg.Tracing,
+	)
+	if err != nil {
+		return runtimeConfig{}, fmt.Errorf("invalid tracing: %w", err)
+	}
+
+	adminAuth, err := resolveAdminAuth(os.Getenv("ADMIN_AUTH_MODE"), os.Getenv("ADMIN_TOKEN"), os.Getenv("ADMIN_TOKEN_FILE"), fileCfg.AdminAuth)
+	if err != nil {
+		return runtimeConfig{}, fmt.Errorf("invalid admin auth: %w", err)
+	}
+
 	return runtimeConfig{
 		AllowedNS:                  allowedNS,
 		SkipCfg:                    skipCfg,
+		Selectors:                  controllers.SelectorConfig{Namespaces: namespaceSelector, Workloads: workloadSelector},
 		ExcludedRegistries:         excludedRegistries,
 		Target:                     t,
 		DryRun:                     dryRun,
@@ -339,7 +472,20 @@ func loadRuntimeConfig(ctx context.Context, dryRunFlag, dryPullFlag bool, fileCf
 		MirrorPlatforms:            mirrorPlatforms,
 		AllowDifferentDigestRepush: allowDifferentDigestRepush,
 		MaxConcurrentReconciles:    maxConcurrent,
+		MirrorWorkers:              mirrorWorkers,
 		WatchResources:             parsedWatch,
+		CustomResources:            customResources,
+		UpcomingVersions:           upcomingVersions,
+		RepositorySync:             repositorySync,
+		StaticImages:               staticImages,
+		GarbageCollection:          garbageCollection,
+		DriftAuditInterval:         driftAuditInterval,
+		StateStore:                 stateStore,
+		LayerCachePath:             layerCachePath,
+		LayerCacheMaxBytes:         layerCacheMaxBytes,
+		BandwidthLimits:            bandwidthLimits,
+		Tracing:                    tracingCfg,
+		AdminAuth:                  adminAuth,
 		ForceResync:                forceResync,
 	}, nil
 }
@@ -363,6 +509,26 @@ func resolveOptionalBoolEnv(value string) (bool, bool, error) {
 	return parsed, true, nil
 }
 
+// resolveLabelSelector parses a label selector from the environment (kubectl syntax such as
+// "tier=prod,team in (a,b)") or falls back to the structured selector from the config file.
+// It returns nil when no selector is configured.
+func resolveLabelSelector(envVal string, configValue *metav1.LabelSelector) (labels.Selector, error) {
+	if trimmed := strings.TrimSpace(envVal); trimmed != "" {
+		return labels.Parse(trimmed)
+	}
+	if configValue == nil {
+		return nil, nil
+	}
+	selector, err := metav1.LabelSelectorAsSelector(configValue)
+	if err != nil {
+		return nil, err
+	}
+	if selector.Empty() {
+		return nil, nil
+	}
+	return selector, nil
+}
+
 func resolveAllowedNamespaces(envVal string, configValues []string) []string {
 	if ns := resolveList(envVal, configValues); len(ns) > 0 {
 		return ns
@@ -370,6 +536,379 @@ func resolveAllowedNamespaces(envVal string, configValues []string) []string {
 	return []string{"*"}
 }
 
+// resolveCustomResources converts custom resource declarations from the config file.
+func resolveCustomResources(values []config.CustomResource) []controllers.CustomResource {
+	if len(values) == 0 {
+		return nil
+	}
+	out := make([]controllers.CustomResource, 0, len(values))
+	for _, v := range values {
+		out = append(out, controllers.CustomResource{
+			GroupVersionKind: schema.GroupVersionKind{
+				Group:   strings.TrimSpace(v.Group),
+				Version: strings.TrimSpace(v.Version),
+				Kind:    strings.TrimSpace(v.Kind),
+			},
+			PodSpecPaths: v.PodSpecPaths,
+			ImagePaths:   v.ImagePaths,
+			SkipNames:    sanitizeStringList(v.SkipNames),
+		})
+	}
+	return out
+}
+
+// resolveUpcomingVersions converts upcoming version rules from the config file.
+func resolveUpcomingVersions(values []config.UpcomingVersionRule) []mirror.UpcomingVersionRule {
+	if len(values) == 0 {
+		return nil
+	}
+	out := make([]mirror.UpcomingVersionRule, 0, len(values))
+	for _, v := range values {
+		out = append(out, mirror.UpcomingVersionRule{
+			Registry:   v.Registry,
+			Image:      v.Image,
+			Next:       v.Next,
+			Scope:      v.Scope,
+			Constraint: v.Constraint,
+		})
+	}
+	return out
+}
+
+// resolveRepositorySync converts repository sync declarations from the config file.
+func resolveRepositorySync(values []config.RepositorySync) []mirror.RepositorySync {
+	if len(values) == 0 {
+		return nil
+	}
+	out := make([]mirror.RepositorySync, 0, len(values))
+	for _, v := range values {
+		interval := mirror.DefaultRepositorySyncInterval
+		if v.IntervalMinutes != nil {
+			interval = time.Duration(*v.IntervalMinutes) * time.Minute
+		}
+		out = append(out, mirror.RepositorySync{
+			Repository: v.Repository,
+			Include:    v.Include,
+			Exclude:    v.Exclude,
+			Interval:   interval,
+		})
+	}
+	return out
+}
+
+// resolveGarbageCollection converts the garbage collection settings from the config file. It
+// returns nil when garbage collection is disabled. A global dry run keeps it report-only.
+func resolveGarbageCollection(c config.GarbageCollection, dryRun bool) (*mirror.GarbageCollection, error) {
+	if !c.Enabled {
+		return nil, nil
+	}
+	gc := mirror.GarbageCollection{
+		Repositories:      sanitizeStringList(c.Repositories),
+		GracePeriod:       mirror.DefaultGCGracePeriod,
+		Interval:          mirror.DefaultGCInterval,
+		KeepLast:          c.KeepLast,
+		ProtectedTags:     sanitizeStringList(c.ProtectedTags),
+		ProtectedVersions: c.ProtectedVersions,
+		DryRun:            dryRun || c.DryRun == nil || *c.DryRun,
+	}
+	if c.GracePeriodHours != nil {
+		gc.GracePeriod = time.Duration(*c.GracePeriodHours) * time.Hour
+	}
+	if c.IntervalMinutes != nil {
+		gc.Interval = time.Duration(*c.IntervalMinutes) * time.Minute
+	}
+	if err := mirror.ValidateGarbageCollection(gc); err != nil {
+		return nil, err
+	}
+	return &gc, nil
+}
+
+// resolveDriftAudit returns the interval of periodic drift audits, zero when they are disabled.
+// DRIFT_AUDIT_MINUTES replaces the config file; 0 disables periodic audits.
+func resolveDriftAudit(minutesEnv string, c config.DriftAudit) (time.Duration, error) {
+	if trimmed := strings.TrimSpace(minutesEnv); trimmed != "" {
+		minutes, err := strconv.Atoi(trimmed)
+		if err != nil {
+			return 0, fmt.Errorf("parse DRIFT_AUDIT_MINUTES: %w", err)
+		}
+		if minutes < 0 {
+			return 0, fmt.Errorf("DRIFT_AUDIT_MINUTES must not be negative")
+		}
+		return durationFromMinutes(minutes), nil
+	}
+	if !c.Enabled {
+		return 0, nil
+	}
+	if c.IntervalMinutes == nil {
+		return mirror.DefaultDriftAuditInterval, nil
+	}
+	if *c.IntervalMinutes <= 0 {
+		return 0, fmt.Errorf("intervalMinutes must be greater than zero")
+	}
+	return time.Duration(*c.IntervalMinutes) * time.Minute, nil
+}
+
+// resolveStateStore converts the state store settings from the config file. It returns nil when
+// state is kept in memory only.
+func resolveStateStore(c config.StateStore) (*stateStoreConfig, error) {
+	storeType := strings.ToLower(strings.TrimSpace(c.Type))
+	if storeType == "" {
+		return nil, nil
+	}
+	s := stateStoreConfig{
+		Type:          storeType,
+		TTL:           mirror.DefaultStateTTL,
+		FlushInterval: mirror.DefaultStateFlushInterval,
+	}
+	if c.TTLHours != nil {
+		if *c.TTLHours <= 0 {
+			return nil, fmt.Errorf("ttlHours must be positive")
+		}
+		s.TTL = time.Duration(*c.TTLHours) * time.Hour
+	}
+	if c.FlushSeconds != nil {
+		if *c.FlushSeconds <= 0 {
+			return nil, fmt.Errorf("flushSeconds must be positive")
+		}
+		s.FlushInterval = time.Duration(*c.FlushSeconds) * time.Second
+	}
+	switch storeType {
+	case stateStoreConfigMap:
+		s.Name = strings.TrimSpace(c.Name)
+		if s.Name == "" {
+			s.Name = defaultStateConfigMapName
+		}
+		s.Namespace = strings.TrimSpace(c.Namespace)
+		if s.Namespace == "" {
+			s.Namespace = podNamespace()
+		}
+		if s.Namespace == "" {
+			return nil, fmt.Errorf("namespace is required when not running in a Pod")
+		}
+	case stateStoreFile:
+		s.Path = strings.TrimSpace(c.Path)
+		if s.Path == "" {
+			return nil, fmt.Errorf("path is required for the file state store")
+		}
+	default:
+		return nil, fmt.Errorf("unknown type %q (expected %s or %s)", c.Type, stateStoreConfigMap, stateStoreFile)
+	}
+	return &s, nil
+}
+
+// resolveLayerCache returns the layer cache directory and size limit, with LAYER_CACHE_PATH and
+// LAYER_CACHE_MAX_SIZE_GB taking precedence over the config file. An empty path disables the cache.
+func resolveLayerCache(pathEnv, sizeEnv string, c config.LayerCache) (string, int64, error) {
+	path := strings.TrimSpace(pathEnv)
+	if path == "" {
+		path = strings.TrimSpace(c.Path)
+	}
+	if path == "" {
+		return "", 0, nil
+	}
+	maxBytes := mirror.DefaultLayerCacheMaxBytes
+	if trimmed := strings.TrimSpace(sizeEnv); trimmed != "" {
+		gb, err := strconv.Atoi(trimmed)
+		if err != nil {
+			return "", 0, fmt.Errorf("parse LAYER_CACHE_MAX_SIZE_GB: %w", err)
+		}
+		if gb <= 0 {
+			return "", 0, fmt.Errorf("LAYER_CACHE_MAX_SIZE_GB must be greater than zero")
+		}
+		maxBytes = int64(gb) << 30
+	} else if c.MaxSizeGB != nil {
+		if *c.MaxSizeGB <= 0 {
+			return "", 0, fmt.Errorf("maxSizeGB must be greater than zero")
+		}
+		maxBytes = int64(*c.MaxSizeGB) << 30
+	}
+	return path, maxBytes, nil
+}
+
+// resolveBandwidthLimits converts the bandwidth limits of the config file. BANDWIDTH_PULL_LIMIT and
+// BANDWIDTH_PUSH_LIMIT replace the global limits.
+func resolveBandwidthLimits(pullEnv, pushEnv string, c config.BandwidthLimits) (mirror.BandwidthLimits, error) {
+	if trimmed := strings.TrimSpace(pullEnv); trimmed != "" {
+		c.Pull = trimmed
+	}
+	if trimmed := strings.TrimSpace(pushEnv); trimmed != "" {
+		c.Push = trimmed
+	}
+	var limits mirror.BandwidthLimits
+	var err error
+	if limits.Default, err = parseBandwidthLimit(c.Pull, c.Push); err != nil {
+		return mirror.BandwidthLimits{}, err
+	}
+	if limits.Registries, err = parseRegistryBandwidth(c.Registries); err != nil {
+		return mirror.BandwidthLimits{}, err
+	}
+	for i, w := range c.Schedule {
+		var window mirror.BandwidthWindow
+		if window.Start, err = parseTimeOfDay(w.Start); err != nil {
+			return mirror.BandwidthLimits{}, fmt.Errorf("schedule[%d] start: %w", i, err)
+		}
+		if window.End, err = parseTimeOfDay(w.End); err != nil {
+			return mirror.BandwidthLimits{}, fmt.Errorf("schedule[%d] end: %w", i, err)
+		}
+		if window.Default, err = parseBandwidthLimit(w.Pull, w.Push); err != nil {
+			return mirror.BandwidthLimits{}, fmt.Errorf("schedule[%d]: %w", i, err)
+		}
+		if window.Registries, err = parseRegistryBandwidth(w.Registries); err != nil {
+			return mirror.BandwidthLimits{}, fmt.Errorf("schedule[%d]: %w", i, err)
+		}
+		limits.Schedule = append(limits.Schedule, window)
+	}
+	if err := mirror.ValidateBandwidthLimits(limits); err != nil {
+		return mirror.BandwidthLimits{}, err
+	}
+	return limits, nil
+}
+
+// resolveTracing returns the OTLP exporter configuration. The standard OTEL_EXPORTER_OTLP_*
+// variables and OTEL_TRACES_SAMPLER_ARG take precedence over the config file.
+func resolveTracing(endpointEnv, protocolEnv, insecureEnv, sampleEnv string, c config.Tracing) (tracing.Config, error) {
+	cfg := tracing.Config{
+		Endpoint:    strings.TrimSpace(c.Endpoint),
+		Protocol:    strings.ToLower(strings.TrimSpace(c.Protocol)),
+		SampleRatio: 1,
+	}
+	if trimmed := strings.TrimSpace(endpointEnv); trimmed != "" {
+		cfg.Endpoint = trimmed
+	}
+	if trimmed := strings.TrimSpace(protocolEnv); trimmed != "" {
+		cfg.Protocol = strings.ToLower(trimmed)
+	}
+	if cfg.Protocol == "" {
+		cfg.Protocol = tracing.ProtocolGRPC
+	}
+	if insecure, ok, err := resolveOptionalBoolEnv(insecureEnv); err != nil {
+		return tracing.Config{}, fmt.Errorf("parse OTEL_EXPORTER_OTLP_INSECURE: %w", err)
+	} else if ok {
+		cfg.Insecure = insecure
+	} else if c.Insecure != nil {
+		cfg.Insecure = *c.Insecure
+	}
+	if trimmed := strings.TrimSpace(sampleEnv); trimmed != "" {
+		ratio, err := strconv.ParseFloat(trimmed, 64)
+		if err != nil {
+			return tracing.Config{}, fmt.Errorf("parse OTEL_TRACES_SAMPLER_ARG: %w", err)
+		}
+		cfg.SampleRatio = ratio
+	} else if c.SampleRatio != nil {
+		cfg.SampleRatio = *c.SampleRatio
+	}
+	if err := cfg.Validate(); err != nil {
+		return tracing.Config{}, err
+	}
+	return cfg, nil
+}
+
+// resolveAdminAuth returns how the admin endpoints are authenticated. A token set through
+// ADMIN_TOKEN takes precedence over a token file.
+func resolveAdminAuth(modeEnv, tokenEnv, tokenFileEnv string, c config.AdminAuth) (adminAuthConfig, error) {
+	cfg := adminAuthConfig{
+		Mode:      strings.ToLower(strings.TrimSpace(c.Mode)),
+		TokenFile: strings.TrimSpace(c.TokenFile),
+	}
+	if trimmed := strings.TrimSpace(modeEnv); trimmed != "" {
+		cfg.Mode = strings.ToLower(trimmed)
+	}
+	if trimmed := strings.TrimSpace(tokenFileEnv); trimmed != "" {
+		cfg.TokenFile = trimmed
+	}
+	if trimmed := strings.TrimSpace(tokenEnv); trimmed != "" {
+		cfg.Token = trimmed
+		cfg.TokenFile = ""
+	}
+	switch cfg.Mode {
+	case "":
+		cfg.Mode = adminAuthNone
+	case adminAuthNone, adminAuthKubernetes:
+	case adminAuthToken:
+		if cfg.Token == "" && cfg.TokenFile == "" {
+			return adminAuthConfig{}, fmt.Errorf("token mode requires ADMIN_TOKEN or a token file")
+		}
+	default:
+		return adminAuthConfig{}, fmt.Errorf("unsupported mode %q, use %q, %q or %q", cfg.Mode, adminAuthNone, adminAuthToken, adminAuthKubernetes)
+	}
+	return cfg, nil
+}
+
+// firstEnv returns the first of the environment variables that is set.
+func firstEnv(keys ...string) string {
+	for _, key := range keys {
+		if value := strings.TrimSpace(os.Getenv(key)); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+func parseRegistryBandwidth(entries []config.RegistryBandwidth) (map[string]mirror.BandwidthLimit, error) {
+	if len(entries) == 0 {
+		return nil, nil
+	}
+	out := make(map[string]mirror.BandwidthLimit, len(entries))
+	for _, entry := range entries {
+		registry := strings.TrimSpace(entry.Registry)
+		if registry == "" {
+			return nil, fmt.Errorf("registry is required for registry bandwidth limits")
+		}
+		limit, err := parseBandwidthLimit(entry.Pull, entry.Push)
+		if err != nil {
+			return nil, fmt.Errorf("registry %s: %w", registry, err)
+		}
+		out[registry] = limit
+	}
+	return out, nil
+}
+
+func parseBandwidthLimit(pull, push string) (mirror.BandwidthLimit, error) {
+	var limit mirror.BandwidthLimit
+	var err error
+	if limit.Pull, err = parseBytesPerSecond(pull); err != nil {
+		return mirror.BandwidthLimit{}, fmt.Errorf("pull: %w", err)
+	}
+	if limit.Push, err = parseBytesPerSecond(push); err != nil {
+		return mirror.BandwidthLimit{}, fmt.Errorf("push: %w", err)
+	}
+	return limit, nil
+}
+
+// parseBytesPerSecond parses a quantity such as "20Mi" or "500k" as bytes per second.
+func parseBytesPerSecond(value string) (int64, error) {
+	trimmed := strings.TrimSpace(value)
+	if trimmed == "" {
+		return 0, nil
+	}
+	q, err := resource.ParseQuantity(trimmed)
+	if err != nil {
+		return 0, fmt.Errorf("parse %q: %w", trimmed, err)
+	}
+	return q.Value(), nil
+}
+
+// parseTimeOfDay parses HH:MM into an offset from midnight.
+func parseTimeOfDay(value string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(value))
+	if err != nil {
+		return 0, fmt.Errorf("expected HH:MM, got %q", value)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// podNamespace returns the namespace copycat runs in, from POD_NAMESPACE or the mounted service
+// account.
+func podNamespace() string {
+	if ns := strings.TrimSpace(os.Getenv("POD_NAMESPACE")); ns != "" {
+		return ns
+	}
+	if b, err := os.ReadFile(serviceAccountNamespaceFile); err == nil {
+		return strings.TrimSpace(string(b))
+	}
+	return ""
+}
+
 func resolveList(envVal string, configValues []string) []string {
 	if trimmed := strings.TrimSpace(envVal); trimmed != "" {
 		return sanitizeStringList(strings.Split(trimmed, ","))
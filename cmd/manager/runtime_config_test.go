@@ -9,6 +9,8 @@ import (
 	"github.com/google/go-containerregistry/pkg/authn"
 
 	"github.com/matzegebbe/k8s-copycat/internal/config"
+	"github.com/matzegebbe/k8s-copycat/internal/mirror"
+	"github.com/matzegebbe/k8s-copycat/internal/tracing"
 )
 
 func TestResolveAllowedNamespaces(t *testing.T) {
@@ -198,3 +200,282 @@ func (f fakeResource) String() string {
 func (f fakeResource) RegistryStr() string {
 	return f.registry
 }
+
+func TestLoadRuntimeConfigCustomResources(t *testing.T) {
+	t.Setenv("TARGET_KIND", "")
+	t.Setenv("TARGET_REGISTRY", "")
+
+	fileCfg := config.Config{
+		TargetKind: "docker",
+		Docker:     config.Docker{Registry: "example.com"},
+		CustomResources: []config.CustomResource{{
+			Group:        "argoproj.io",
+			Version:      "v1alpha1",
+			Kind:         "Rollout",
+			PodSpecPaths: []string{".spec.template.spec"},
+		}},
+	}
+	cfg, err := loadRuntimeConfig(context.Background(), false, false, fileCfg, true)
+	if err != nil {
+		t.Fatalf("unexpected config error: %v", err)
+	}
+	if len(cfg.CustomResources) != 1 || cfg.CustomResources[0].GroupVersionKind.Kind != "Rollout" {
+		t.Fatalf("unexpected custom resources: %+v", cfg.CustomResources)
+	}
+
+	fileCfg.CustomResources[0].PodSpecPaths = nil
+	if _, err := loadRuntimeConfig(context.Background(), false, false, fileCfg, true); err == nil {
+		t.Fatalf("expected custom resource without paths to be rejected")
+	}
+}
+
+func TestLoadRuntimeConfigRepositorySync(t *testing.T) {
+	t.Setenv("TARGET_KIND", "")
+	t.Setenv("TARGET_REGISTRY", "")
+
+	daily := 1440
+	fileCfg := config.Config{
+		TargetKind: "docker",
+		Docker:     config.Docker{Registry: "example.com"},
+		RepositorySync: []config.RepositorySync{
+			{Repository: "library/alpine", Include: `^3\.`},
+			{Repository: "ghcr.io/acme/operator", IntervalMinutes: &daily},
+		},
+	}
+	cfg, err := loadRuntimeConfig(context.Background(), false, false, fileCfg, true)
+	if err != nil {
+		t.Fatalf("unexpected config error: %v", err)
+	}
+	if len(cfg.RepositorySync) != 2 {
+		t.Fatalf("unexpected repository sync: %+v", cfg.RepositorySync)
+	}
+	if cfg.RepositorySync[0].Interval != mirror.DefaultRepositorySyncInterval || cfg.RepositorySync[1].Interval != 24*time.Hour {
+		t.Fatalf("unexpected repository sync intervals: %+v", cfg.RepositorySync)
+	}
+
+	fileCfg.RepositorySync[0].Exclude = "("
+	if _, err := loadRuntimeConfig(context.Background(), false, false, fileCfg, true); err == nil {
+		t.Fatalf("expected invalid exclude expression to be rejected")
+	}
+}
+
+func TestLoadRuntimeConfigGarbageCollection(t *testing.T) {
+	t.Setenv("TARGET_KIND", "")
+	t.Setenv("TARGET_REGISTRY", "")
+	t.Setenv("DRY_RUN", "")
+
+	fileCfg := config.Config{
+		TargetKind: "docker",
+		Docker:     config.Docker{Registry: "example.com"},
+	}
+	cfg, err := loadRuntimeConfig(context.Background(), false, false, fileCfg, true)
+	if err != nil {
+		t.Fatalf("unexpected config error: %v", err)
+	}
+	if cfg.GarbageCollection != nil {
+		t.Fatalf("expected garbage collection to be disabled by default")
+	}
+
+	grace := 24
+	fileCfg.GarbageCollection = config.GarbageCollection{
+		Enabled:          true,
+		Repositories:     []string{"mirrors/*"},
+		GracePeriodHours: &grace,
+		KeepLast:         2,
+	}
+	cfg, err = loadRuntimeConfig(context.Background(), false, false, fileCfg, true)
+	if err != nil {
+		t.Fatalf("unexpected config error: %v", err)
+	}
+	gc := cfg.GarbageCollection
+	if gc == nil || !gc.DryRun || gc.GracePeriod != 24*time.Hour || gc.Interval != mirror.DefaultGCInterval || gc.KeepLast != 2 {
+		t.Fatalf("unexpected garbage collection config: %+v", gc)
+	}
+
+	disabled := false
+	fileCfg.GarbageCollection.DryRun = &disabled
+	cfg, err = loadRuntimeConfig(context.Background(), true, false, fileCfg, true)
+	if err != nil {
+		t.Fatalf("unexpected config error: %v", err)
+	}
+	if !cfg.GarbageCollection.DryRun {
+		t.Fatalf("expected global dry run to keep garbage collection report-only")
+	}
+
+	fileCfg.GarbageCollection.Repositories = nil
+	if _, err := loadRuntimeConfig(context.Background(), false, false, fileCfg, true); err == nil {
+		t.Fatalf("expected garbage collection without repositories to be rejected")
+	}
+}
+
+func TestResolveStateStore(t *testing.T) {
+	t.Setenv("POD_NAMESPACE", "copycat")
+
+	if s, err := resolveStateStore(config.StateStore{}); err != nil || s != nil {
+		t.Fatalf("expected in-memory state by default, got %+v (%v)", s, err)
+	}
+
+	s, err := resolveStateStore(config.StateStore{Type: "ConfigMap"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if s.Type != stateStoreConfigMap || s.Namespace != "copycat" || s.Name != defaultStateConfigMapName || s.TTL != mirror.DefaultStateTTL {
+		t.Fatalf("unexpected configmap state store: %+v", s)
+	}
+
+	ttl := 6
+	s, err = resolveStateStore(config.StateStore{Type: "file", Path: "/data/state.json", TTLHours: &ttl})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if s.Path != "/data/state.json" || s.TTL != 6*time.Hour {
+		t.Fatalf("unexpected file state store: %+v", s)
+	}
+
+	if _, err := resolveStateStore(config.StateStore{Type: "file"}); err == nil {
+		t.Fatalf("expected file state store without path to be rejected")
+	}
+	if _, err := resolveStateStore(config.StateStore{Type: "bolt"}); err == nil {
+		t.Fatalf("expected unknown state store type to be rejected")
+	}
+}
+
+func TestResolveLayerCache(t *testing.T) {
+	if path, _, err := resolveLayerCache("", "", config.LayerCache{}); err != nil || path != "" {
+		t.Fatalf("expected layer cache to be disabled by default, got %q (%v)", path, err)
+	}
+
+	size := 50
+	path, maxBytes, err := resolveLayerCache("", "", config.LayerCache{Path: "/cache", MaxSizeGB: &size})
+	if err != nil || path != "/cache" || maxBytes != 50<<30 {
+		t.Fatalf("unexpected layer cache from config: %q %d (%v)", path, maxBytes, err)
+	}
+
+	path, maxBytes, err = resolveLayerCache("/env-cache", "2", config.LayerCache{Path: "/cache", MaxSizeGB: &size})
+	if err != nil || path != "/env-cache" || maxBytes != 2<<30 {
+		t.Fatalf("expected env vars to take precedence, got %q %d (%v)", path, maxBytes, err)
+	}
+
+	if _, _, err := resolveLayerCache("/cache", "0", config.LayerCache{}); err == nil {
+		t.Fatalf("expected non-positive size to be rejected")
+	}
+}
+
+func TestResolveDriftAudit(t *testing.T) {
+	if interval, err := resolveDriftAudit("", config.DriftAudit{}); err != nil || interval != 0 {
+		t.Fatalf("expected periodic audits to be disabled by default, got %v (%v)", interval, err)
+	}
+	if interval, err := resolveDriftAudit("", config.DriftAudit{Enabled: true}); err != nil || interval != mirror.DefaultDriftAuditInterval {
+		t.Fatalf("expected the default interval, got %v (%v)", interval, err)
+	}
+	minutes := 30
+	if interval, err := resolveDriftAudit("", config.DriftAudit{Enabled: true, IntervalMinutes: &minutes}); err != nil || interval != 30*time.Minute {
+		t.Fatalf("unexpected interval from config: %v (%v)", interval, err)
+	}
+	if interval, err := resolveDriftAudit("0", config.DriftAudit{Enabled: true, IntervalMinutes: &minutes}); err != nil || interval != 0 {
+		t.Fatalf("expected DRIFT_AUDIT_MINUTES=0 to disable periodic audits, got %v (%v)", interval, err)
+	}
+	if interval, err := resolveDriftAudit("90", config.DriftAudit{}); err != nil || interval != 90*time.Minute {
+		t.Fatalf("expected env var to enable periodic audits, got %v (%v)", interval, err)
+	}
+	minutes = 0
+	if _, err := resolveDriftAudit("", config.DriftAudit{Enabled: true, IntervalMinutes: &minutes}); err == nil {
+		t.Fatalf("expected non-positive interval to be rejected")
+	}
+	if _, err := resolveDriftAudit("soon", config.DriftAudit{}); err == nil {
+		t.Fatalf("expected invalid env var to be rejected")
+	}
+}
+
+func TestResolveBandwidthLimits(t *testing.T) {
+	limits, err := resolveBandwidthLimits("", "", config.BandwidthLimits{})
+	if err != nil || limits.Enabled() {
+		t.Fatalf("expected no limits by default, got %+v (%v)", limits, err)
+	}
+
+	limits, err = resolveBandwidthLimits("40Mi", "", config.BandwidthLimits{
+		Pull:       "20Mi",
+		Push:       "10M",
+		Registries: []config.RegistryBandwidth{{Registry: "docker.io", Pull: "5Mi"}},
+		Schedule:   []config.BandwidthWindow{{Start: "22:00", End: "06:30", Pull: "200Mi"}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if limits.Default.Pull != 40<<20 || limits.Default.Push != 10_000_000 {
+		t.Fatalf("unexpected global limits: %+v", limits.Default)
+	}
+	if limits.Registries["docker.io"].Pull != 5<<20 {
+		t.Fatalf("unexpected registry limits: %+v", limits.Registries)
+	}
+	if len(limits.Schedule) != 1 || limits.Schedule[0].Start != 22*time.Hour || limits.Schedule[0].End != 6*time.Hour+30*time.Minute || limits.Schedule[0].Default.Pull != 200<<20 {
+		t.Fatalf("unexpected schedule: %+v", limits.Schedule)
+	}
+
+	for _, invalid := range []config.BandwidthLimits{
+		{Pull: "fast"},
+		{Push: "-1Mi"},
+		{Registries: []config.RegistryBandwidth{{Pull: "1Mi"}}},
+		{Schedule: []config.BandwidthWindow{{Start: "25:00", End: "06:00", Pull: "1Mi"}}},
+	} {
+		if _, err := resolveBandwidthLimits("", "", invalid); err == nil {
+			t.Fatalf("expected %+v to be rejected", invalid)
+		}
+	}
+}
+
+func TestResolveTracing(t *testing.T) {
+	cfg, err := resolveTracing("", "", "", "", config.Tracing{})
+	if err != nil || cfg.Enabled() {
+		t.Fatalf("expected tracing to be disabled by default, got %+v (%v)", cfg, err)
+	}
+
+	insecure := true
+	ratio := 0.25
+	cfg, err = resolveTracing("", "", "", "", config.Tracing{Endpoint: "otel-collector:4317", Insecure: &insecure, SampleRatio: &ratio})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Endpoint != "otel-collector:4317" || cfg.Protocol != tracing.ProtocolGRPC || !cfg.Insecure || cfg.SampleRatio != 0.25 {
+		t.Fatalf("unexpected tracing config from file: %+v", cfg)
+	}
+
+	cfg, err = resolveTracing("http://collector:4318", "http/protobuf", "false", "1", config.Tracing{Endpoint: "otel-collector:4317", Insecure: &insecure, SampleRatio: &ratio})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Endpoint != "http://collector:4318" || cfg.Protocol != tracing.ProtocolHTTP || cfg.Insecure || cfg.SampleRatio != 1 {
+		t.Fatalf("expected env vars to take precedence, got %+v", cfg)
+	}
+
+	if _, err := resolveTracing("collector:4317", "zipkin", "", "", config.Tracing{}); err == nil {
+		t.Fatalf("expected unsupported protocol to be rejected")
+	}
+	if _, err := resolveTracing("collector:4317", "", "", "1.5", config.Tracing{}); err == nil {
+		t.Fatalf("expected sample ratio above 1 to be rejected")
+	}
+}
+
+func TestResolveAdminAuth(t *testing.T) {
+	cfg, err := resolveAdminAuth("", "", "", config.AdminAuth{})
+	if err != nil || cfg.Mode != adminAuthNone {
+		t.Fatalf("expected admin auth to be disabled by default, got %+v (%v)", cfg, err)
+	}
+
+	cfg, err = resolveAdminAuth("", "", "", config.AdminAuth{Mode: "Token", TokenFile: "/var/run/secrets/copycat/token"})
+	if err != nil || cfg.Mode != adminAuthToken || cfg.TokenFile != "/var/run/secrets/copycat/token" {
+		t.Fatalf("unexpected admin auth from file: %+v (%v)", cfg, err)
+	}
+
+	cfg, err = resolveAdminAuth("token", "s3cret", "", config.AdminAuth{Mode: "kubernetes", TokenFile: "/var/run/secrets/copycat/token"})
+	if err != nil || cfg.Mode != adminAuthToken || cfg.Token != "s3cret" || cfg.TokenFile != "" {
+		t.Fatalf("expected env vars to take precedence, got %+v (%v)", cfg, err)
+	}
+
+	if _, err := resolveAdminAuth("token", "", "", config.AdminAuth{}); err == nil {
+		t.Fatalf("expected token mode without a token to be rejected")
+	}
+	if _, err := resolveAdminAuth("basic", "", "", config.AdminAuth{}); err == nil {
+		t.Fatalf("expected unsupported mode to be rejected")
+	}
+}
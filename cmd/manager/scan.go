@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+
+	"github.com/matzegebbe/k8s-copycat/internal/controllers"
+	"github.com/matzegebbe/k8s-copycat/internal/mirror"
+)
+
+// manifestExtensions are the files read when scan walks a directory.
+var manifestExtensions = map[string]struct{}{".yaml": {}, ".yml": {}, ".json": {}}
+
+// scanResult is an image referenced by the scanned manifests, once per target.
+type scanResult struct {
+	Image        string   `json:"image"`
+	Namespace    string   `json:"namespace"`
+	Target       string   `json:"target,omitempty"`
+	Status       string   `json:"status"`
+	TargetDigest string   `json:"targetDigest,omitempty"`
+	Error        string   `json:"error,omitempty"`
+	Workloads    []string `json:"workloads"`
+}
+
+// skippedWorkload is a workload copycat would not mirror in a cluster.
+type skippedWorkload struct {
+	Workload  string `json:"workload"`
+	File      string `json:"file,omitempty"`
+	SkippedBy string `json:"skippedBy"`
+}
+
+type scanReport struct {
+	Images  []scanResult      `json:"images"`
+	Skipped []skippedWorkload `json:"skipped,omitempty"`
+}
+
+// runScanCommand reads Kubernetes manifests, such as the output of helm template or kustomize
+// build, and verifies that the images of their workloads are mirrored, or mirrors them with
+// --mirror. It fails when any image is missing, differs from its source or fails to mirror.
+func runScanCommand(args []string, stdout, stderr io.Writer) int {
+	c := newCommand("scan", "scan [flags] <file|directory|->...", stderr)
+	c.flags.Lookup("namespace").Usage = "namespace of manifests that do not set one (default \"default\")"
+	mirrorImages := c.flags.Bool("mirror", false, "mirror missing images instead of reporting them")
+	c.flags.BoolVar(&c.dryRun, "dry-run", false, "with --mirror, simulate image push without actually pushing")
+	c.flags.BoolVar(&c.dryPull, "dry-pull", false, "with --mirror, simulate image pull without contacting the source registry")
+	paths, err := c.parseArgs(args)
+	if err != nil {
+		return c.usageError(err)
+	}
+	if len(paths) == 0 {
+		return c.usageError(errors.New("at least one file, directory or - for stdin is required"))
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	cfg, pusher, err := c.pusher(ctx)
+	if err != nil {
+		return c.fail(err)
+	}
+	inspector, ok := pusher.(mirror.Inspector)
+	if !ok {
+		return c.fail(errors.New("the pusher cannot verify images"))
+	}
+	scanner, err := controllers.NewManifestScanner(cfg.AllowedNS, cfg.SkipCfg, cfg.Selectors, cfg.WatchResources, cfg.CustomResources, c.namespace)
+	if err != nil {
+		return c.fail(fmt.Errorf("custom resources: %w", err))
+	}
+	workloads, err := scanManifests(scanner, paths, os.Stdin)
+	if err != nil {
+		return c.fail(err)
+	}
+
+	var report scanReport
+	type pending struct {
+		index int
+		meta  mirror.Metadata
+	}
+	var queue []pending
+	seen := make(map[string]int)
+	platforms := c.meta().Platforms
+	// Manifests carry no Pod digest, so tags are mirrored by tag even with digest pull.
+	digestPull := false
+	for _, w := range workloads {
+		workload := fmt.Sprintf("%s %s/%s", w.Kind, w.Namespace, w.Name)
+		if w.Skipped != "" {
+			report.Skipped = append(report.Skipped, skippedWorkload{Workload: workload, File: w.File, SkippedBy: w.Skipped})
+			continue
+		}
+		for _, img := range w.Images {
+			meta := mirror.Metadata{Namespace: w.Namespace, PodName: w.Name, ContainerName: img.ContainerName, Platforms: platforms, DigestPull: &digestPull}
+			res, err := inspector.Resolve(img.Image, meta)
+			if err != nil {
+				return c.fail(fmt.Errorf("%s in %s: %w", img.Image, workload, err))
+			}
+			key := img.Image + "\x00" + res.Target
+			if i, ok := seen[key]; ok {
+				if !slices.Contains(report.Images[i].Workloads, workload) {
+					report.Images[i].Workloads = append(report.Images[i].Workloads, workload)
+				}
+				continue
+			}
+			seen[key] = len(report.Images)
+			queue = append(queue, pending{index: len(report.Images), meta: meta})
+			report.Images = append(report.Images, scanResult{Image: img.Image, Namespace: w.Namespace, Target: res.Target, Workloads: []string{workload}})
+		}
+	}
+
+	inventory, _ := pusher.(mirror.ImageInventory)
+	code := exitOK
+	for _, p := range queue {
+		result := &report.Images[p.index]
+		if *mirrorImages {
+			result.Status = jobSucceeded
+			if err := pusher.Mirror(ctx, result.Image, p.meta); err != nil {
+				result.Status, result.Error = jobFailed, err.Error()
+				code = exitFailed
+				continue
+			}
+			if inventory != nil {
+				if record, ok := inventory.ImageFor(result.Image, p.meta); ok {
+					result.Status, result.TargetDigest = orDash(record.Status), record.TargetDigest
+				}
+			}
+			continue
+		}
+		v, err := inspector.Verify(ctx, result.Image, p.meta)
+		result.Status, result.TargetDigest = v.Status, v.TargetDigest
+		if err != nil {
+			result.Status, result.Error = "error", err.Error()
+		}
+		switch result.Status {
+		case mirror.VerifyMatch, mirror.VerifyPlatformSubset, mirror.VerifyExcluded:
+		default:
+			code = exitFailed
+		}
+	}
+
+	if c.output == outputJSON {
+		if report.Images == nil {
+			report.Images = []scanResult{}
+		}
+		return c.writeJSON(stdout, report, code)
+	}
+	w := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "IMAGE\tSTATUS\tTARGET\tWORKLOADS")
+	for _, r := range report.Images {
+		target := r.Target
+		if r.Error != "" {
+			target = r.Error
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", r.Image, r.Status, orDash(target), strings.Join(r.Workloads, ", "))
+	}
+	if len(report.Skipped) > 0 {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "SKIPPED WORKLOAD\tSKIPPED BY\tFILE")
+		for _, s := range report.Skipped {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", s.Workload, s.SkippedBy, orDash(s.File))
+		}
+	}
+	return c.flush(w, code)
+}
+
+// scanManifests scans the files, the manifest files below directories and stdin for "-".
+func scanManifests(scanner *controllers.ManifestScanner, paths []string, stdin io.Reader) ([]controllers.ManifestWorkload, error) {
+	var out []controllers.ManifestWorkload
+	scanFile := func(path string) error {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		workloads, err := scanner.Scan(f, path)
+		out = append(out, workloads...)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		return nil
+	}
+	for _, path := range paths {
+		if path == "-" {
+			workloads, err := scanner.Scan(stdin, "-")
+			out = append(out, workloads...)
+			if err != nil {
+				return nil, fmt.Errorf("stdin: %w", err)
+			}
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			if err := scanFile(path); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		err = filepath.WalkDir(path, func(file string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			if _, ok := manifestExtensions[strings.ToLower(filepath.Ext(file))]; !ok {
+				return nil
+			}
+			return scanFile(file)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
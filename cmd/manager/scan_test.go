@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+func TestRunScanCommand(t *testing.T) {
+	server := httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+	t.Cleanup(server.Close)
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatalf("random image: %v", err)
+	}
+	source := host + "/upstream/app:1.0"
+	ref, err := name.ParseReference(source)
+	if err != nil {
+		t.Fatalf("parse source: %v", err)
+	}
+	if err := remote.Write(ref, img); err != nil {
+		t.Fatalf("push source image: %v", err)
+	}
+	path := writeCommandConfig(t, "targetKind: docker\ndocker:\n  registry: "+host+"\n  repoPrefix: $namespace\n  insecure: true\nskipNamespaces: [legacy]\ndigestPull: true\n")
+	t.Setenv("DIGEST_PULL", "")
+
+	dir := t.TempDir()
+	manifests := `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: api
+spec:
+  template:
+    spec:
+      containers:
+        - name: api
+          image: ` + source + `
+---
+apiVersion: batch/v1
+kind: Job
+metadata:
+  name: migrate
+spec:
+  template:
+    spec:
+      containers:
+        - name: migrate
+          image: ` + source + `
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: old
+  namespace: legacy
+spec:
+  template:
+    spec:
+      containers:
+        - name: old
+          image: ` + host + `/upstream/old:0.1
+`
+	if err := os.WriteFile(filepath.Join(dir, "rendered.yaml"), []byte(manifests), 0o600); err != nil {
+		t.Fatalf("write manifests: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "README.md"), []byte("not a manifest"), 0o600); err != nil {
+		t.Fatalf("write readme: %v", err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	if code := runScanCommand([]string{"--config", path, "--namespace", "shop", dir}, &stdout, &stderr); code != exitFailed {
+		t.Fatalf("expected scan to fail before mirroring, got %d: %s", code, stderr.String())
+	}
+	for _, want := range []string{"missing", host + "/shop/upstream/app:1.0", "Deployment shop/api, Job shop/migrate", "Deployment legacy/old", "skipNamespaces"} {
+		if !strings.Contains(stdout.String(), want) {
+			t.Fatalf("expected output to contain %q, got:\n%s", want, stdout.String())
+		}
+	}
+
+	stdout.Reset()
+	if code := runScanCommand([]string{"--mirror", "--config", path, "--namespace", "shop", dir}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("expected mirror to succeed, got %d: %s\n%s", code, stderr.String(), stdout.String())
+	}
+
+	stdout.Reset()
+	if code := runScanCommand([]string{"-o", "json", "--config", path, "--namespace", "shop", filepath.Join(dir, "rendered.yaml")}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("expected scan to succeed after mirroring, got %d: %s\n%s", code, stderr.String(), stdout.String())
+	}
+	var report scanReport
+	if err := json.Unmarshal(stdout.Bytes(), &report); err != nil {
+		t.Fatalf("decode output: %v", err)
+	}
+	digest, err := img.Digest()
+	if err != nil {
+		t.Fatalf("digest: %v", err)
+	}
+	want := scanReport{
+		Images: []scanResult{{
+			Image:        source,
+			Namespace:    "shop",
+			Target:       host + "/shop/upstream/app:1.0",
+			Status:       "match",
+			TargetDigest: digest.String(),
+			Workloads:    []string{"Deployment shop/api", "Job shop/migrate"},
+		}},
+		Skipped: []skippedWorkload{{Workload: "Deployment legacy/old", File: filepath.Join(dir, "rendered.yaml"), SkippedBy: "skipNamespaces"}},
+	}
+	if !reflect.DeepEqual(report, want) {
+		t.Fatalf("unexpected report:\n got %+v\nwant %+v", report, want)
+	}
+
+	if code := runScanCommand([]string{"--config", path}, io.Discard, io.Discard); code != exitUsage {
+		t.Fatalf("expected usage error without manifests, got %d", code)
+	}
+	if code := runScanCommand([]string{"--config", path, filepath.Join(dir, "missing.yaml")}, io.Discard, io.Discard); code != exitFailed {
+		t.Fatalf("expected failure for a missing file, got %d", code)
+	}
+}
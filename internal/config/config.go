@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"sigs.k8s.io/yaml"
 
 	"github.com/matzegebbe/k8s-copycat/pkg/util"
@@ -43,31 +44,45 @@ type RegistryCredential struct {
 }
 
 type Config struct {
-	TargetKind                  string               `yaml:"targetKind"` // ecr | docker
-	LogLevel                    string               `yaml:"logLevel"`
-	ECR                         ECR                  `yaml:"ecr"`
-	Docker                      Docker               `yaml:"docker"`
-	DigestPull                  bool                 `yaml:"digestPull"`
-	DigestPullIgnoredTags       []string             `yaml:"digestPullIgnoredTags"`
-	IgnoreMissingPlatforms      []string             `yaml:"ignoreMissingPlatforms"`
-	CheckNodePlatform           bool                 `yaml:"checkNodePlatform"`
-	MirrorPlatforms             []string             `yaml:"mirrorPlatforms"`
-	AllowDifferentDigestRepush  *bool                `yaml:"allowDifferentDigestRepush"`
-	IncludeNamespaces           []string             `yaml:"includeNamespaces"`
-	SkipNamespaces              []string             `yaml:"skipNamespaces"`
-	SkipNames                   ResourceSkipNames    `yaml:"skipNames"`
-	ExcludeRegistries           []string             `yaml:"excludeRegistries"`
-	WatchResources              []string             `yaml:"watchResources"`
-	DryRun                      bool                 `yaml:"dryRun"`
-	DryPull                     bool                 `yaml:"dryPull"`
-	RequestTimeoutSeconds       *int                 `yaml:"requestTimeout"`
-	RegistryRetryAttempts       *int                 `yaml:"registryRetryAttempts"`
-	RegistryRetryBackoffSeconds *int                 `yaml:"registryRetryBackoff"`
-	FailureCooldownMinutes      *int                 `yaml:"failureCooldownMinutes"`
-	ForceReconcileMinutes       *int                 `yaml:"forceReconcileMinutes"`
-	MaxConcurrentReconciles     *int                 `yaml:"maxConcurrentReconciles"`
-	RegistryCredentials         []RegistryCredential `yaml:"registryCredentials"`
-	PathMap                     []util.PathMapping   `yaml:"pathMap"`
+	TargetKind                  string                `yaml:"targetKind"` // ecr | docker
+	LogLevel                    string                `yaml:"logLevel"`
+	ECR                         ECR                   `yaml:"ecr"`
+	Docker                      Docker                `yaml:"docker"`
+	DigestPull                  bool                  `yaml:"digestPull"`
+	DigestPullIgnoredTags       []string              `yaml:"digestPullIgnoredTags"`
+	IgnoreMissingPlatforms      []string              `yaml:"ignoreMissingPlatforms"`
+	CheckNodePlatform           bool                  `yaml:"checkNodePlatform"`
+	MirrorPlatforms             []string              `yaml:"mirrorPlatforms"`
+	AllowDifferentDigestRepush  *bool                 `yaml:"allowDifferentDigestRepush"`
+	IncludeNamespaces           []string              `yaml:"includeNamespaces"`
+	SkipNamespaces              []string              `yaml:"skipNamespaces"`
+	NamespaceSelector           *metav1.LabelSelector `yaml:"namespaceSelector"`
+	WorkloadSelector            *metav1.LabelSelector `yaml:"workloadSelector"`
+	SkipNames                   ResourceSkipNames     `yaml:"skipNames"`
+	ExcludeRegistries           []string              `yaml:"excludeRegistries"`
+	WatchResources              []string              `yaml:"watchResources"`
+	DryRun                      bool                  `yaml:"dryRun"`
+	DryPull                     bool                  `yaml:"dryPull"`
+	RequestTimeoutSeconds       *int                  `yaml:"requestTimeout"`
+	RegistryRetryAttempts       *int                  `yaml:"registryRetryAttempts"`
+	RegistryRetryBackoffSeconds *int                  `yaml:"registryRetryBackoff"`
+	FailureCooldownMinutes      *int                  `yaml:"failureCooldownMinutes"`
+	ForceReconcileMinutes       *int                  `yaml:"forceReconcileMinutes"`
+	MaxConcurrentReconciles     *int                  `yaml:"maxConcurrentReconciles"`
+	MirrorWorkers               *int                  `yaml:"mirrorWorkers"`
+	RegistryCredentials         []RegistryCredential  `yaml:"registryCredentials"`
+	PathMap                     []util.PathMapping    `yaml:"pathMap"`
+	CustomResources             []CustomResource      `yaml:"customResources"`
+	UpcomingVersions            []UpcomingVersionRule `yaml:"upcomingVersions"`
+	RepositorySync              []RepositorySync      `yaml:"repositorySync"`
+	StaticImages                []string              `yaml:"staticImages"`
+	GarbageCollection           GarbageCollection     `yaml:"garbageCollection"`
+	DriftAudit                  DriftAudit            `yaml:"driftAudit"`
+	StateStore                  StateStore            `yaml:"stateStore"`
+	LayerCache                  LayerCache            `yaml:"layerCache"`
+	BandwidthLimits             BandwidthLimits       `yaml:"bandwidthLimits"`
+	Tracing                     Tracing               `yaml:"tracing"`
+	AdminAuth                   AdminAuth             `yaml:"adminAuth"`
 }
 
 // ResourceSkipNames declares resource names that should be ignored by copycat.
@@ -78,6 +93,124 @@ type ResourceSkipNames struct {
 	Jobs         []string `yaml:"jobs"`
 	CronJobs     []string `yaml:"cronJobs"`
 	Pods         []string `yaml:"pods"`
+
+	ReplicaSets            []string `yaml:"replicaSets"`
+	ReplicationControllers []string `yaml:"replicationControllers"`
+	PodTemplates           []string `yaml:"podTemplates"`
+}
+
+// CustomResource declares an additional kind whose images are discovered through JSONPath
+// expressions. PodSpecPaths must yield pod specs, ImagePaths must yield image strings.
+type CustomResource struct {
+	Group        string   `yaml:"group"`
+	Version      string   `yaml:"version"`
+	Kind         string   `yaml:"kind"`
+	PodSpecPaths []string `yaml:"podSpecPaths"`
+	ImagePaths   []string `yaml:"imagePaths"`
+	SkipNames    []string `yaml:"skipNames"`
+}
+
+// UpcomingVersionRule pre-mirrors newer semver tags of matching images. Registry or Image
+// selects the images, Next and/or Constraint select the versions.
+type UpcomingVersionRule struct {
+	Registry   string `yaml:"registry"`
+	Image      string `yaml:"image"`
+	Next       int    `yaml:"next"`
+	Scope      string `yaml:"scope"`
+	Constraint string `yaml:"constraint"`
+}
+
+// RepositorySync mirrors every tag of Repository matching Include and not matching Exclude,
+// every IntervalMinutes (default 60, 0 syncs once at startup).
+type RepositorySync struct {
+	Repository      string `yaml:"repository"`
+	Include         string `yaml:"include"`
+	Exclude         string `yaml:"exclude"`
+	IntervalMinutes *int   `yaml:"intervalMinutes"`
+}
+
+// GarbageCollection removes mirrored images that no watched workload references any more.
+// DryRun defaults to true so that the first deployment only reports what would be removed.
+type GarbageCollection struct {
+	Enabled           bool     `yaml:"enabled"`
+	DryRun            *bool    `yaml:"dryRun"`
+	Repositories      []string `yaml:"repositories"`
+	GracePeriodHours  *int     `yaml:"gracePeriodHours"`
+	IntervalMinutes   *int     `yaml:"intervalMinutes"`
+	KeepLast          int      `yaml:"keepLast"`
+	ProtectedTags     []string `yaml:"protectedTags"`
+	ProtectedVersions string   `yaml:"protectedVersions"`
+}
+
+// DriftAudit periodically compares the images of watched workloads at their source and target
+// registries every IntervalMinutes (default 360). Audits run on demand through /audit regardless.
+type DriftAudit struct {
+	Enabled         bool `yaml:"enabled"`
+	IntervalMinutes *int `yaml:"intervalMinutes"`
+}
+
+// StateStore persists mirrored digests and failure cooldowns across restarts. Type is "configmap"
+// (default Name "k8s-copycat-state" in the Pod's namespace) or "file" (Path on a persistent
+// volume); an empty Type keeps state in memory only.
+type StateStore struct {
+	Type         string `yaml:"type"`
+	Namespace    string `yaml:"namespace"`
+	Name         string `yaml:"name"`
+	Path         string `yaml:"path"`
+	TTLHours     *int   `yaml:"ttlHours"`
+	FlushSeconds *int   `yaml:"flushSeconds"`
+}
+
+// LayerCache keeps layers pulled from source registries on a local volume so that they are
+// downloaded once for every target, retry and force reconcile. An empty Path disables the cache.
+type LayerCache struct {
+	Path      string `yaml:"path"`
+	MaxSizeGB *int   `yaml:"maxSizeGB"`
+}
+
+// BandwidthLimits caps source downloads (Pull) and target uploads (Push) in bytes per second,
+// written as Kubernetes quantities such as "20Mi". Empty or "0" leaves a direction unlimited.
+// Schedule windows ("22:00" to "06:00") replace the limits they set while they are active.
+type BandwidthLimits struct {
+	Pull       string              `yaml:"pull"`
+	Push       string              `yaml:"push"`
+	Registries []RegistryBandwidth `yaml:"registries"`
+	Schedule   []BandwidthWindow   `yaml:"schedule"`
+}
+
+// RegistryBandwidth caps the transfers of a single registry on top of the global limits.
+type RegistryBandwidth struct {
+	Registry string `yaml:"registry"`
+	Pull     string `yaml:"pull"`
+	Push     string `yaml:"push"`
+}
+
+// BandwidthWindow adjusts bandwidth limits between Start and End, given as HH:MM.
+type BandwidthWindow struct {
+	Start      string              `yaml:"start"`
+	End        string              `yaml:"end"`
+	Pull       string              `yaml:"pull"`
+	Push       string              `yaml:"push"`
+	Registries []RegistryBandwidth `yaml:"registries"`
+}
+
+// Tracing exports OpenTelemetry spans of reconciles and mirrors to an OTLP collector. An empty
+// Endpoint disables tracing. Protocol is "grpc" (default) or "http/protobuf"; SampleRatio keeps
+// that fraction of traces and defaults to 1.
+type Tracing struct {
+	Endpoint    string   `yaml:"endpoint"`
+	Protocol    string   `yaml:"protocol"`
+	Insecure    *bool    `yaml:"insecure"`
+	SampleRatio *float64 `yaml:"sampleRatio"`
+}
+
+// AdminAuth protects the admin endpoints of the metrics listener, such as /force-reconcile and
+// /reset-cooldown. Mode is "none" (default), "token" to require the bearer token stored in
+// TokenFile, or "kubernetes" to authenticate bearer tokens with a TokenReview and authorize them
+// with a SubjectAccessReview.
+type AdminAuth struct {
+	Mode      string `yaml:"mode"`
+	TokenFile string `yaml:"tokenFile"`
 }
 
 func Load(path string) (Config, bool, error) {
@@ -4,16 +4,23 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"path"
 	"strings"
 	"time"
 
+	"go.opentelemetry.io/otel/attribute"
 	appsv1 "k8s.io/api/apps/v1"
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
@@ -32,6 +39,17 @@ type SkipConfig struct {
 	Jobs         []string
 	CronJobs     []string
 	Pods         []string
+
+	ReplicaSets            []string
+	ReplicationControllers []string
+	PodTemplates           []string
+}
+
+// SelectorConfig restricts reconciliation to namespaces and workloads carrying matching labels.
+// A nil selector disables the corresponding filter.
+type SelectorConfig struct {
+	Namespaces labels.Selector
+	Workloads  labels.Selector
 }
 
 // ResourceType describes a Kubernetes resource that can be watched by copycat.
@@ -44,6 +62,10 @@ const (
 	ResourceJobs         ResourceType = "jobs"
 	ResourceCronJobs     ResourceType = "cronjobs"
 	ResourcePods         ResourceType = "pods"
+
+	ResourceReplicaSets            ResourceType = "replicasets"
+	ResourceReplicationControllers ResourceType = "replicationcontrollers"
+	ResourcePodTemplates           ResourceType = "podtemplates"
 )
 
 var supportedResourceTypes = map[string]ResourceType{
@@ -53,10 +75,16 @@ var supportedResourceTypes = map[string]ResourceType{
 	"jobs":         ResourceJobs,
 	"cronjobs":     ResourceCronJobs,
 	"pods":         ResourcePods,
+
+	"replicasets":            ResourceReplicaSets,
+	"replicationcontrollers": ResourceReplicationControllers,
+	"podtemplates":           ResourcePodTemplates,
 }
 
-// AllResourceTypes returns every supported resource type in deterministic order.
-func AllResourceTypes() []ResourceType {
+// DefaultResourceTypes returns the resource types watched when no watch list is configured.
+// ReplicaSets, ReplicationControllers and PodTemplates are opt-in because they need additional
+// RBAC permissions and ReplicaSets largely duplicate the templates of their Deployments.
+func DefaultResourceTypes() []ResourceType {
 	return []ResourceType{
 		ResourceDeployments,
 		ResourceStatefulSets,
@@ -91,106 +119,85 @@ func ParseWatchResources(values []string) ([]ResourceType, []string) {
 	return parsed, invalid
 }
 
-type nameMatcher struct {
-	matchAll   bool
-	any        map[string]struct{}
-	namespaced map[string]map[string]struct{}
-}
-
-func newNameMatcher(values []string) nameMatcher {
-	m := nameMatcher{}
-	for _, raw := range values {
-		name := strings.TrimSpace(raw)
-		if name == "" {
-			continue
-		}
-		if name == "*" {
-			m.matchAll = true
-			continue
-		}
-		if strings.Contains(name, "/") {
-			parts := strings.SplitN(name, "/", 2)
-			ns := strings.TrimSpace(parts[0])
-			val := strings.TrimSpace(parts[1])
-			if ns == "" || val == "" {
-				continue
-			}
-			if m.namespaced == nil {
-				m.namespaced = make(map[string]map[string]struct{})
-			}
-			nsSet := m.namespaced[ns]
-			if nsSet == nil {
-				nsSet = make(map[string]struct{})
-				m.namespaced[ns] = nsSet
-			}
-			nsSet[val] = struct{}{}
-			continue
-		}
-		if m.any == nil {
-			m.any = make(map[string]struct{})
-		}
-		m.any[name] = struct{}{}
-	}
-	return m
-}
-
-func (m nameMatcher) matches(namespace, name string) bool {
-	if m.matchAll {
-		return true
-	}
-	if len(m.any) > 0 {
-		if _, ok := m.any[name]; ok {
-			return true
-		}
-	}
-	if len(m.namespaced) > 0 {
-		if nsSet, ok := m.namespaced[namespace]; ok {
-			if _, ok := nsSet[name]; ok {
-				return true
-			}
-		}
-	}
-	return false
-}
-
 type baseReconciler struct {
 	client.Client
 	Scheme            *runtime.Scheme
 	Pusher            mirror.Pusher
 	CheckNodePlatform bool
+	// waitForMirror makes reconcilers wait for the result even when Pusher queues images.
+	waitForMirror     bool
 	AllowedNamespaces []string // "*" or explicit list
-	SkippedNamespaces map[string]struct{}
+	SkippedNamespaces patternSet
+	NamespaceSelector labels.Selector
+	WorkloadSelector  labels.Selector
 	SkipDeployments   nameMatcher
 	SkipStatefulSets  nameMatcher
 	SkipDaemonSets    nameMatcher
 	SkipJobs          nameMatcher
 	SkipCronJobs      nameMatcher
 	SkipPods          nameMatcher
+
+	SkipReplicaSets            nameMatcher
+	SkipReplicationControllers nameMatcher
+	SkipPodTemplates           nameMatcher
 }
 
 type ForceReconciler struct {
 	baseReconciler
-	watch []ResourceType
+	watch  []ResourceType
+	custom []*customExtractor
 }
 
 func (r *ForceReconciler) ForceReconcile(ctx context.Context) (int, int, error) {
-	watch := r.watch
-	if len(watch) == 0 {
-		watch = AllResourceTypes()
+	return r.reconcileAll(ctx, "")
+}
+
+// ReconcileNamespace mirrors the images of every watched workload in a single namespace.
+func (r *ForceReconciler) ReconcileNamespace(ctx context.Context, namespace string) (int, int, error) {
+	return r.reconcileAll(ctx, namespace)
+}
+
+func (r *ForceReconciler) reconcileAll(ctx context.Context, namespace string) (int, int, error) {
+	ctx, span := startForceReconcileSpan(ctx, namespace)
+	workloads, images, err := r.reconcileWatched(ctx, namespace)
+	span.SetAttributes(attribute.Int("copycat.workloads", workloads), attribute.Int("copycat.images", images))
+	endReconcileSpan(span, ctrl.Result{}, err)
+	return workloads, images, err
+}
+
+// watchedResources returns the resource types a force reconcile lists.
+func (r *ForceReconciler) watchedResources() []ResourceType {
+	if len(r.watch) == 0 {
+		return DefaultResourceTypes()
 	}
+	return r.watch
+}
+
+func (r *ForceReconciler) reconcileWatched(ctx context.Context, namespace string) (int, int, error) {
+	var listOpts []client.ListOption
+	if namespace != "" {
+		listOpts = append(listOpts, client.InNamespace(namespace))
+	}
+	scope := forceScopeFrom(ctx)
 	workloads := 0
 	images := 0
 	var errs []error
-	for _, res := range watch {
+	for _, res := range r.watchedResources() {
+		if !scope.resourceSelected(string(res)) {
+			continue
+		}
 		switch res {
 		case ResourceDeployments:
 			var list appsv1.DeploymentList
-			if err := r.List(ctx, &list); err != nil {
+			if err := r.List(ctx, &list, listOpts...); err != nil {
 				return workloads, images, err
 			}
 			for i := range list.Items {
+				if err := ctx.Err(); err != nil {
+					return workloads, images, err
+				}
 				d := &list.Items[i]
-				if !r.nsAllowed(d.Namespace) || r.SkipDeployments.matches(d.Namespace, d.Name) {
+				if !r.nsAllowed(ctx, d.Namespace) || !r.workloadSelected(d) || r.SkipDeployments.matches(d.Namespace, d.Name) {
 					continue
 				}
 				mirrored, err := r.mirrorPodSpec(ctx, d.Namespace, d.Name, &d.Spec.Template.Spec)
@@ -198,18 +205,23 @@ func (r *ForceReconciler) ForceReconcile(ctx context.Context) (int, int, error)
 				if err != nil {
 					errs = append(errs, fmt.Errorf("deployment %s/%s: %w", d.Namespace, d.Name, err))
 					workloads++
+					scope.report(workloads, images)
 					continue
 				}
 				workloads++
+				scope.report(workloads, images)
 			}
 		case ResourceStatefulSets:
 			var list appsv1.StatefulSetList
-			if err := r.List(ctx, &list); err != nil {
+			if err := r.List(ctx, &list, listOpts...); err != nil {
 				return workloads, images, err
 			}
 			for i := range list.Items {
+				if err := ctx.Err(); err != nil {
+					return workloads, images, err
+				}
 				s := &list.Items[i]
-				if !r.nsAllowed(s.Namespace) || r.SkipStatefulSets.matches(s.Namespace, s.Name) {
+				if !r.nsAllowed(ctx, s.Namespace) || !r.workloadSelected(s) || r.SkipStatefulSets.matches(s.Namespace, s.Name) {
 					continue
 				}
 				mirrored, err := r.mirrorPodSpec(ctx, s.Namespace, s.Name, &s.Spec.Template.Spec)
@@ -217,18 +229,23 @@ func (r *ForceReconciler) ForceReconcile(ctx context.Context) (int, int, error)
 				if err != nil {
 					errs = append(errs, fmt.Errorf("statefulset %s/%s: %w", s.Namespace, s.Name, err))
 					workloads++
+					scope.report(workloads, images)
 					continue
 				}
 				workloads++
+				scope.report(workloads, images)
 			}
 		case ResourceDaemonSets:
 			var list appsv1.DaemonSetList
-			if err := r.List(ctx, &list); err != nil {
+			if err := r.List(ctx, &list, listOpts...); err != nil {
 				return workloads, images, err
 			}
 			for i := range list.Items {
+				if err := ctx.Err(); err != nil {
+					return workloads, images, err
+				}
 				ds := &list.Items[i]
-				if !r.nsAllowed(ds.Namespace) || r.SkipDaemonSets.matches(ds.Namespace, ds.Name) {
+				if !r.nsAllowed(ctx, ds.Namespace) || !r.workloadSelected(ds) || r.SkipDaemonSets.matches(ds.Namespace, ds.Name) {
 					continue
 				}
 				mirrored, err := r.mirrorPodSpec(ctx, ds.Namespace, ds.Name, &ds.Spec.Template.Spec)
@@ -236,18 +253,23 @@ func (r *ForceReconciler) ForceReconcile(ctx context.Context) (int, int, error)
 				if err != nil {
 					errs = append(errs, fmt.Errorf("daemonset %s/%s: %w", ds.Namespace, ds.Name, err))
 					workloads++
+					scope.report(workloads, images)
 					continue
 				}
 				workloads++
+				scope.report(workloads, images)
 			}
 		case ResourceJobs:
 			var list batchv1.JobList
-			if err := r.List(ctx, &list); err != nil {
+			if err := r.List(ctx, &list, listOpts...); err != nil {
 				return workloads, images, err
 			}
 			for i := range list.Items {
+				if err := ctx.Err(); err != nil {
+					return workloads, images, err
+				}
 				j := &list.Items[i]
-				if !r.nsAllowed(j.Namespace) || r.SkipJobs.matches(j.Namespace, j.Name) {
+				if !r.nsAllowed(ctx, j.Namespace) || !r.workloadSelected(j) || r.SkipJobs.matches(j.Namespace, j.Name) {
 					continue
 				}
 				mirrored, err := r.mirrorPodSpec(ctx, j.Namespace, j.Name, &j.Spec.Template.Spec)
@@ -255,18 +277,23 @@ func (r *ForceReconciler) ForceReconcile(ctx context.Context) (int, int, error)
 				if err != nil {
 					errs = append(errs, fmt.Errorf("job %s/%s: %w", j.Namespace, j.Name, err))
 					workloads++
+					scope.report(workloads, images)
 					continue
 				}
 				workloads++
+				scope.report(workloads, images)
 			}
 		case ResourceCronJobs:
 			var list batchv1.CronJobList
-			if err := r.List(ctx, &list); err != nil {
+			if err := r.List(ctx, &list, listOpts...); err != nil {
 				return workloads, images, err
 			}
 			for i := range list.Items {
+				if err := ctx.Err(); err != nil {
+					return workloads, images, err
+				}
 				cj := &list.Items[i]
-				if !r.nsAllowed(cj.Namespace) || r.SkipCronJobs.matches(cj.Namespace, cj.Name) {
+				if !r.nsAllowed(ctx, cj.Namespace) || !r.workloadSelected(cj) || r.SkipCronJobs.matches(cj.Namespace, cj.Name) {
 					continue
 				}
 				mirrored, err := r.mirrorPodSpec(ctx, cj.Namespace, cj.Name, &cj.Spec.JobTemplate.Spec.Template.Spec)
@@ -274,18 +301,95 @@ func (r *ForceReconciler) ForceReconcile(ctx context.Context) (int, int, error)
 				if err != nil {
 					errs = append(errs, fmt.Errorf("cronjob %s/%s: %w", cj.Namespace, cj.Name, err))
 					workloads++
+					scope.report(workloads, images)
+					continue
+				}
+				workloads++
+				scope.report(workloads, images)
+			}
+		case ResourceReplicaSets:
+			var list appsv1.ReplicaSetList
+			if err := r.List(ctx, &list, listOpts...); err != nil {
+				return workloads, images, err
+			}
+			for i := range list.Items {
+				if err := ctx.Err(); err != nil {
+					return workloads, images, err
+				}
+				rs := &list.Items[i]
+				if !r.nsAllowed(ctx, rs.Namespace) || !r.workloadSelected(rs) || r.replicaSetSkipped(rs) {
+					continue
+				}
+				mirrored, err := r.mirrorPodSpec(ctx, rs.Namespace, rs.Name, &rs.Spec.Template.Spec)
+				images += mirrored
+				if err != nil {
+					errs = append(errs, fmt.Errorf("replicaset %s/%s: %w", rs.Namespace, rs.Name, err))
+					workloads++
+					scope.report(workloads, images)
 					continue
 				}
 				workloads++
+				scope.report(workloads, images)
+			}
+		case ResourceReplicationControllers:
+			var list corev1.ReplicationControllerList
+			if err := r.List(ctx, &list, listOpts...); err != nil {
+				return workloads, images, err
+			}
+			for i := range list.Items {
+				if err := ctx.Err(); err != nil {
+					return workloads, images, err
+				}
+				rc := &list.Items[i]
+				if !r.nsAllowed(ctx, rc.Namespace) || !r.workloadSelected(rc) || r.SkipReplicationControllers.matches(rc.Namespace, rc.Name) || rc.Spec.Template == nil {
+					continue
+				}
+				mirrored, err := r.mirrorPodSpec(ctx, rc.Namespace, rc.Name, &rc.Spec.Template.Spec)
+				images += mirrored
+				if err != nil {
+					errs = append(errs, fmt.Errorf("replicationcontroller %s/%s: %w", rc.Namespace, rc.Name, err))
+					workloads++
+					scope.report(workloads, images)
+					continue
+				}
+				workloads++
+				scope.report(workloads, images)
+			}
+		case ResourcePodTemplates:
+			var list corev1.PodTemplateList
+			if err := r.List(ctx, &list, listOpts...); err != nil {
+				return workloads, images, err
+			}
+			for i := range list.Items {
+				if err := ctx.Err(); err != nil {
+					return workloads, images, err
+				}
+				pt := &list.Items[i]
+				if !r.nsAllowed(ctx, pt.Namespace) || !r.workloadSelected(pt) || r.SkipPodTemplates.matches(pt.Namespace, pt.Name) {
+					continue
+				}
+				mirrored, err := r.mirrorPodSpec(ctx, pt.Namespace, pt.Name, &pt.Template.Spec)
+				images += mirrored
+				if err != nil {
+					errs = append(errs, fmt.Errorf("podtemplate %s/%s: %w", pt.Namespace, pt.Name, err))
+					workloads++
+					scope.report(workloads, images)
+					continue
+				}
+				workloads++
+				scope.report(workloads, images)
 			}
 		case ResourcePods:
 			var list corev1.PodList
-			if err := r.List(ctx, &list); err != nil {
+			if err := r.List(ctx, &list, listOpts...); err != nil {
 				return workloads, images, err
 			}
 			for i := range list.Items {
+				if err := ctx.Err(); err != nil {
+					return workloads, images, err
+				}
 				p := &list.Items[i]
-				if !r.nsAllowed(p.Namespace) {
+				if !r.nsAllowed(ctx, p.Namespace) || !r.workloadSelected(p) {
 					continue
 				}
 				skip, err := r.shouldSkipPod(ctx, p)
@@ -307,22 +411,58 @@ func (r *ForceReconciler) ForceReconcile(ctx context.Context) (int, int, error)
 				if err != nil {
 					errs = append(errs, fmt.Errorf("pod %s/%s: %w", p.Namespace, p.Name, err))
 					workloads++
+					scope.report(workloads, images)
 					continue
 				}
 				workloads++
+				scope.report(workloads, images)
 			}
 		}
 	}
+	for _, ext := range r.custom {
+		if !scope.resourceSelected(strings.ToLower(ext.gvk.Kind)) {
+			continue
+		}
+		processed, mirrored, customErrs, err := r.reconcileCustom(ctx, ext, listOpts)
+		workloads += processed
+		images += mirrored
+		if err != nil {
+			return workloads, images, err
+		}
+		errs = append(errs, customErrs...)
+		scope.report(workloads, images)
+	}
 	if len(errs) > 0 {
-		return workloads, images, errors.Join(errs...)
+		return workloads, images, &MirrorErrors{Errs: errs}
 	}
 	return workloads, images, nil
 }
 
-func (r *baseReconciler) nsAllowed(ns string) bool {
-	if r.namespaceSkipped(ns) {
+// MirrorErrors is returned by a force reconcile that listed every workload but could not mirror
+// some of their images.
+type MirrorErrors struct {
+	Errs []error
+}
+
+func (e *MirrorErrors) Error() string {
+	return errors.Join(e.Errs...).Error()
+}
+
+func (e *MirrorErrors) Unwrap() []error {
+	return e.Errs
+}
+
+func (r *baseReconciler) nsAllowed(ctx context.Context, ns string) bool {
+	if r.namespaceSkipped(ns) || !forceScopeFrom(ctx).namespaceSelected(ns) {
+		return false
+	}
+	if !r.namespaceListed(ns) {
 		return false
 	}
+	return r.namespaceSelected(ctx, ns)
+}
+
+func (r *baseReconciler) namespaceListed(ns string) bool {
 	if len(r.AllowedNamespaces) == 0 {
 		return true
 	}
@@ -330,23 +470,60 @@ func (r *baseReconciler) nsAllowed(ns string) bool {
 		return true
 	}
 	for _, n := range r.AllowedNamespaces {
-		if strings.TrimSpace(n) == ns {
+		pattern := strings.TrimSpace(n)
+		if pattern == ns {
 			return true
 		}
+		if hasWildcard(pattern) {
+			if ok, err := path.Match(pattern, ns); err == nil && ok {
+				return true
+			}
+		}
 	}
 	return false
 }
 
-func (r *baseReconciler) namespaceSkipped(ns string) bool {
-	if len(r.SkippedNamespaces) == 0 {
+// namespaceSelected reports whether the namespace labels match the configured namespace selector.
+func (r *baseReconciler) namespaceSelected(ctx context.Context, ns string) bool {
+	if r.NamespaceSelector == nil || r.NamespaceSelector.Empty() {
+		return true
+	}
+	var namespace corev1.Namespace
+	if err := r.Get(ctx, types.NamespacedName{Name: ns}, &namespace); err != nil {
+		if !apierrors.IsNotFound(err) {
+			ctrl.LoggerFrom(ctx).Error(err, "unable to evaluate namespace selector", "namespace", ns)
+		}
 		return false
 	}
-	_, ok := r.SkippedNamespaces[ns]
-	return ok
+	return r.NamespaceSelector.Matches(labels.Set(namespace.Labels))
+}
+
+// ignoreDeleted ignores err if the reconciled object was deleted, and lets the pusher forget the
+// images the object referenced.
+func (r *baseReconciler) ignoreDeleted(req ctrl.Request, err error) error {
+	if !apierrors.IsNotFound(err) {
+		return err
+	}
+	if f, ok := r.Pusher.(mirror.WorkloadForgetter); ok {
+		f.ForgetWorkload(req.Namespace, req.Name)
+	}
+	return nil
+}
+
+// workloadSelected reports whether the object labels match the configured workload selector.
+func (r *baseReconciler) workloadSelected(obj metav1.Object) bool {
+	if r.WorkloadSelector == nil || r.WorkloadSelector.Empty() {
+		return true
+	}
+	return r.WorkloadSelector.Matches(labels.Set(obj.GetLabels()))
+}
+
+func (r *baseReconciler) namespaceSkipped(ns string) bool {
+	return r.SkippedNamespaces.matches(ns)
 }
 
 func (r *baseReconciler) mirrorPodSpec(ctx context.Context, ns, podName string, spec *corev1.PodSpec) (int, error) {
-	if !r.nsAllowed(ns) {
+	if !r.nsAllowed(ctx, ns) {
 		return 0, nil
 	}
 	images := util.ImagesFromPodSpec(spec)
@@ -362,6 +539,11 @@ func (r *baseReconciler) mirrorPodImages(ctx context.Context, ns, podName string
 	mirrored := 0
 	var firstErr error
 	var retryErr *mirror.RetryError
+	// Queue images instead of blocking the reconcile worker on pulls and pushes; the queue
+	// retries images whose mirror failed once their cooldown expires.
+	queue, async := r.Pusher.(mirror.AsyncPusher)
+	async = async && !r.waitForMirror
+	scope := forceScopeFrom(ctx)
 	for _, img := range images {
 		meta := mirror.Metadata{
 			Namespace:     ns,
@@ -371,8 +553,21 @@ func (r *baseReconciler) mirrorPodImages(ctx context.Context, ns, podName string
 			Architecture:  arch,
 			OS:            os,
 		}
+		if !scope.imageSelected(img.Image, meta) {
+			continue
+		}
+		if scope != nil && scope.collect != nil {
+			scope.collect(img.Image, meta)
+			mirrored++
+			continue
+		}
+		if async {
+			queue.Enqueue(ctx, img.Image, meta, ns+"/"+podName)
+			mirrored++
+			continue
+		}
 		if err := r.Pusher.Mirror(ctx, img.Image, meta); err != nil {
-			log.Error(err, "unable to mirror image", "image", img.Image, "container", img.ContainerName)
+			log.Error(err, "unable to mirror image", "image", img.Image, "container", img.ContainerName, "pullPolicy", img.PullPolicy)
 			if firstErr == nil {
 				firstErr = err
 			}
@@ -393,7 +588,7 @@ func (r *baseReconciler) mirrorPodImages(ctx context.Context, ns, podName string
 }
 
 func (r *baseReconciler) processPodSpec(ctx context.Context, ns, podName string, spec *corev1.PodSpec) (ctrl.Result, error) {
-	if !r.nsAllowed(ns) {
+	if !r.nsAllowed(ctx, ns) {
 		return ctrl.Result{}, nil
 	}
 	_, err := r.mirrorPodSpec(ctx, ns, podName, spec)
@@ -413,22 +608,32 @@ func mirrorResultForError(err error) (ctrl.Result, error) {
 	return ctrl.Result{}, err
 }
 
-type workloadFetcher func(context.Context, client.Client, types.NamespacedName) (string, string, *corev1.PodSpec, error)
+type workloadFetcher func(context.Context, client.Client, types.NamespacedName) (client.Object, *corev1.PodSpec, error)
 
-func (r *baseReconciler) reconcileWorkload(ctx context.Context, req ctrl.Request, skip nameMatcher, kind string, fetch workloadFetcher) (ctrl.Result, error) {
-	if !r.nsAllowed(req.Namespace) {
+func (r *baseReconciler) reconcileWorkload(ctx context.Context, req ctrl.Request, skip nameMatcher, kind string, fetch workloadFetcher) (res ctrl.Result, err error) {
+	if !r.nsAllowed(ctx, req.Namespace) {
 		return ctrl.Result{}, nil
 	}
 	if skip.matches(req.Namespace, req.Name) {
 		return ctrl.Result{}, nil
 	}
+	ctx, span := startReconcileSpan(ctx, kind, req)
+	defer func() { endReconcileSpan(span, res, err) }()
 	log := ctrl.LoggerFrom(ctx)
 	log.V(1).Info("saw "+kind, "name", req.Name, "namespace", req.Namespace)
-	ns, name, spec, err := fetch(ctx, r.Client, req.NamespacedName)
+	obj, spec, err := fetch(ctx, r.Client, req.NamespacedName)
 	if err != nil {
-		return ctrl.Result{}, client.IgnoreNotFound(err)
+		return ctrl.Result{}, r.ignoreDeleted(req, err)
+	}
+	if !r.workloadSelected(obj) {
+		log.V(1).Info("skipping "+kind+" not matching workload selector", "name", req.Name, "namespace", req.Namespace)
+		return ctrl.Result{}, nil
 	}
-	return r.processPodSpec(ctx, ns, name, spec)
+	if spec == nil {
+		log.V(1).Info("skipping "+kind+" without pod template", "name", req.Name, "namespace", req.Namespace)
+		return ctrl.Result{}, nil
+	}
+	return r.processPodSpec(ctx, obj.GetNamespace(), obj.GetName(), spec)
 }
 
 func setupWorkloadController(mgr ctrl.Manager, r reconcile.Reconciler, obj client.Object, maxConcurrent int) error {
@@ -439,44 +644,63 @@ func setupWorkloadController(mgr ctrl.Manager, r reconcile.Reconciler, obj clien
 		Complete(r)
 }
 
-func fetchDeploymentSpec(ctx context.Context, c client.Client, key types.NamespacedName) (string, string, *corev1.PodSpec, error) {
+func fetchDeploymentSpec(ctx context.Context, c client.Client, key types.NamespacedName) (client.Object, *corev1.PodSpec, error) {
 	var d appsv1.Deployment
 	if err := c.Get(ctx, key, &d); err != nil {
-		return "", "", nil, err
+		return nil, nil, err
 	}
-	return d.Namespace, d.Name, &d.Spec.Template.Spec, nil
+	return &d, &d.Spec.Template.Spec, nil
 }
 
-func fetchStatefulSetSpec(ctx context.Context, c client.Client, key types.NamespacedName) (string, string, *corev1.PodSpec, error) {
+func fetchStatefulSetSpec(ctx context.Context, c client.Client, key types.NamespacedName) (client.Object, *corev1.PodSpec, error) {
 	var s appsv1.StatefulSet
 	if err := c.Get(ctx, key, &s); err != nil {
-		return "", "", nil, err
+		return nil, nil, err
 	}
-	return s.Namespace, s.Name, &s.Spec.Template.Spec, nil
+	return &s, &s.Spec.Template.Spec, nil
 }
 
-func fetchDaemonSetSpec(ctx context.Context, c client.Client, key types.NamespacedName) (string, string, *corev1.PodSpec, error) {
+func fetchDaemonSetSpec(ctx context.Context, c client.Client, key types.NamespacedName) (client.Object, *corev1.PodSpec, error) {
 	var ds appsv1.DaemonSet
 	if err := c.Get(ctx, key, &ds); err != nil {
-		return "", "", nil, err
+		return nil, nil, err
 	}
-	return ds.Namespace, ds.Name, &ds.Spec.Template.Spec, nil
+	return &ds, &ds.Spec.Template.Spec, nil
 }
 
-func fetchJobSpec(ctx context.Context, c client.Client, key types.NamespacedName) (string, string, *corev1.PodSpec, error) {
+func fetchJobSpec(ctx context.Context, c client.Client, key types.NamespacedName) (client.Object, *corev1.PodSpec, error) {
 	var j batchv1.Job
 	if err := c.Get(ctx, key, &j); err != nil {
-		return "", "", nil, err
+		return nil, nil, err
 	}
-	return j.Namespace, j.Name, &j.Spec.Template.Spec, nil
+	return &j, &j.Spec.Template.Spec, nil
 }
 
-func fetchCronJobSpec(ctx context.Context, c client.Client, key types.NamespacedName) (string, string, *corev1.PodSpec, error) {
+func fetchCronJobSpec(ctx context.Context, c client.Client, key types.NamespacedName) (client.Object, *corev1.PodSpec, error) {
 	var cj batchv1.CronJob
 	if err := c.Get(ctx, key, &cj); err != nil {
-		return "", "", nil, err
+		return nil, nil, err
+	}
+	return &cj, &cj.Spec.JobTemplate.Spec.Template.Spec, nil
+}
+
+func fetchReplicationControllerSpec(ctx context.Context, c client.Client, key types.NamespacedName) (client.Object, *corev1.PodSpec, error) {
+	var rc corev1.ReplicationController
+	if err := c.Get(ctx, key, &rc); err != nil {
+		return nil, nil, err
 	}
-	return cj.Namespace, cj.Name, &cj.Spec.JobTemplate.Spec.Template.Spec, nil
+	if rc.Spec.Template == nil {
+		return &rc, nil, nil
+	}
+	return &rc, &rc.Spec.Template.Spec, nil
+}
+
+func fetchPodTemplateSpec(ctx context.Context, c client.Client, key types.NamespacedName) (client.Object, *corev1.PodSpec, error) {
+	var pt corev1.PodTemplate
+	if err := c.Get(ctx, key, &pt); err != nil {
+		return nil, nil, err
+	}
+	return &pt, &pt.Template.Spec, nil
 }
 
 type DeploymentReconciler struct{ baseReconciler }
@@ -526,20 +750,77 @@ func (r *CronJobReconciler) SetupWithManager(mgr ctrl.Manager, maxConcurrent int
 	return setupWorkloadController(mgr, r, &batchv1.CronJob{}, maxConcurrent)
 }
 
+// ReplicaSetReconciler mirrors the templates of current and old ReplicaSets. Old revisions kept
+// by a Deployment's revisionHistoryLimit reference exactly the images a rollback needs.
+type ReplicaSetReconciler struct{ baseReconciler }
+
+func (r *ReplicaSetReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	return r.reconcileWorkload(ctx, req, r.SkipReplicaSets, "ReplicaSet", r.fetchReplicaSetSpec)
+}
+
+// fetchReplicaSetSpec omits the pod template when the owning Deployment is skipped, so skipping
+// a Deployment also skips its revision history.
+func (r *ReplicaSetReconciler) fetchReplicaSetSpec(ctx context.Context, c client.Client, key types.NamespacedName) (client.Object, *corev1.PodSpec, error) {
+	var rs appsv1.ReplicaSet
+	if err := c.Get(ctx, key, &rs); err != nil {
+		return nil, nil, err
+	}
+	if r.replicaSetSkipped(&rs) {
+		return &rs, nil, nil
+	}
+	return &rs, &rs.Spec.Template.Spec, nil
+}
+
+func (r *ReplicaSetReconciler) SetupWithManager(mgr ctrl.Manager, maxConcurrent int) error {
+	return setupWorkloadController(mgr, r, &appsv1.ReplicaSet{}, maxConcurrent)
+}
+
+type ReplicationControllerReconciler struct{ baseReconciler }
+
+func (r *ReplicationControllerReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	return r.reconcileWorkload(ctx, req, r.SkipReplicationControllers, "ReplicationController", fetchReplicationControllerSpec)
+}
+
+func (r *ReplicationControllerReconciler) SetupWithManager(mgr ctrl.Manager, maxConcurrent int) error {
+	return setupWorkloadController(mgr, r, &corev1.ReplicationController{}, maxConcurrent)
+}
+
+// PodTemplateReconciler mirrors standalone PodTemplate objects. PodTemplates have no generation,
+// so every update is reconciled.
+type PodTemplateReconciler struct{ baseReconciler }
+
+func (r *PodTemplateReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	return r.reconcileWorkload(ctx, req, r.SkipPodTemplates, "PodTemplate", fetchPodTemplateSpec)
+}
+
+func (r *PodTemplateReconciler) SetupWithManager(mgr ctrl.Manager, maxConcurrent int) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&corev1.PodTemplate{}).
+		WithOptions(controller.Options{MaxConcurrentReconciles: maxConcurrent}).
+		WithEventFilter(predicate.ResourceVersionChangedPredicate{}).
+		Complete(r)
+}
+
 type PodReconciler struct{ baseReconciler }
 
-func (r *PodReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
-	if !r.nsAllowed(req.Namespace) {
+func (r *PodReconciler) Reconcile(ctx context.Context, req ctrl.Request) (res ctrl.Result, err error) {
+	if !r.nsAllowed(ctx, req.Namespace) {
 		return ctrl.Result{}, nil
 	}
 	if r.SkipPods.matches(req.Namespace, req.Name) {
 		return ctrl.Result{}, nil
 	}
+	ctx, span := startReconcileSpan(ctx, "Pod", req)
+	defer func() { endReconcileSpan(span, res, err) }()
 	log := ctrl.LoggerFrom(ctx)
 	log.V(1).Info("saw Pod", "name", req.Name, "namespace", req.Namespace)
 	var p corev1.Pod
 	if err := r.Get(ctx, req.NamespacedName, &p); err != nil {
-		return ctrl.Result{}, client.IgnoreNotFound(err)
+		return ctrl.Result{}, r.ignoreDeleted(req, err)
+	}
+	if !r.workloadSelected(&p) {
+		log.V(1).Info("skipping Pod not matching workload selector", "name", req.Name, "namespace", req.Namespace)
+		return ctrl.Result{}, nil
 	}
 	if skip, err := r.shouldSkipPod(ctx, &p); err != nil {
 		return ctrl.Result{}, err
@@ -603,6 +884,10 @@ func (r *baseReconciler) shouldSkipPod(ctx context.Context, pod *corev1.Pod) (bo
 			if skip {
 				return true, nil
 			}
+		case "ReplicationController":
+			if r.SkipReplicationControllers.matches(pod.Namespace, owner.Name) {
+				return true, nil
+			}
 		case "Deployment":
 			if r.SkipDeployments.matches(pod.Namespace, owner.Name) {
 				return true, nil
@@ -629,6 +914,9 @@ func (r *baseReconciler) shouldSkipPod(ctx context.Context, pod *corev1.Pod) (bo
 }
 
 func (r *baseReconciler) shouldSkipReplicaSetOwner(ctx context.Context, namespace, name string) (bool, error) {
+	if r.SkipReplicaSets.matches(namespace, name) {
+		return true, nil
+	}
 	var rs appsv1.ReplicaSet
 	if err := r.Get(ctx, types.NamespacedName{Name: name, Namespace: namespace}, &rs); err != nil {
 		if apierrors.IsNotFound(err) {
@@ -636,12 +924,20 @@ func (r *baseReconciler) shouldSkipReplicaSetOwner(ctx context.Context, namespac
 		}
 		return false, err
 	}
+	return r.replicaSetSkipped(&rs), nil
+}
+
+// replicaSetSkipped reports whether the ReplicaSet or its owning Deployment is skipped.
+func (r *baseReconciler) replicaSetSkipped(rs *appsv1.ReplicaSet) bool {
+	if r.SkipReplicaSets.matches(rs.Namespace, rs.Name) {
+		return true
+	}
 	for _, owner := range rs.OwnerReferences {
-		if owner.Kind == "Deployment" && r.SkipDeployments.matches(namespace, owner.Name) {
-			return true, nil
+		if owner.Kind == "Deployment" && r.SkipDeployments.matches(rs.Namespace, owner.Name) {
+			return true
 		}
 	}
-	return false, nil
+	return false
 }
 
 func (r *baseReconciler) shouldSkipJobOwner(ctx context.Context, namespace, name string) (bool, error) {
@@ -663,34 +959,112 @@ func (r *baseReconciler) shouldSkipJobOwner(ctx context.Context, namespace, name
 	return false, nil
 }
 
-func SetupAll(mgr ctrl.Manager, pusher mirror.Pusher, allowedNS []string, skipCfg SkipConfig, watch []ResourceType, maxConcurrent int, checkNodePlatform bool) (*ForceReconciler, error) {
-	base := baseReconciler{
-		Client:            mgr.GetClient(),
-		Scheme:            mgr.GetScheme(),
-		Pusher:            pusher,
-		CheckNodePlatform: checkNodePlatform,
+// CacheByObject builds per-object cache options so informers only hold workloads and namespaces
+// matching the configured selectors. Custom resource kinds that mapper does not know are left
+// out, like setupCustomResources ignores them, because the cache rejects entries for kinds the
+// API server does not serve.
+func CacheByObject(watch []ResourceType, custom []CustomResource, selectors SelectorConfig, mapper apimeta.RESTMapper) (map[client.Object]cache.ByObject, error) {
+	byObject := make(map[client.Object]cache.ByObject)
+	if selectors.Namespaces != nil && !selectors.Namespaces.Empty() {
+		byObject[&corev1.Namespace{}] = cache.ByObject{Label: selectors.Namespaces}
+	}
+	if selectors.Workloads == nil || selectors.Workloads.Empty() {
+		return byObject, nil
+	}
+	if len(watch) == 0 {
+		watch = DefaultResourceTypes()
+	}
+	for _, res := range watch {
+		if obj := objectForResource(res); obj != nil {
+			byObject[obj] = cache.ByObject{Label: selectors.Workloads}
+		}
+	}
+	for _, res := range custom {
+		gvk := res.GroupVersionKind
+		if _, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version); err != nil {
+			if apimeta.IsNoMatchError(err) {
+				continue
+			}
+			return nil, fmt.Errorf("custom resource %s: %w", gvk, err)
+		}
+		obj := &unstructured.Unstructured{}
+		obj.SetGroupVersionKind(gvk)
+		byObject[obj] = cache.ByObject{Label: selectors.Workloads}
+	}
+	return byObject, nil
+}
+
+func objectForResource(res ResourceType) client.Object {
+	switch res {
+	case ResourceDeployments:
+		return &appsv1.Deployment{}
+	case ResourceStatefulSets:
+		return &appsv1.StatefulSet{}
+	case ResourceDaemonSets:
+		return &appsv1.DaemonSet{}
+	case ResourceJobs:
+		return &batchv1.Job{}
+	case ResourceCronJobs:
+		return &batchv1.CronJob{}
+	case ResourcePods:
+		return &corev1.Pod{}
+	case ResourceReplicaSets:
+		return &appsv1.ReplicaSet{}
+	case ResourceReplicationControllers:
+		return &corev1.ReplicationController{}
+	case ResourcePodTemplates:
+		return &corev1.PodTemplate{}
+	default:
+		return nil
+	}
+}
+
+// newBaseReconciler returns a reconciler applying the include, skip and selector rules.
+func newBaseReconciler(allowedNS []string, skipCfg SkipConfig, selectors SelectorConfig) baseReconciler {
+	return baseReconciler{
 		AllowedNamespaces: allowedNS,
-		SkippedNamespaces: make(map[string]struct{}, len(skipCfg.Namespaces)),
+		SkippedNamespaces: newPatternSet(skipCfg.Namespaces),
+		NamespaceSelector: selectors.Namespaces,
+		WorkloadSelector:  selectors.Workloads,
 		SkipDeployments:   newNameMatcher(skipCfg.Deployments),
 		SkipStatefulSets:  newNameMatcher(skipCfg.StatefulSets),
 		SkipDaemonSets:    newNameMatcher(skipCfg.DaemonSets),
 		SkipJobs:          newNameMatcher(skipCfg.Jobs),
 		SkipCronJobs:      newNameMatcher(skipCfg.CronJobs),
 		SkipPods:          newNameMatcher(skipCfg.Pods),
+
+		SkipReplicaSets:            newNameMatcher(skipCfg.ReplicaSets),
+		SkipReplicationControllers: newNameMatcher(skipCfg.ReplicationControllers),
+		SkipPodTemplates:           newNameMatcher(skipCfg.PodTemplates),
 	}
-	for _, ns := range skipCfg.Namespaces {
-		if trimmed := strings.TrimSpace(ns); trimmed != "" {
-			base.SkippedNamespaces[trimmed] = struct{}{}
-		}
-	}
+}
+
+func SetupAll(mgr ctrl.Manager, pusher mirror.Pusher, allowedNS []string, skipCfg SkipConfig, selectors SelectorConfig, watch []ResourceType, custom []CustomResource, maxConcurrent int, checkNodePlatform bool) (*ForceReconciler, error) {
+	base := newBaseReconciler(allowedNS, skipCfg, selectors)
+	base.Client = mgr.GetClient()
+	base.Scheme = mgr.GetScheme()
+	base.Pusher = pusher
+	base.CheckNodePlatform = checkNodePlatform
 	if maxConcurrent <= 0 {
 		maxConcurrent = 1
 	}
 	if len(watch) == 0 {
-		watch = AllResourceTypes()
+		watch = DefaultResourceTypes()
 	}
-	force := &ForceReconciler{baseReconciler: base, watch: append([]ResourceType(nil), watch...)}
+	extractors, err := setupCustomResources(mgr, base, custom, maxConcurrent)
+	if err != nil {
+		return nil, err
+	}
+	force := &ForceReconciler{baseReconciler: base, watch: append([]ResourceType(nil), watch...), custom: extractors}
+	// Force reconciles report how many images were mirrored and feed garbage collection, so they
+	// wait for every image.
+	force.waitForMirror = true
 	logger := ctrl.Log.WithName("controllers")
+	if NamespaceTrackingRequired(allowedNS, selectors.Namespaces) {
+		if err := (&NamespaceReconciler{baseReconciler: base, force: force}).SetupWithManager(mgr); err != nil {
+			return nil, err
+		}
+	}
 	for _, res := range watch {
 		switch res {
 		case ResourceDeployments:
@@ -717,6 +1091,18 @@ func SetupAll(mgr ctrl.Manager, pusher mirror.Pusher, allowedNS []string, skipCf
 			if err := (&PodReconciler{base}).SetupWithManager(mgr, maxConcurrent); err != nil {
 				return nil, err
 			}
+		case ResourceReplicaSets:
+			if err := (&ReplicaSetReconciler{base}).SetupWithManager(mgr, maxConcurrent); err != nil {
+				return nil, err
+			}
+		case ResourceReplicationControllers:
+			if err := (&ReplicationControllerReconciler{base}).SetupWithManager(mgr, maxConcurrent); err != nil {
+				return nil, err
+			}
+		case ResourcePodTemplates:
+			if err := (&PodTemplateReconciler{base}).SetupWithManager(mgr, maxConcurrent); err != nil {
+				return nil, err
+			}
 		default:
 			logger.Error(fmt.Errorf("unsupported resource type"), "ignoring watch resource", "resource", res)
 		}
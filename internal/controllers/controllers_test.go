@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -11,7 +12,10 @@ import (
 	appsv1 "k8s.io/api/apps/v1"
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
@@ -39,33 +43,419 @@ func TestNameMatcherMatches(t *testing.T) {
 	}
 }
 
+func TestNameMatcherPatterns(t *testing.T) {
+	matcher := newNameMatcher([]string{"*/ci-runner-*", "/^tmp-.*/", "team-*/debug", "/^prod-[a-z]+$//canary-?"})
+	cases := []struct {
+		namespace string
+		name      string
+		want      bool
+	}{
+		{"build", "ci-runner-abc12", true},
+		{"default", "tmp-job-1", true},
+		{"default", "job-tmp", false},
+		{"team-a", "debug", true},
+		{"prod", "debug", false},
+		{"prod-eu", "canary-1", true},
+		{"prod-eu", "canary-10", false},
+		{"prod-2", "canary-1", false},
+	}
+	for _, tc := range cases {
+		if got := matcher.matches(tc.namespace, tc.name); got != tc.want {
+			t.Errorf("matches(%q, %q) = %v, want %v", tc.namespace, tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestSkipConfigValidate(t *testing.T) {
+	valid := SkipConfig{
+		Namespaces: []string{"kube-*", "/^tmp-/"},
+		Pods:       []string{"*", "*/ci-runner-*", "/^a\\/b$/"},
+	}
+	if err := valid.Validate(); err != nil {
+		t.Fatalf("expected valid skip config, got %v", err)
+	}
+	invalid := SkipConfig{
+		Namespaces:  []string{"/([/"},
+		Deployments: []string{"/unterminated"},
+		Jobs:        []string{"ns/"},
+	}
+	err := invalid.Validate()
+	if err == nil {
+		t.Fatalf("expected invalid patterns to be reported")
+	}
+	for _, want := range []string{"skip namespaces", "skip deployments", "skip jobs"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Fatalf("expected error to mention %q, got %v", want, err)
+		}
+	}
+}
+
 func TestNamespaceFiltering(t *testing.T) {
 	r := baseReconciler{
 		AllowedNamespaces: []string{"*"},
-		SkippedNamespaces: map[string]struct{}{"kube-system": {}},
+		SkippedNamespaces: newPatternSet([]string{"kube-system"}),
 	}
-	if r.nsAllowed("kube-system") {
+	if r.nsAllowed(context.Background(), "kube-system") {
 		t.Fatalf("expected kube-system to be skipped")
 	}
-	if !r.nsAllowed("default") {
+	if !r.nsAllowed(context.Background(), "default") {
 		t.Fatalf("expected default to be allowed")
 	}
 
 	r = baseReconciler{
 		AllowedNamespaces: []string{"prod", "default"},
-		SkippedNamespaces: map[string]struct{}{"prod": {}},
+		SkippedNamespaces: newPatternSet([]string{"prod"}),
 	}
-	if r.nsAllowed("prod") {
+	if r.nsAllowed(context.Background(), "prod") {
 		t.Fatalf("expected prod to be skipped despite allow list")
 	}
-	if !r.nsAllowed("default") {
+	if !r.nsAllowed(context.Background(), "default") {
 		t.Fatalf("expected default to be allowed from allow list")
 	}
-	if r.nsAllowed("dev") {
+	if r.nsAllowed(context.Background(), "dev") {
 		t.Fatalf("expected dev to be disallowed")
 	}
 }
 
+func TestNamespaceGlobFiltering(t *testing.T) {
+	r := baseReconciler{
+		AllowedNamespaces: []string{"team-*", "default"},
+		SkippedNamespaces: newPatternSet([]string{"team-legacy", "/-sandbox$/"}),
+	}
+	ctx := context.Background()
+	if !r.nsAllowed(ctx, "team-a") {
+		t.Fatalf("expected team-a to match team-* pattern")
+	}
+	if r.nsAllowed(ctx, "team-legacy") {
+		t.Fatalf("expected skipped namespace to win over pattern")
+	}
+	if r.nsAllowed(ctx, "team-b-sandbox") {
+		t.Fatalf("expected regex skip pattern to reject team-b-sandbox")
+	}
+	if r.nsAllowed(ctx, "prod") {
+		t.Fatalf("expected prod to be disallowed")
+	}
+}
+
+func TestNamespaceTrackingRequired(t *testing.T) {
+	if NamespaceTrackingRequired([]string{"*"}, nil) {
+		t.Fatalf("expected * without selector to use a static cache")
+	}
+	if NamespaceTrackingRequired([]string{"default", "prod"}, labels.Everything()) {
+		t.Fatalf("expected explicit namespaces with empty selector to use a static cache")
+	}
+	if !NamespaceTrackingRequired([]string{"team-*"}, nil) {
+		t.Fatalf("expected glob pattern to require namespace tracking")
+	}
+	if !NamespaceTrackingRequired([]string{"*"}, labels.SelectorFromSet(labels.Set{"tier": "prod"})) {
+		t.Fatalf("expected namespace selector to require namespace tracking")
+	}
+}
+
+func TestNamespaceExclusion(t *testing.T) {
+	skip := SkipConfig{Namespaces: []string{"team-b", "/^tmp-/"}}
+	cases := map[string]string{
+		"team-a": "",
+		"team-b": "skipNamespaces",
+		"tmp-1":  "skipNamespaces",
+		"prod":   "includeNamespaces",
+	}
+	for ns, want := range cases {
+		if got := NamespaceExclusion([]string{"team-*", "tmp-1"}, skip, ns); got != want {
+			t.Fatalf("namespace %s: expected %q, got %q", ns, want, got)
+		}
+	}
+	if got := NamespaceExclusion([]string{"*"}, SkipConfig{}, "prod"); got != "" {
+		t.Fatalf("expected * to include every namespace, got %q", got)
+	}
+}
+
+func TestNamespaceReconcilerMirrorsNewlySelectedNamespace(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := corev1.AddToScheme(scheme); err != nil {
+		t.Fatalf("add core scheme: %v", err)
+	}
+
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-a"}}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "team-a"},
+		Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "app", Image: "docker.io/library/nginx:1.27"}}},
+		Status:     corev1.PodStatus{Phase: corev1.PodRunning},
+	}
+	client := fake.NewClientBuilder().WithScheme(scheme).WithObjects(ns, pod).Build()
+	pusher := &recordingPusher{}
+	base := baseReconciler{
+		Client:            client,
+		Pusher:            pusher,
+		AllowedNamespaces: []string{"*"},
+		NamespaceSelector: labels.SelectorFromSet(labels.Set{"tier": "prod"}),
+	}
+	reconciler := &NamespaceReconciler{
+		baseReconciler: base,
+		force:          &ForceReconciler{baseReconciler: base, watch: []ResourceType{ResourcePods}},
+		tracked:        map[string]bool{},
+		seeded:         true,
+	}
+
+	ctx := context.Background()
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "team-a"}}
+	if _, err := reconciler.Reconcile(ctx, req); err != nil {
+		t.Fatalf("reconcile unlabelled namespace: %v", err)
+	}
+	if len(pusher.calls) != 0 {
+		t.Fatalf("expected unselected namespace to be ignored, got %v", pusher.calls)
+	}
+
+	ns.Labels = map[string]string{"tier": "prod"}
+	if err := client.Update(ctx, ns); err != nil {
+		t.Fatalf("label namespace: %v", err)
+	}
+	if _, err := reconciler.Reconcile(ctx, req); err != nil {
+		t.Fatalf("reconcile labelled namespace: %v", err)
+	}
+	if !reflect.DeepEqual(pusher.calls, []string{"docker.io/library/nginx:1.27"}) {
+		t.Fatalf("expected workloads of newly selected namespace to be mirrored, got %v", pusher.calls)
+	}
+
+	if _, err := reconciler.Reconcile(ctx, req); err != nil {
+		t.Fatalf("reconcile unchanged namespace: %v", err)
+	}
+	if len(pusher.calls) != 1 {
+		t.Fatalf("expected unchanged namespace not to trigger another pass, got %v", pusher.calls)
+	}
+}
+
+func TestNamespaceSelectorFiltering(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := corev1.AddToScheme(scheme); err != nil {
+		t.Fatalf("add core scheme: %v", err)
+	}
+
+	client := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "prod", Labels: map[string]string{"copycat.io/mirror": "true"}}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "dev"}},
+	).Build()
+
+	r := baseReconciler{
+		Client:            client,
+		AllowedNamespaces: []string{"*"},
+		NamespaceSelector: labels.SelectorFromSet(labels.Set{"copycat.io/mirror": "true"}),
+	}
+	ctx := context.Background()
+	if !r.nsAllowed(ctx, "prod") {
+		t.Fatalf("expected labelled namespace to be allowed")
+	}
+	if r.nsAllowed(ctx, "dev") {
+		t.Fatalf("expected unlabelled namespace to be rejected")
+	}
+	if r.nsAllowed(ctx, "missing") {
+		t.Fatalf("expected unknown namespace to be rejected")
+	}
+}
+
+func TestDeploymentReconcilerHonoursWorkloadSelector(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := appsv1.AddToScheme(scheme); err != nil {
+		t.Fatalf("add apps scheme: %v", err)
+	}
+
+	template := corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+		Containers: []corev1.Container{{Name: "app", Image: "docker.io/library/nginx:1.27"}},
+	}}
+	optedIn := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "opted-in", Namespace: "default", Labels: map[string]string{"copycat.io/mirror": "true"}},
+		Spec:       appsv1.DeploymentSpec{Template: template},
+	}
+	other := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "default"},
+		Spec:       appsv1.DeploymentSpec{Template: template},
+	}
+
+	client := fake.NewClientBuilder().WithScheme(scheme).WithObjects(optedIn, other).Build()
+	pusher := &recordingPusher{}
+	reconciler := DeploymentReconciler{baseReconciler{
+		Client:            client,
+		Pusher:            pusher,
+		AllowedNamespaces: []string{"*"},
+		WorkloadSelector:  labels.SelectorFromSet(labels.Set{"copycat.io/mirror": "true"}),
+	}}
+
+	ctx := context.Background()
+	for _, name := range []string{"opted-in", "other"} {
+		if _, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Name: name, Namespace: "default"}}); err != nil {
+			t.Fatalf("reconcile %s: %v", name, err)
+		}
+	}
+	if len(pusher.calls) != 1 {
+		t.Fatalf("expected only the selected deployment to be mirrored, got %d calls", len(pusher.calls))
+	}
+}
+
+func TestReconcilersForgetDeletedWorkloads(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := appsv1.AddToScheme(scheme); err != nil {
+		t.Fatalf("add apps scheme: %v", err)
+	}
+	if err := corev1.AddToScheme(scheme); err != nil {
+		t.Fatalf("add core scheme: %v", err)
+	}
+	pusher := &recordingPusher{}
+	base := baseReconciler{
+		Client:            fake.NewClientBuilder().WithScheme(scheme).Build(),
+		Pusher:            pusher,
+		AllowedNamespaces: []string{"*"},
+	}
+
+	ctx := context.Background()
+	if _, err := (&DeploymentReconciler{base}).Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Name: "web", Namespace: "shop"}}); err != nil {
+		t.Fatalf("reconcile deleted deployment: %v", err)
+	}
+	if _, err := (&PodReconciler{base}).Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Name: "web-1", Namespace: "shop"}}); err != nil {
+		t.Fatalf("reconcile deleted pod: %v", err)
+	}
+	if !reflect.DeepEqual(pusher.forgotten, []string{"shop/web", "shop/web-1"}) {
+		t.Fatalf("expected deleted workloads to be forgotten, got %v", pusher.forgotten)
+	}
+}
+
+func TestReplicaSetReconcilerMirrorsOldRevisions(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := appsv1.AddToScheme(scheme); err != nil {
+		t.Fatalf("add apps scheme: %v", err)
+	}
+
+	deploymentGVK := appsv1.SchemeGroupVersion.WithKind("Deployment")
+	replicaSet := func(name, owner, image string) *appsv1.ReplicaSet {
+		return &appsv1.ReplicaSet{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: "default",
+				OwnerReferences: []metav1.OwnerReference{{
+					APIVersion: deploymentGVK.GroupVersion().String(),
+					Kind:       deploymentGVK.Kind,
+					Name:       owner,
+				}},
+			},
+			Spec: appsv1.ReplicaSetSpec{Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+				Containers: []corev1.Container{{Name: "app", Image: image}},
+			}}},
+		}
+	}
+	old := replicaSet("web-5d4f", "web", "docker.io/library/nginx:1.26")
+	skipped := replicaSet("debug-7c9a", "debug", "docker.io/library/busybox:1.36")
+
+	client := fake.NewClientBuilder().WithScheme(scheme).WithObjects(old, skipped).Build()
+	pusher := &recordingPusher{}
+	reconciler := ReplicaSetReconciler{baseReconciler{
+		Client:            client,
+		Pusher:            pusher,
+		AllowedNamespaces: []string{"*"},
+		SkipDeployments:   newNameMatcher([]string{"debug"}),
+	}}
+
+	ctx := context.Background()
+	for _, name := range []string{old.Name, skipped.Name} {
+		if _, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Name: name, Namespace: "default"}}); err != nil {
+			t.Fatalf("reconcile %s: %v", name, err)
+		}
+	}
+	if !reflect.DeepEqual(pusher.calls, []string{"docker.io/library/nginx:1.26"}) {
+		t.Fatalf("expected only the old revision of the non-skipped deployment, got %v", pusher.calls)
+	}
+}
+
+func TestForceReconcileReplicationControllersAndPodTemplates(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := corev1.AddToScheme(scheme); err != nil {
+		t.Fatalf("add core scheme: %v", err)
+	}
+
+	rc := &corev1.ReplicationController{
+		ObjectMeta: metav1.ObjectMeta{Name: "legacy", Namespace: "default"},
+		Spec: corev1.ReplicationControllerSpec{Template: &corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{Name: "app", Image: "docker.io/library/redis:7"}},
+		}}},
+	}
+	emptyRC := &corev1.ReplicationController{ObjectMeta: metav1.ObjectMeta{Name: "empty", Namespace: "default"}}
+	template := &corev1.PodTemplate{
+		ObjectMeta: metav1.ObjectMeta{Name: "runner", Namespace: "default"},
+		Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{Name: "runner", Image: "docker.io/library/alpine:3.20"}},
+		}},
+	}
+
+	client := fake.NewClientBuilder().WithScheme(scheme).WithObjects(rc, emptyRC, template).Build()
+	pusher := &recordingPusher{}
+	reconciler := ForceReconciler{
+		baseReconciler: baseReconciler{
+			Client:            client,
+			Pusher:            pusher,
+			AllowedNamespaces: []string{"*"},
+		},
+		watch: []ResourceType{ResourceReplicationControllers, ResourcePodTemplates},
+	}
+
+	workloads, mirrored, err := reconciler.ForceReconcile(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected force reconcile error: %v", err)
+	}
+	if workloads != 2 || mirrored != 2 {
+		t.Fatalf("expected two workloads and two mirrored images, got workloads=%d mirrored=%d", workloads, mirrored)
+	}
+	expected := []string{"docker.io/library/redis:7", "docker.io/library/alpine:3.20"}
+	if !reflect.DeepEqual(pusher.calls, expected) {
+		t.Fatalf("unexpected mirrored images: %v", pusher.calls)
+	}
+}
+
+func TestCacheByObjectAppliesSelectors(t *testing.T) {
+	nsSelector := labels.SelectorFromSet(labels.Set{"tier": "prod"})
+	workloadSelector := labels.SelectorFromSet(labels.Set{"copycat.io/mirror": "true"})
+
+	byObject, err := CacheByObject([]ResourceType{ResourceDeployments, ResourcePods}, nil, SelectorConfig{Namespaces: nsSelector, Workloads: workloadSelector}, nil)
+	if err != nil {
+		t.Fatalf("cache by object: %v", err)
+	}
+	if len(byObject) != 3 {
+		t.Fatalf("expected namespace, deployment and pod cache entries, got %d", len(byObject))
+	}
+	for obj, opts := range byObject {
+		want := workloadSelector
+		if _, ok := obj.(*corev1.Namespace); ok {
+			want = nsSelector
+		}
+		if opts.Label.String() != want.String() {
+			t.Fatalf("unexpected selector for %T: %s", obj, opts.Label)
+		}
+	}
+
+	if got, err := CacheByObject(nil, nil, SelectorConfig{}, nil); err != nil || len(got) != 0 {
+		t.Fatalf("expected no cache restrictions without selectors, got %d (%v)", len(got), err)
+	}
+}
+
+func TestCacheByObjectSkipsCustomKindsNotServed(t *testing.T) {
+	rollout := schema.GroupVersionKind{Group: "argoproj.io", Version: "v1alpha1", Kind: "Rollout"}
+	task := schema.GroupVersionKind{Group: "tekton.dev", Version: "v1", Kind: "Task"}
+	mapper := apimeta.NewDefaultRESTMapper(nil)
+	mapper.Add(rollout, apimeta.RESTScopeNamespace)
+
+	byObject, err := CacheByObject([]ResourceType{ResourcePods}, []CustomResource{{GroupVersionKind: rollout}, {GroupVersionKind: task}},
+		SelectorConfig{Workloads: labels.SelectorFromSet(labels.Set{"copycat.io/mirror": "true"})}, mapper)
+	if err != nil {
+		t.Fatalf("cache by object: %v", err)
+	}
+	var kinds []string
+	for obj := range byObject {
+		if u, ok := obj.(*unstructured.Unstructured); ok {
+			kinds = append(kinds, u.GetKind())
+		}
+	}
+	if len(byObject) != 2 || !reflect.DeepEqual(kinds, []string{"Rollout"}) {
+		t.Fatalf("expected pod and Rollout cache entries only, got %d entries with custom kinds %v", len(byObject), kinds)
+	}
+}
+
 func TestPodReconcilerShouldSkip(t *testing.T) {
 	scheme := runtime.NewScheme()
 	if err := appsv1.AddToScheme(scheme); err != nil {
@@ -114,7 +504,7 @@ func TestPodReconcilerShouldSkip(t *testing.T) {
 	reconciler := PodReconciler{baseReconciler{
 		Client:            client,
 		AllowedNamespaces: []string{"*"},
-		SkippedNamespaces: map[string]struct{}{},
+		SkippedNamespaces: newPatternSet(nil),
 		SkipDeployments:   newNameMatcher([]string{"copycat"}),
 		SkipStatefulSets:  newNameMatcher([]string{"db"}),
 		SkipDaemonSets:    newNameMatcher([]string{"node-agent"}),
@@ -184,6 +574,15 @@ func TestParseWatchResources(t *testing.T) {
 		t.Fatalf("unexpected parse result: %v", parsed)
 	}
 
+	parsed, invalid = ParseWatchResources([]string{"ReplicaSets", "replicationcontrollers", "podtemplates"})
+	if len(invalid) != 0 {
+		t.Fatalf("expected opt-in resource types to be supported, got invalid %v", invalid)
+	}
+	expected = []ResourceType{ResourceReplicaSets, ResourceReplicationControllers, ResourcePodTemplates}
+	if !reflect.DeepEqual(parsed, expected) {
+		t.Fatalf("unexpected parse result for opt-in types: %v", parsed)
+	}
+
 	parsed, invalid = ParseWatchResources([]string{"unknown", ""})
 	if len(parsed) != 0 {
 		t.Fatalf("expected no parsed entries for invalid input, got %v", parsed)
@@ -366,10 +765,46 @@ func TestForceReconcilePodsUsesPodImageStatusAndNodePlatform(t *testing.T) {
 	}
 }
 
+func TestMirrorPodImagesQueuesWithoutWaiting(t *testing.T) {
+	pusher := &queueingPusher{}
+	images := []util.PodImage{{Image: "docker.io/library/a:v1", ContainerName: "a"}}
+	ctx := ctrl.LoggerInto(context.Background(), testr.New(t))
+
+	r := baseReconciler{Pusher: pusher}
+	if _, err := r.mirrorPodImages(ctx, "default", "pod", images, "", ""); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(pusher.calls) != 0 || len(pusher.requesters) != 1 || pusher.requesters[0] != "default/pod" {
+		t.Fatalf("expected image to be queued for default/pod, got calls=%v requesters=%v", pusher.calls, pusher.requesters)
+	}
+
+	r.waitForMirror = true
+	if _, err := r.mirrorPodImages(ctx, "default", "pod", images, "", ""); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(pusher.calls) != 1 {
+		t.Fatalf("expected force reconciles to wait for the mirror, got calls=%v", pusher.calls)
+	}
+}
+
+type queueingPusher struct {
+	recordingPusher
+	requesters []string
+}
+
+func (p *queueingPusher) Enqueue(_ context.Context, _ string, _ mirror.Metadata, requester string) {
+	p.requesters = append(p.requesters, requester)
+}
+
 type recordingPusher struct {
 	responses []error
 	calls     []string
 	metas     []mirror.Metadata
+	forgotten []string
+}
+
+func (p *recordingPusher) ForgetWorkload(namespace, name string) {
+	p.forgotten = append(p.forgotten, namespace+"/"+name)
 }
 
 func (p *recordingPusher) Mirror(_ context.Context, sourceImage string, meta mirror.Metadata) error {
@@ -387,7 +822,11 @@ func (*recordingPusher) DryRun() bool { return false }
 
 func (*recordingPusher) DryPull() bool { return false }
 
-func (*recordingPusher) ResetCooldown() (int, bool) { return 0, false }
+func (*recordingPusher) ResetCooldown() (int, bool)        { return 0, false }
+func (*recordingPusher) Cooldowns() []mirror.CooldownEntry { return nil }
+func (*recordingPusher) ResetCooldowns(mirror.CooldownSelector) (int, bool, error) {
+	return 0, false, nil
+}
 
 func podWithOwner(namespace, name string, gvkt schema.GroupVersionKind, ownerName string) *corev1.Pod {
 	return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
@@ -0,0 +1,295 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/util/jsonpath"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	"github.com/matzegebbe/k8s-copycat/pkg/util"
+)
+
+// CustomResource describes an additional kind whose images are discovered through JSONPath
+// expressions, for example Argo Rollouts or Tekton Tasks. PodSpecPaths must resolve to pod
+// specs, ImagePaths to image strings. Expressions may omit the surrounding braces.
+type CustomResource struct {
+	GroupVersionKind schema.GroupVersionKind
+	PodSpecPaths     []string
+	ImagePaths       []string
+	SkipNames        []string
+}
+
+// customExtractor holds the compiled JSONPath expressions of a CustomResource.
+type customExtractor struct {
+	gvk      schema.GroupVersionKind
+	podSpecs []*jsonpath.JSONPath
+	images   []*jsonpath.JSONPath
+	skip     nameMatcher
+}
+
+func newCustomExtractor(res CustomResource) (*customExtractor, error) {
+	gvk := res.GroupVersionKind
+	if strings.TrimSpace(gvk.Version) == "" || strings.TrimSpace(gvk.Kind) == "" {
+		return nil, fmt.Errorf("custom resource %q: version and kind are required", gvk.String())
+	}
+	ext := &customExtractor{gvk: gvk, skip: newNameMatcher(res.SkipNames)}
+	for _, raw := range res.PodSpecPaths {
+		jp, err := compileJSONPath(raw)
+		if err != nil {
+			return nil, fmt.Errorf("custom resource %s: pod spec path %q: %w", gvk.Kind, raw, err)
+		}
+		if jp != nil {
+			ext.podSpecs = append(ext.podSpecs, jp)
+		}
+	}
+	for _, raw := range res.ImagePaths {
+		jp, err := compileJSONPath(raw)
+		if err != nil {
+			return nil, fmt.Errorf("custom resource %s: image path %q: %w", gvk.Kind, raw, err)
+		}
+		if jp != nil {
+			ext.images = append(ext.images, jp)
+		}
+	}
+	if len(ext.podSpecs) == 0 && len(ext.images) == 0 {
+		return nil, fmt.Errorf("custom resource %s: at least one podSpecPaths or imagePaths entry is required", gvk.Kind)
+	}
+	return ext, nil
+}
+
+func compileJSONPath(raw string) (*jsonpath.JSONPath, error) {
+	expr := strings.TrimSpace(raw)
+	if expr == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(expr, "{") {
+		expr = "{" + expr + "}"
+	}
+	jp := jsonpath.New("copycat").AllowMissingKeys(true)
+	if err := jp.Parse(expr); err != nil {
+		return nil, err
+	}
+	return jp, nil
+}
+
+// ValidateCustomResources reports invalid or duplicate custom resource declarations.
+func ValidateCustomResources(resources []CustomResource) error {
+	var errs []error
+	seen := make(map[schema.GroupVersionKind]struct{}, len(resources))
+	for _, res := range resources {
+		if _, err := newCustomExtractor(res); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if _, dup := seen[res.GroupVersionKind]; dup {
+			errs = append(errs, fmt.Errorf("custom resource %s declared more than once", res.GroupVersionKind.String()))
+			continue
+		}
+		seen[res.GroupVersionKind] = struct{}{}
+		for _, raw := range res.SkipNames {
+			entry := strings.TrimSpace(raw)
+			if entry == "" || entry == "*" {
+				continue
+			}
+			if _, _, err := parseNameEntry(entry); err != nil {
+				errs = append(errs, fmt.Errorf("custom resource %s: skip names: %w", res.GroupVersionKind.Kind, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// imagesFrom evaluates the configured expressions against obj. Containers found through pod spec
+// paths keep their names; bare image strings are reported without a container name.
+func (e *customExtractor) imagesFrom(obj *unstructured.Unstructured) ([]util.PodImage, error) {
+	var out []util.PodImage
+	seen := make(map[util.PodImage]struct{})
+	add := func(img util.PodImage) {
+		if _, dup := seen[img]; dup {
+			return
+		}
+		seen[img] = struct{}{}
+		out = append(out, img)
+	}
+
+	for _, jp := range e.podSpecs {
+		results, err := jp.FindResults(obj.Object)
+		if err != nil {
+			return nil, err
+		}
+		for _, values := range results {
+			for _, value := range values {
+				raw, ok := value.Interface().(map[string]interface{})
+				if !ok {
+					continue
+				}
+				var spec corev1.PodSpec
+				if err := runtime.DefaultUnstructuredConverter.FromUnstructured(raw, &spec); err != nil {
+					return nil, fmt.Errorf("decode pod spec: %w", err)
+				}
+				for _, img := range util.ImagesFromPodSpec(&spec) {
+					add(img)
+				}
+			}
+		}
+	}
+
+	for _, jp := range e.images {
+		results, err := jp.FindResults(obj.Object)
+		if err != nil {
+			return nil, err
+		}
+		for _, values := range results {
+			for _, value := range values {
+				for _, image := range imageStrings(value.Interface()) {
+					add(util.PodImage{Image: image})
+				}
+			}
+		}
+	}
+	return out, nil
+}
+
+func imageStrings(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		if trimmed := strings.TrimSpace(v); trimmed != "" {
+			return []string{trimmed}
+		}
+	case []interface{}:
+		var out []string
+		for _, item := range v {
+			out = append(out, imageStrings(item)...)
+		}
+		return out
+	}
+	return nil
+}
+
+func (e *customExtractor) newObject() *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(e.gvk)
+	return obj
+}
+
+func (e *customExtractor) newList() *unstructured.UnstructuredList {
+	list := &unstructured.UnstructuredList{}
+	list.SetGroupVersionKind(e.gvk.GroupVersion().WithKind(e.gvk.Kind + "List"))
+	return list
+}
+
+// CustomResourceReconciler mirrors images discovered in a custom resource through JSONPath.
+type CustomResourceReconciler struct {
+	baseReconciler
+	extractor *customExtractor
+}
+
+func (r *CustomResourceReconciler) Reconcile(ctx context.Context, req ctrl.Request) (res ctrl.Result, err error) {
+	kind := r.extractor.gvk.Kind
+	if !r.nsAllowed(ctx, req.Namespace) || r.extractor.skip.matches(req.Namespace, req.Name) {
+		return ctrl.Result{}, nil
+	}
+	ctx, span := startReconcileSpan(ctx, kind, req)
+	defer func() { endReconcileSpan(span, res, err) }()
+	log := ctrl.LoggerFrom(ctx)
+	log.V(1).Info("saw "+kind, "name", req.Name, "namespace", req.Namespace)
+	obj := r.extractor.newObject()
+	if err := r.Get(ctx, req.NamespacedName, obj); err != nil {
+		return ctrl.Result{}, r.ignoreDeleted(req, err)
+	}
+	if !r.workloadSelected(obj) {
+		log.V(1).Info("skipping "+kind+" not matching workload selector", "name", req.Name, "namespace", req.Namespace)
+		return ctrl.Result{}, nil
+	}
+	images, err := r.extractor.imagesFrom(obj)
+	if err != nil {
+		log.Error(err, "unable to extract images", "kind", kind, "name", req.Name, "namespace", req.Namespace)
+		return ctrl.Result{}, nil
+	}
+	_, err = r.mirrorPodImages(ctx, obj.GetNamespace(), obj.GetName(), images, "", "")
+	return mirrorResultForError(err)
+}
+
+func (r *CustomResourceReconciler) SetupWithManager(mgr ctrl.Manager, maxConcurrent int) error {
+	gvk := r.extractor.gvk
+	name := strings.ToLower(gvk.Kind)
+	if gvk.Group != "" {
+		name += "." + gvk.Group
+	}
+	return ctrl.NewControllerManagedBy(mgr).
+		Named(name).
+		For(r.extractor.newObject()).
+		WithOptions(controller.Options{MaxConcurrentReconciles: maxConcurrent}).
+		WithEventFilter(predicate.GenerationChangedPredicate{}).
+		Complete(r)
+}
+
+// reconcileCustom mirrors every object of the custom resource during a force reconcile.
+func (r *ForceReconciler) reconcileCustom(ctx context.Context, ext *customExtractor, listOpts []client.ListOption) (int, int, []error, error) {
+	list := ext.newList()
+	if err := r.List(ctx, list, listOpts...); err != nil {
+		return 0, 0, nil, err
+	}
+	workloads := 0
+	images := 0
+	var errs []error
+	kind := strings.ToLower(ext.gvk.Kind)
+	for i := range list.Items {
+		if err := ctx.Err(); err != nil {
+			return workloads, images, errs, err
+		}
+		obj := &list.Items[i]
+		if !r.nsAllowed(ctx, obj.GetNamespace()) || !r.workloadSelected(obj) || ext.skip.matches(obj.GetNamespace(), obj.GetName()) {
+			continue
+		}
+		workloads++
+		found, err := ext.imagesFrom(obj)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s %s/%s: %w", kind, obj.GetNamespace(), obj.GetName(), err))
+			continue
+		}
+		mirrored, err := r.mirrorPodImages(ctx, obj.GetNamespace(), obj.GetName(), found, "", "")
+		images += mirrored
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s %s/%s: %w", kind, obj.GetNamespace(), obj.GetName(), err))
+		}
+	}
+	return workloads, images, errs, nil
+}
+
+// setupCustomResources registers a controller per custom resource whose kind is served by the
+// API server. Kinds that are not installed are logged and ignored so optional CRDs do not block
+// startup.
+func setupCustomResources(mgr ctrl.Manager, base baseReconciler, resources []CustomResource, maxConcurrent int) ([]*customExtractor, error) {
+	logger := ctrl.Log.WithName("controllers")
+	var extractors []*customExtractor
+	for _, res := range resources {
+		ext, err := newCustomExtractor(res)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := mgr.GetRESTMapper().RESTMapping(ext.gvk.GroupKind(), ext.gvk.Version); err != nil {
+			if apimeta.IsNoMatchError(err) {
+				logger.Error(err, "custom resource kind is not served by the API server; ignoring it", "gvk", ext.gvk.String())
+				continue
+			}
+			return nil, err
+		}
+		if err := (&CustomResourceReconciler{baseReconciler: base, extractor: ext}).SetupWithManager(mgr, maxConcurrent); err != nil {
+			return nil, err
+		}
+		extractors = append(extractors, ext)
+	}
+	return extractors, nil
+}
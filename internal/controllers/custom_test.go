@@ -0,0 +1,188 @@
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/matzegebbe/k8s-copycat/pkg/util"
+)
+
+var (
+	rolloutGVK = schema.GroupVersionKind{Group: "argoproj.io", Version: "v1alpha1", Kind: "Rollout"}
+	taskGVK    = schema.GroupVersionKind{Group: "tekton.dev", Version: "v1", Kind: "Task"}
+)
+
+func newCustomScheme() *runtime.Scheme {
+	scheme := runtime.NewScheme()
+	for _, gvk := range []schema.GroupVersionKind{rolloutGVK, taskGVK} {
+		scheme.AddKnownTypeWithName(gvk, &unstructured.Unstructured{})
+		scheme.AddKnownTypeWithName(gvk.GroupVersion().WithKind(gvk.Kind+"List"), &unstructured.UnstructuredList{})
+	}
+	return scheme
+}
+
+func rollout(name string) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{
+		"spec": map[string]interface{}{
+			"template": map[string]interface{}{
+				"spec": map[string]interface{}{
+					"initContainers": []interface{}{map[string]interface{}{"name": "init", "image": "docker.io/library/busybox:1.36"}},
+					"containers":     []interface{}{map[string]interface{}{"name": "app", "image": "docker.io/library/nginx:1.27"}},
+				},
+			},
+		},
+	}}
+	obj.SetGroupVersionKind(rolloutGVK)
+	obj.SetNamespace("default")
+	obj.SetName(name)
+	return obj
+}
+
+func task(name string) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{
+		"spec": map[string]interface{}{
+			"steps": []interface{}{
+				map[string]interface{}{"name": "build", "image": "gcr.io/kaniko-project/executor:v1.23.0"},
+				map[string]interface{}{"name": "test", "image": "docker.io/library/golang:1.25"},
+			},
+		},
+	}}
+	obj.SetGroupVersionKind(taskGVK)
+	obj.SetNamespace("default")
+	obj.SetName(name)
+	return obj
+}
+
+func TestCustomExtractorImages(t *testing.T) {
+	ext, err := newCustomExtractor(CustomResource{
+		GroupVersionKind: rolloutGVK,
+		PodSpecPaths:     []string{".spec.template.spec"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected extractor error: %v", err)
+	}
+	images, err := ext.imagesFrom(rollout("web"))
+	if err != nil {
+		t.Fatalf("unexpected extraction error: %v", err)
+	}
+	expected := []util.PodImage{
+		{Image: "docker.io/library/busybox:1.36", ContainerName: "init"},
+		{Image: "docker.io/library/nginx:1.27", ContainerName: "app"},
+	}
+	if !reflect.DeepEqual(images, expected) {
+		t.Fatalf("unexpected pod spec images: %+v", images)
+	}
+
+	ext, err = newCustomExtractor(CustomResource{
+		GroupVersionKind: taskGVK,
+		ImagePaths:       []string{"{.spec.steps[*].image}", ".spec.sidecars[*].image"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected extractor error: %v", err)
+	}
+	images, err = ext.imagesFrom(task("build"))
+	if err != nil {
+		t.Fatalf("unexpected extraction error: %v", err)
+	}
+	expected = []util.PodImage{
+		{Image: "gcr.io/kaniko-project/executor:v1.23.0"},
+		{Image: "docker.io/library/golang:1.25"},
+	}
+	if !reflect.DeepEqual(images, expected) {
+		t.Fatalf("unexpected image path results: %+v", images)
+	}
+}
+
+func TestValidateCustomResources(t *testing.T) {
+	valid := []CustomResource{
+		{GroupVersionKind: rolloutGVK, PodSpecPaths: []string{".spec.template.spec"}},
+		{GroupVersionKind: taskGVK, ImagePaths: []string{".spec.steps[*].image"}, SkipNames: []string{"ci/*"}},
+	}
+	if err := ValidateCustomResources(valid); err != nil {
+		t.Fatalf("expected valid custom resources, got %v", err)
+	}
+
+	invalid := []CustomResource{
+		{GroupVersionKind: schema.GroupVersionKind{Group: "example.com", Kind: "Widget"}, ImagePaths: []string{".spec.image"}},
+		{GroupVersionKind: rolloutGVK},
+		{GroupVersionKind: taskGVK, ImagePaths: []string{".spec.steps[*.image"}},
+		{GroupVersionKind: taskGVK, ImagePaths: []string{".spec.steps[*].image"}},
+		{GroupVersionKind: taskGVK, ImagePaths: []string{".spec.steps[*].image"}},
+	}
+	err := ValidateCustomResources(invalid)
+	if err == nil {
+		t.Fatalf("expected validation errors")
+	}
+	for _, want := range []string{"version and kind are required", "at least one podSpecPaths or imagePaths", "image path", "declared more than once"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Fatalf("expected error to mention %q, got %v", want, err)
+		}
+	}
+}
+
+func TestCustomResourceReconcilerMirrorsImages(t *testing.T) {
+	client := fake.NewClientBuilder().WithScheme(newCustomScheme()).WithObjects(rollout("web"), rollout("canary")).Build()
+	ext, err := newCustomExtractor(CustomResource{
+		GroupVersionKind: rolloutGVK,
+		PodSpecPaths:     []string{".spec.template.spec"},
+		SkipNames:        []string{"canary"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected extractor error: %v", err)
+	}
+	pusher := &recordingPusher{}
+	reconciler := CustomResourceReconciler{
+		baseReconciler: baseReconciler{Client: client, Pusher: pusher, AllowedNamespaces: []string{"*"}},
+		extractor:      ext,
+	}
+
+	ctx := context.Background()
+	for _, name := range []string{"web", "canary"} {
+		if _, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: name}}); err != nil {
+			t.Fatalf("reconcile %s: %v", name, err)
+		}
+	}
+	expected := []string{"docker.io/library/busybox:1.36", "docker.io/library/nginx:1.27"}
+	if !reflect.DeepEqual(pusher.calls, expected) {
+		t.Fatalf("expected only the non-skipped rollout to be mirrored, got %v", pusher.calls)
+	}
+	if pusher.metas[1].ContainerName != "app" || pusher.metas[1].PodName != "web" {
+		t.Fatalf("unexpected metadata: %+v", pusher.metas[1])
+	}
+}
+
+func TestForceReconcileIncludesCustomResources(t *testing.T) {
+	scheme := newCustomScheme()
+	if err := corev1.AddToScheme(scheme); err != nil {
+		t.Fatalf("add core scheme: %v", err)
+	}
+	client := fake.NewClientBuilder().WithScheme(scheme).WithObjects(task("build")).Build()
+	ext, err := newCustomExtractor(CustomResource{GroupVersionKind: taskGVK, ImagePaths: []string{".spec.steps[*].image"}})
+	if err != nil {
+		t.Fatalf("unexpected extractor error: %v", err)
+	}
+	pusher := &recordingPusher{}
+	reconciler := ForceReconciler{
+		baseReconciler: baseReconciler{Client: client, Pusher: pusher, AllowedNamespaces: []string{"*"}},
+		watch:          []ResourceType{ResourcePods},
+		custom:         []*customExtractor{ext},
+	}
+
+	workloads, mirrored, err := reconciler.ForceReconcile(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected force reconcile error: %v", err)
+	}
+	if workloads != 1 || mirrored != 2 {
+		t.Fatalf("expected one custom workload with two images, got workloads=%d mirrored=%d", workloads, mirrored)
+	}
+}
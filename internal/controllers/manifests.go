@@ -0,0 +1,206 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+
+	"github.com/matzegebbe/k8s-copycat/pkg/util"
+)
+
+// ManifestWorkload is a workload found in a manifest together with its images. Skipped names the
+// setting that keeps copycat from mirroring it in a cluster; its images are listed regardless.
+type ManifestWorkload struct {
+	File      string
+	Kind      string
+	Namespace string
+	Name      string
+	Images    []util.PodImage
+	Skipped   string
+}
+
+// manifestKind decodes the pod spec of a built-in workload kind.
+type manifestKind struct {
+	resource ResourceType
+	podSpec  func(obj map[string]interface{}) (*corev1.PodSpec, error)
+	skip     func(r *baseReconciler) nameMatcher
+}
+
+var manifestKinds = map[schema.GroupKind]manifestKind{
+	{Group: "apps", Kind: "Deployment"}: {ResourceDeployments, func(obj map[string]interface{}) (*corev1.PodSpec, error) {
+		var d appsv1.Deployment
+		err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj, &d)
+		return &d.Spec.Template.Spec, err
+	}, func(r *baseReconciler) nameMatcher { return r.SkipDeployments }},
+	{Group: "apps", Kind: "StatefulSet"}: {ResourceStatefulSets, func(obj map[string]interface{}) (*corev1.PodSpec, error) {
+		var s appsv1.StatefulSet
+		err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj, &s)
+		return &s.Spec.Template.Spec, err
+	}, func(r *baseReconciler) nameMatcher { return r.SkipStatefulSets }},
+	{Group: "apps", Kind: "DaemonSet"}: {ResourceDaemonSets, func(obj map[string]interface{}) (*corev1.PodSpec, error) {
+		var ds appsv1.DaemonSet
+		err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj, &ds)
+		return &ds.Spec.Template.Spec, err
+	}, func(r *baseReconciler) nameMatcher { return r.SkipDaemonSets }},
+	{Group: "apps", Kind: "ReplicaSet"}: {ResourceReplicaSets, func(obj map[string]interface{}) (*corev1.PodSpec, error) {
+		var rs appsv1.ReplicaSet
+		err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj, &rs)
+		return &rs.Spec.Template.Spec, err
+	}, func(r *baseReconciler) nameMatcher { return r.SkipReplicaSets }},
+	{Group: "batch", Kind: "Job"}: {ResourceJobs, func(obj map[string]interface{}) (*corev1.PodSpec, error) {
+		var j batchv1.Job
+		err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj, &j)
+		return &j.Spec.Template.Spec, err
+	}, func(r *baseReconciler) nameMatcher { return r.SkipJobs }},
+	{Group: "batch", Kind: "CronJob"}: {ResourceCronJobs, func(obj map[string]interface{}) (*corev1.PodSpec, error) {
+		var cj batchv1.CronJob
+		err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj, &cj)
+		return &cj.Spec.JobTemplate.Spec.Template.Spec, err
+	}, func(r *baseReconciler) nameMatcher { return r.SkipCronJobs }},
+	{Kind: "Pod"}: {ResourcePods, func(obj map[string]interface{}) (*corev1.PodSpec, error) {
+		var p corev1.Pod
+		err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj, &p)
+		return &p.Spec, err
+	}, func(r *baseReconciler) nameMatcher { return r.SkipPods }},
+	{Kind: "ReplicationController"}: {ResourceReplicationControllers, func(obj map[string]interface{}) (*corev1.PodSpec, error) {
+		var rc corev1.ReplicationController
+		err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj, &rc)
+		if rc.Spec.Template == nil {
+			return nil, err
+		}
+		return &rc.Spec.Template.Spec, err
+	}, func(r *baseReconciler) nameMatcher { return r.SkipReplicationControllers }},
+	{Kind: "PodTemplate"}: {ResourcePodTemplates, func(obj map[string]interface{}) (*corev1.PodSpec, error) {
+		var pt corev1.PodTemplate
+		err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj, &pt)
+		return &pt.Template.Spec, err
+	}, func(r *baseReconciler) nameMatcher { return r.SkipPodTemplates }},
+}
+
+// ManifestScanner finds the images of workloads in Kubernetes manifests, such as the output of
+// helm template or kustomize build, with the rules the controllers apply in a cluster. Namespace
+// label selectors need the live namespace and are not evaluated.
+type ManifestScanner struct {
+	base             baseReconciler
+	watch            map[ResourceType]struct{}
+	custom           map[schema.GroupVersionKind]*customExtractor
+	defaultNamespace string
+}
+
+// NewManifestScanner returns a scanner for the given configuration. Manifests without a
+// namespace are attributed to defaultNamespace.
+func NewManifestScanner(allowedNS []string, skipCfg SkipConfig, selectors SelectorConfig, watch []ResourceType, custom []CustomResource, defaultNamespace string) (*ManifestScanner, error) {
+	if len(watch) == 0 {
+		watch = DefaultResourceTypes()
+	}
+	s := &ManifestScanner{
+		base:             newBaseReconciler(allowedNS, skipCfg, selectors),
+		watch:            make(map[ResourceType]struct{}, len(watch)),
+		custom:           make(map[schema.GroupVersionKind]*customExtractor, len(custom)),
+		defaultNamespace: strings.TrimSpace(defaultNamespace),
+	}
+	if s.defaultNamespace == "" {
+		s.defaultNamespace = metav1.NamespaceDefault
+	}
+	for _, res := range watch {
+		s.watch[res] = struct{}{}
+	}
+	for _, res := range custom {
+		ext, err := newCustomExtractor(res)
+		if err != nil {
+			return nil, err
+		}
+		s.custom[res.GroupVersionKind] = ext
+	}
+	return s, nil
+}
+
+// Scan decodes the YAML or JSON documents in r and returns the workloads with images. Objects of
+// other kinds are ignored; List objects are expanded. file is recorded on every workload.
+func (s *ManifestScanner) Scan(r io.Reader, file string) ([]ManifestWorkload, error) {
+	decoder := utilyaml.NewYAMLOrJSONDecoder(r, 4096)
+	var out []ManifestWorkload
+	for doc := 1; ; doc++ {
+		var obj map[string]interface{}
+		if err := decoder.Decode(&obj); err != nil {
+			if errors.Is(err, io.EOF) {
+				return out, nil
+			}
+			return out, fmt.Errorf("document %d: %w", doc, err)
+		}
+		if len(obj) == 0 {
+			continue
+		}
+		workloads, err := s.scanObject(&unstructured.Unstructured{Object: obj}, file)
+		if err != nil {
+			return out, fmt.Errorf("document %d: %w", doc, err)
+		}
+		out = append(out, workloads...)
+	}
+}
+
+func (s *ManifestScanner) scanObject(obj *unstructured.Unstructured, file string) ([]ManifestWorkload, error) {
+	if obj.IsList() {
+		var out []ManifestWorkload
+		err := obj.EachListItem(func(item runtime.Object) error {
+			workloads, err := s.scanObject(item.(*unstructured.Unstructured), file)
+			out = append(out, workloads...)
+			return err
+		})
+		return out, err
+	}
+
+	gvk := obj.GroupVersionKind()
+	w := ManifestWorkload{File: file, Kind: gvk.Kind, Namespace: obj.GetNamespace(), Name: obj.GetName()}
+	if w.Namespace == "" {
+		w.Namespace = s.defaultNamespace
+	}
+	var skip nameMatcher
+	if ext, ok := s.custom[gvk]; ok {
+		images, err := ext.imagesFrom(obj)
+		if err != nil {
+			return nil, fmt.Errorf("%s %s: %w", gvk.Kind, obj.GetName(), err)
+		}
+		w.Images = images
+		skip = ext.skip
+	} else {
+		kind, ok := manifestKinds[gvk.GroupKind()]
+		if !ok {
+			return nil, nil
+		}
+		spec, err := kind.podSpec(obj.Object)
+		if err != nil {
+			return nil, fmt.Errorf("decode %s %s: %w", gvk.Kind, obj.GetName(), err)
+		}
+		w.Images = util.ImagesFromPodSpec(spec)
+		skip = kind.skip(&s.base)
+		if _, watched := s.watch[kind.resource]; !watched {
+			w.Skipped = "watchResources"
+		}
+	}
+	if len(w.Images) == 0 {
+		return nil, nil
+	}
+	switch {
+	case w.Skipped != "":
+	case s.base.namespaceSkipped(w.Namespace):
+		w.Skipped = "skipNamespaces"
+	case !s.base.namespaceListed(w.Namespace):
+		w.Skipped = "includeNamespaces"
+	case skip.matches(w.Namespace, w.Name):
+		w.Skipped = "skipNames"
+	case !s.base.workloadSelected(obj):
+		w.Skipped = "workloadSelector"
+	}
+	return []ManifestWorkload{w}, nil
+}
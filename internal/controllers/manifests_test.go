@@ -0,0 +1,144 @@
+package controllers
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const scanManifests = `# Source: shop/templates/api.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: api
+spec:
+  template:
+    spec:
+      initContainers:
+        - name: migrate
+          image: ghcr.io/acme/migrate:1.0
+      containers:
+        - name: api
+          image: ghcr.io/acme/api:2.4.0
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: api
+---
+---
+apiVersion: batch/v1
+kind: CronJob
+metadata:
+  name: cleanup
+  namespace: kube-system
+spec:
+  schedule: "0 * * * *"
+  jobTemplate:
+    spec:
+      template:
+        spec:
+          containers:
+            - name: cleanup
+              image: busybox:1.36
+---
+{"apiVersion": "v1", "kind": "List", "items": [
+  {"apiVersion": "v1", "kind": "Pod", "metadata": {"name": "debug", "labels": {"tier": "dev"}}, "spec": {"containers": [{"name": "sh", "image": "alpine:3.20"}]}},
+  {"apiVersion": "v1", "kind": "PodTemplate", "metadata": {"name": "tpl"}, "template": {"spec": {"containers": [{"name": "c", "image": "redis:7"}]}}}
+]}
+---
+apiVersion: argoproj.io/v1alpha1
+kind: Rollout
+metadata:
+  name: web
+  namespace: shop
+spec:
+  template:
+    spec:
+      containers:
+        - name: web
+          image: nginx:1.27
+`
+
+func TestManifestScannerFindsWorkloadImages(t *testing.T) {
+	scanner, err := NewManifestScanner(
+		[]string{"*"},
+		SkipConfig{Namespaces: []string{"kube-system"}},
+		SelectorConfig{Workloads: labels.SelectorFromSet(labels.Set{"tier": "prod"})},
+		nil,
+		[]CustomResource{{GroupVersionKind: schema.GroupVersionKind{Group: "argoproj.io", Version: "v1alpha1", Kind: "Rollout"}, PodSpecPaths: []string{".spec.template.spec"}}},
+		"shop",
+	)
+	if err != nil {
+		t.Fatalf("new scanner: %v", err)
+	}
+	workloads, err := scanner.Scan(strings.NewReader(scanManifests), "rendered.yaml")
+	if err != nil {
+		t.Fatalf("scan: %v", err)
+	}
+
+	type summary struct {
+		kind, namespace, name, skipped string
+		images                         []string
+	}
+	var got []summary
+	for _, w := range workloads {
+		if w.File != "rendered.yaml" {
+			t.Fatalf("expected file to be recorded, got %q", w.File)
+		}
+		s := summary{kind: w.Kind, namespace: w.Namespace, name: w.Name, skipped: w.Skipped}
+		for _, img := range w.Images {
+			s.images = append(s.images, img.Image)
+		}
+		got = append(got, s)
+	}
+	want := []summary{
+		{"Deployment", "shop", "api", "workloadSelector", []string{"ghcr.io/acme/migrate:1.0", "ghcr.io/acme/api:2.4.0"}},
+		{"CronJob", "kube-system", "cleanup", "skipNamespaces", []string{"busybox:1.36"}},
+		{"Pod", "shop", "debug", "workloadSelector", []string{"alpine:3.20"}},
+		{"PodTemplate", "shop", "tpl", "watchResources", []string{"redis:7"}},
+		{"Rollout", "shop", "web", "workloadSelector", []string{"nginx:1.27"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected workloads:\n got %+v\nwant %+v", got, want)
+	}
+}
+
+func TestManifestScannerAppliesSkipNames(t *testing.T) {
+	scanner, err := NewManifestScanner([]string{"shop"}, SkipConfig{Deployments: []string{"shop/api"}}, SelectorConfig{}, nil, nil, "")
+	if err != nil {
+		t.Fatalf("new scanner: %v", err)
+	}
+	workloads, err := scanner.Scan(strings.NewReader(scanManifests), "")
+	if err != nil {
+		t.Fatalf("scan: %v", err)
+	}
+	skipped := make(map[string]string, len(workloads))
+	for _, w := range workloads {
+		skipped[w.Kind+"/"+w.Namespace+"/"+w.Name] = w.Skipped
+	}
+	want := map[string]string{
+		"Deployment/default/api":      "includeNamespaces",
+		"CronJob/kube-system/cleanup": "includeNamespaces",
+		"Pod/default/debug":           "includeNamespaces",
+		"PodTemplate/default/tpl":     "watchResources",
+	}
+	if !reflect.DeepEqual(skipped, want) {
+		t.Fatalf("unexpected skip reasons %v", skipped)
+	}
+
+	workloads, err = scanner.Scan(strings.NewReader("apiVersion: apps/v1\nkind: Deployment\nmetadata: {name: api, namespace: shop}\nspec: {template: {spec: {containers: [{name: api, image: api:1}]}}}\n"), "")
+	if err != nil {
+		t.Fatalf("scan: %v", err)
+	}
+	if len(workloads) != 1 || workloads[0].Skipped != "skipNames" {
+		t.Fatalf("expected skipped deployment, got %+v", workloads)
+	}
+
+	if _, err := scanner.Scan(strings.NewReader("kind: [unterminated"), ""); err == nil || !strings.Contains(err.Error(), "document 1") {
+		t.Fatalf("expected decode error naming the document, got %v", err)
+	}
+}
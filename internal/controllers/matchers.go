@@ -0,0 +1,270 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// stringPattern matches a single namespace or object name. Values wrapped in slashes
+// (for example /^tmp-.*/) are regular expressions, values containing *, ? or [ are globs and
+// everything else must match exactly.
+type stringPattern struct {
+	literal string
+	glob    bool
+	re      *regexp.Regexp
+}
+
+func parseStringPattern(value string) (stringPattern, error) {
+	if len(value) >= 2 && strings.HasPrefix(value, "/") && strings.HasSuffix(value, "/") {
+		re, err := regexp.Compile(value[1 : len(value)-1])
+		if err != nil {
+			return stringPattern{}, fmt.Errorf("invalid regular expression %q: %w", value, err)
+		}
+		return stringPattern{re: re}, nil
+	}
+	if hasWildcard(value) {
+		if _, err := path.Match(value, ""); err != nil {
+			return stringPattern{}, fmt.Errorf("invalid glob pattern %q: %w", value, err)
+		}
+		return stringPattern{literal: value, glob: true}, nil
+	}
+	return stringPattern{literal: value}, nil
+}
+
+func (p stringPattern) matches(value string) bool {
+	switch {
+	case p.re != nil:
+		return p.re.MatchString(value)
+	case p.glob:
+		ok, _ := path.Match(p.literal, value)
+		return ok
+	default:
+		return p.literal == value
+	}
+}
+
+func (p stringPattern) exact() bool {
+	return p.re == nil && !p.glob
+}
+
+// patternSet matches a value against a list of exact names, globs and regular expressions.
+type patternSet struct {
+	exact    map[string]struct{}
+	patterns []stringPattern
+}
+
+// newPatternSet builds a patternSet from configuration values. Invalid patterns are ignored;
+// SkipConfig.Validate reports them at startup.
+func newPatternSet(values []string) patternSet {
+	s := patternSet{}
+	for _, raw := range values {
+		value := strings.TrimSpace(raw)
+		if value == "" {
+			continue
+		}
+		p, err := parseStringPattern(value)
+		if err != nil {
+			continue
+		}
+		if p.exact() {
+			if s.exact == nil {
+				s.exact = make(map[string]struct{})
+			}
+			s.exact[value] = struct{}{}
+			continue
+		}
+		s.patterns = append(s.patterns, p)
+	}
+	return s
+}
+
+func (s patternSet) matches(value string) bool {
+	if _, ok := s.exact[value]; ok {
+		return true
+	}
+	for _, p := range s.patterns {
+		if p.matches(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// namePattern matches object names, optionally restricted to namespaces matching namespace.
+type namePattern struct {
+	namespace *stringPattern
+	name      stringPattern
+}
+
+type nameMatcher struct {
+	matchAll   bool
+	any        map[string]struct{}
+	namespaced map[string]map[string]struct{}
+	patterns   []namePattern
+}
+
+// newNameMatcher parses skip entries of the form name or namespace/name. Either part may be an
+// exact value, a glob such as ci-runner-* or a regular expression wrapped in slashes such as
+// /^tmp-.*/. Invalid entries are ignored; SkipConfig.Validate reports them at startup.
+func newNameMatcher(values []string) nameMatcher {
+	m := nameMatcher{}
+	for _, raw := range values {
+		entry := strings.TrimSpace(raw)
+		if entry == "" {
+			continue
+		}
+		if entry == "*" {
+			m.matchAll = true
+			continue
+		}
+		ns, name, err := parseNameEntry(entry)
+		if err != nil {
+			continue
+		}
+		switch {
+		case ns == nil && name.exact():
+			if m.any == nil {
+				m.any = make(map[string]struct{})
+			}
+			m.any[name.literal] = struct{}{}
+		case ns != nil && ns.exact() && name.exact():
+			if m.namespaced == nil {
+				m.namespaced = make(map[string]map[string]struct{})
+			}
+			nsSet := m.namespaced[ns.literal]
+			if nsSet == nil {
+				nsSet = make(map[string]struct{})
+				m.namespaced[ns.literal] = nsSet
+			}
+			nsSet[name.literal] = struct{}{}
+		default:
+			m.patterns = append(m.patterns, namePattern{namespace: ns, name: name})
+		}
+	}
+	return m
+}
+
+// parseNameEntry splits a skip entry into its optional namespace part and its name part.
+func parseNameEntry(entry string) (*stringPattern, stringPattern, error) {
+	var nsPart, namePart string
+	namespaced := false
+	if strings.HasPrefix(entry, "/") {
+		end := closingSlash(entry)
+		if end < 0 {
+			return nil, stringPattern{}, fmt.Errorf("unterminated regular expression %q", entry)
+		}
+		rest := entry[end+1:]
+		switch {
+		case rest == "":
+			namePart = entry
+		case strings.HasPrefix(rest, "/"):
+			nsPart, namePart, namespaced = entry[:end+1], rest[1:], true
+		default:
+			return nil, stringPattern{}, fmt.Errorf("unexpected %q after regular expression in %q", rest, entry)
+		}
+	} else if idx := strings.Index(entry, "/"); idx >= 0 {
+		nsPart, namePart, namespaced = entry[:idx], entry[idx+1:], true
+	} else {
+		namePart = entry
+	}
+
+	nsPart = strings.TrimSpace(nsPart)
+	namePart = strings.TrimSpace(namePart)
+	if namePart == "" || (namespaced && nsPart == "") {
+		return nil, stringPattern{}, fmt.Errorf("entry %q must use name or namespace/name", entry)
+	}
+	name, err := parseStringPattern(namePart)
+	if err != nil {
+		return nil, stringPattern{}, err
+	}
+	if !namespaced {
+		return nil, name, nil
+	}
+	ns, err := parseStringPattern(nsPart)
+	if err != nil {
+		return nil, stringPattern{}, err
+	}
+	return &ns, name, nil
+}
+
+// closingSlash returns the index of the slash terminating a regular expression that starts at
+// index 0, skipping escaped slashes.
+func closingSlash(value string) int {
+	for i := 1; i < len(value); i++ {
+		switch value[i] {
+		case '\\':
+			i++
+		case '/':
+			return i
+		}
+	}
+	return -1
+}
+
+func (m nameMatcher) matches(namespace, name string) bool {
+	if m.matchAll {
+		return true
+	}
+	if len(m.any) > 0 {
+		if _, ok := m.any[name]; ok {
+			return true
+		}
+	}
+	if len(m.namespaced) > 0 {
+		if nsSet, ok := m.namespaced[namespace]; ok {
+			if _, ok := nsSet[name]; ok {
+				return true
+			}
+		}
+	}
+	for _, p := range m.patterns {
+		if p.namespace != nil && !p.namespace.matches(namespace) {
+			continue
+		}
+		if p.name.matches(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate reports skip entries whose glob or regular expression cannot be parsed.
+func (c SkipConfig) Validate() error {
+	var errs []error
+	for _, raw := range c.Namespaces {
+		if value := strings.TrimSpace(raw); value != "" {
+			if _, err := parseStringPattern(value); err != nil {
+				errs = append(errs, fmt.Errorf("skip namespaces: %w", err))
+			}
+		}
+	}
+	lists := []struct {
+		kind    string
+		entries []string
+	}{
+		{"deployments", c.Deployments},
+		{"statefulsets", c.StatefulSets},
+		{"daemonsets", c.DaemonSets},
+		{"jobs", c.Jobs},
+		{"cronjobs", c.CronJobs},
+		{"pods", c.Pods},
+		{"replicasets", c.ReplicaSets},
+		{"replicationcontrollers", c.ReplicationControllers},
+		{"podtemplates", c.PodTemplates},
+	}
+	for _, list := range lists {
+		for _, raw := range list.entries {
+			entry := strings.TrimSpace(raw)
+			if entry == "" || entry == "*" {
+				continue
+			}
+			if _, _, err := parseNameEntry(entry); err != nil {
+				errs = append(errs, fmt.Errorf("skip %s: %w", list.kind, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
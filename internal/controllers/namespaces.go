@@ -0,0 +1,156 @@
+package controllers
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+// NamespaceTrackingRequired reports whether the namespace configuration can only be evaluated
+// against live namespaces. Glob patterns and label selectors match namespaces that may be
+// created or relabelled after startup, so they require a cluster-wide cache filtered by
+// nsAllowed instead of a fixed list of namespaces.
+func NamespaceTrackingRequired(allowedNS []string, selector labels.Selector) bool {
+	if selector != nil && !selector.Empty() {
+		return true
+	}
+	for _, ns := range allowedNS {
+		trimmed := strings.TrimSpace(ns)
+		if trimmed != "*" && hasWildcard(trimmed) {
+			return true
+		}
+	}
+	return false
+}
+
+// NamespaceExclusion names the setting that keeps workloads in ns from being mirrored,
+// skipNamespaces or includeNamespaces, or returns an empty string when ns is included. Namespace
+// label selectors need the live namespace and are not evaluated.
+func NamespaceExclusion(allowedNS []string, skip SkipConfig, ns string) string {
+	r := baseReconciler{AllowedNamespaces: allowedNS, SkippedNamespaces: newPatternSet(skip.Namespaces)}
+	switch {
+	case r.namespaceSkipped(ns):
+		return "skipNamespaces"
+	case !r.namespaceListed(ns):
+		return "includeNamespaces"
+	}
+	return ""
+}
+
+func hasWildcard(value string) bool {
+	return strings.ContainsAny(value, "*?[")
+}
+
+// NamespaceReconciler re-evaluates include, skip and selector rules whenever namespaces are
+// created, relabelled or deleted. Workloads in a namespace that becomes eligible after startup
+// are mirrored right away instead of waiting for the next resync.
+type NamespaceReconciler struct {
+	baseReconciler
+	force *ForceReconciler
+
+	mu      sync.Mutex
+	tracked map[string]bool
+	seeded  bool
+}
+
+func (r *NamespaceReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := ctrl.LoggerFrom(ctx).WithValues("namespace", req.Name)
+
+	var ns corev1.Namespace
+	if err := r.Get(ctx, req.NamespacedName, &ns); err != nil {
+		if apierrors.IsNotFound(err) {
+			if r.forget(req.Name) {
+				log.Info("stopped tracking deleted namespace")
+			}
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
+
+	allowed := r.nsAllowed(ctx, ns.Name)
+	previous, seen, seeded := r.update(ns.Name, allowed)
+	switch {
+	case !seeded:
+		log.V(1).Info("observed namespace during startup", "tracked", allowed)
+		return ctrl.Result{}, nil
+	case allowed == previous && seen:
+		return ctrl.Result{}, nil
+	case !allowed:
+		if seen {
+			log.Info("namespace no longer matches include configuration; stopped tracking")
+		}
+		return ctrl.Result{}, nil
+	}
+
+	log.Info("namespace now matches include configuration; mirroring its workloads")
+	workloads, images, err := r.force.ReconcileNamespace(ctx, ns.Name)
+	log.V(1).Info("mirrored workloads in newly tracked namespace", "workloadsProcessed", workloads, "imagesMirrored", images)
+	return mirrorResultForError(err)
+}
+
+// update records the allowed state for a namespace and returns the previous state, whether the
+// namespace was known before and whether the initial namespace inventory has been recorded.
+func (r *NamespaceReconciler) update(name string, allowed bool) (bool, bool, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.tracked == nil {
+		r.tracked = make(map[string]bool)
+	}
+	previous, seen := r.tracked[name]
+	r.tracked[name] = allowed
+	return previous, seen, r.seeded
+}
+
+func (r *NamespaceReconciler) forget(name string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	allowed := r.tracked[name]
+	delete(r.tracked, name)
+	return allowed
+}
+
+// seed records every namespace present once the cache has synced. Namespaces that show up
+// afterwards are new or newly selected, so their workloads are reconciled immediately.
+func (r *NamespaceReconciler) seed(ctx context.Context, c cache.Cache) error {
+	if !c.WaitForCacheSync(ctx) {
+		return nil
+	}
+	var list corev1.NamespaceList
+	if err := r.List(ctx, &list); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.tracked == nil {
+		r.tracked = make(map[string]bool, len(list.Items))
+	}
+	for i := range list.Items {
+		name := list.Items[i].Name
+		if _, ok := r.tracked[name]; !ok {
+			r.tracked[name] = r.nsAllowed(ctx, name)
+		}
+	}
+	r.seeded = true
+	ctrl.LoggerFrom(ctx).V(1).Info("recorded initial namespace inventory", "namespaces", len(list.Items))
+	return nil
+}
+
+func (r *NamespaceReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if err := mgr.Add(manager.RunnableFunc(func(ctx context.Context) error {
+		return r.seed(ctx, mgr.GetCache())
+	})); err != nil {
+		return err
+	}
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&corev1.Namespace{}).
+		WithEventFilter(predicate.LabelChangedPredicate{}).
+		Complete(r)
+}
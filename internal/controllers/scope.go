@@ -0,0 +1,175 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+
+	"github.com/matzegebbe/k8s-copycat/internal/mirror"
+)
+
+// ForceReconcileScope narrows a force reconcile. Empty fields select everything.
+type ForceReconcileScope struct {
+	// Namespaces are exact names, globs or regular expressions wrapped in slashes. Namespaces
+	// excluded by the configuration stay excluded.
+	Namespaces []string `json:"namespaces,omitempty"`
+	// Resources are watched resource types such as deployments, or the lowercase kind of a
+	// custom resource.
+	Resources []string `json:"resources,omitempty"`
+	// Image is an exact reference, a glob or a regular expression wrapped in slashes, matched
+	// against the reference as written in the workload and its fully qualified form, such as
+	// docker.io/library/nginx:1.27.
+	Image string `json:"image,omitempty"`
+	// FailedOnly mirrors only images whose last mirror failed.
+	FailedOnly bool `json:"failedOnly,omitempty"`
+}
+
+// ForceReconcileProgress is called after each processed workload with the running totals.
+type ForceReconcileProgress func(workloads, images int)
+
+type forceScope struct {
+	namespaces patternSet
+	resources  map[string]struct{}
+	image      *stringPattern
+	failed     mirror.ImageInventory
+	progress   ForceReconcileProgress
+	// collect, when set, receives the selected images instead of the pusher.
+	collect func(image string, meta mirror.Metadata)
+}
+
+type forceScopeKey struct{}
+
+// ValidateScope reports resource types and patterns of scope that a force reconcile cannot use.
+func (r *ForceReconciler) ValidateScope(scope ForceReconcileScope) error {
+	_, err := r.compileScope(scope, nil)
+	return err
+}
+
+// ReconcileScope mirrors the images of the watched workloads selected by scope. progress, if not
+// nil, is called after every workload. Cancelling ctx stops the reconcile before the next
+// workload.
+func (r *ForceReconciler) ReconcileScope(ctx context.Context, scope ForceReconcileScope, progress ForceReconcileProgress) (int, int, error) {
+	compiled, err := r.compileScope(scope, progress)
+	if err != nil {
+		return 0, 0, err
+	}
+	return r.reconcileAll(context.WithValue(ctx, forceScopeKey{}, compiled), "")
+}
+
+// WatchedImages lists the images of every watched workload with the metadata a reconcile would
+// mirror them with, without mirroring them.
+func (r *ForceReconciler) WatchedImages(ctx context.Context) ([]mirror.WorkloadImage, error) {
+	var images []mirror.WorkloadImage
+	scope := &forceScope{collect: func(image string, meta mirror.Metadata) {
+		images = append(images, mirror.WorkloadImage{Image: image, Meta: meta})
+	}}
+	if _, _, err := r.reconcileWatched(context.WithValue(ctx, forceScopeKey{}, scope), ""); err != nil {
+		return nil, err
+	}
+	return images, nil
+}
+
+func (r *ForceReconciler) compileScope(scope ForceReconcileScope, progress ForceReconcileProgress) (*forceScope, error) {
+	var errs []error
+	compiled := &forceScope{progress: progress}
+	for _, raw := range scope.Namespaces {
+		if _, err := parseStringPattern(strings.TrimSpace(raw)); err != nil {
+			errs = append(errs, fmt.Errorf("namespaces: %w", err))
+		}
+	}
+	compiled.namespaces = newPatternSet(scope.Namespaces)
+	if len(scope.Resources) > 0 {
+		known := make(map[string]struct{})
+		for _, res := range r.watchedResources() {
+			known[string(res)] = struct{}{}
+		}
+		for _, ext := range r.custom {
+			known[strings.ToLower(ext.gvk.Kind)] = struct{}{}
+		}
+		compiled.resources = make(map[string]struct{}, len(scope.Resources))
+		for _, raw := range scope.Resources {
+			res := strings.ToLower(strings.TrimSpace(raw))
+			if res == "" {
+				continue
+			}
+			if _, ok := known[res]; !ok {
+				errs = append(errs, fmt.Errorf("resources: %q is not watched", raw))
+				continue
+			}
+			compiled.resources[res] = struct{}{}
+		}
+	}
+	if image := strings.TrimSpace(scope.Image); image != "" {
+		p, err := parseStringPattern(image)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("image: %w", err))
+		}
+		compiled.image = &p
+	}
+	if scope.FailedOnly {
+		inventory, ok := r.Pusher.(mirror.ImageInventory)
+		if !ok {
+			errs = append(errs, errors.New("failed only: the mirror status of images is not available"))
+		}
+		compiled.failed = inventory
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return compiled, nil
+}
+
+func forceScopeFrom(ctx context.Context) *forceScope {
+	scope, _ := ctx.Value(forceScopeKey{}).(*forceScope)
+	return scope
+}
+
+func (s *forceScope) namespaceSelected(ns string) bool {
+	if s == nil || (len(s.namespaces.exact) == 0 && len(s.namespaces.patterns) == 0) {
+		return true
+	}
+	return s.namespaces.matches(ns)
+}
+
+func (s *forceScope) resourceSelected(res string) bool {
+	if s == nil || s.resources == nil {
+		return true
+	}
+	_, ok := s.resources[res]
+	return ok
+}
+
+func (s *forceScope) imageSelected(image string, meta mirror.Metadata) bool {
+	if s == nil {
+		return true
+	}
+	if s.image != nil && !s.image.matches(image) {
+		ref, err := name.ParseReference(image, name.WeakValidation)
+		if err != nil {
+			return false
+		}
+		full := ref.Name()
+		if rest, ok := strings.CutPrefix(full, name.DefaultRegistry+"/"); ok {
+			full = "docker.io/" + rest
+		}
+		if !s.image.matches(full) {
+			return false
+		}
+	}
+	if s.failed != nil {
+		record, ok := s.failed.ImageFor(image, meta)
+		if !ok || (record.Status != mirror.ImageFailed && record.Status != mirror.ImageCooldown) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *forceScope) report(workloads, images int) {
+	if s != nil && s.progress != nil {
+		s.progress(workloads, images)
+	}
+}
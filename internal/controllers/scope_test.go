@@ -0,0 +1,160 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/matzegebbe/k8s-copycat/internal/mirror"
+)
+
+// inventoryPusher reports every image in failed as failed.
+type inventoryPusher struct {
+	recordingPusher
+	failed map[string]bool
+}
+
+func (*inventoryPusher) Images() []mirror.ImageRecord { return nil }
+
+func (p *inventoryPusher) Image(ref string) []mirror.ImageRecord {
+	record, _ := p.ImageFor(ref, mirror.Metadata{})
+	return []mirror.ImageRecord{record}
+}
+
+func (p *inventoryPusher) ImageFor(ref string, _ mirror.Metadata) (mirror.ImageRecord, bool) {
+	if p.failed[ref] {
+		return mirror.ImageRecord{Source: ref, Status: mirror.ImageFailed}, true
+	}
+	return mirror.ImageRecord{Source: ref, Status: mirror.ImageMirrored}, true
+}
+
+func scopedReconciler(t *testing.T, pusher mirror.Pusher) *ForceReconciler {
+	t.Helper()
+	scheme := runtime.NewScheme()
+	if err := appsv1.AddToScheme(scheme); err != nil {
+		t.Fatalf("add apps scheme: %v", err)
+	}
+	if err := corev1.AddToScheme(scheme); err != nil {
+		t.Fatalf("add core scheme: %v", err)
+	}
+	deployment := func(ns, name, image string) *appsv1.Deployment {
+		return &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: ns},
+			Spec: appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+				Containers: []corev1.Container{{Name: "app", Image: image}},
+			}}},
+		}
+	}
+	template := &corev1.PodTemplate{
+		ObjectMeta: metav1.ObjectMeta{Name: "runner", Namespace: "team-a"},
+		Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{Name: "runner", Image: "alpine:3.20"}},
+		}},
+	}
+	client := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		deployment("team-a", "web", "nginx:1.27"),
+		deployment("team-a", "api", "ghcr.io/acme/api:2"),
+		deployment("team-b", "web", "nginx:1.27"),
+		template,
+	).Build()
+	return &ForceReconciler{
+		baseReconciler: baseReconciler{Client: client, Pusher: pusher, AllowedNamespaces: []string{"*"}},
+		watch:          []ResourceType{ResourceDeployments, ResourcePodTemplates},
+	}
+}
+
+func TestReconcileScopeFiltersNamespacesResourcesAndImages(t *testing.T) {
+	pusher := &recordingPusher{}
+	reconciler := scopedReconciler(t, pusher)
+
+	var progress []int
+	scope := ForceReconcileScope{Namespaces: []string{"team-*"}, Resources: []string{"deployments"}, Image: "docker.io/library/*"}
+	workloads, images, err := reconciler.ReconcileScope(context.Background(), scope, func(workloads, _ int) {
+		progress = append(progress, workloads)
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if workloads != 3 || images != 2 {
+		t.Fatalf("expected three workloads and two images, got workloads=%d images=%d", workloads, images)
+	}
+	if !reflect.DeepEqual(pusher.calls, []string{"nginx:1.27", "nginx:1.27"}) {
+		t.Fatalf("unexpected mirrored images: %v", pusher.calls)
+	}
+	if !reflect.DeepEqual(progress, []int{1, 2, 3}) {
+		t.Fatalf("expected progress after every workload, got %v", progress)
+	}
+
+	pusher.calls = nil
+	if _, _, err := reconciler.ReconcileScope(context.Background(), ForceReconcileScope{Namespaces: []string{"team-b"}}, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(pusher.calls, []string{"nginx:1.27"}) {
+		t.Fatalf("expected only team-b to be reconciled, got %v", pusher.calls)
+	}
+}
+
+func TestReconcileScopeFailedOnly(t *testing.T) {
+	pusher := &inventoryPusher{failed: map[string]bool{"ghcr.io/acme/api:2": true}}
+	reconciler := scopedReconciler(t, pusher)
+
+	if _, images, err := reconciler.ReconcileScope(context.Background(), ForceReconcileScope{FailedOnly: true}, nil); err != nil || images != 1 {
+		t.Fatalf("expected one failed image to be mirrored, got images=%d err=%v", images, err)
+	}
+	if !reflect.DeepEqual(pusher.calls, []string{"ghcr.io/acme/api:2"}) {
+		t.Fatalf("unexpected mirrored images: %v", pusher.calls)
+	}
+
+	if err := scopedReconciler(t, &recordingPusher{}).ValidateScope(ForceReconcileScope{FailedOnly: true}); err == nil {
+		t.Fatalf("expected failed only to require an image inventory")
+	}
+}
+
+func TestReconcileScopeValidationAndCancellation(t *testing.T) {
+	reconciler := scopedReconciler(t, &recordingPusher{})
+	if err := reconciler.ValidateScope(ForceReconcileScope{Resources: []string{"statefulsets"}}); err == nil {
+		t.Fatalf("expected unwatched resource type to be rejected")
+	}
+	if err := reconciler.ValidateScope(ForceReconcileScope{Image: "/[/"}); err == nil {
+		t.Fatalf("expected invalid image pattern to be rejected")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, _, err := reconciler.ReconcileScope(ctx, ForceReconcileScope{}, nil); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected cancelled reconcile to stop, got %v", err)
+	}
+}
+
+func TestWatchedImagesListsWithoutMirroring(t *testing.T) {
+	pusher := &recordingPusher{}
+	reconciler := scopedReconciler(t, pusher)
+
+	images, err := reconciler.WatchedImages(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(pusher.calls) != 0 {
+		t.Fatalf("expected no mirrors, got %v", pusher.calls)
+	}
+	got := make([]string, 0, len(images))
+	for _, img := range images {
+		got = append(got, img.Meta.Namespace+"/"+img.Meta.PodName+"/"+img.Meta.ContainerName+"="+img.Image)
+	}
+	want := []string{
+		"team-a/api/app=ghcr.io/acme/api:2",
+		"team-a/web/app=nginx:1.27",
+		"team-b/web/app=nginx:1.27",
+		"team-a/runner/runner=alpine:3.20",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected images:\n got %v\nwant %v", got, want)
+	}
+}
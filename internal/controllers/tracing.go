@@ -0,0 +1,42 @@
+package controllers
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+const tracerName = "github.com/matzegebbe/k8s-copycat/internal/controllers"
+
+// startReconcileSpan starts the span that the mirror spans of one reconcile are recorded below.
+func startReconcileSpan(ctx context.Context, kind string, req ctrl.Request) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, "reconcile "+kind, trace.WithAttributes(
+		attribute.String("k8s.object.kind", kind),
+		attribute.String("k8s.namespace.name", req.Namespace),
+		attribute.String("k8s.object.name", req.Name),
+	))
+}
+
+// startForceReconcileSpan starts the span of a force reconcile of namespace, or of all
+// namespaces when it is empty.
+func startForceReconcileSpan(ctx context.Context, namespace string) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, "force reconcile", trace.WithAttributes(
+		attribute.String("k8s.namespace.name", namespace),
+	))
+}
+
+// endReconcileSpan records the outcome of a reconcile and ends its span.
+func endReconcileSpan(span trace.Span, res ctrl.Result, err error) {
+	if res.RequeueAfter > 0 {
+		span.SetAttributes(attribute.String("copycat.requeue_after", res.RequeueAfter.String()))
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,395 @@
+package mirror
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	remotetransport "github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	"github.com/matzegebbe/k8s-copycat/pkg/metrics"
+)
+
+// Drift statuses of an audited image.
+const (
+	// DriftInSync is a target holding the current source, or the platforms copycat mirrored of it.
+	DriftInSync = "in_sync"
+	// DriftMissing is a target that does not exist.
+	DriftMissing = "missing"
+	// DriftTargetDiffers is a target whose digest matches neither the source nor what was mirrored.
+	DriftTargetDiffers = "target_differs"
+	// DriftSourceMoved is a source tag that points to a new digest while the target still holds
+	// the one that was mirrored or is running.
+	DriftSourceMoved = "source_moved"
+	// DriftSourceGone is a source that no longer exists, so the target is the only copy left.
+	DriftSourceGone = "source_gone"
+	// DriftError is an image whose registries could not be checked.
+	DriftError = "error"
+)
+
+// DriftStatuses lists every drift status in report order.
+func DriftStatuses() []string {
+	return []string{DriftInSync, DriftMissing, DriftTargetDiffers, DriftSourceMoved, DriftSourceGone, DriftError}
+}
+
+// DefaultDriftAuditInterval is how often the drift audit runs unless configured otherwise.
+const DefaultDriftAuditInterval = 6 * time.Hour
+
+// Drift compares an image at its source and target with what copycat mirrored. MirroredDigest is
+// the source digest the target was last mirrored from and RunningDigest the digest a Pod runs.
+type Drift struct {
+	Source         string `json:"source"`
+	Target         string `json:"target,omitempty"`
+	Status         string `json:"status"`
+	SourceDigest   string `json:"sourceDigest,omitempty"`
+	TargetDigest   string `json:"targetDigest,omitempty"`
+	MirroredDigest string `json:"mirroredDigest,omitempty"`
+	RunningDigest  string `json:"runningDigest,omitempty"`
+}
+
+// DriftChecker audits images without mirroring them.
+type DriftChecker interface {
+	Resolve(src string, meta Metadata) (Resolution, error)
+	// Drift sends HEAD requests for src and its target and classifies the result. Images from
+	// excluded registries are reported with VerifyExcluded.
+	Drift(ctx context.Context, src string, meta Metadata) (Drift, error)
+}
+
+// WorkloadImage is an image of a watched workload together with the metadata it is mirrored with.
+type WorkloadImage struct {
+	Image string
+	Meta  Metadata
+}
+
+func (p *pusher) Drift(ctx context.Context, src string, meta Metadata) (Drift, error) {
+	res, err := p.Resolve(src, meta)
+	if err != nil {
+		return Drift{Source: src}, err
+	}
+	d := Drift{Source: src, Target: res.Target}
+	if res.ExcludedBy != "" {
+		d.Status = VerifyExcluded
+		return d, nil
+	}
+	srcRef, err := name.ParseReference(src, name.WeakValidation)
+	if err != nil {
+		return d, fmt.Errorf("parse source: %w", err)
+	}
+	targetRef, err := name.ParseReference(res.Target, p.targetNameOptions()...)
+	if err != nil {
+		return d, fmt.Errorf("parse target: %w", err)
+	}
+	if id := normalizeImageID(meta.ImageID); id != "" {
+		if digest, _, err := digestReferenceFromImageID(id, srcRef); err == nil {
+			d.RunningDigest = digest
+		}
+	}
+	if state, ok := p.state.lookup(res.Target); ok && state.TargetDigest != "" {
+		d.MirroredDigest = state.SourceDigest
+	} else if record, ok := p.inventory.get(p.inventoryKey(src, meta)); ok && record.Target == res.Target && record.TargetDigest != "" {
+		d.MirroredDigest = record.SourceDigest
+	}
+
+	sourceOpts := []remote.Option{remote.WithAuthFromKeychain(p.keychain), remote.WithTransport(p.sourceTransport)}
+	srcDesc, err := p.head(ctx, srcRef, sourceOpts...)
+	switch {
+	case isNotFound(err):
+		d.Status = DriftSourceGone
+	case err != nil:
+		return d, fmt.Errorf("head source: %w", err)
+	default:
+		d.SourceDigest = srcDesc.Digest.String()
+	}
+
+	username, password, err := p.target.BasicAuth(ctx)
+	if err != nil {
+		return d, fmt.Errorf("auth: %w", err)
+	}
+	targetOpts := []remote.Option{remote.WithAuth(&authn.Basic{Username: username, Password: password}), remote.WithTransport(p.targetTransport)}
+	targetDesc, err := p.head(ctx, targetRef, targetOpts...)
+	switch {
+	case isNotFound(err):
+		if d.Status == "" {
+			d.Status = DriftMissing
+		}
+		return d, nil
+	case err != nil:
+		return d, fmt.Errorf("head target: %w", err)
+	}
+	d.TargetDigest = targetDesc.Digest.String()
+	if d.Status != "" {
+		return d, nil
+	}
+
+	mirroredTarget := p.mirroredTargetDigest(p.inventoryKey(src, meta), res.Target, d.MirroredDigest)
+	switch {
+	case d.SourceDigest == d.TargetDigest:
+		d.Status = DriftInSync
+	case d.MirroredDigest == d.SourceDigest && mirroredTarget == d.TargetDigest:
+		// The target was mirrored from the current source, with the selected platforms only.
+		d.Status = DriftInSync
+	case d.MirroredDigest != "" && d.MirroredDigest != d.SourceDigest && (mirroredTarget == d.TargetDigest || d.MirroredDigest == d.TargetDigest):
+		d.Status = DriftSourceMoved
+	case d.RunningDigest != "" && d.RunningDigest != d.SourceDigest && d.RunningDigest == d.TargetDigest:
+		d.Status = DriftSourceMoved
+	default:
+		// Without a record of the mirror, fetch both manifests to recognise a platform subset.
+		d.Status = DriftTargetDiffers
+		srcFull, err := p.describe(ctx, srcRef, sourceOpts...)
+		if err != nil {
+			return d, fmt.Errorf("get source manifest: %w", err)
+		}
+		targetFull, err := p.describe(ctx, targetRef, targetOpts...)
+		if err != nil {
+			return d, fmt.Errorf("get target manifest: %w", err)
+		}
+		if platformSubset(srcFull, targetFull) {
+			d.Status = DriftInSync
+		}
+	}
+	return d, nil
+}
+
+// mirroredTargetDigest returns the target digest written when target was mirrored from
+// sourceDigest, as remembered by the state store or the image inventory.
+func (p *pusher) mirroredTargetDigest(key inventoryKey, target, sourceDigest string) string {
+	if sourceDigest == "" {
+		return ""
+	}
+	if state, ok := p.state.lookup(target); ok && state.SourceDigest == sourceDigest {
+		return state.TargetDigest
+	}
+	if record, ok := p.inventory.get(key); ok && record.Target == target && record.SourceDigest == sourceDigest {
+		return record.TargetDigest
+	}
+	return ""
+}
+
+func (p *pusher) head(ctx context.Context, ref name.Reference, opts ...remote.Option) (*v1.Descriptor, error) {
+	ctx, cancel := p.operationContext(ctx)
+	defer cancel()
+	return remoteHeadFunc(ref, append(opts, remote.WithContext(ctx))...)
+}
+
+func isNotFound(err error) bool {
+	var te *remotetransport.Error
+	return errors.As(err, &te) && te.StatusCode == http.StatusNotFound
+}
+
+// DriftImage is the drift of an image together with the workloads that use it.
+type DriftImage struct {
+	Drift
+	Error     string              `json:"error,omitempty"`
+	Workloads []WorkloadReference `json:"workloads"`
+}
+
+// DriftReport summarises an audit. Summary counts the images by status.
+type DriftReport struct {
+	StartedAt  time.Time      `json:"startedAt"`
+	FinishedAt time.Time      `json:"finishedAt"`
+	Summary    map[string]int `json:"summary"`
+	Images     []DriftImage   `json:"images"`
+	Errors     []string       `json:"errors,omitempty"`
+}
+
+// DriftAuditor is a manager runnable that periodically compares the images of the watched
+// workloads at their source and target registries, so that failed mirrors and targets removed
+// by registry lifecycle policies are noticed before the mirror is needed.
+type DriftAuditor struct {
+	checker  DriftChecker
+	list     func(context.Context) ([]WorkloadImage, error)
+	interval time.Duration
+	logger   logr.Logger
+	now      func() time.Time
+
+	mu         sync.Mutex
+	running    chan struct{}
+	lastReport *DriftReport
+}
+
+// NewDriftAuditor returns an auditor that checks the images returned by list. With a
+// non-positive interval it only audits on demand.
+func NewDriftAuditor(checker DriftChecker, list func(context.Context) ([]WorkloadImage, error), interval time.Duration, logger logr.Logger) *DriftAuditor {
+	if logger.GetSink() == nil {
+		logger = ctrl.Log.WithName("mirror").WithName("audit")
+	} else {
+		logger = logger.WithName("audit")
+	}
+	return &DriftAuditor{checker: checker, list: list, interval: interval, logger: logger, now: time.Now}
+}
+
+// Start audits every interval until ctx is cancelled. The first audit runs after one interval so
+// that the watched workloads have been mirrored once.
+func (a *DriftAuditor) Start(ctx context.Context) error {
+	if a.interval <= 0 {
+		<-ctx.Done()
+		return nil
+	}
+	ticker := time.NewTicker(a.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			a.Audit(ctx)
+		}
+	}
+}
+
+// LastReport returns the report of the most recent audit.
+func (a *DriftAuditor) LastReport() (DriftReport, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.lastReport == nil {
+		return DriftReport{}, false
+	}
+	return *a.lastReport, true
+}
+
+// Running reports whether an audit is in progress.
+func (a *DriftAuditor) Running() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.running != nil
+}
+
+// Audit runs an audit and returns its report. When an audit is already running it waits for that
+// one instead.
+func (a *DriftAuditor) Audit(ctx context.Context) DriftReport {
+	a.mu.Lock()
+	if done := a.running; done != nil {
+		a.mu.Unlock()
+		select {
+		case <-done:
+		case <-ctx.Done():
+		}
+		report, _ := a.LastReport()
+		return report
+	}
+	done := make(chan struct{})
+	a.running = done
+	a.mu.Unlock()
+	return a.run(ctx, done)
+}
+
+// Trigger starts an audit in the background unless one is running already. The returned channel
+// is closed when the started or running audit has finished.
+func (a *DriftAuditor) Trigger() (<-chan struct{}, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.running != nil {
+		return a.running, false
+	}
+	done := make(chan struct{})
+	a.running = done
+	// The audit outlives the request that started it.
+	go a.run(context.Background(), done)
+	return done, true
+}
+
+func (a *DriftAuditor) run(ctx context.Context, done chan struct{}) DriftReport {
+	report := a.audit(ctx)
+	a.mu.Lock()
+	a.lastReport = &report
+	a.running = nil
+	a.mu.Unlock()
+	close(done)
+	return report
+}
+
+func (a *DriftAuditor) audit(ctx context.Context) DriftReport {
+	report := DriftReport{StartedAt: a.now(), Summary: make(map[string]int), Images: []DriftImage{}}
+	for _, status := range DriftStatuses() {
+		report.Summary[status] = 0
+	}
+	defer func() { report.FinishedAt = a.now() }()
+
+	images, err := a.list(ctx)
+	if err != nil {
+		a.logger.Error(err, "unable to list the images of watched workloads; skipping drift audit")
+		report.Errors = append(report.Errors, fmt.Sprintf("list images: %v", err))
+		return report
+	}
+
+	// Workloads sharing an image and a target share one check.
+	type group struct {
+		image     string
+		meta      Metadata
+		workloads map[WorkloadReference]struct{}
+	}
+	groups := make(map[string]*group)
+	var order []string
+	for _, img := range images {
+		res, err := a.checker.Resolve(img.Image, img.Meta)
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("resolve %s: %v", img.Image, err))
+			continue
+		}
+		if res.ExcludedBy != "" {
+			continue
+		}
+		key := img.Image + "\x00" + res.Target
+		g, ok := groups[key]
+		if !ok {
+			g = &group{image: img.Image, meta: img.Meta, workloads: make(map[WorkloadReference]struct{})}
+			groups[key] = g
+			order = append(order, key)
+		} else if g.meta.ImageID == "" {
+			g.meta.ImageID = img.Meta.ImageID
+		}
+		g.workloads[WorkloadReference{Namespace: img.Meta.Namespace, Name: img.Meta.PodName, Container: img.Meta.ContainerName}] = struct{}{}
+	}
+
+	for _, key := range order {
+		if ctx.Err() != nil {
+			report.Errors = append(report.Errors, "audit cancelled")
+			break
+		}
+		g := groups[key]
+		d, err := a.checker.Drift(ctx, g.image, g.meta)
+		result := DriftImage{Drift: d, Workloads: make([]WorkloadReference, 0, len(g.workloads))}
+		if err != nil {
+			result.Status = DriftError
+			result.Error = err.Error()
+		}
+		for ref := range g.workloads {
+			result.Workloads = append(result.Workloads, ref)
+		}
+		sort.Slice(result.Workloads, func(i, j int) bool {
+			x, y := result.Workloads[i], result.Workloads[j]
+			if x.Namespace != y.Namespace {
+				return x.Namespace < y.Namespace
+			}
+			if x.Name != y.Name {
+				return x.Name < y.Name
+			}
+			return x.Container < y.Container
+		})
+		switch result.Status {
+		case DriftInSync:
+		case DriftError:
+			a.logger.Error(err, "unable to audit image", "image", result.Source, "target", result.Target)
+		default:
+			a.logger.Info("image drifted from its mirror", "image", result.Source, "target", result.Target, "status", result.Status, "sourceDigest", result.SourceDigest, "targetDigest", result.TargetDigest, "workloads", len(result.Workloads))
+		}
+		report.Summary[result.Status]++
+		report.Images = append(report.Images, result)
+	}
+	sort.SliceStable(report.Images, func(i, j int) bool { return report.Images[i].Source < report.Images[j].Source })
+
+	metrics.SetDriftImages(report.Summary)
+	metrics.SetDriftAuditTimestamp(a.now())
+	a.logger.Info("drift audit finished", "images", len(report.Images), "summary", report.Summary, "errors", len(report.Errors))
+	return report
+}
@@ -0,0 +1,183 @@
+package mirror
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	remotetransport "github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/matzegebbe/k8s-copycat/pkg/metrics"
+)
+
+func TestDriftClassifiesSourceAndTarget(t *testing.T) {
+	digest := func(c string) v1.Hash { return v1.Hash{Algorithm: "sha256", Hex: strings.Repeat(c, 64)} }
+	amd64, arm64 := digest("a"), digest("b")
+	raw, err := json.Marshal(v1.IndexManifest{SchemaVersion: 2, MediaType: types.OCIImageIndex, Manifests: []v1.Descriptor{
+		{MediaType: types.OCIManifestSchema1, Digest: amd64},
+		{MediaType: types.OCIManifestSchema1, Digest: arm64},
+	}})
+	if err != nil {
+		t.Fatalf("marshal index: %v", err)
+	}
+	indexDigest, _, _ := v1.SHA256(strings.NewReader(string(raw)))
+	index := &remote.Descriptor{Descriptor: v1.Descriptor{MediaType: types.OCIImageIndex, Digest: indexDigest}, Manifest: raw}
+	notFound := &remotetransport.Error{StatusCode: http.StatusNotFound}
+
+	cases := []struct {
+		name    string
+		source  *v1.Hash
+		target  *v1.Hash
+		imageID string
+		want    string
+	}{
+		{"in sync", &indexDigest, &indexDigest, "", DriftInSync},
+		{"platform subset", &indexDigest, &amd64, "", DriftInSync},
+		{"missing", &indexDigest, nil, "", DriftMissing},
+		{"source gone", nil, &amd64, "", DriftSourceGone},
+		{"source moved", &indexDigest, &arm64, "docker.io/library/nginx@" + arm64.String(), DriftSourceMoved},
+		{"target differs", &amd64, &arm64, "", DriftTargetDiffers},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			head := func(hash *v1.Hash) (*v1.Descriptor, error) {
+				if hash == nil {
+					return nil, notFound
+				}
+				return &v1.Descriptor{Digest: *hash}, nil
+			}
+			originalHead, originalGet := remoteHeadFunc, remoteGetFunc
+			remoteHeadFunc = func(ref name.Reference, _ ...remote.Option) (*v1.Descriptor, error) {
+				if ref.Context().RegistryStr() == "example.com" {
+					return head(tc.target)
+				}
+				return head(tc.source)
+			}
+			remoteGetFunc = func(ref name.Reference, _ ...remote.Option) (*remote.Descriptor, error) {
+				hash := tc.source
+				if ref.Context().RegistryStr() == "example.com" {
+					hash = tc.target
+				}
+				if *hash == indexDigest {
+					return index, nil
+				}
+				return &remote.Descriptor{Descriptor: v1.Descriptor{MediaType: types.OCIManifestSchema1, Digest: *hash}}, nil
+			}
+			t.Cleanup(func() { remoteHeadFunc, remoteGetFunc = originalHead, originalGet })
+
+			p := NewPusher(fakeTarget{}, false, false, nil, testr.New(t), nil, 0, 0, false, nil, nil, false, nil, nil)
+			d, err := p.(DriftChecker).Drift(context.Background(), "nginx:1.27", Metadata{ImageID: tc.imageID})
+			if err != nil {
+				t.Fatalf("drift: %v", err)
+			}
+			if d.Status != tc.want {
+				t.Fatalf("expected status %s, got %+v", tc.want, d)
+			}
+			if d.Target != "example.com/library/nginx:1.27" {
+				t.Fatalf("unexpected target %q", d.Target)
+			}
+		})
+	}
+}
+
+// fakeDriftChecker resolves targets per namespace and reports drift from a fixed table.
+type fakeDriftChecker struct {
+	drift map[string]string
+	calls []string
+}
+
+func (f *fakeDriftChecker) Resolve(src string, meta Metadata) (Resolution, error) {
+	if strings.HasPrefix(src, "registry.k8s.io/") {
+		return Resolution{Source: src, ExcludedBy: "registry.k8s.io"}, nil
+	}
+	return Resolution{Source: src, Target: "mirror.example.com/" + meta.Namespace + "/" + src}, nil
+}
+
+func (f *fakeDriftChecker) Drift(_ context.Context, src string, meta Metadata) (Drift, error) {
+	f.calls = append(f.calls, meta.Namespace+"/"+src)
+	status, ok := f.drift[src]
+	if !ok {
+		return Drift{Source: src}, errors.New("registry unavailable")
+	}
+	return Drift{Source: src, Target: "mirror.example.com/" + meta.Namespace + "/" + src, Status: status}, nil
+}
+
+func TestDriftAuditorGroupsImagesAndPublishesMetrics(t *testing.T) {
+	t.Cleanup(metrics.Reset)
+	metrics.Reset()
+
+	checker := &fakeDriftChecker{drift: map[string]string{"nginx:1.27": DriftInSync, "ghcr.io/acme/api:2": DriftMissing}}
+	list := func(context.Context) ([]WorkloadImage, error) {
+		return []WorkloadImage{
+			{Image: "nginx:1.27", Meta: Metadata{Namespace: "shop", PodName: "web", ContainerName: "nginx"}},
+			{Image: "nginx:1.27", Meta: Metadata{Namespace: "shop", PodName: "web-7d9f", ContainerName: "nginx"}},
+			{Image: "nginx:1.27", Meta: Metadata{Namespace: "blog", PodName: "web", ContainerName: "nginx"}},
+			{Image: "ghcr.io/acme/api:2", Meta: Metadata{Namespace: "shop", PodName: "api", ContainerName: "api"}},
+			{Image: "registry.k8s.io/pause:3.10", Meta: Metadata{Namespace: "shop", PodName: "web", ContainerName: "pause"}},
+			{Image: "quay.io/acme/broken:1", Meta: Metadata{Namespace: "shop", PodName: "broken", ContainerName: "app"}},
+		}, nil
+	}
+	auditor := NewDriftAuditor(checker, list, 0, testr.New(t))
+	if _, ok := auditor.LastReport(); ok {
+		t.Fatalf("expected no report before the first audit")
+	}
+
+	report := auditor.Audit(context.Background())
+	if !reflect.DeepEqual(checker.calls, []string{"shop/nginx:1.27", "blog/nginx:1.27", "shop/ghcr.io/acme/api:2", "shop/quay.io/acme/broken:1"}) {
+		t.Fatalf("expected one check per image and target, got %v", checker.calls)
+	}
+	wantSummary := map[string]int{DriftInSync: 2, DriftMissing: 1, DriftTargetDiffers: 0, DriftSourceMoved: 0, DriftSourceGone: 0, DriftError: 1}
+	if !reflect.DeepEqual(report.Summary, wantSummary) {
+		t.Fatalf("unexpected summary %v", report.Summary)
+	}
+	var shopNginx *DriftImage
+	for i := range report.Images {
+		if report.Images[i].Target == "mirror.example.com/shop/nginx:1.27" {
+			shopNginx = &report.Images[i]
+		}
+		if report.Images[i].Source == "quay.io/acme/broken:1" && report.Images[i].Error != "registry unavailable" {
+			t.Fatalf("expected the check error to be reported, got %+v", report.Images[i])
+		}
+	}
+	if shopNginx == nil || !reflect.DeepEqual(shopNginx.Workloads, []WorkloadReference{{Namespace: "shop", Name: "web", Container: "nginx"}, {Namespace: "shop", Name: "web-7d9f", Container: "nginx"}}) {
+		t.Fatalf("expected both workloads on the shared image, got %+v", shopNginx)
+	}
+	if last, ok := auditor.LastReport(); !ok || len(last.Images) != 4 {
+		t.Fatalf("expected the report to be kept, got %+v", last)
+	}
+	if got := testutil.ToFloat64(metrics.DriftImagesGauge().WithLabelValues(DriftMissing)); got != 1 {
+		t.Fatalf("expected one missing image in metrics, got %v", got)
+	}
+	if got := testutil.ToFloat64(metrics.DriftAuditTimestampGauge()); got == 0 {
+		t.Fatalf("expected the audit timestamp to be set")
+	}
+
+	done, started := auditor.Trigger()
+	if !started {
+		t.Fatalf("expected an idle auditor to start an audit")
+	}
+	<-done
+	if auditor.Running() {
+		t.Fatalf("expected the audit to have finished")
+	}
+}
+
+func TestDriftAuditorReportsListErrors(t *testing.T) {
+	auditor := NewDriftAuditor(&fakeDriftChecker{}, func(context.Context) ([]WorkloadImage, error) {
+		return nil, errors.New("cache not synced")
+	}, 0, testr.New(t))
+	report := auditor.Audit(context.Background())
+	if len(report.Images) != 0 || len(report.Errors) != 1 || !strings.Contains(report.Errors[0], "cache not synced") {
+		t.Fatalf("unexpected report %+v", report)
+	}
+}
@@ -0,0 +1,305 @@
+package mirror
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"golang.org/x/time/rate"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// bandwidthChunk is the largest read that is throttled in one step and the burst of every limiter.
+const bandwidthChunk = 32 * 1024
+
+// noBandwidthWindow marks a limiter whose schedule has not been evaluated yet; -1 is used when no
+// window is active.
+const noBandwidthWindow = -2
+
+// BandwidthLimit caps transfers in bytes per second. Zero leaves a direction unlimited.
+type BandwidthLimit struct {
+	Pull int64
+	Push int64
+}
+
+// BandwidthWindow raises or lowers limits during a time of day. Start and End are offsets from
+// midnight in the local time of the process; a window whose End is before its Start wraps around
+// midnight. Limits set in a window replace the corresponding base limits, unset ones keep them.
+type BandwidthWindow struct {
+	Start      time.Duration
+	End        time.Duration
+	Default    BandwidthLimit
+	Registries map[string]BandwidthLimit
+}
+
+// BandwidthLimits caps source downloads and target uploads. Default applies to all transfers in
+// one direction together, Registries additionally cap transfers of a single registry (Docker Hub
+// is docker.io). The first Schedule window containing the current time adjusts both.
+type BandwidthLimits struct {
+	Default    BandwidthLimit
+	Registries map[string]BandwidthLimit
+	Schedule   []BandwidthWindow
+}
+
+// Enabled reports whether any limit is configured.
+func (l BandwidthLimits) Enabled() bool {
+	if l.Default != (BandwidthLimit{}) || len(l.Registries) > 0 {
+		return true
+	}
+	for _, w := range l.Schedule {
+		if w.Default != (BandwidthLimit{}) || len(w.Registries) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateBandwidthLimits reports negative limits and windows outside of a day.
+func ValidateBandwidthLimits(l BandwidthLimits) error {
+	var errs []string
+	check := func(scope string, limit BandwidthLimit) {
+		if limit.Pull < 0 || limit.Push < 0 {
+			errs = append(errs, fmt.Sprintf("%s: limits must not be negative", scope))
+		}
+	}
+	check("default", l.Default)
+	for reg, limit := range l.Registries {
+		check("registry "+reg, limit)
+	}
+	for i, w := range l.Schedule {
+		scope := fmt.Sprintf("schedule[%d]", i)
+		if w.Start < 0 || w.Start >= 24*time.Hour || w.End < 0 || w.End >= 24*time.Hour {
+			errs = append(errs, fmt.Sprintf("%s: start and end must be within a day", scope))
+		}
+		if w.Start == w.End {
+			errs = append(errs, fmt.Sprintf("%s: start and end must differ", scope))
+		}
+		check(scope, w.Default)
+		for reg, limit := range w.Registries {
+			check(scope+" registry "+reg, limit)
+		}
+	}
+	if len(errs) > 0 {
+		sort.Strings(errs)
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func (w BandwidthWindow) contains(offset time.Duration) bool {
+	if w.Start < w.End {
+		return offset >= w.Start && offset < w.End
+	}
+	return offset >= w.Start || offset < w.End
+}
+
+func (l BandwidthLimit) get(d transferDirection) int64 {
+	if d == transferPush {
+		return l.Push
+	}
+	return l.Pull
+}
+
+// BandwidthLimiter enforces BandwidthLimits in the HTTP transports of the pusher. Pulls are
+// throttled while response bodies are read, pushes while request bodies are sent.
+type BandwidthLimiter struct {
+	limits     BandwidthLimits
+	registries map[string]struct{}
+	logger     logr.Logger
+	now        func() time.Time
+
+	mu       sync.Mutex
+	window   int
+	limiters map[limiterKey]*rate.Limiter
+}
+
+type limiterKey struct {
+	direction transferDirection
+	registry  string
+}
+
+// NewBandwidthLimiter returns a limiter for limits, or nil when no limit is configured.
+func NewBandwidthLimiter(limits BandwidthLimits, logger logr.Logger) *BandwidthLimiter {
+	if !limits.Enabled() {
+		return nil
+	}
+	if logger.GetSink() == nil {
+		logger = ctrl.Log.WithName("mirror").WithName("bandwidth")
+	} else {
+		logger = logger.WithName("bandwidth")
+	}
+	registries := make(map[string]struct{})
+	limits.Registries = normalizeBandwidthRegistries(limits.Registries, registries)
+	schedule := make([]BandwidthWindow, len(limits.Schedule))
+	for i, w := range limits.Schedule {
+		w.Registries = normalizeBandwidthRegistries(w.Registries, registries)
+		schedule[i] = w
+	}
+	limits.Schedule = schedule
+	return &BandwidthLimiter{
+		limits:     limits,
+		registries: registries,
+		logger:     logger,
+		now:        time.Now,
+		window:     noBandwidthWindow,
+		limiters:   make(map[limiterKey]*rate.Limiter),
+	}
+}
+
+func normalizeBandwidthRegistries(in map[string]BandwidthLimit, seen map[string]struct{}) map[string]BandwidthLimit {
+	out := make(map[string]BandwidthLimit, len(in))
+	for reg, limit := range in {
+		reg = normalizeBandwidthRegistry(reg)
+		out[reg] = limit
+		seen[reg] = struct{}{}
+	}
+	return out
+}
+
+// normalizeBandwidthRegistry maps the hosts Docker Hub is reached through to docker.io.
+func normalizeBandwidthRegistry(reg string) string {
+	reg = strings.ToLower(strings.TrimSpace(reg))
+	switch reg {
+	case "index.docker.io", "registry-1.docker.io":
+		return "docker.io"
+	}
+	return reg
+}
+
+// activeWindow returns the index of the schedule window containing t, or -1.
+func (b *BandwidthLimiter) activeWindow(t time.Time) int {
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	offset := t.Sub(midnight)
+	for i, w := range b.limits.Schedule {
+		if w.contains(offset) {
+			return i
+		}
+	}
+	return -1
+}
+
+// limit returns the limit of a direction for registry, or for all registries when it is empty.
+func (b *BandwidthLimiter) limit(window int, d transferDirection, registry string) int64 {
+	var limit int64
+	if registry == "" {
+		limit = b.limits.Default.get(d)
+	} else {
+		limit = b.limits.Registries[registry].get(d)
+	}
+	if window < 0 {
+		return limit
+	}
+	w := b.limits.Schedule[window]
+	var override int64
+	if registry == "" {
+		override = w.Default.get(d)
+	} else {
+		override = w.Registries[registry].get(d)
+	}
+	if override > 0 {
+		return override
+	}
+	return limit
+}
+
+// limitersFor returns the limiters a transfer of registry in direction d waits for, after
+// applying the schedule window that is active now.
+func (b *BandwidthLimiter) limitersFor(d transferDirection, registry string) []*rate.Limiter {
+	registry = normalizeBandwidthRegistry(registry)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if window := b.activeWindow(b.now()); window != b.window {
+		if len(b.limits.Schedule) > 0 {
+			b.logger.Info("applying bandwidth limits", "scheduleWindow", window)
+		}
+		b.window = window
+		for key, limiter := range b.limiters {
+			limiter.SetLimit(bytesPerSecond(b.limit(window, key.direction, key.registry)))
+		}
+	}
+
+	keys := []string{""}
+	if _, ok := b.registries[registry]; ok {
+		keys = append(keys, registry)
+	}
+	var out []*rate.Limiter
+	for _, reg := range keys {
+		key := limiterKey{direction: d, registry: reg}
+		limiter, ok := b.limiters[key]
+		if !ok {
+			limiter = rate.NewLimiter(bytesPerSecond(b.limit(b.window, d, reg)), bandwidthChunk)
+			b.limiters[key] = limiter
+		}
+		// Unlimited limiters stay registered so that a schedule window can still lower them.
+		if limiter.Limit() != rate.Inf {
+			out = append(out, limiter)
+		}
+	}
+	return out
+}
+
+func bytesPerSecond(limit int64) rate.Limit {
+	if limit <= 0 {
+		return rate.Inf
+	}
+	return rate.Limit(limit)
+}
+
+// transport wraps rt so that bodies in direction d are throttled.
+func (b *BandwidthLimiter) transport(rt http.RoundTripper, d transferDirection) http.RoundTripper {
+	if b == nil {
+		return rt
+	}
+	return &throttledTransport{inner: rt, limiter: b, direction: d}
+}
+
+type throttledTransport struct {
+	inner     http.RoundTripper
+	limiter   *BandwidthLimiter
+	direction transferDirection
+}
+
+func (t *throttledTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	limiters := t.limiter.limitersFor(t.direction, transferRegistry(req, t.direction))
+	if len(limiters) == 0 {
+		return t.inner.RoundTrip(req)
+	}
+	if t.direction == transferPush && req.Body != nil && req.Body != http.NoBody {
+		req = req.Clone(req.Context())
+		req.Body = &throttledBody{ReadCloser: req.Body, ctx: req.Context(), limiters: limiters}
+	}
+	resp, err := t.inner.RoundTrip(req)
+	if err != nil || t.direction != transferPull {
+		return resp, err
+	}
+	resp.Body = &throttledBody{ReadCloser: resp.Body, ctx: req.Context(), limiters: limiters}
+	return resp, nil
+}
+
+type throttledBody struct {
+	io.ReadCloser
+	ctx      context.Context
+	limiters []*rate.Limiter
+}
+
+func (b *throttledBody) Read(p []byte) (int, error) {
+	if len(p) > bandwidthChunk {
+		p = p[:bandwidthChunk]
+	}
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		for _, limiter := range b.limiters {
+			if waitErr := limiter.WaitN(b.ctx, n); waitErr != nil {
+				return n, waitErr
+			}
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,88 @@
+package mirror
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr/testr"
+)
+
+func TestBandwidthLimiterAppliesScheduleWindows(t *testing.T) {
+	limiter := NewBandwidthLimiter(BandwidthLimits{
+		Default:    BandwidthLimit{Pull: 1000, Push: 500},
+		Registries: map[string]BandwidthLimit{"index.docker.io": {Pull: 100}},
+		Schedule: []BandwidthWindow{{
+			Start:      22 * time.Hour,
+			End:        6 * time.Hour,
+			Default:    BandwidthLimit{Pull: 5000},
+			Registries: map[string]BandwidthLimit{"docker.io": {Pull: 2000}},
+		}},
+	}, testr.New(t))
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	limiter.now = func() time.Time { return now }
+
+	limits := func(d transferDirection, registry string) []float64 {
+		var out []float64
+		for _, l := range limiter.limitersFor(d, registry) {
+			out = append(out, float64(l.Limit()))
+		}
+		return out
+	}
+	if got := limits(transferPull, "docker.io"); len(got) != 2 || got[0] != 1000 || got[1] != 100 {
+		t.Fatalf("unexpected daytime pull limits for docker.io: %v", got)
+	}
+	if got := limits(transferPull, "ghcr.io"); len(got) != 1 || got[0] != 1000 {
+		t.Fatalf("expected only the global limit for other registries, got %v", got)
+	}
+
+	now = time.Date(2026, 1, 1, 23, 30, 0, 0, time.UTC)
+	if got := limits(transferPull, "docker.io"); len(got) != 2 || got[0] != 5000 || got[1] != 2000 {
+		t.Fatalf("unexpected night pull limits for docker.io: %v", got)
+	}
+	if got := limits(transferPush, "registry.example.com"); len(got) != 1 || got[0] != 500 {
+		t.Fatalf("expected push limit without override to be kept at night, got %v", got)
+	}
+}
+
+func TestThrottledTransportLimitsDownloadsOfSourceRegistry(t *testing.T) {
+	body := strings.Repeat("x", 320*1024)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = io.WriteString(w, body)
+	}))
+	defer server.Close()
+
+	limiter := NewBandwidthLimiter(BandwidthLimits{Registries: map[string]BandwidthLimit{"docker.io": {Pull: 1 << 20}}}, testr.New(t))
+	client := &http.Client{Transport: limiter.transport(http.DefaultTransport, transferPull)}
+
+	download := func(ctx context.Context) time.Duration {
+		t.Helper()
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+		if err != nil {
+			t.Fatalf("request: %v", err)
+		}
+		start := time.Now()
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("get: %v", err)
+		}
+		defer resp.Body.Close()
+		b, err := io.ReadAll(resp.Body)
+		if err != nil || len(b) != len(body) {
+			t.Fatalf("read %d bytes: %v", len(b), err)
+		}
+		return time.Since(start)
+	}
+
+	// The storage host is not docker.io, but the request is attributed to it by the pusher.
+	if elapsed := download(withTransferRegistry(context.Background(), "docker.io")); elapsed < 200*time.Millisecond {
+		t.Fatalf("expected download to be throttled, took %v", elapsed)
+	}
+	if elapsed := download(withTransferRegistry(context.Background(), "ghcr.io")); elapsed > 200*time.Millisecond {
+		t.Fatalf("expected download of another registry to be unlimited, took %v", elapsed)
+	}
+}
@@ -0,0 +1,130 @@
+package mirror
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+)
+
+// CooldownManager inspects and clears the failure cooldowns of target references.
+type CooldownManager interface {
+	// ResetCooldown clears every cooldown.
+	ResetCooldown() (cleared int, cooldownEnabled bool)
+	// Cooldowns lists the targets that are currently in cooldown, sorted by target.
+	Cooldowns() []CooldownEntry
+	// ResetCooldowns clears the cooldowns matched by sel.
+	ResetCooldowns(sel CooldownSelector) (cleared int, cooldownEnabled bool, err error)
+}
+
+// CooldownEntry is a target whose last mirror failed and that is not retried before RetryAt.
+// Source is known for images requested since startup; failures loaded from the state store
+// show up without it until their image is requested again.
+type CooldownEntry struct {
+	Target         string    `json:"target"`
+	Source         string    `json:"source,omitempty"`
+	SourceRegistry string    `json:"sourceRegistry,omitempty"`
+	FailedAt       time.Time `json:"failedAt"`
+	RetryAt        time.Time `json:"retryAt"`
+	LastError      string    `json:"lastError,omitempty"`
+}
+
+// CooldownSelector selects cooldowns to reset. Target is an exact target reference, a glob such
+// as */library/nginx:* or a regular expression wrapped in slashes; Registry is a source registry,
+// with Docker Hub spelled docker.io. Empty fields match every cooldown.
+type CooldownSelector struct {
+	Target   string
+	Registry string
+}
+
+// Empty reports whether sel matches every cooldown.
+func (sel CooldownSelector) Empty() bool {
+	return strings.TrimSpace(sel.Target) == "" && strings.TrimSpace(sel.Registry) == ""
+}
+
+// Filter returns the entries matched by sel. It fails when Target is an invalid pattern.
+func (sel CooldownSelector) Filter(entries []CooldownEntry) ([]CooldownEntry, error) {
+	matchTarget, err := compileNamePattern(sel.Target)
+	if err != nil {
+		return nil, fmt.Errorf("target: %w", err)
+	}
+	registry := normalizeBandwidthRegistry(sel.Registry)
+	var out []CooldownEntry
+	for _, e := range entries {
+		if matchTarget != nil && !matchTarget(e.Target) {
+			continue
+		}
+		if registry != "" && e.SourceRegistry != registry {
+			continue
+		}
+		out = append(out, e)
+	}
+	return out, nil
+}
+
+func (p *pusher) Cooldowns() []CooldownEntry {
+	if p.failureCooldown <= 0 {
+		return nil
+	}
+	requested := p.inventory.byTarget()
+	now := p.currentTime()
+	entries := make(map[string]CooldownEntry)
+	for target, state := range p.state.failures() {
+		entries[target] = CooldownEntry{Target: target, FailedAt: state.FailedAt, LastError: state.FailureReason}
+	}
+	p.mu.Lock()
+	for target, failedAt := range p.failed {
+		entry := entries[target]
+		entry.Target = target
+		entry.FailedAt = failedAt
+		entries[target] = entry
+	}
+	p.mu.Unlock()
+
+	out := make([]CooldownEntry, 0, len(entries))
+	for target, entry := range entries {
+		entry.RetryAt = entry.FailedAt.Add(p.failureCooldown)
+		if !now.Before(entry.RetryAt) {
+			continue
+		}
+		if record, ok := requested[target]; ok {
+			entry.Source = record.Source
+			if ref, err := name.ParseReference(record.Source, name.WeakValidation); err == nil {
+				entry.SourceRegistry = sourceRegistry(ref)
+			}
+			if entry.LastError == "" {
+				entry.LastError = record.FailureReason
+			}
+		}
+		out = append(out, entry)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Target < out[j].Target })
+	return out
+}
+
+func (p *pusher) ResetCooldowns(sel CooldownSelector) (int, bool, error) {
+	if p.failureCooldown <= 0 {
+		return 0, false, nil
+	}
+	if sel.Empty() {
+		cleared, enabled := p.ResetCooldown()
+		return cleared, enabled, nil
+	}
+	matched, err := sel.Filter(p.Cooldowns())
+	if err != nil {
+		return 0, true, err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, entry := range matched {
+		delete(p.failed, entry.Target)
+		p.state.clearFailure(entry.Target)
+	}
+	cleared := len(matched)
+	if cleared > 0 {
+		p.updateStateGauges()
+	}
+	return cleared, true, nil
+}
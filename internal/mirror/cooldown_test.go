@@ -0,0 +1,92 @@
+package mirror
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+
+	"github.com/matzegebbe/k8s-copycat/pkg/metrics"
+)
+
+func TestCooldownsListAndResetBySourceRegistry(t *testing.T) {
+	metrics.Reset()
+	t.Cleanup(metrics.Reset)
+
+	originalGet := remoteGetFunc
+	remoteGetFunc = func(ref name.Reference, _ ...remote.Option) (*remote.Descriptor, error) {
+		return nil, errors.New("unauthorized: " + ref.Context().RegistryStr())
+	}
+	t.Cleanup(func() { remoteGetFunc = originalGet })
+
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	state := NewStateCache(FileStateStore{Path: filepath.Join(t.TempDir(), "state.json")}, 24*time.Hour, time.Minute, testr.New(t))
+	// A failure of a previous run that no workload has requested since startup.
+	state.markFailed("example.com/old/app:1", now.Add(-10*time.Minute), now.Add(50*time.Minute), "timeout")
+
+	p := NewPusher(fakeTarget{}, false, false, nil, testr.New(t), nil, 0, time.Hour, false, nil, nil, true, nil, nil, WithStateCache(state))
+	impl := p.(*pusher)
+	impl.now = func() time.Time { return now }
+	for _, src := range []string{"nginx:1.25", "ghcr.io/acme/app:1"} {
+		if err := p.Mirror(context.Background(), src, Metadata{}); err == nil {
+			t.Fatalf("expected error from Mirror of %s", src)
+		}
+	}
+
+	entries := p.Cooldowns()
+	if len(entries) != 3 {
+		t.Fatalf("expected three cooldowns, got %+v", entries)
+	}
+	registries := map[string]CooldownEntry{}
+	for _, e := range entries {
+		registries[e.SourceRegistry] = e
+	}
+	ghcr, ok := registries["ghcr.io"]
+	if !ok || ghcr.Source != "ghcr.io/acme/app:1" || !ghcr.RetryAt.Equal(now.Add(time.Hour)) || !strings.Contains(ghcr.LastError, "unauthorized") {
+		t.Fatalf("unexpected ghcr.io cooldown: %+v", ghcr)
+	}
+	if old := registries[""]; old.Target != "example.com/old/app:1" || old.LastError != "timeout" {
+		t.Fatalf("expected persisted failure to be listed, got %+v", old)
+	}
+
+	cleared, enabled, err := p.ResetCooldowns(CooldownSelector{Registry: "ghcr.io"})
+	if err != nil || !enabled || cleared != 1 {
+		t.Fatalf("expected one cleared cooldown, got %d (enabled %t, err %v)", cleared, enabled, err)
+	}
+	for _, e := range p.Cooldowns() {
+		if e.SourceRegistry == "ghcr.io" {
+			t.Fatalf("expected ghcr.io cooldown to be cleared, got %+v", e)
+		}
+	}
+
+	cleared, _, err = p.ResetCooldowns(CooldownSelector{Target: "example.com/old/*"})
+	if err != nil || cleared != 1 {
+		t.Fatalf("expected glob to clear the persisted failure, got %d (%v)", cleared, err)
+	}
+	if _, ok := state.failedAt("example.com/old/app:1"); ok {
+		t.Fatalf("expected reset to clear the persisted failure")
+	}
+	if remaining := p.Cooldowns(); len(remaining) != 1 || remaining[0].SourceRegistry != "docker.io" {
+		t.Fatalf("expected only the docker.io cooldown to remain, got %+v", remaining)
+	}
+
+	if _, _, err := p.ResetCooldowns(CooldownSelector{Target: "/[/"}); err == nil {
+		t.Fatalf("expected invalid pattern to be rejected")
+	}
+}
+
+func TestCooldownsDisabled(t *testing.T) {
+	p := NewPusher(fakeTarget{}, false, false, nil, testr.New(t), nil, 0, 0, false, nil, nil, true, nil, nil)
+	if entries := p.Cooldowns(); entries != nil {
+		t.Fatalf("expected no cooldowns without a failure cooldown, got %+v", entries)
+	}
+	if _, enabled, err := p.ResetCooldowns(CooldownSelector{Registry: "docker.io"}); enabled || err != nil {
+		t.Fatalf("expected reset to report the disabled cooldown, got enabled %t err %v", enabled, err)
+	}
+}
@@ -0,0 +1,463 @@
+package mirror
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/google/go-containerregistry/pkg/name"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	"github.com/matzegebbe/k8s-copycat/internal/registry"
+	"github.com/matzegebbe/k8s-copycat/pkg/util"
+)
+
+// Garbage collection actions reported for unreferenced images.
+const (
+	GCActionDelete = "delete"
+	GCActionUntag  = "untag"
+)
+
+// Garbage collection defaults.
+const (
+	DefaultGCGracePeriod = 7 * 24 * time.Hour
+	DefaultGCInterval    = 6 * time.Hour
+)
+
+// ReferenceRecorder receives every target reference the pusher resolves, whether or not the
+// image still has to be copied.
+type ReferenceRecorder interface {
+	RecordReference(target string)
+}
+
+// ReferenceTracker remembers when each target tag or digest was last referenced. It only knows
+// about references seen since it was created, so everything counts as referenced at startup.
+type ReferenceTracker struct {
+	mu      sync.Mutex
+	started time.Time
+	seen    map[string]time.Time
+	now     func() time.Time
+}
+
+// NewReferenceTracker returns an empty tracker.
+func NewReferenceTracker() *ReferenceTracker {
+	return &ReferenceTracker{started: time.Now(), seen: make(map[string]time.Time), now: time.Now}
+}
+
+// RecordReference marks target, a full target reference such as registry/repo:tag, as referenced now.
+func (t *ReferenceTracker) RecordReference(target string) {
+	ref, err := name.ParseReference(target, name.WeakValidation)
+	if err != nil {
+		return
+	}
+	key := trackerKey(ref.Context().RepositoryStr(), ref.Identifier())
+	t.mu.Lock()
+	t.seen[key] = t.now()
+	t.mu.Unlock()
+}
+
+// lastSeen returns when repository:identifier was last referenced, but never earlier than the
+// tracker's creation.
+func (t *ReferenceTracker) lastSeen(repository, identifier string) time.Time {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if seen, ok := t.seen[trackerKey(repository, identifier)]; ok && seen.After(t.started) {
+		return seen
+	}
+	return t.started
+}
+
+func trackerKey(repository, identifier string) string {
+	return repository + "\x00" + identifier
+}
+
+// GarbageCollection configures the removal of mirrored images that no watched workload references
+// any more. Repositories selects the target repositories that may be cleaned, as globs or regular
+// expressions wrapped in slashes. Tags referenced within GracePeriod, the KeepLast newest images
+// per repository, tags matching ProtectedTags and versions satisfying ProtectedVersions are kept.
+type GarbageCollection struct {
+	Repositories      []string
+	GracePeriod       time.Duration
+	Interval          time.Duration
+	KeepLast          int
+	ProtectedTags     []string
+	ProtectedVersions string
+	DryRun            bool
+}
+
+// GCAction describes an image removed, or to be removed in dry-run mode, by a collection pass.
+type GCAction struct {
+	Repository string    `json:"repository"`
+	Digest     string    `json:"digest"`
+	Tags       []string  `json:"tags"`
+	Action     string    `json:"action"`
+	LastSeen   time.Time `json:"lastSeen"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// GCReport summarises a collection pass.
+type GCReport struct {
+	StartedAt  time.Time  `json:"startedAt"`
+	FinishedAt time.Time  `json:"finishedAt"`
+	DryRun     bool       `json:"dryRun"`
+	Actions    []GCAction `json:"actions"`
+	Errors     []string   `json:"errors,omitempty"`
+}
+
+type namePatternFunc func(string) bool
+
+// GarbageCollector is a manager runnable that periodically removes unreferenced mirrored images.
+type GarbageCollector struct {
+	cleaner           registry.Cleaner
+	tracker           *ReferenceTracker
+	refresh           func(context.Context) error
+	forget            func(repository string, identifiers []string)
+	repositories      []namePatternFunc
+	protectedTags     []namePatternFunc
+	protectedVersions *util.VersionConstraint
+	gracePeriod       time.Duration
+	interval          time.Duration
+	keepLast          int
+	dryRun            bool
+	logger            logr.Logger
+	now               func() time.Time
+
+	mu         sync.Mutex
+	lastReport *GCReport
+}
+
+// NewGarbageCollector returns a collector that removes images from cleaner. Before every pass it
+// calls refresh, which must re-mirror every watched workload so that tracker sees all references
+// that are still in use; a pass is aborted when refresh fails. forget, if not nil, receives the
+// tags and digests of every removed image, so that remembered digests do not prevent mirroring
+// them again.
+func NewGarbageCollector(cleaner registry.Cleaner, tracker *ReferenceTracker, refresh func(context.Context) error, forget func(repository string, identifiers []string), cfg GarbageCollection, logger logr.Logger) (*GarbageCollector, error) {
+	if cleaner == nil {
+		return nil, fmt.Errorf("garbage collection is not supported by the target registry")
+	}
+	if err := ValidateGarbageCollection(cfg); err != nil {
+		return nil, err
+	}
+	if logger.GetSink() == nil {
+		logger = ctrl.Log.WithName("mirror").WithName("gc")
+	} else {
+		logger = logger.WithName("gc")
+	}
+	g := &GarbageCollector{
+		cleaner:     cleaner,
+		tracker:     tracker,
+		refresh:     refresh,
+		forget:      forget,
+		gracePeriod: cfg.GracePeriod,
+		interval:    cfg.Interval,
+		keepLast:    cfg.KeepLast,
+		dryRun:      cfg.DryRun,
+		logger:      logger,
+		now:         time.Now,
+	}
+	for _, raw := range cfg.Repositories {
+		if match, _ := compileNamePattern(raw); match != nil {
+			g.repositories = append(g.repositories, match)
+		}
+	}
+	for _, raw := range cfg.ProtectedTags {
+		if match, _ := compileNamePattern(raw); match != nil {
+			g.protectedTags = append(g.protectedTags, match)
+		}
+	}
+	if expr := strings.TrimSpace(cfg.ProtectedVersions); expr != "" {
+		constraint, err := util.ParseVersionConstraint(expr)
+		if err != nil {
+			return nil, err
+		}
+		g.protectedVersions = &constraint
+	}
+	return g, nil
+}
+
+// ValidateGarbageCollection reports invalid garbage collection settings.
+func ValidateGarbageCollection(cfg GarbageCollection) error {
+	var errs []error
+	repositories := 0
+	for _, raw := range cfg.Repositories {
+		match, err := compileNamePattern(raw)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("repositories: %w", err))
+		}
+		if match != nil {
+			repositories++
+		}
+	}
+	if repositories == 0 && len(errs) == 0 {
+		errs = append(errs, fmt.Errorf("at least one repository pattern is required"))
+	}
+	for _, raw := range cfg.ProtectedTags {
+		if _, err := compileNamePattern(raw); err != nil {
+			errs = append(errs, fmt.Errorf("protected tags: %w", err))
+		}
+	}
+	if expr := strings.TrimSpace(cfg.ProtectedVersions); expr != "" {
+		if _, err := util.ParseVersionConstraint(expr); err != nil {
+			errs = append(errs, fmt.Errorf("protected versions: %w", err))
+		}
+	}
+	if cfg.GracePeriod <= 0 {
+		errs = append(errs, fmt.Errorf("grace period must be positive"))
+	}
+	if cfg.Interval <= 0 {
+		errs = append(errs, fmt.Errorf("interval must be positive"))
+	}
+	if cfg.KeepLast < 0 {
+		errs = append(errs, fmt.Errorf("keepLast must not be negative"))
+	}
+	return errors.Join(errs...)
+}
+
+// compileNamePattern compiles a glob or a regular expression wrapped in slashes. Empty values
+// yield a nil matcher.
+func compileNamePattern(raw string) (namePatternFunc, error) {
+	value := strings.TrimSpace(raw)
+	switch {
+	case value == "":
+		return nil, nil
+	case len(value) >= 2 && strings.HasPrefix(value, "/") && strings.HasSuffix(value, "/"):
+		re, err := regexp.Compile(value[1 : len(value)-1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression %q: %w", value, err)
+		}
+		return re.MatchString, nil
+	default:
+		if _, err := path.Match(value, ""); err != nil {
+			return nil, fmt.Errorf("invalid glob pattern %q: %w", value, err)
+		}
+		return func(s string) bool {
+			ok, _ := path.Match(value, s)
+			return ok
+		}, nil
+	}
+}
+
+func matchesAny(patterns []namePatternFunc, value string) bool {
+	for _, match := range patterns {
+		if match(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// Start runs a collection pass every interval until ctx is cancelled. The first pass runs after one
+// interval so that the tracker has observed the cluster.
+func (g *GarbageCollector) Start(ctx context.Context) error {
+	ticker := time.NewTicker(g.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			g.Collect(ctx)
+		}
+	}
+}
+
+// LastReport returns the report of the most recent collection pass.
+func (g *GarbageCollector) LastReport() (GCReport, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.lastReport == nil {
+		return GCReport{}, false
+	}
+	return *g.lastReport, true
+}
+
+// Collect runs a single collection pass and returns its report.
+func (g *GarbageCollector) Collect(ctx context.Context) GCReport {
+	report := GCReport{StartedAt: g.now(), DryRun: g.dryRun, Actions: []GCAction{}}
+	defer func() {
+		report.FinishedAt = g.now()
+		g.mu.Lock()
+		g.lastReport = &report
+		g.mu.Unlock()
+	}()
+
+	if g.refresh != nil {
+		if err := g.refresh(ctx); err != nil {
+			g.logger.Error(err, "unable to refresh image references; skipping garbage collection")
+			report.Errors = append(report.Errors, fmt.Sprintf("refresh references: %v", err))
+			return report
+		}
+	}
+	// References seen during the refresh are in use even when the grace period is shorter than it.
+	cutoff := g.now().Add(-g.gracePeriod)
+	if report.StartedAt.Before(cutoff) {
+		cutoff = report.StartedAt
+	}
+
+	repositories, err := g.cleaner.Repositories(ctx)
+	if err != nil {
+		g.logger.Error(err, "unable to list target repositories")
+		report.Errors = append(report.Errors, fmt.Sprintf("list repositories: %v", err))
+		return report
+	}
+	sort.Strings(repositories)
+	for _, repository := range repositories {
+		if ctx.Err() != nil {
+			return report
+		}
+		if !matchesAny(g.repositories, repository) {
+			continue
+		}
+		log := g.logger.WithValues("repository", repository)
+		images, err := g.cleaner.Images(ctx, repository)
+		if err != nil {
+			log.Error(err, "unable to list images")
+			report.Errors = append(report.Errors, fmt.Sprintf("list images in %s: %v", repository, err))
+			continue
+		}
+		for _, action := range g.plan(repository, images, cutoff) {
+			if !g.dryRun {
+				if err := g.apply(ctx, action, images); err != nil {
+					action.Error = err.Error()
+					log.Error(err, "unable to remove unreferenced image", "digest", action.Digest, "tags", action.Tags, "action", action.Action)
+				} else {
+					log.Info("removed unreferenced image", "digest", action.Digest, "tags", action.Tags, "action", action.Action, "lastSeen", action.LastSeen)
+				}
+			} else {
+				log.Info("would remove unreferenced image", "digest", action.Digest, "tags", action.Tags, "action", action.Action, "lastSeen", action.LastSeen, "dryRun", true)
+			}
+			report.Actions = append(report.Actions, action)
+		}
+	}
+	g.logger.Info("garbage collection finished", "actions", len(report.Actions), "errors", len(report.Errors), "dryRun", g.dryRun)
+	return report
+}
+
+// plan selects the tags of images in repository that are no longer referenced since cutoff.
+// Untagged images are left alone because they are usually platform manifests of a tagged index.
+func (g *GarbageCollector) plan(repository string, images []registry.Image, cutoff time.Time) []GCAction {
+	tagged := make([]registry.Image, 0, len(images))
+	for _, img := range images {
+		if len(img.Tags) > 0 {
+			tagged = append(tagged, img)
+		}
+	}
+	sort.SliceStable(tagged, func(i, j int) bool { return newerImage(tagged[i], tagged[j]) })
+
+	_, canUntag := g.cleaner.(registry.Untagger)
+	var actions []GCAction
+	for i, img := range tagged {
+		if i < g.keepLast {
+			continue
+		}
+		lastSeen := g.tracker.lastSeen(repository, img.Digest)
+		if !lastSeen.Before(cutoff) {
+			continue
+		}
+		var remove []string
+		for _, tag := range img.Tags {
+			seen := g.tracker.lastSeen(repository, tag)
+			if seen.After(lastSeen) {
+				lastSeen = seen
+			}
+			if !seen.Before(cutoff) || g.tagProtected(tag) {
+				continue
+			}
+			remove = append(remove, tag)
+		}
+		action := GCAction{Repository: repository, Digest: img.Digest, Tags: remove, LastSeen: lastSeen}
+		switch {
+		case len(remove) == len(img.Tags):
+			action.Action = GCActionDelete
+		case len(remove) > 0 && canUntag:
+			action.Action = GCActionUntag
+		default:
+			continue
+		}
+		actions = append(actions, action)
+	}
+	return actions
+}
+
+func (g *GarbageCollector) tagProtected(tag string) bool {
+	if matchesAny(g.protectedTags, tag) {
+		return true
+	}
+	if g.protectedVersions != nil {
+		if v, ok := util.ParseVersion(tag); ok && g.protectedVersions.Matches(v) {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *GarbageCollector) apply(ctx context.Context, action GCAction, images []registry.Image) error {
+	if action.Action == GCActionUntag {
+		if err := g.cleaner.(registry.Untagger).Untag(ctx, action.Repository, action.Tags); err != nil {
+			return err
+		}
+		g.forgetRemoved(action.Repository, action.Tags)
+		return nil
+	}
+	for _, img := range images {
+		if img.Digest == action.Digest {
+			if err := g.cleaner.DeleteImage(ctx, action.Repository, img); err != nil {
+				return err
+			}
+			g.forgetRemoved(action.Repository, append([]string{img.Digest}, img.Tags...))
+			return nil
+		}
+	}
+	return nil
+}
+
+func (g *GarbageCollector) forgetRemoved(repository string, identifiers []string) {
+	if g.forget != nil {
+		g.forget(repository, identifiers)
+	}
+}
+
+// newerImage orders images by push time when the registry reports it and by their highest tag
+// otherwise, newest first.
+func newerImage(a, b registry.Image) bool {
+	if !a.PushedAt.Equal(b.PushedAt) {
+		return a.PushedAt.After(b.PushedAt)
+	}
+	av, aok := highestVersion(a.Tags)
+	bv, bok := highestVersion(b.Tags)
+	switch {
+	case aok && bok && av.Compare(bv) != 0:
+		return av.Compare(bv) > 0
+	case aok != bok:
+		return aok
+	}
+	return maxString(a.Tags) > maxString(b.Tags)
+}
+
+func highestVersion(tags []string) (util.Version, bool) {
+	var best util.Version
+	found := false
+	for _, tag := range tags {
+		if v, ok := util.ParseVersion(tag); ok && (!found || v.Compare(best) > 0) {
+			best, found = v, true
+		}
+	}
+	return best, found
+}
+
+func maxString(values []string) string {
+	best := ""
+	for _, v := range values {
+		if v > best {
+			best = v
+		}
+	}
+	return best
+}
@@ -0,0 +1,216 @@
+package mirror
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr/testr"
+
+	"github.com/matzegebbe/k8s-copycat/internal/registry"
+)
+
+type fakeCleaner struct {
+	images  map[string][]registry.Image
+	deleted []string
+}
+
+func (f *fakeCleaner) Repositories(context.Context) ([]string, error) {
+	repos := make([]string, 0, len(f.images))
+	for repo := range f.images {
+		repos = append(repos, repo)
+	}
+	return repos, nil
+}
+
+func (f *fakeCleaner) Images(_ context.Context, repository string) ([]registry.Image, error) {
+	return f.images[repository], nil
+}
+
+func (f *fakeCleaner) DeleteImage(_ context.Context, repository string, image registry.Image) error {
+	f.deleted = append(f.deleted, repository+"@"+image.Digest)
+	return nil
+}
+
+type fakeUntagger struct {
+	fakeCleaner
+	untagged []string
+}
+
+func (f *fakeUntagger) Untag(_ context.Context, repository string, tags []string) error {
+	for _, tag := range tags {
+		f.untagged = append(f.untagged, repository+":"+tag)
+	}
+	return nil
+}
+
+func newTestCollector(t *testing.T, cleaner registry.Cleaner, tracker *ReferenceTracker, refresh func(context.Context) error, cfg GarbageCollection) *GarbageCollector {
+	t.Helper()
+	if cfg.GracePeriod == 0 {
+		cfg.GracePeriod = time.Hour
+	}
+	if cfg.Interval == 0 {
+		cfg.Interval = time.Hour
+	}
+	g, err := NewGarbageCollector(cleaner, tracker, refresh, nil, cfg, testr.New(t))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return g
+}
+
+func TestGarbageCollectorRemovesUnreferencedImages(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := start
+	tracker := NewReferenceTracker()
+	tracker.started = start
+	tracker.now = func() time.Time { return now }
+
+	cleaner := &fakeCleaner{images: map[string][]registry.Image{
+		"mirrors/nginx": {
+			{Digest: "sha256:old", Tags: []string{"1.24.0"}},
+			{Digest: "sha256:used", Tags: []string{"1.25.3"}},
+			{Digest: "sha256:protected", Tags: []string{"stable"}},
+			{Digest: "sha256:shared", Tags: []string{"1.23.0", "1.23"}},
+			{Digest: "sha256:index-child"},
+		},
+		"other/app": {{Digest: "sha256:foreign", Tags: []string{"v1"}}},
+	}}
+	refreshed := 0
+	refresh := func(context.Context) error {
+		refreshed++
+		tracker.RecordReference("registry.example.com/mirrors/nginx:1.25.3")
+		tracker.RecordReference("registry.example.com/mirrors/nginx:1.23")
+		return nil
+	}
+	g := newTestCollector(t, cleaner, tracker, refresh, GarbageCollection{
+		Repositories:  []string{"mirrors/*"},
+		ProtectedTags: []string{"stable"},
+	})
+	g.now = func() time.Time { return now }
+	var forgotten []string
+	g.forget = func(repository string, identifiers []string) {
+		for _, id := range identifiers {
+			forgotten = append(forgotten, repository+"/"+id)
+		}
+	}
+
+	now = start.Add(30 * time.Minute)
+	if report := g.Collect(context.Background()); len(report.Actions) != 0 {
+		t.Fatalf("expected nothing to be collected within the grace period, got %+v", report.Actions)
+	}
+
+	now = start.Add(2 * time.Hour)
+	report := g.Collect(context.Background())
+	if refreshed != 2 {
+		t.Fatalf("expected references to be refreshed before every pass, got %d", refreshed)
+	}
+	if !reflect.DeepEqual(cleaner.deleted, []string{"mirrors/nginx@sha256:old"}) {
+		t.Fatalf("unexpected deletions: %v", cleaner.deleted)
+	}
+	if !reflect.DeepEqual(forgotten, []string{"mirrors/nginx/sha256:old", "mirrors/nginx/1.24.0"}) {
+		t.Fatalf("expected the state of deleted images to be forgotten, got %v", forgotten)
+	}
+	if len(report.Actions) != 1 || report.Actions[0].Action != GCActionDelete || report.DryRun {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	if last, ok := g.LastReport(); !ok || len(last.Actions) != 1 {
+		t.Fatalf("expected last report to be stored, got %+v", last)
+	}
+}
+
+func TestGarbageCollectorDryRunKeepLastAndUntag(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	tracker := NewReferenceTracker()
+	tracker.started = start
+	tracker.now = func() time.Time { return start }
+	tracker.RecordReference("123.dkr.ecr.eu-central-1.amazonaws.com/mirrors/app:v1.3.0")
+
+	cleaner := &fakeUntagger{fakeCleaner: fakeCleaner{images: map[string][]registry.Image{
+		"mirrors/app": {
+			{Digest: "sha256:a", Tags: []string{"v1.0.0"}, PushedAt: start.Add(-4 * time.Hour)},
+			{Digest: "sha256:b", Tags: []string{"v1.1.0", "v1.1"}, PushedAt: start.Add(-3 * time.Hour)},
+			{Digest: "sha256:c", Tags: []string{"v1.2.0", "release"}, PushedAt: start.Add(-2 * time.Hour)},
+			{Digest: "sha256:d", Tags: []string{"v1.3.0", "v1.3"}, PushedAt: start.Add(-1 * time.Hour)},
+			{Digest: "sha256:e", Tags: []string{"v2.0.0"}, PushedAt: start.Add(-5 * time.Hour)},
+		},
+	}}}
+	g := newTestCollector(t, cleaner, tracker, nil, GarbageCollection{
+		Repositories:      []string{"/^mirrors\\//"},
+		KeepLast:          1,
+		ProtectedTags:     []string{"release"},
+		ProtectedVersions: ">=2",
+		DryRun:            true,
+	})
+	g.now = func() time.Time { return start.Add(2 * time.Hour) }
+
+	report := g.Collect(context.Background())
+	if len(cleaner.deleted) != 0 || len(cleaner.untagged) != 0 {
+		t.Fatalf("dry run must not remove anything, got %v %v", cleaner.deleted, cleaner.untagged)
+	}
+	var got []string
+	for _, action := range report.Actions {
+		got = append(got, action.Action+" "+action.Digest+" "+strings.Join(action.Tags, ","))
+	}
+	sort.Strings(got)
+	expected := []string{
+		"delete sha256:a v1.0.0",
+		"delete sha256:b v1.1.0,v1.1",
+		"untag sha256:c v1.2.0",
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("unexpected actions: %v", got)
+	}
+
+	g.dryRun = false
+	g.Collect(context.Background())
+	sort.Strings(cleaner.deleted)
+	if !reflect.DeepEqual(cleaner.deleted, []string{"mirrors/app@sha256:a", "mirrors/app@sha256:b"}) || !reflect.DeepEqual(cleaner.untagged, []string{"mirrors/app:v1.2.0"}) {
+		t.Fatalf("unexpected removals: %v %v", cleaner.deleted, cleaner.untagged)
+	}
+}
+
+func TestGarbageCollectorSkipsPassWhenRefreshFails(t *testing.T) {
+	cleaner := &fakeCleaner{images: map[string][]registry.Image{"mirrors/app": {{Digest: "sha256:a", Tags: []string{"v1"}}}}}
+	tracker := NewReferenceTracker()
+	tracker.started = time.Now().Add(-48 * time.Hour)
+	g := newTestCollector(t, cleaner, tracker, func(context.Context) error { return context.DeadlineExceeded }, GarbageCollection{Repositories: []string{"mirrors/*"}})
+
+	report := g.Collect(context.Background())
+	if len(cleaner.deleted) != 0 || len(report.Errors) != 1 {
+		t.Fatalf("expected pass to be skipped, got deleted=%v report=%+v", cleaner.deleted, report)
+	}
+}
+
+func TestValidateGarbageCollection(t *testing.T) {
+	valid := GarbageCollection{Repositories: []string{"mirrors/*"}, GracePeriod: time.Hour, Interval: time.Hour}
+	if err := ValidateGarbageCollection(valid); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	invalid := GarbageCollection{ProtectedTags: []string{"/(/"}, ProtectedVersions: ">=x", KeepLast: -1}
+	err := ValidateGarbageCollection(invalid)
+	if err == nil {
+		t.Fatal("expected validation errors")
+	}
+	for _, want := range []string{"repository pattern is required", "protected tags", "protected versions", "grace period", "interval", "keepLast"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Fatalf("expected %q in %v", want, err)
+		}
+	}
+}
+
+func TestPusherRecordsReferencesOfSkippedImages(t *testing.T) {
+	tracker := NewReferenceTracker()
+	p := NewPusher(fakeTarget{}, false, false, nil, testr.New(t), nil, 0, 0, true, nil, nil, true, nil, nil, WithReferenceRecorder(tracker))
+
+	// Digest pull skips the image until the Pod reports its digest, but the reference is still in use.
+	if err := p.Mirror(context.Background(), "docker.io/library/nginx:1.25", Metadata{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := tracker.seen[trackerKey("library/nginx", "1.25")]; !ok {
+		t.Fatalf("expected reference to be recorded, got %v", tracker.seen)
+	}
+}
@@ -0,0 +1,186 @@
+package mirror
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	remotetransport "github.com/google/go-containerregistry/pkg/v1/remote/transport"
+)
+
+// Verification statuses.
+const (
+	// VerifyMatch is a target with the digest of the source.
+	VerifyMatch = "match"
+	// VerifyPlatformSubset is a target holding some of the platform manifests of a source index,
+	// as written when mirrorPlatforms or the node platform select platforms.
+	VerifyPlatformSubset = "platform_subset"
+	// VerifyMismatch is a target whose digest differs from the source.
+	VerifyMismatch = "mismatch"
+	// VerifyMissing is a target that does not exist.
+	VerifyMissing = "missing"
+	// VerifyExcluded is a source from an excluded registry, which is never mirrored.
+	VerifyExcluded = "excluded"
+)
+
+// Inspector resolves and verifies images without mirroring them.
+type Inspector interface {
+	// Resolve reports how src would be mirrored for meta without contacting a registry.
+	Resolve(src string, meta Metadata) (Resolution, error)
+	// Verify compares the digest of src with the digest of its target.
+	Verify(ctx context.Context, src string, meta Metadata) (Verification, error)
+}
+
+// Resolution is the target of an image and the configuration that led to it. Target is empty
+// when ExcludedBy names the excludeRegistries entry matching the source.
+type Resolution struct {
+	Source            string   `json:"source"`
+	SourceRegistry    string   `json:"sourceRegistry"`
+	SourceRepository  string   `json:"sourceRepository"`
+	ExcludedBy        string   `json:"excludedBy,omitempty"`
+	Repository        string   `json:"repository,omitempty"`
+	RepoPrefix        string   `json:"repoPrefix,omitempty"`
+	Target            string   `json:"target,omitempty"`
+	DigestPull        bool     `json:"digestPull"`
+	DigestPullIgnored bool     `json:"digestPullIgnored,omitempty"`
+	Platforms         []string `json:"platforms,omitempty"`
+}
+
+// Verification is the result of comparing an image at its source and its target.
+type Verification struct {
+	Source       string `json:"source"`
+	Target       string `json:"target,omitempty"`
+	SourceDigest string `json:"sourceDigest,omitempty"`
+	TargetDigest string `json:"targetDigest,omitempty"`
+	Status       string `json:"status"`
+}
+
+func (p *pusher) Resolve(src string, meta Metadata) (Resolution, error) {
+	res := Resolution{Source: src}
+	srcRef, err := name.ParseReference(src, name.WeakValidation)
+	if err != nil {
+		return res, fmt.Errorf("parse source: %w", err)
+	}
+	res.SourceRegistry = sourceRegistry(srcRef)
+	res.SourceRepository = srcRef.Context().RepositoryStr()
+	if excluded, ok := p.matchExcludedRegistry(src); ok {
+		res.ExcludedBy = excluded
+		return res, nil
+	}
+	if meta.Registry == "" {
+		meta.Registry = res.SourceRegistry
+	}
+	res.Repository = p.transform(res.SourceRepository)
+	res.RepoPrefix = expandRepoPrefix(p.target.RepoPrefix(), meta)
+	res.Target, _, err = p.buildTarget(src, srcRef, p.resolveRepoPath(res.SourceRepository, meta))
+	if err != nil {
+		return res, fmt.Errorf("parse target: %w", err)
+	}
+	res.DigestPull = p.pullByDigest
+	if meta.DigestPull != nil {
+		res.DigestPull = *meta.DigestPull
+	}
+	if tag, ok := srcRef.(name.Tag); ok && res.DigestPull {
+		_, res.DigestPullIgnored = p.digestPullIgnoredTags[strings.ToLower(tag.TagStr())]
+	}
+	platforms, _ := p.platformsFor(p.logger, meta)
+	res.Platforms = specsToStrings(mergePlatforms(platformFromMetadata(meta), platforms))
+	return res, nil
+}
+
+func (p *pusher) Verify(ctx context.Context, src string, meta Metadata) (Verification, error) {
+	res, err := p.Resolve(src, meta)
+	if err != nil {
+		return Verification{Source: src}, err
+	}
+	v := Verification{Source: src, Target: res.Target}
+	if res.ExcludedBy != "" {
+		v.Status = VerifyExcluded
+		return v, nil
+	}
+	srcRef, err := name.ParseReference(src, name.WeakValidation)
+	if err != nil {
+		return v, fmt.Errorf("parse source: %w", err)
+	}
+	targetRef, err := name.ParseReference(res.Target, p.targetNameOptions()...)
+	if err != nil {
+		return v, fmt.Errorf("parse target: %w", err)
+	}
+
+	srcDesc, err := p.describe(ctx, srcRef, remote.WithAuthFromKeychain(p.keychain), remote.WithTransport(p.sourceTransport))
+	if err != nil {
+		return v, fmt.Errorf("get source manifest: %w", err)
+	}
+	v.SourceDigest = srcDesc.Digest.String()
+
+	username, password, err := p.target.BasicAuth(ctx)
+	if err != nil {
+		return v, fmt.Errorf("auth: %w", err)
+	}
+	targetDesc, err := p.describe(ctx, targetRef, remote.WithAuth(&authn.Basic{Username: username, Password: password}), remote.WithTransport(p.targetTransport))
+	if err != nil {
+		var te *remotetransport.Error
+		if errors.As(err, &te) && te.StatusCode == http.StatusNotFound {
+			v.Status = VerifyMissing
+			return v, nil
+		}
+		return v, fmt.Errorf("get target manifest: %w", err)
+	}
+	v.TargetDigest = targetDesc.Digest.String()
+
+	switch {
+	case srcDesc.Digest == targetDesc.Digest:
+		v.Status = VerifyMatch
+	case platformSubset(srcDesc, targetDesc):
+		v.Status = VerifyPlatformSubset
+	default:
+		v.Status = VerifyMismatch
+	}
+	return v, nil
+}
+
+func (p *pusher) describe(ctx context.Context, ref name.Reference, opts ...remote.Option) (*remote.Descriptor, error) {
+	ctx, cancel := p.operationContext(ctx)
+	defer cancel()
+	return remoteGetFunc(ref, append(opts, remote.WithContext(ctx))...)
+}
+
+// platformSubset reports whether every manifest of target is a platform manifest of the source
+// index, which is what copycat pushes when it mirrors selected platforms only.
+func platformSubset(source, target *remote.Descriptor) bool {
+	if !source.MediaType.IsIndex() {
+		return false
+	}
+	sourceIndex, err := v1.ParseIndexManifest(bytes.NewReader(source.Manifest))
+	if err != nil {
+		return false
+	}
+	children := make(map[v1.Hash]struct{}, len(sourceIndex.Manifests))
+	for _, desc := range sourceIndex.Manifests {
+		children[desc.Digest] = struct{}{}
+	}
+	targets := []v1.Hash{target.Digest}
+	if target.MediaType.IsIndex() {
+		targetIndex, err := v1.ParseIndexManifest(bytes.NewReader(target.Manifest))
+		if err != nil || len(targetIndex.Manifests) == 0 {
+			return false
+		}
+		targets = targets[:0]
+		for _, desc := range targetIndex.Manifests {
+			targets = append(targets, desc.Digest)
+		}
+	}
+	for _, digest := range targets {
+		if _, ok := children[digest]; !ok {
+			return false
+		}
+	}
+	return true
+}
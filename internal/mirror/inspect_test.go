@@ -0,0 +1,109 @@
+package mirror
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	remotetransport "github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+func TestResolveReportsTargetAndRules(t *testing.T) {
+	p := NewPusher(fakeTarget{prefix: "$namespace"}, false, false, nil, testr.New(t), nil, 0, 0, true, []string{"latest"}, nil, false, []string{"registry.k8s.io"}, []string{"linux/arm64"})
+	inspector, ok := p.(Inspector)
+	if !ok {
+		t.Fatalf("expected pusher to implement Inspector")
+	}
+
+	res, err := inspector.Resolve("nginx:latest", Metadata{Namespace: "team-a"})
+	if err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+	want := Resolution{
+		Source:            "nginx:latest",
+		SourceRegistry:    "docker.io",
+		SourceRepository:  "library/nginx",
+		Repository:        "library/nginx",
+		RepoPrefix:        "team-a",
+		Target:            "example.com/team-a/library/nginx:latest",
+		DigestPull:        true,
+		DigestPullIgnored: true,
+		Platforms:         []string{"linux/arm64"},
+	}
+	if !reflect.DeepEqual(res, want) {
+		t.Fatalf("unexpected resolution:\n got %+v\nwant %+v", res, want)
+	}
+
+	res, err = inspector.Resolve("registry.k8s.io/pause:3.10", Metadata{})
+	if err != nil {
+		t.Fatalf("resolve excluded image: %v", err)
+	}
+	if res.ExcludedBy != "registry.k8s.io" || res.Target != "" {
+		t.Fatalf("expected excluded image without target, got %+v", res)
+	}
+}
+
+func TestVerifyComparesSourceAndTargetDigests(t *testing.T) {
+	amd64 := v1.Hash{Algorithm: "sha256", Hex: strings.Repeat("a", 64)}
+	arm64 := v1.Hash{Algorithm: "sha256", Hex: strings.Repeat("b", 64)}
+	index := func(children ...v1.Hash) *remote.Descriptor {
+		manifest := v1.IndexManifest{SchemaVersion: 2, MediaType: types.OCIImageIndex}
+		for _, digest := range children {
+			manifest.Manifests = append(manifest.Manifests, v1.Descriptor{MediaType: types.OCIManifestSchema1, Digest: digest})
+		}
+		raw, err := json.Marshal(manifest)
+		if err != nil {
+			t.Fatalf("marshal index: %v", err)
+		}
+		digest, _, _ := v1.SHA256(strings.NewReader(string(raw)))
+		return &remote.Descriptor{Descriptor: v1.Descriptor{MediaType: types.OCIImageIndex, Digest: digest}, Manifest: raw}
+	}
+	source := index(amd64, arm64)
+
+	cases := []struct {
+		name   string
+		target *remote.Descriptor
+		want   string
+	}{
+		{"match", source, VerifyMatch},
+		{"platform subset", index(arm64), VerifyPlatformSubset},
+		{"single platform", &remote.Descriptor{Descriptor: v1.Descriptor{MediaType: types.OCIManifestSchema1, Digest: amd64}}, VerifyPlatformSubset},
+		{"mismatch", index(amd64, v1.Hash{Algorithm: "sha256", Hex: strings.Repeat("c", 64)}), VerifyMismatch},
+		{"missing", nil, VerifyMissing},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			originalGet := remoteGetFunc
+			remoteGetFunc = func(ref name.Reference, _ ...remote.Option) (*remote.Descriptor, error) {
+				if ref.Context().RegistryStr() != "example.com" {
+					return source, nil
+				}
+				if tc.target == nil {
+					return nil, &remotetransport.Error{StatusCode: http.StatusNotFound}
+				}
+				return tc.target, nil
+			}
+			t.Cleanup(func() { remoteGetFunc = originalGet })
+
+			p := NewPusher(fakeTarget{}, false, false, nil, testr.New(t), nil, 0, 0, false, nil, nil, false, nil, nil)
+			v, err := p.(Inspector).Verify(context.Background(), "nginx:1.27", Metadata{})
+			if err != nil {
+				t.Fatalf("verify: %v", err)
+			}
+			if v.Status != tc.want {
+				t.Fatalf("expected status %s, got %+v", tc.want, v)
+			}
+			if v.Target != "example.com/library/nginx:1.27" || v.SourceDigest != source.Digest.String() {
+				t.Fatalf("unexpected verification %+v", v)
+			}
+		})
+	}
+}
@@ -0,0 +1,425 @@
+package mirror
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+)
+
+// Image statuses reported by the inventory.
+const (
+	// ImagePending is an image that was requested but has not been mirrored yet, for example
+	// during a dry run.
+	ImagePending = "pending"
+	// ImageMirroring is an image whose mirror is running.
+	ImageMirroring = "mirroring"
+	// ImageMirrored is an image present at the target with the source digest.
+	ImageMirrored = "mirrored"
+	// ImagePendingDigest is an image skipped with digest pull until its Pod reports a digest.
+	ImagePendingDigest = "pending_digest"
+	// ImageCooldown is an image whose last mirror failed and that is retried at RetryAt.
+	ImageCooldown = "cooldown"
+	// ImageExcluded is an image from an excluded registry.
+	ImageExcluded = "excluded"
+	// ImageFailed is an image whose last mirror failed without a cooldown.
+	ImageFailed = "failed"
+)
+
+// WorkloadReference is a workload container that requested an image. Name is the Pod or the
+// owning workload, depending on the controller that saw it.
+type WorkloadReference struct {
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Container string `json:"container,omitempty"`
+}
+
+// ImageRecord describes a source reference copycat knows about.
+type ImageRecord struct {
+	Source        string              `json:"source"`
+	Target        string              `json:"target,omitempty"`
+	SourceDigest  string              `json:"sourceDigest,omitempty"`
+	TargetDigest  string              `json:"targetDigest,omitempty"`
+	Status        string              `json:"status"`
+	MirroredAt    time.Time           `json:"mirroredAt,omitzero"`
+	RetryAt       time.Time           `json:"retryAt,omitzero"`
+	FailureReason string              `json:"failureReason,omitempty"`
+	LastSeen      time.Time           `json:"lastSeen"`
+	Workloads     []WorkloadReference `json:"workloads,omitempty"`
+}
+
+// ImageInventory lists the images requested since startup together with their mirror state. A
+// source reference has one record for every target it is mirrored to, for example one per
+// namespace with a $namespace repository prefix.
+type ImageInventory interface {
+	Images() []ImageRecord
+	// Image returns the records of ref, which is matched the same way regardless of whether the
+	// registry or library/ prefix of Docker Hub images is spelled out.
+	Image(ref string) []ImageRecord
+	// ImageFor returns the record of ref for the target it is mirrored to with meta.
+	ImageFor(ref string, meta Metadata) (ImageRecord, bool)
+}
+
+// WorkloadForgetter is implemented by pushers that attribute images to workloads, so that
+// controllers can drop the references of a deleted workload.
+type WorkloadForgetter interface {
+	ForgetWorkload(namespace, name string)
+}
+
+// requestRecorder is implemented by pushers that keep an inventory, so that requests coalesced by
+// the mirror queue are still attributed to every workload.
+type requestRecorder interface {
+	recordRequest(src string, meta Metadata)
+}
+
+// inventoryRetention is how long records and workload references are kept after they were last
+// requested. Controllers reconcile every workload at least once per resync period, which is
+// shorter by default.
+const inventoryRetention = 24 * time.Hour
+
+// inventoryExpiryInterval bounds how often the inventory looks for expired entries.
+const inventoryExpiryInterval = time.Minute
+
+// inventoryKey identifies a record by its source reference and the target resolved when it was
+// requested, before the architecture of the image is known. Excluded images have no target.
+type inventoryKey struct {
+	source string
+	target string
+}
+
+// normalizeSource normalizes src so that equivalent spellings share one record.
+func normalizeSource(src string) string {
+	ref, err := name.ParseReference(src, name.WeakValidation)
+	if err != nil {
+		return strings.TrimSpace(src)
+	}
+	return ref.Name()
+}
+
+// inventoryKey returns the key src is recorded under when it is mirrored with meta.
+func (p *pusher) inventoryKey(src string, meta Metadata) inventoryKey {
+	key := inventoryKey{source: normalizeSource(src)}
+	if _, excluded := p.matchExcludedRegistry(src); excluded {
+		return key
+	}
+	srcRef, err := name.ParseReference(src, name.WeakValidation)
+	if err != nil {
+		return key
+	}
+	if meta.Registry == "" {
+		meta.Registry = sourceRegistry(srcRef)
+	}
+	if target, _, err := p.buildTarget(src, srcRef, p.resolveRepoPath(srcRef.Context().RepositoryStr(), meta)); err == nil {
+		key.target = target
+	}
+	return key
+}
+
+type inventoryEntry struct {
+	ImageRecord
+	// workloads maps every referencing workload to the time it last requested the image.
+	workloads map[WorkloadReference]time.Time
+}
+
+// imageInventory remembers the outcome of the last mirror of every source reference and target.
+// Cooldowns are derived from the failure state of the pusher when the inventory is read, so that
+// a reset is reflected immediately. Records and workload references expire once they have not been
+// requested for inventoryRetention.
+type imageInventory struct {
+	mu      sync.Mutex
+	entries map[inventoryKey]*inventoryEntry
+	expired time.Time
+}
+
+func newImageInventory() *imageInventory {
+	return &imageInventory{entries: make(map[inventoryKey]*inventoryEntry)}
+}
+
+// update applies fn to the record of key, creating a pending record first if needed.
+func (i *imageInventory) update(key inventoryKey, fn func(*inventoryEntry)) {
+	if i == nil {
+		return
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	entry, ok := i.entries[key]
+	if !ok {
+		entry = &inventoryEntry{
+			ImageRecord: ImageRecord{Source: key.source, Target: key.target, Status: ImagePending},
+			workloads:   make(map[WorkloadReference]time.Time),
+		}
+		i.entries[key] = entry
+	}
+	fn(entry)
+}
+
+func (i *imageInventory) request(key inventoryKey, meta Metadata, now time.Time) {
+	i.update(key, func(e *inventoryEntry) {
+		e.LastSeen = now
+		if meta.Namespace != "" || meta.PodName != "" {
+			e.workloads[WorkloadReference{Namespace: meta.Namespace, Name: meta.PodName, Container: meta.ContainerName}] = now
+		}
+	})
+	i.expire(now)
+}
+
+// expire drops the records and workload references not requested within inventoryRetention.
+func (i *imageInventory) expire(now time.Time) {
+	if i == nil {
+		return
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if now.Sub(i.expired) < inventoryExpiryInterval {
+		return
+	}
+	i.expired = now
+	cutoff := now.Add(-inventoryRetention)
+	for key, entry := range i.entries {
+		if entry.LastSeen.Before(cutoff) {
+			delete(i.entries, key)
+			continue
+		}
+		for w, seen := range entry.workloads {
+			if seen.Before(cutoff) {
+				delete(entry.workloads, w)
+			}
+		}
+	}
+}
+
+// forgetWorkload drops the references of the workload namespace/name. Records that only this
+// workload referenced are dropped with it.
+func (i *imageInventory) forgetWorkload(namespace, name string) {
+	if i == nil {
+		return
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	for key, entry := range i.entries {
+		if len(entry.workloads) == 0 {
+			continue
+		}
+		for w := range entry.workloads {
+			if w.Namespace == namespace && w.Name == name {
+				delete(entry.workloads, w)
+			}
+		}
+		if len(entry.workloads) == 0 {
+			delete(i.entries, key)
+		}
+	}
+}
+
+func (i *imageInventory) setStatus(key inventoryKey, status string) {
+	i.update(key, func(e *inventoryEntry) {
+		e.Status = status
+		e.FailureReason = ""
+	})
+}
+
+func (i *imageInventory) setTarget(key inventoryKey, target string) {
+	i.update(key, func(e *inventoryEntry) { e.Target = target })
+}
+
+func (i *imageInventory) mirrored(key inventoryKey, sourceDigest, targetDigest string, at time.Time) {
+	i.update(key, func(e *inventoryEntry) {
+		e.Status = ImageMirrored
+		e.SourceDigest = sourceDigest
+		e.TargetDigest = targetDigest
+		e.MirroredAt = at
+		e.FailureReason = ""
+	})
+}
+
+// failed records a failed mirror. A skip during the cooldown keeps the reason of the failure
+// that started it; failures of a previous run are looked up in the state store when read.
+func (i *imageInventory) failed(key inventoryKey, err error) {
+	i.update(key, func(e *inventoryEntry) {
+		if e.Status != ImageFailed {
+			e.FailureReason = ""
+		}
+		e.Status = ImageFailed
+		if !errors.Is(err, ErrInCooldown) {
+			e.FailureReason = err.Error()
+		}
+	})
+}
+
+func (i *imageInventory) snapshot() []ImageRecord {
+	if i == nil {
+		return nil
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	out := make([]ImageRecord, 0, len(i.entries))
+	for _, entry := range i.entries {
+		out = append(out, entry.record())
+	}
+	sortRecords(out)
+	return out
+}
+
+// sortRecords sorts records by source and target.
+func sortRecords(records []ImageRecord) {
+	sort.Slice(records, func(a, b int) bool {
+		if records[a].Source != records[b].Source {
+			return records[a].Source < records[b].Source
+		}
+		return records[a].Target < records[b].Target
+	})
+}
+
+// source returns the records of the source reference source.
+func (i *imageInventory) source(source string) []ImageRecord {
+	if i == nil {
+		return nil
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	var out []ImageRecord
+	for key, entry := range i.entries {
+		if key.source == source {
+			out = append(out, entry.record())
+		}
+	}
+	sortRecords(out)
+	return out
+}
+
+func (i *imageInventory) get(key inventoryKey) (ImageRecord, bool) {
+	if i == nil {
+		return ImageRecord{}, false
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	entry, ok := i.entries[key]
+	if !ok {
+		return ImageRecord{}, false
+	}
+	return entry.record(), true
+}
+
+// byTarget returns the records of images with a resolved target, keyed by target.
+func (i *imageInventory) byTarget() map[string]ImageRecord {
+	if i == nil {
+		return nil
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	out := make(map[string]ImageRecord, len(i.entries))
+	for _, entry := range i.entries {
+		if entry.Target != "" {
+			out[entry.Target] = entry.ImageRecord
+		}
+	}
+	return out
+}
+
+func (e *inventoryEntry) record() ImageRecord {
+	r := e.ImageRecord
+	r.Workloads = make([]WorkloadReference, 0, len(e.workloads))
+	for w := range e.workloads {
+		r.Workloads = append(r.Workloads, w)
+	}
+	sort.Slice(r.Workloads, func(a, b int) bool {
+		x, y := r.Workloads[a], r.Workloads[b]
+		if x.Namespace != y.Namespace {
+			return x.Namespace < y.Namespace
+		}
+		if x.Name != y.Name {
+			return x.Name < y.Name
+		}
+		return x.Container < y.Container
+	})
+	return r
+}
+
+// markMirrored remembers that target holds the image requested as key.
+func (p *pusher) markMirrored(key inventoryKey, target, sourceDigest, targetDigest string) {
+	p.state.markMirrored(target, key.target, sourceDigest, targetDigest)
+	p.inventory.mirrored(key, sourceDigest, targetDigest, p.currentTime())
+}
+
+// markKnownDigest records an image skipped because the state store knows that target was pushed
+// to pushed.
+func (p *pusher) markKnownDigest(key inventoryKey, target, pushed string) {
+	if state, ok := p.state.lookup(target); ok {
+		p.inventory.setTarget(key, pushed)
+		p.inventory.mirrored(key, state.SourceDigest, state.TargetDigest, state.MirroredAt)
+	}
+}
+
+func (p *pusher) recordRequest(src string, meta Metadata) {
+	p.inventory.request(p.inventoryKey(src, meta), meta, p.currentTime())
+}
+
+// ForgetWorkload drops the references of a deleted workload from the inventory.
+func (p *pusher) ForgetWorkload(namespace, name string) {
+	p.inventory.forgetWorkload(namespace, name)
+}
+
+// Images returns every source reference requested since startup, sorted by source and target.
+func (p *pusher) Images() []ImageRecord {
+	records := p.inventory.snapshot()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for n := range records {
+		p.resolveImageStatus(&records[n])
+	}
+	return records
+}
+
+func (p *pusher) Image(ref string) []ImageRecord {
+	records := p.inventory.source(normalizeSource(ref))
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for n := range records {
+		p.resolveImageStatus(&records[n])
+	}
+	return records
+}
+
+func (p *pusher) ImageFor(ref string, meta Metadata) (ImageRecord, bool) {
+	record, ok := p.inventory.get(p.inventoryKey(ref, meta))
+	if !ok {
+		return ImageRecord{}, false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.resolveImageStatus(&record)
+	return record, true
+}
+
+// resolveImageStatus reports running mirrors and failures still in cooldown. Callers must hold
+// p.mu.
+func (p *pusher) resolveImageStatus(r *ImageRecord) {
+	if r.Target == "" {
+		return
+	}
+	if _, running := p.pushed[r.Target]; running {
+		r.Status = ImageMirroring
+		return
+	}
+	if r.Status != ImageFailed {
+		return
+	}
+	if r.FailureReason == "" {
+		if state, ok := p.state.lookup(r.Target); ok {
+			r.FailureReason = state.FailureReason
+		}
+	}
+	if p.failureCooldown <= 0 {
+		return
+	}
+	p.adoptPersistedFailure(r.Target)
+	if failedAt, ok := p.failed[r.Target]; ok {
+		if retryAt := failedAt.Add(p.failureCooldown); p.currentTime().Before(retryAt) {
+			r.Status = ImageCooldown
+			r.RetryAt = retryAt
+		}
+	}
+}
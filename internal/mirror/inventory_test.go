@@ -0,0 +1,205 @@
+package mirror
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+
+	"github.com/matzegebbe/k8s-copycat/pkg/metrics"
+)
+
+func TestInventoryRecordsMirroredImagesAndWorkloads(t *testing.T) {
+	metrics.Reset()
+	t.Cleanup(metrics.Reset)
+
+	digest := v1.Hash{Algorithm: "sha256", Hex: strings.Repeat("a", 64)}
+	originalHead := remoteHeadFunc
+	remoteHeadFunc = func(name.Reference, ...remote.Option) (*v1.Descriptor, error) {
+		return &v1.Descriptor{Digest: digest}, nil
+	}
+	t.Cleanup(func() { remoteHeadFunc = originalHead })
+
+	p := NewPusher(fakeTarget{}, false, false, nil, testr.New(t), nil, 0, 0, true, nil, nil, true, nil, nil)
+	source := "nginx@" + digest.String()
+	for _, pod := range []string{"web", "api"} {
+		if err := p.Mirror(context.Background(), source, Metadata{Namespace: "apps", PodName: pod, ContainerName: "nginx"}); err != nil {
+			t.Fatalf("unexpected error from Mirror: %v", err)
+		}
+	}
+
+	inventory := p.(ImageInventory)
+	records := inventory.Image("docker.io/library/nginx@" + digest.String())
+	if len(records) != 1 {
+		t.Fatalf("expected image to be found by its fully qualified reference, got %+v", records)
+	}
+	record := records[0]
+	if record.Status != ImageMirrored || record.SourceDigest != digest.String() || record.TargetDigest != digest.String() {
+		t.Fatalf("unexpected record: %+v", record)
+	}
+	if !strings.HasPrefix(record.Target, "example.com/") {
+		t.Fatalf("expected target reference, got %q", record.Target)
+	}
+	want := []WorkloadReference{{Namespace: "apps", Name: "api", Container: "nginx"}, {Namespace: "apps", Name: "web", Container: "nginx"}}
+	if len(record.Workloads) != len(want) || record.Workloads[0] != want[0] || record.Workloads[1] != want[1] {
+		t.Fatalf("unexpected workloads: %+v", record.Workloads)
+	}
+	if images := inventory.Images(); len(images) != 1 {
+		t.Fatalf("expected equivalent references to share one record, got %d", len(images))
+	}
+}
+
+func TestInventoryReportsCooldownUntilReset(t *testing.T) {
+	metrics.Reset()
+	t.Cleanup(metrics.Reset)
+
+	originalGet := remoteGetFunc
+	remoteGetFunc = func(name.Reference, ...remote.Option) (*remote.Descriptor, error) {
+		return nil, errors.New("pull failed")
+	}
+	t.Cleanup(func() { remoteGetFunc = originalGet })
+
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	p := NewPusher(fakeTarget{}, false, false, nil, testr.New(t), nil, 0, time.Hour, false, nil, nil, true, nil, nil)
+	impl := p.(*pusher)
+	impl.now = func() time.Time { return now }
+
+	if err := p.Mirror(context.Background(), "nginx:1.25", Metadata{}); err == nil {
+		t.Fatalf("expected error from Mirror when source pull fails")
+	}
+	// A request during the cooldown keeps the reason of the original failure.
+	if err := p.Mirror(context.Background(), "nginx:1.25", Metadata{}); !errors.Is(err, ErrInCooldown) {
+		t.Fatalf("expected cooldown error, got %v", err)
+	}
+
+	record, ok := impl.ImageFor("nginx:1.25", Metadata{})
+	if !ok {
+		t.Fatalf("expected image to be recorded")
+	}
+	if record.Status != ImageCooldown || !record.RetryAt.Equal(now.Add(time.Hour)) {
+		t.Fatalf("expected cooldown until %v, got %+v", now.Add(time.Hour), record)
+	}
+	if !strings.Contains(record.FailureReason, "pull failed") {
+		t.Fatalf("expected failure reason of the original error, got %q", record.FailureReason)
+	}
+
+	impl.ResetCooldown()
+	record, _ = impl.ImageFor("nginx:1.25", Metadata{})
+	if record.Status != ImageFailed || !record.RetryAt.IsZero() {
+		t.Fatalf("expected failed image without cooldown after reset, got %+v", record)
+	}
+}
+
+func TestInventoryRecordsExcludedImages(t *testing.T) {
+	p := NewPusher(fakeTarget{}, false, false, nil, testr.New(t), nil, 0, 0, false, nil, nil, true, []string{"quay.io"}, nil)
+	if err := p.Mirror(context.Background(), "quay.io/prometheus/prometheus:v3.0.0", Metadata{Namespace: "monitoring"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	record, ok := p.(ImageInventory).ImageFor("quay.io/prometheus/prometheus:v3.0.0", Metadata{Namespace: "monitoring"})
+	if !ok || record.Status != ImageExcluded || record.Target != "" {
+		t.Fatalf("expected excluded image without target, got %+v (%v)", record, ok)
+	}
+}
+
+func TestMirrorQueueRecordsCoalescedRequests(t *testing.T) {
+	p := NewPusher(fakeTarget{}, false, false, nil, testr.New(t), nil, 0, 0, false, nil, nil, true, nil, nil)
+	q := NewMirrorQueue(p, 1, testr.New(t))
+	// Without running workers both requests join the same queued job.
+	q.Enqueue(context.Background(), "nginx:1.25", Metadata{Namespace: "a", PodName: "one"}, "a/one")
+	q.Enqueue(context.Background(), "nginx:1.25", Metadata{Namespace: "b", PodName: "two"}, "b/two")
+	if q.Len() != 1 {
+		t.Fatalf("expected requests to be coalesced, got %d jobs", q.Len())
+	}
+	record, ok := p.(ImageInventory).ImageFor("nginx:1.25", Metadata{Namespace: "a"})
+	if !ok || record.Status != ImagePending || len(record.Workloads) != 2 {
+		t.Fatalf("expected pending image requested by both workloads, got %+v (%v)", record, ok)
+	}
+}
+
+func TestInventoryKeepsARecordPerTarget(t *testing.T) {
+	digest := v1.Hash{Algorithm: "sha256", Hex: strings.Repeat("c", 64)}
+	originalHead := remoteHeadFunc
+	remoteHeadFunc = func(name.Reference, ...remote.Option) (*v1.Descriptor, error) {
+		return &v1.Descriptor{Digest: digest}, nil
+	}
+	t.Cleanup(func() { remoteHeadFunc = originalHead })
+
+	p := NewPusher(fakeTarget{prefix: "$namespace"}, false, false, nil, testr.New(t), nil, 0, 0, true, nil, nil, true, nil, nil)
+	source := "nginx@" + digest.String()
+	for _, ns := range []string{"shop", "blog"} {
+		if err := p.Mirror(context.Background(), source, Metadata{Namespace: ns, PodName: "web", ContainerName: "nginx"}); err != nil {
+			t.Fatalf("unexpected error from Mirror: %v", err)
+		}
+	}
+
+	inventory := p.(ImageInventory)
+	records := inventory.Image(source)
+	if len(records) != 2 || !strings.Contains(records[0].Target, "/blog/") || !strings.Contains(records[1].Target, "/shop/") {
+		t.Fatalf("expected one record per namespace target, got %+v", records)
+	}
+	for _, record := range records {
+		if record.Status != ImageMirrored || len(record.Workloads) != 1 {
+			t.Fatalf("expected each target to be mirrored for its own workload, got %+v", record)
+		}
+	}
+	record, ok := inventory.ImageFor(source, Metadata{Namespace: "shop"})
+	if !ok || record.Target != records[1].Target || record.Workloads[0].Namespace != "shop" {
+		t.Fatalf("expected the record of the shop target, got %+v (%v)", record, ok)
+	}
+}
+
+func TestInventoryForgetsDeletedAndExpiredWorkloads(t *testing.T) {
+	digest := v1.Hash{Algorithm: "sha256", Hex: strings.Repeat("d", 64)}
+	originalHead := remoteHeadFunc
+	remoteHeadFunc = func(name.Reference, ...remote.Option) (*v1.Descriptor, error) {
+		return &v1.Descriptor{Digest: digest}, nil
+	}
+	t.Cleanup(func() { remoteHeadFunc = originalHead })
+
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	p := NewPusher(fakeTarget{}, false, false, nil, testr.New(t), nil, 0, 0, true, nil, nil, true, nil, nil)
+	impl := p.(*pusher)
+	impl.now = func() time.Time { return now }
+	mirror := func(image string, meta Metadata) {
+		t.Helper()
+		if err := p.Mirror(context.Background(), image+"@"+digest.String(), meta); err != nil {
+			t.Fatalf("unexpected error from Mirror: %v", err)
+		}
+	}
+	records := func(image string) []ImageRecord {
+		return impl.Image(image + "@" + digest.String())
+	}
+
+	mirror("nginx", Metadata{Namespace: "apps", PodName: "web", ContainerName: "nginx"})
+	mirror("nginx", Metadata{Namespace: "apps", PodName: "api", ContainerName: "nginx"})
+	mirror("redis", Metadata{Namespace: "apps", PodName: "web", ContainerName: "redis"})
+	mirror("alpine", Metadata{})
+
+	p.(WorkloadForgetter).ForgetWorkload("apps", "web")
+	if r := records("nginx"); len(r) != 1 || len(r[0].Workloads) != 1 || r[0].Workloads[0].Name != "api" {
+		t.Fatalf("expected only the remaining workload to reference nginx, got %+v", r)
+	}
+	if r := records("redis"); len(r) != 0 {
+		t.Fatalf("expected image of the deleted workload to be dropped, got %+v", r)
+	}
+	if r := records("alpine"); len(r) != 1 {
+		t.Fatalf("expected image requested without a workload to be kept, got %+v", r)
+	}
+
+	now = now.Add(inventoryRetention / 2)
+	mirror("nginx", Metadata{Namespace: "apps", PodName: "job", ContainerName: "nginx"})
+	now = now.Add(inventoryRetention/2 + time.Minute)
+	mirror("busybox", Metadata{})
+	if r := records("alpine"); len(r) != 0 {
+		t.Fatalf("expected image not requested within the retention to expire, got %+v", r)
+	}
+	if r := records("nginx"); len(r) != 1 || len(r[0].Workloads) != 1 || r[0].Workloads[0].Name != "job" {
+		t.Fatalf("expected only the recently requesting workload to be kept, got %+v", r)
+	}
+}
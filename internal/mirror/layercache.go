@@ -0,0 +1,323 @@
+package mirror
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// DefaultLayerCacheMaxBytes bounds the layer cache when no size is configured.
+const DefaultLayerCacheMaxBytes int64 = 10 << 30
+
+const layerCacheTempPrefix = ".download-"
+
+// LayerCache keeps compressed layers pulled from source registries on a local volume, so that
+// pushes of the same layer to another target, retries after a failed push and later force
+// reconciles read it from disk instead of downloading it again. Files are named after their
+// digest and only stored after the download was read completely and matched the digest. When
+// the cache grows beyond its size, the least recently used layers are removed.
+type LayerCache struct {
+	dir      string
+	maxBytes int64
+	logger   logr.Logger
+
+	mu   sync.Mutex
+	size int64
+}
+
+// NewLayerCache returns a cache in dir holding at most maxBytes of layers. Incomplete downloads
+// left behind by a previous run are removed.
+func NewLayerCache(dir string, maxBytes int64, logger logr.Logger) (*LayerCache, error) {
+	if maxBytes <= 0 {
+		maxBytes = DefaultLayerCacheMaxBytes
+	}
+	if logger.GetSink() == nil {
+		logger = ctrl.Log.WithName("mirror").WithName("layer-cache")
+	} else {
+		logger = logger.WithName("layer-cache")
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("create layer cache directory: %w", err)
+	}
+	c := &LayerCache{dir: dir, maxBytes: maxBytes, logger: logger}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("read layer cache directory: %w", err)
+	}
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), layerCacheTempPrefix) {
+			_ = os.Remove(filepath.Join(dir, entry.Name()))
+			continue
+		}
+		if info, err := entry.Info(); err == nil && info.Mode().IsRegular() {
+			c.size += info.Size()
+		}
+	}
+	c.prune()
+	return c, nil
+}
+
+// Size returns the number of bytes currently held by the cache.
+func (c *LayerCache) Size() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.size
+}
+
+func (c *LayerCache) path(digest v1.Hash) string {
+	return filepath.Join(c.dir, digest.Algorithm+"-"+digest.Hex)
+}
+
+// open returns the cached layer for digest and marks it as recently used.
+func (c *LayerCache) open(digest v1.Hash) (*os.File, bool) {
+	p := c.path(digest)
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, false
+	}
+	now := time.Now()
+	_ = os.Chtimes(p, now, now)
+	return f, true
+}
+
+// store moves a completed download into place and evicts old layers when the cache is full.
+func (c *LayerCache) store(tmp string, digest v1.Hash, size int64) {
+	if err := os.Rename(tmp, c.path(digest)); err != nil {
+		c.logger.V(1).Info("unable to store layer in cache", "digest", digest.String(), "error", err)
+		_ = os.Remove(tmp)
+		return
+	}
+	c.mu.Lock()
+	c.size += size
+	c.mu.Unlock()
+	c.prune()
+}
+
+func (c *LayerCache) prune() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.size <= c.maxBytes {
+		return
+	}
+	entries, err := os.ReadDir(c.dir)
+	if err != nil {
+		c.logger.V(1).Info("unable to read layer cache directory", "error", err)
+		return
+	}
+	type cached struct {
+		path   string
+		size   int64
+		usedAt time.Time
+	}
+	var files []cached
+	var total int64
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), layerCacheTempPrefix) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		files = append(files, cached{path: filepath.Join(c.dir, entry.Name()), size: info.Size(), usedAt: info.ModTime()})
+		total += info.Size()
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].usedAt.Before(files[j].usedAt) })
+	removed := 0
+	for _, f := range files {
+		if total <= c.maxBytes {
+			break
+		}
+		// Readers that already opened the file keep reading it after removal.
+		if err := os.Remove(f.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		total -= f.size
+		removed++
+	}
+	c.size = total
+	if removed > 0 {
+		c.logger.V(1).Info("evicted least recently used layers from cache", "layers", removed, "bytes", total)
+	}
+}
+
+// layer wraps l so that its compressed contents are served from and written to the cache.
+func (c *LayerCache) layer(l v1.Layer) v1.Layer {
+	if c == nil {
+		return l
+	}
+	// Keep layers mountable from the source repository when it lives in the target registry.
+	if ml, ok := l.(*remote.MountableLayer); ok {
+		return &remote.MountableLayer{Layer: &cachedLayer{Layer: ml.Layer, cache: c}, Reference: ml.Reference}
+	}
+	return &cachedLayer{Layer: l, cache: c}
+}
+
+func (c *LayerCache) image(img v1.Image) v1.Image {
+	if c == nil {
+		return img
+	}
+	return &cachedImage{Image: img, cache: c}
+}
+
+func (c *LayerCache) imageIndex(idx v1.ImageIndex) v1.ImageIndex {
+	if c == nil {
+		return idx
+	}
+	return &cachedIndex{index: idx, cache: c}
+}
+
+type cachedLayer struct {
+	v1.Layer
+	cache *LayerCache
+}
+
+func (l *cachedLayer) Compressed() (io.ReadCloser, error) {
+	digest, err := l.Digest()
+	if err != nil {
+		return l.Layer.Compressed()
+	}
+	if f, ok := l.cache.open(digest); ok {
+		l.cache.logger.V(1).Info("reading layer from cache", "digest", digest.String())
+		return f, nil
+	}
+	rc, err := l.Layer.Compressed()
+	if err != nil {
+		return nil, err
+	}
+	if digest.Algorithm != "sha256" {
+		return rc, nil
+	}
+	tmp, err := os.CreateTemp(l.cache.dir, layerCacheTempPrefix)
+	if err != nil {
+		l.cache.logger.V(1).Info("unable to cache layer", "digest", digest.String(), "error", err)
+		return rc, nil
+	}
+	return &cachingReader{source: rc, file: tmp, hash: sha256.New(), digest: digest, cache: l.cache}, nil
+}
+
+// cachingReader copies a layer download into a temporary file and keeps it only when the
+// download was read to the end and its content matches the digest.
+type cachingReader struct {
+	source   io.ReadCloser
+	file     *os.File
+	hash     hash.Hash
+	digest   v1.Hash
+	cache    *LayerCache
+	size     int64
+	complete bool
+	failed   bool
+}
+
+func (r *cachingReader) Read(b []byte) (int, error) {
+	n, err := r.source.Read(b)
+	if n > 0 && !r.failed {
+		if _, werr := r.file.Write(b[:n]); werr != nil {
+			r.failed = true
+		} else {
+			r.hash.Write(b[:n])
+			r.size += int64(n)
+		}
+	}
+	if errors.Is(err, io.EOF) {
+		r.complete = true
+	}
+	return n, err
+}
+
+func (r *cachingReader) Close() error {
+	err := r.source.Close()
+	tmp := r.file.Name()
+	if closeErr := r.file.Close(); closeErr != nil {
+		r.failed = true
+	}
+	if !r.complete || r.failed || hex.EncodeToString(r.hash.Sum(nil)) != r.digest.Hex {
+		_ = os.Remove(tmp)
+		return err
+	}
+	r.cache.store(tmp, r.digest, r.size)
+	return err
+}
+
+type cachedImage struct {
+	v1.Image
+	cache *LayerCache
+}
+
+func (i *cachedImage) Layers() ([]v1.Layer, error) {
+	layers, err := i.Image.Layers()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]v1.Layer, len(layers))
+	for n, l := range layers {
+		out[n] = i.cache.layer(l)
+	}
+	return out, nil
+}
+
+func (i *cachedImage) LayerByDigest(h v1.Hash) (v1.Layer, error) {
+	l, err := i.Image.LayerByDigest(h)
+	if err != nil {
+		return nil, err
+	}
+	return i.cache.layer(l), nil
+}
+
+type cachedIndex struct {
+	index v1.ImageIndex
+	cache *LayerCache
+}
+
+func (i *cachedIndex) MediaType() (types.MediaType, error) { return i.index.MediaType() }
+func (i *cachedIndex) Digest() (v1.Hash, error)            { return i.index.Digest() }
+func (i *cachedIndex) Size() (int64, error)                { return i.index.Size() }
+func (i *cachedIndex) IndexManifest() (*v1.IndexManifest, error) {
+	return i.index.IndexManifest()
+}
+func (i *cachedIndex) RawManifest() ([]byte, error) { return i.index.RawManifest() }
+
+func (i *cachedIndex) Image(h v1.Hash) (v1.Image, error) {
+	img, err := i.index.Image(h)
+	if err != nil {
+		return nil, err
+	}
+	return i.cache.image(img), nil
+}
+
+func (i *cachedIndex) ImageIndex(h v1.Hash) (v1.ImageIndex, error) {
+	idx, err := i.index.ImageIndex(h)
+	if err != nil {
+		return nil, err
+	}
+	return i.cache.imageIndex(idx), nil
+}
+
+func (i *cachedIndex) Layer(h v1.Hash) (v1.Layer, error) {
+	wl, ok := i.index.(interface {
+		Layer(v1.Hash) (v1.Layer, error)
+	})
+	if !ok {
+		return nil, fmt.Errorf("index has no layer %s", h)
+	}
+	l, err := wl.Layer(h)
+	if err != nil {
+		return nil, err
+	}
+	return i.cache.layer(l), nil
+}
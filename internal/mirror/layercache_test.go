@@ -0,0 +1,101 @@
+package mirror
+
+import (
+	"io"
+	"os"
+	"testing"
+
+	"github.com/go-logr/logr/testr"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// countingLayer counts how often the compressed layer is read from its source.
+type countingLayer struct {
+	v1.Layer
+	reads int
+}
+
+func (l *countingLayer) Compressed() (io.ReadCloser, error) {
+	l.reads++
+	return l.Layer.Compressed()
+}
+
+func newCountingLayer(t *testing.T) *countingLayer {
+	t.Helper()
+	l, err := random.Layer(4096, types.DockerLayer)
+	if err != nil {
+		t.Fatalf("random layer: %v", err)
+	}
+	return &countingLayer{Layer: l}
+}
+
+func readLayer(t *testing.T, l v1.Layer, limit int64) []byte {
+	t.Helper()
+	rc, err := l.Compressed()
+	if err != nil {
+		t.Fatalf("compressed: %v", err)
+	}
+	defer rc.Close()
+	var r io.Reader = rc
+	if limit > 0 {
+		r = io.LimitReader(rc, limit)
+	}
+	b, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	return b
+}
+
+func TestLayerCacheServesCompletedDownloadsFromDisk(t *testing.T) {
+	cache, err := NewLayerCache(t.TempDir(), 0, testr.New(t))
+	if err != nil {
+		t.Fatalf("new cache: %v", err)
+	}
+	source := newCountingLayer(t)
+
+	// An interrupted download must not be kept.
+	readLayer(t, cache.layer(source), 10)
+	if cache.Size() != 0 {
+		t.Fatalf("expected partial download to be discarded, cache holds %d bytes", cache.Size())
+	}
+
+	first := readLayer(t, cache.layer(source), 0)
+	second := readLayer(t, cache.layer(source), 0)
+	if source.reads != 2 {
+		t.Fatalf("expected the complete download to be served from disk, source read %d times", source.reads)
+	}
+	if string(first) != string(second) || cache.Size() != int64(len(first)) {
+		t.Fatalf("unexpected cached content: %d bytes vs %d bytes, cache size %d", len(first), len(second), cache.Size())
+	}
+}
+
+func TestLayerCacheEvictsLeastRecentlyUsedLayers(t *testing.T) {
+	dir := t.TempDir()
+	cache, err := NewLayerCache(dir, 1, testr.New(t))
+	if err != nil {
+		t.Fatalf("new cache: %v", err)
+	}
+	readLayer(t, cache.layer(newCountingLayer(t)), 0)
+	readLayer(t, cache.layer(newCountingLayer(t)), 0)
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("read dir: %v", err)
+	}
+	if len(entries) != 0 || cache.Size() != 0 {
+		t.Fatalf("expected layers beyond the size limit to be evicted, got %d files and %d bytes", len(entries), cache.Size())
+	}
+
+	if err := os.WriteFile(dir+"/"+layerCacheTempPrefix+"stale", []byte("partial"), 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if _, err := NewLayerCache(dir, 0, testr.New(t)); err != nil {
+		t.Fatalf("new cache: %v", err)
+	}
+	if _, err := os.Stat(dir + "/" + layerCacheTempPrefix + "stale"); !os.IsNotExist(err) {
+		t.Fatalf("expected stale download to be removed on startup, got %v", err)
+	}
+}
@@ -0,0 +1,188 @@
+package mirror
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// maxTrackedBlobs bounds the memory used to remember blob locations. When it is exceeded the
+// index starts over, which only costs uploads that could have been mounts.
+const maxTrackedBlobs = 200000
+
+// blobIndex remembers one target repository that holds each blob pushed by copycat, so that a
+// push of the same layers into another repository of the target registry can mount them instead
+// of uploading them again.
+type blobIndex struct {
+	mu    sync.Mutex
+	repos map[v1.Hash]name.Repository
+}
+
+func newBlobIndex() *blobIndex {
+	return &blobIndex{repos: make(map[v1.Hash]name.Repository)}
+}
+
+// forRepository returns the mounts for a single push into repo.
+func (b *blobIndex) forRepository(repo name.Repository) *repositoryMounts {
+	return &repositoryMounts{index: b, repo: repo}
+}
+
+func (b *blobIndex) lookup(digest v1.Hash) (name.Repository, bool) {
+	if b == nil {
+		return name.Repository{}, false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	repo, ok := b.repos[digest]
+	return repo, ok
+}
+
+func (b *blobIndex) record(repo name.Repository, digests []v1.Hash) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.repos)+len(digests) > maxTrackedBlobs {
+		b.repos = make(map[v1.Hash]name.Repository)
+	}
+	for _, digest := range digests {
+		b.repos[digest] = repo
+	}
+}
+
+// repositoryMounts rewrites the layers of a push into repo so that blobs known to exist in another
+// repository are mounted from there. The registry refuses a mount it cannot serve, for example
+// after the blob was deleted, and go-containerregistry then uploads the blob as usual.
+type repositoryMounts struct {
+	index *blobIndex
+	repo  name.Repository
+
+	mu      sync.Mutex
+	digests []v1.Hash
+	mounted int
+}
+
+func (m *repositoryMounts) layer(l v1.Layer) v1.Layer {
+	digest, err := l.Digest()
+	if err != nil {
+		return l
+	}
+	m.mu.Lock()
+	m.digests = append(m.digests, digest)
+	m.mu.Unlock()
+
+	from, ok := m.index.lookup(digest)
+	if !ok || from.String() == m.repo.String() {
+		return l
+	}
+	// Layers pulled from the source registry are already mountable from there; mounting from
+	// the target registry is what avoids the upload.
+	if ml, ok := l.(*remote.MountableLayer); ok {
+		l = ml.Layer
+	}
+	m.mu.Lock()
+	m.mounted++
+	m.mu.Unlock()
+	return &remote.MountableLayer{Layer: l, Reference: from.Digest(digest.String())}
+}
+
+// commit records every blob of a successful push as present in the repository.
+func (m *repositoryMounts) commit() {
+	m.mu.Lock()
+	digests := m.digests
+	m.mu.Unlock()
+	m.index.record(m.repo, digests)
+}
+
+func (m *repositoryMounts) mountCandidates() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.mounted
+}
+
+func (m *repositoryMounts) image(img v1.Image) v1.Image {
+	return &mountableImage{Image: img, mounts: m}
+}
+
+func (m *repositoryMounts) imageIndex(idx v1.ImageIndex) v1.ImageIndex {
+	return &mountableIndex{index: idx, mounts: m}
+}
+
+type mountableImage struct {
+	v1.Image
+	mounts *repositoryMounts
+}
+
+func (i *mountableImage) Layers() ([]v1.Layer, error) {
+	layers, err := i.Image.Layers()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]v1.Layer, len(layers))
+	for n, l := range layers {
+		out[n] = i.mounts.layer(l)
+	}
+	return out, nil
+}
+
+func (i *mountableImage) LayerByDigest(h v1.Hash) (v1.Layer, error) {
+	l, err := i.Image.LayerByDigest(h)
+	if err != nil {
+		return nil, err
+	}
+	return i.mounts.layer(l), nil
+}
+
+func (i *mountableImage) ConfigLayer() (v1.Layer, error) {
+	l, err := partial.ConfigLayer(i.Image)
+	if err != nil {
+		return nil, err
+	}
+	return i.mounts.layer(l), nil
+}
+
+type mountableIndex struct {
+	index  v1.ImageIndex
+	mounts *repositoryMounts
+}
+
+func (i *mountableIndex) MediaType() (types.MediaType, error) { return i.index.MediaType() }
+func (i *mountableIndex) Digest() (v1.Hash, error)            { return i.index.Digest() }
+func (i *mountableIndex) Size() (int64, error)                { return i.index.Size() }
+func (i *mountableIndex) IndexManifest() (*v1.IndexManifest, error) {
+	return i.index.IndexManifest()
+}
+func (i *mountableIndex) RawManifest() ([]byte, error) { return i.index.RawManifest() }
+
+func (i *mountableIndex) Image(h v1.Hash) (v1.Image, error) {
+	img, err := i.index.Image(h)
+	if err != nil {
+		return nil, err
+	}
+	return i.mounts.image(img), nil
+}
+
+func (i *mountableIndex) ImageIndex(h v1.Hash) (v1.ImageIndex, error) {
+	idx, err := i.index.ImageIndex(h)
+	if err != nil {
+		return nil, err
+	}
+	return i.mounts.imageIndex(idx), nil
+}
+
+// Layer keeps non-image children of the index, such as artifacts, available to the writer.
+func (i *mountableIndex) Layer(h v1.Hash) (v1.Layer, error) {
+	wl, ok := i.index.(interface {
+		Layer(v1.Hash) (v1.Layer, error)
+	})
+	if !ok {
+		return nil, fmt.Errorf("index has no layer %s", h)
+	}
+	return wl.Layer(h)
+}
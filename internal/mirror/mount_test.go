@@ -0,0 +1,74 @@
+package mirror
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+func TestRepositoryMountsMountSharedLayersAndFallBackToUpload(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		mounts []string
+	)
+	reg := registry.New(registry.Logger(log.New(io.Discard, "", 0)))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost && r.URL.Query().Get("mount") != "" {
+			mu.Lock()
+			mounts = append(mounts, r.URL.Query().Get("from"))
+			mu.Unlock()
+		}
+		// The test registry shares blobs between repositories and does not support mounts. Hide the
+		// blobs from the second repository so the push has to mount or upload them.
+		if r.Method == http.MethodHead && strings.HasPrefix(r.URL.Path, "/v2/team-b/app/blobs/") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		reg.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	img, err := random.Image(1024, 2)
+	if err != nil {
+		t.Fatalf("random image: %v", err)
+	}
+	blobs := newBlobIndex()
+	for _, repo := range []string{"team-a/app", "team-b/app"} {
+		ref, err := name.ParseReference(host+"/"+repo+":1.0", name.Insecure)
+		if err != nil {
+			t.Fatalf("parse reference: %v", err)
+		}
+		m := blobs.forRepository(ref.Context())
+		if err := remote.Write(ref, m.image(img)); err != nil {
+			t.Fatalf("write %s: %v", repo, err)
+		}
+		m.commit()
+		if repo == "team-b/app" && m.mountCandidates() != 3 {
+			t.Fatalf("expected both layers and the config to be mountable, got %d", m.mountCandidates())
+		}
+		if _, err := remote.Image(ref); err != nil {
+			t.Fatalf("expected %s to be complete after falling back to upload: %v", repo, err)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(mounts) != 3 {
+		t.Fatalf("expected three mount attempts, got %v", mounts)
+	}
+	for _, from := range mounts {
+		if from != "team-a/app" {
+			t.Fatalf("expected mounts from team-a/app, got %v", mounts)
+		}
+	}
+}
@@ -23,6 +23,9 @@ import (
 	"github.com/google/go-containerregistry/pkg/v1/remote"
 	remotetransport "github.com/google/go-containerregistry/pkg/v1/remote/transport"
 	"github.com/google/go-containerregistry/pkg/v1/types"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 
 	"github.com/matzegebbe/k8s-copycat/internal/registry"
 	"github.com/matzegebbe/k8s-copycat/pkg/metrics"
@@ -37,13 +40,14 @@ var (
 	remoteWriteIndexFunc = remote.WriteIndex
 	remoteImageFunc      = remote.Image
 	remoteIndexFunc      = remote.Index
+	remoteListFunc       = remote.List
 )
 
 type Pusher interface {
 	Mirror(ctx context.Context, sourceImage string, meta Metadata) error
 	DryRun() bool
 	DryPull() bool
-	ResetCooldown() (cleared int, cooldownEnabled bool)
+	CooldownManager
 }
 
 // Metadata captures contextual information about the image being mirrored.
@@ -55,6 +59,10 @@ type Metadata struct {
 	OS            string
 	ImageID       string
 	Registry      string
+	// DigestPull overrides the pusher's digestPull setting for this image when set.
+	DigestPull *bool
+	// Platforms overrides the pusher's mirrorPlatforms for this image when set.
+	Platforms []string
 }
 
 type platformSpec struct {
@@ -146,6 +154,17 @@ func parsePlatformSpec(value string) (platformSpec, error) {
 	return spec, nil
 }
 
+// ValidatePlatforms reports platforms that are not written as os/arch or arch.
+func ValidatePlatforms(values []string) error {
+	var errs []error
+	for _, raw := range values {
+		if _, err := parsePlatformSpec(raw); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
 func parseMirrorPlatforms(logger logr.Logger, values []string) ([]platformSpec, map[string]struct{}) {
 	if len(values) == 0 {
 		return nil, nil
@@ -232,8 +251,14 @@ type pusher struct {
 	registryRetry              RetryConfig
 	failureCooldown            time.Duration
 	failed                     map[string]time.Time
+	awaitingDigest             map[string]time.Time
 	now                        func() time.Time
 	excludedRegistries         []string
+	recorder                   ReferenceRecorder
+	state                      *StateCache
+	blobs                      *blobIndex
+	layers                     *LayerCache
+	inventory                  *imageInventory
 }
 
 const DefaultFailureCooldown = time.Hour
@@ -266,7 +291,47 @@ func (e *RetryError) Unwrap() error {
 	return e.Cause
 }
 
-func NewPusher(t registry.Target, dryRun bool, dryPull bool, transform func(string) string, logger logr.Logger, keychain authn.Keychain, requestTimeout time.Duration, failureCooldown time.Duration, pullByDigest bool, digestPullIgnoredTags []string, ignoreMissingPlatforms []string, allowDifferentDigestRepush bool, excluded []string, mirrorPlatforms []string, retryConfig ...RetryConfig) Pusher {
+// PusherOption configures optional dependencies of the pusher returned by NewPusher.
+type PusherOption func(*pusherOptions)
+
+type pusherOptions struct {
+	retry     RetryConfig
+	recorder  ReferenceRecorder
+	state     *StateCache
+	layers    *LayerCache
+	bandwidth *BandwidthLimiter
+}
+
+// WithRetryConfig sets how often and how patiently failed registry requests are retried.
+func WithRetryConfig(retry RetryConfig) PusherOption {
+	return func(o *pusherOptions) { o.retry = retry }
+}
+
+// WithReferenceRecorder passes every target reference the pusher resolves to recorder.
+func WithReferenceRecorder(recorder ReferenceRecorder) PusherOption {
+	return func(o *pusherOptions) { o.recorder = recorder }
+}
+
+// WithStateCache remembers mirrored digests and failures in state.
+func WithStateCache(state *StateCache) PusherOption {
+	return func(o *pusherOptions) { o.state = state }
+}
+
+// WithLayerCache reads layers pulled before from layers instead of downloading them again.
+func WithLayerCache(layers *LayerCache) PusherOption {
+	return func(o *pusherOptions) { o.layers = layers }
+}
+
+// WithBandwidthLimiter throttles pulls and pushes with bandwidth.
+func WithBandwidthLimiter(bandwidth *BandwidthLimiter) PusherOption {
+	return func(o *pusherOptions) { o.bandwidth = bandwidth }
+}
+
+func NewPusher(t registry.Target, dryRun bool, dryPull bool, transform func(string) string, logger logr.Logger, keychain authn.Keychain, requestTimeout time.Duration, failureCooldown time.Duration, pullByDigest bool, digestPullIgnoredTags []string, ignoreMissingPlatforms []string, allowDifferentDigestRepush bool, excluded []string, mirrorPlatforms []string, opts ...PusherOption) Pusher {
+	options := pusherOptions{retry: RetryConfig{Attempts: DefaultRegistryRetryAttempts, Backoff: DefaultRegistryRetryBackoff}}
+	for _, opt := range opts {
+		opt(&options)
+	}
 	if transform == nil {
 		transform = util.CleanRepoName
 	}
@@ -284,10 +349,7 @@ func NewPusher(t registry.Target, dryRun bool, dryPull bool, transform func(stri
 	if failureCooldown < 0 {
 		failureCooldown = DefaultFailureCooldown
 	}
-	retry := RetryConfig{Attempts: DefaultRegistryRetryAttempts, Backoff: DefaultRegistryRetryBackoff}
-	if len(retryConfig) > 0 {
-		retry = retryConfig[0]
-	}
+	retry := options.retry
 	if retry.Attempts <= 0 {
 		retry.Attempts = 1
 	}
@@ -313,8 +375,8 @@ func NewPusher(t registry.Target, dryRun bool, dryPull bool, transform func(stri
 		allowDifferentDigestRepush: allowDifferentDigestRepush,
 		mirrorPlatforms:            parsedPlatforms,
 		mirrorPlatformSet:          platformSet,
-		sourceTransport:            newTransport(false),
-		targetTransport:            newTransport(targetInsecure),
+		sourceTransport:            options.bandwidth.transport(meterTransport(newTransport(false), transferPull), transferPull),
+		targetTransport:            options.bandwidth.transport(meterTransport(newTransport(targetInsecure), transferPush), transferPush),
 		pushed:                     make(map[string]struct{}),
 		logger:                     logger,
 		keychain:                   keychain,
@@ -322,11 +384,118 @@ func NewPusher(t registry.Target, dryRun bool, dryPull bool, transform func(stri
 		registryRetry:              retry,
 		failureCooldown:            failureCooldown,
 		failed:                     make(map[string]time.Time),
+		awaitingDigest:             make(map[string]time.Time),
 		now:                        time.Now,
 		excludedRegistries:         normalizedExclusions,
+		recorder:                   options.recorder,
+		state:                      options.state,
+		blobs:                      newBlobIndex(),
+		layers:                     options.layers,
+		inventory:                  newImageInventory(),
 	}
 }
 
+// sourceRegistry returns the registry of ref, with Docker Hub normalized to docker.io.
+func sourceRegistry(ref name.Reference) string {
+	reg := ref.Context().RegistryStr()
+	if reg == name.DefaultRegistry {
+		reg = "docker.io"
+	}
+	return reg
+}
+
+func (p *pusher) targetNameOptions() []name.Option {
+	opts := []name.Option{name.WeakValidation}
+	if p.target.Insecure() {
+		opts = append(opts, name.Insecure)
+	}
+	return opts
+}
+
+// buildTarget returns the target reference for src in repo.
+func (p *pusher) buildTarget(src string, srcRef name.Reference, repo string) (string, name.Reference, error) {
+	opts := p.targetNameOptions()
+	switch r := srcRef.(type) {
+	case name.Tag:
+		ref := fmt.Sprintf("%s/%s:%s", p.target.Registry(), repo, r.TagStr())
+		tgt, tgtErr := name.NewTag(ref, opts...)
+		return ref, tgt, tgtErr
+	case name.Digest:
+		stripped := src
+		if idx := strings.Index(stripped, "@"); idx > 0 {
+			stripped = stripped[:idx]
+		}
+		// Try to honour the original tag when the source reference included both tag and digest.
+		if tagRef, tagErr := name.NewTag(stripped, name.WeakValidation); tagErr == nil {
+			ref := fmt.Sprintf("%s/%s:%s", p.target.Registry(), repo, tagRef.TagStr())
+			tgt, tgtErr := name.NewTag(ref, opts...)
+			return ref, tgt, tgtErr
+		}
+		ref := fmt.Sprintf("%s/%s@%s", p.target.Registry(), repo, r.DigestStr())
+		tgt, tgtErr := name.NewDigest(ref, opts...)
+		return ref, tgt, tgtErr
+	default:
+		return "", nil, fmt.Errorf("unsupported reference type %T", srcRef)
+	}
+}
+
+// jobKey identifies the work Mirror performs for src and meta, so that requests from different
+// workloads for the same image can share one mirror operation. Metadata only contributes where it
+// changes the outcome: the pod digest and platform matter only when pulling by digest.
+func (p *pusher) jobKey(src string, meta Metadata) (string, bool) {
+	srcRef, err := name.ParseReference(src, name.WeakValidation)
+	if err != nil {
+		return "", false
+	}
+	if meta.Registry == "" {
+		meta.Registry = sourceRegistry(srcRef)
+	}
+	target, _, err := p.buildTarget(src, srcRef, p.resolveRepoPath(srcRef.Context().RepositoryStr(), meta))
+	if err != nil {
+		return "", false
+	}
+	pullByDigest := p.pullByDigest
+	if meta.DigestPull != nil {
+		pullByDigest = *meta.DigestPull
+	}
+	if !pullByDigest {
+		return target, true
+	}
+	return strings.Join([]string{target, normalizeImageID(meta.ImageID), meta.OS, meta.Architecture, strings.Join(meta.Platforms, ",")}, "|"), true
+}
+
+// confirmKnownDigest reports whether the state store remembers that target was mirrored from
+// sourceDigest, and returns the reference the image was pushed to, which may carry the
+// architecture of the image. A HEAD request confirms that the image is still there, so an image
+// deleted from the target registry is mirrored again before its state expires.
+func (p *pusher) confirmKnownDigest(ctx context.Context, log logr.Logger, auth authn.Authenticator, target, sourceDigest string) (string, bool) {
+	pushed, targetDigest, ok := p.state.knownDigest(target, sourceDigest)
+	if !ok {
+		return "", false
+	}
+	pushedRef, err := name.ParseReference(pushed, p.targetNameOptions()...)
+	if err != nil {
+		return "", false
+	}
+	headStart := time.Now()
+	headCtx, headSpan := startStage(ctx, "target_head", attribute.String("copycat.reference", pushedRef.String()))
+	headCtx, cancelHead := p.operationContext(headCtx)
+	headDesc, headErr := remoteHeadFunc(pushedRef, remote.WithAuth(auth), remote.WithContext(headCtx), remote.WithTransport(p.targetTransport))
+	cancelHead()
+	endSpan(headSpan, unexpectedHeadError(headErr))
+	metrics.ObserveStage(metrics.StageHead, time.Since(headStart))
+	switch {
+	case headErr == nil:
+		return pushed, headDesc.Digest.String() == targetDigest
+	case isNotFound(headErr):
+		log.V(1).Info("image remembered by state store is missing at target", "pushedTo", pushed, "digest", targetDigest)
+		p.state.forget(pushed)
+	default:
+		log.V(1).Error(headErr, "unable to confirm image remembered by state store", "pushedTo", pushed)
+	}
+	return "", false
+}
+
 func normalizeTagSet(tags []string) map[string]struct{} {
 	out := make(map[string]struct{}, len(tags))
 	for _, tag := range tags {
@@ -359,13 +528,31 @@ func compileRegexList(logger logr.Logger, field string, patterns []string) []*re
 	return out
 }
 
+// sourceTransporter is implemented by pushers whose source transport applies the bandwidth limits
+// and transfer metrics, so that components talking to source registries on their own share it.
+type sourceTransporter interface {
+	sourceRoundTripper() http.RoundTripper
+}
+
+func (p *pusher) sourceRoundTripper() http.RoundTripper {
+	return p.sourceTransport
+}
+
+// sourceTransportOf returns the source transport of inner, or a new transport if it has none.
+func sourceTransportOf(inner Pusher) http.RoundTripper {
+	if t, ok := inner.(sourceTransporter); ok {
+		return t.sourceRoundTripper()
+	}
+	return newTransport(false)
+}
+
 func newTransport(insecure bool) http.RoundTripper {
 	d := &net.Dialer{Timeout: 10 * time.Second, KeepAlive: 30 * time.Second}
 	tlsCfg := &tls.Config{MinVersion: tls.VersionTLS12}
 	if insecure {
 		tlsCfg.InsecureSkipVerify = true
 	}
-	return &http.Transport{
+	return traceTransport(&http.Transport{
 		Proxy:                 http.ProxyFromEnvironment,
 		DialContext:           d.DialContext,
 		MaxIdleConns:          100,
@@ -373,10 +560,33 @@ func newTransport(insecure bool) http.RoundTripper {
 		TLSHandshakeTimeout:   10 * time.Second,
 		ExpectContinueTimeout: 1 * time.Second,
 		TLSClientConfig:       tlsCfg,
-	}
+	})
 }
 
 func (p *pusher) Mirror(ctx context.Context, src string, meta Metadata) error {
+	attrs := []attribute.KeyValue{attribute.String("copycat.source", src)}
+	if meta.Namespace != "" {
+		attrs = append(attrs, attribute.String("k8s.namespace.name", meta.Namespace))
+	}
+	if meta.PodName != "" {
+		attrs = append(attrs, attribute.String("k8s.pod.name", meta.PodName))
+	}
+	if meta.ContainerName != "" {
+		attrs = append(attrs, attribute.String("k8s.container.name", meta.ContainerName))
+	}
+	ctx, span := tracer().Start(ctx, "mirror", trace.WithAttributes(attrs...))
+	key := p.inventoryKey(src, meta)
+	p.inventory.request(key, meta, p.currentTime())
+	err := p.mirror(ctx, key, src, meta)
+	if err != nil {
+		p.inventory.failed(key, err)
+	}
+	endSpan(span, err)
+	return err
+}
+
+// mirror copies src to the target registry and records the outcome under key in the inventory.
+func (p *pusher) mirror(ctx context.Context, key inventoryKey, src string, meta Metadata) error {
 	log := logr.FromContextOrDiscard(ctx)
 	if log.GetSink() == nil {
 		log = p.logger
@@ -399,6 +609,7 @@ func (p *pusher) Mirror(ctx context.Context, src string, meta Metadata) error {
 			"excludedPrefix", excluded,
 			"result", "skipped",
 		)
+		p.inventory.setStatus(key, ImageExcluded)
 		return nil
 	}
 
@@ -407,14 +618,13 @@ func (p *pusher) Mirror(ctx context.Context, src string, meta Metadata) error {
 		return fmt.Errorf("parse source: %w", err)
 	}
 
+	// Blob downloads are often redirected to storage hosts, so transfers are attributed to the
+	// source registry for its bandwidth limit and byte counters.
+	ctx = withTransferRegistry(ctx, sourceRegistry(srcRef))
+
 	// Populate source registry in metadata for repoPrefix templating.
 	if meta.Registry == "" {
-		reg := srcRef.Context().RegistryStr()
-		// Normalize Docker Hub registry to docker.io.
-		if reg == name.DefaultRegistry {
-			reg = "docker.io"
-		}
-		meta.Registry = reg
+		meta.Registry = sourceRegistry(srcRef)
 	}
 
 	// Build target repo path
@@ -426,33 +636,9 @@ func (p *pusher) Mirror(ctx context.Context, src string, meta Metadata) error {
 	pullRef := srcRef
 	var podDigestStr string
 	havePodDigest := false
-	opts := []name.Option{name.WeakValidation}
-	if p.target.Insecure() {
-		opts = append(opts, name.Insecure)
-	}
+	opts := p.targetNameOptions()
 	buildTarget := func(repo string) (string, name.Reference, error) {
-		switch r := srcRef.(type) {
-		case name.Tag:
-			ref := fmt.Sprintf("%s/%s:%s", p.target.Registry(), repo, r.TagStr())
-			tgt, tgtErr := name.NewTag(ref, opts...)
-			return ref, tgt, tgtErr
-		case name.Digest:
-			stripped := src
-			if idx := strings.Index(stripped, "@"); idx > 0 {
-				stripped = stripped[:idx]
-			}
-			// Try to honour the original tag when the source reference included both tag and digest.
-			if tagRef, tagErr := name.NewTag(stripped, name.WeakValidation); tagErr == nil {
-				ref := fmt.Sprintf("%s/%s:%s", p.target.Registry(), repo, tagRef.TagStr())
-				tgt, tgtErr := name.NewTag(ref, opts...)
-				return ref, tgt, tgtErr
-			}
-			ref := fmt.Sprintf("%s/%s@%s", p.target.Registry(), repo, r.DigestStr())
-			tgt, tgtErr := name.NewDigest(ref, opts...)
-			return ref, tgt, tgtErr
-		default:
-			return "", nil, fmt.Errorf("unsupported reference type %T", srcRef)
-		}
+		return p.buildTarget(src, srcRef, repo)
 	}
 
 	target, targetRef, err = buildTarget(repo)
@@ -460,8 +646,12 @@ func (p *pusher) Mirror(ctx context.Context, src string, meta Metadata) error {
 		return fmt.Errorf("parse target: %w", err)
 	}
 
+	p.recordReference(target)
+	p.inventory.setTarget(key, target)
 	log = baseLog.WithValues("target", target)
 	procLog := log
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(attribute.String("copycat.target", target))
 
 	procLog.V(1).Info("resolved target reference", "reference", target)
 
@@ -471,8 +661,12 @@ func (p *pusher) Mirror(ctx context.Context, src string, meta Metadata) error {
 	}
 
 	normalizedID := normalizeImageID(meta.ImageID)
-	usePodDigest := p.pullByDigest
-	if p.pullByDigest {
+	pullByDigest := p.pullByDigest
+	if meta.DigestPull != nil {
+		pullByDigest = *meta.DigestPull
+	}
+	usePodDigest := pullByDigest
+	if pullByDigest {
 		if srcTag, ok := srcRef.(name.Tag); ok {
 			if _, ignored := p.digestPullIgnoredTags[strings.ToLower(strings.TrimSpace(srcTag.TagStr()))]; ignored {
 				usePodDigest = false
@@ -493,6 +687,8 @@ func (p *pusher) Mirror(ctx context.Context, src string, meta Metadata) error {
 			"digest pull enabled but pod imageID digest is not available yet, skipping until it is reported",
 			"result", "skipped",
 		)
+		p.markAwaitingDigest(target)
+		p.inventory.setStatus(key, ImagePendingDigest)
 		return nil
 	}
 
@@ -509,7 +705,7 @@ func (p *pusher) Mirror(ctx context.Context, src string, meta Metadata) error {
 
 	username, password, err := p.target.BasicAuth(ctx)
 	if err != nil {
-		metrics.RecordPushError(target)
+		metrics.RecordPushError(target, metrics.ReasonAuth)
 		return p.failureResult(target, fmt.Errorf("auth: %w", err))
 	}
 
@@ -521,8 +717,23 @@ func (p *pusher) Mirror(ctx context.Context, src string, meta Metadata) error {
 
 	auth := &authn.Basic{Username: username, Password: password}
 
+	// The state store remembers which source digest every target was mirrored from, so a known
+	// digest is skipped without contacting the source registry.
+	knownSourceDigest := ""
+	if usePodDigest && havePodDigest {
+		knownSourceDigest = podDigestStr
+	} else if digestRef, ok := srcRef.(name.Digest); ok {
+		knownSourceDigest = digestRef.DigestStr()
+	}
+	if pushed, ok := p.confirmKnownDigest(ctx, log, auth, target, knownSourceDigest); ok {
+		log.V(1).Info("image digest already mirrored according to state store", "digest", knownSourceDigest, "pushedTo", pushed, "result", "skipped")
+		p.markKnownDigest(key, target, pushed)
+		return nil
+	}
+
 	metaPlatform := platformFromMetadata(meta)
-	desiredPlatforms := p.desiredPlatforms(metaPlatform)
+	mirrorPlatforms, mirrorPlatformSet := p.platformsFor(log, meta)
+	desiredPlatforms := mergePlatforms(metaPlatform, mirrorPlatforms)
 	primaryPlatform := metaPlatform
 	if len(desiredPlatforms) > 0 {
 		primaryPlatform = desiredPlatforms[0].toPlatform()
@@ -548,15 +759,22 @@ func (p *pusher) Mirror(ctx context.Context, src string, meta Metadata) error {
 		}
 
 		if digestRef != nil {
-			headCtx, cancelHead := p.operationContext(ctx)
+			headStart := time.Now()
+			headCtx, headSpan := startStage(ctx, "target_head", attribute.String("copycat.reference", digestRef.String()))
+			headCtx, cancelHead := p.operationContext(headCtx)
 			_, headErr := remoteHeadFunc(digestRef, remote.WithAuth(auth), remote.WithContext(headCtx), remote.WithTransport(p.targetTransport))
 			cancelHead()
+			endSpan(headSpan, unexpectedHeadError(headErr))
+			metrics.ObserveStage(metrics.StageHead, time.Since(headStart))
 			if headErr == nil {
 				log.V(1).Info("image digest already present at target", "digest", podDigestStr, "result", "skipped")
+				p.markMirrored(key, target, podDigestStr, podDigestStr)
+				metrics.RecordMirrorSuccess(target)
 				return nil
 			}
 			if te, ok := headErr.(*remotetransport.Error); ok && te.StatusCode == http.StatusNotFound {
-				// continue to pull and push
+				// The image was removed from the target, so the state store must not skip it.
+				p.state.forget(target)
 			} else if headErr != nil {
 				log.V(1).Error(headErr, "unable to confirm existing digest", "digest", podDigestStr)
 			}
@@ -564,7 +782,9 @@ func (p *pusher) Mirror(ctx context.Context, src string, meta Metadata) error {
 	}
 
 	getDescriptor := func(ref name.Reference, platform *v1.Platform) (*remote.Descriptor, context.CancelFunc, error) {
-		descCtx, cancel := p.operationContext(ctx)
+		descCtx, descSpan := startStage(ctx, "resolve_descriptor", attribute.String("copycat.reference", ref.String()))
+		defer descSpan.End()
+		descCtx, cancel := p.operationContext(descCtx)
 		opts := []remote.Option{
 			remote.WithContext(descCtx),
 			remote.WithAuthFromKeychain(p.keychain),
@@ -576,8 +796,14 @@ func (p *pusher) Mirror(ctx context.Context, src string, meta Metadata) error {
 		desc, err := remoteGetFunc(ref, opts...)
 		if err != nil {
 			cancel()
+			descSpan.RecordError(err)
+			descSpan.SetStatus(codes.Error, err.Error())
 			return nil, func() {}, err
 		}
+		descSpan.SetAttributes(
+			attribute.String("copycat.source.digest", desc.Digest.String()),
+			attribute.String("copycat.source.media_type", string(desc.MediaType)),
+		)
 		return desc, cancel, nil
 	}
 
@@ -586,8 +812,10 @@ func (p *pusher) Mirror(ctx context.Context, src string, meta Metadata) error {
 		descCancel context.CancelFunc
 	)
 
-	if usePodDigest && !havePodDigest && len(p.mirrorPlatforms) == 0 {
-		headCtx, cancelHead := p.operationContext(ctx)
+	if usePodDigest && !havePodDigest && len(mirrorPlatforms) == 0 {
+		headStart := time.Now()
+		headCtx, headSpan := startStage(ctx, "target_head", attribute.String("copycat.reference", targetRef.String()))
+		headCtx, cancelHead := p.operationContext(headCtx)
 		targetHead, headErr := remoteHeadFunc(
 			targetRef,
 			remote.WithAuth(auth),
@@ -595,12 +823,16 @@ func (p *pusher) Mirror(ctx context.Context, src string, meta Metadata) error {
 			remote.WithTransport(p.targetTransport),
 		)
 		cancelHead()
+		endSpan(headSpan, unexpectedHeadError(headErr))
+		metrics.ObserveStage(metrics.StageHead, time.Since(headStart))
 		switch {
 		case headErr == nil:
 			if targetHead == nil || targetHead.Digest == (v1.Hash{}) {
 				break
 			}
-			sourceHeadCtx, cancelSourceHead := p.operationContext(ctx)
+			resolveStart := time.Now()
+			sourceHeadCtx, resolveSpan := startStage(ctx, "resolve_descriptor", attribute.String("copycat.reference", pullRef.String()))
+			sourceHeadCtx, cancelSourceHead := p.operationContext(sourceHeadCtx)
 			headOpts := []remote.Option{
 				remote.WithContext(sourceHeadCtx),
 				remote.WithAuthFromKeychain(p.keychain),
@@ -611,6 +843,8 @@ func (p *pusher) Mirror(ctx context.Context, src string, meta Metadata) error {
 			}
 			sourceHead, sourceHeadErr := remoteHeadFunc(pullRef, headOpts...)
 			cancelSourceHead()
+			endSpan(resolveSpan, sourceHeadErr)
+			metrics.ObserveStage(metrics.StageResolve, time.Since(resolveStart))
 			if sourceHeadErr != nil {
 				logRegistryAuthError(log, sourceHeadErr, "pull descriptor head")
 				break
@@ -621,19 +855,22 @@ func (p *pusher) Mirror(ctx context.Context, src string, meta Metadata) error {
 				} else {
 					log.V(1).Info("image already present at target", "digest", sourceHead.Digest.String())
 				}
+				p.markMirrored(key, target, sourceHead.Digest.String(), targetHead.Digest.String())
+				metrics.RecordMirrorSuccess(target)
 				return nil
 			}
 		case headErr != nil:
 			if te, ok := headErr.(*remotetransport.Error); ok && te.StatusCode == http.StatusNotFound {
-				// target image absent; continue with pull
+				// target image absent; forget any remembered digest and continue with pull
+				p.state.forget(target)
 				break
 			}
 			logRegistryAuthError(log, headErr, "target preflight check")
 		}
 	}
 
-	if spec, ok := specFromPlatform(metaPlatform); ok && len(p.mirrorPlatformSet) > 0 {
-		if _, allowed := p.mirrorPlatformSet[spec.key()]; !allowed {
+	if spec, ok := specFromPlatform(metaPlatform); ok && len(mirrorPlatformSet) > 0 {
+		if _, allowed := mirrorPlatformSet[spec.key()]; !allowed {
 			log.WithValues("severity", "warning").Info(
 				"checkNodePlatform detected platform not configured in mirrorPlatforms; continuing with node-specific manifest",
 				"architecture", metaPlatform.Architecture,
@@ -642,10 +879,12 @@ func (p *pusher) Mirror(ctx context.Context, src string, meta Metadata) error {
 		}
 	}
 
+	resolveStart := time.Now()
 	desc, descCancel, err = getDescriptor(pullRef, requestPlatform)
+	metrics.ObserveStage(metrics.StageResolve, time.Since(resolveStart))
 	if err != nil {
 		logRegistryAuthError(log, err, "pull descriptor")
-		metrics.RecordPullError(src)
+		metrics.RecordPullError(src, errorReason(err))
 		if usePodDigest && havePodDigest && strings.Contains(err.Error(), "MANIFEST_UNKNOWN") {
 			return p.failureResult(target, fmt.Errorf("describe %s: %w (looks like the original image was overwritten and pod imageID digest is no longer available at source)", src, err))
 		}
@@ -653,6 +892,12 @@ func (p *pusher) Mirror(ctx context.Context, src string, meta Metadata) error {
 	}
 	defer descCancel()
 
+	if pushed, ok := p.confirmKnownDigest(ctx, log, auth, target, desc.Digest.String()); ok {
+		log.V(1).Info("image digest already mirrored according to state store", "digest", desc.Digest.String(), "pushedTo", pushed, "result", "skipped")
+		p.markKnownDigest(key, target, pushed)
+		return nil
+	}
+
 	log.V(1).Info("starting pull from source")
 	log.V(1).Info("pull progress update", "percentage", "0%")
 
@@ -666,6 +911,7 @@ func (p *pusher) Mirror(ctx context.Context, src string, meta Metadata) error {
 		return nil
 	}
 
+	pullStart := time.Now()
 	pushIndex := false
 
 	var (
@@ -674,22 +920,25 @@ func (p *pusher) Mirror(ctx context.Context, src string, meta Metadata) error {
 		selectedFromIndex bool
 	)
 
-	if len(p.mirrorPlatforms) > 0 && len(desiredPlatforms) > 1 && !desc.MediaType.IsIndex() {
+	if len(mirrorPlatforms) > 0 && len(desiredPlatforms) > 1 && !desc.MediaType.IsIndex() {
 		logUnavailablePlatforms(log, src, desiredPlatforms[1:], p.ignoreMissingPlatforms)
 	}
 
 	switch {
-	case desc.MediaType.IsIndex() && p.pullByDigest && len(desiredPlatforms) > 1:
+	case desc.MediaType.IsIndex() && pullByDigest && len(desiredPlatforms) > 1:
 		idx, err = desc.ImageIndex()
 		if err != nil {
 			logRegistryAuthError(log, err, "pull")
-			metrics.RecordPullError(src)
+			metrics.RecordPullError(src, errorReason(err))
 			return p.failureResult(target, fmt.Errorf("load index %s: %w", src, err))
 		}
-		filtered, matched, missing, filterErr := p.filterIndexByPlatforms(ctx, log, idx, desiredPlatforms, targetRef.Context(), auth, opts)
+		filterCtx, filterSpan := startStage(ctx, "filter_index", attribute.StringSlice("copycat.platforms", specsToStrings(desiredPlatforms)))
+		filtered, matched, missing, filterErr := p.filterIndexByPlatforms(filterCtx, log, idx, desiredPlatforms, targetRef.Context(), auth, opts)
+		filterSpan.SetAttributes(attribute.StringSlice("copycat.platforms.matched", specsToStrings(matched)))
+		endSpan(filterSpan, filterErr)
 		if filterErr != nil {
 			logRegistryAuthError(log, filterErr, "pull")
-			metrics.RecordPullError(src)
+			metrics.RecordPullError(src, errorReason(filterErr))
 			return p.failureResult(target, fmt.Errorf("filter index %s: %w", src, filterErr))
 		}
 		if len(matched) == 0 {
@@ -713,11 +962,11 @@ func (p *pusher) Mirror(ctx context.Context, src string, meta Metadata) error {
 			)
 		}
 		pushIndex = true
-	case shouldMirrorEntireIndex(desc.MediaType, p.pullByDigest, primaryPlatform):
+	case shouldMirrorEntireIndex(desc.MediaType, pullByDigest, primaryPlatform):
 		idx, err = desc.ImageIndex()
 		if err != nil {
 			logRegistryAuthError(log, err, "pull")
-			metrics.RecordPullError(src)
+			metrics.RecordPullError(src, errorReason(err))
 			return p.failureResult(target, fmt.Errorf("load index %s: %w", src, err))
 		}
 		pushIndex = true
@@ -733,20 +982,20 @@ func (p *pusher) Mirror(ctx context.Context, src string, meta Metadata) error {
 				idx, idxErr := desc.ImageIndex()
 				if idxErr != nil {
 					logRegistryAuthError(log, idxErr, "pull")
-					metrics.RecordPullError(src)
+					metrics.RecordPullError(src, errorReason(idxErr))
 					return p.failureResult(target, fmt.Errorf("load index %s: %w", src, idxErr))
 				}
 				var selectErr error
 				img, selectErr = imageFromIndex(idx, primaryPlatform)
 				if selectErr != nil {
 					logRegistryAuthError(log, selectErr, "pull")
-					metrics.RecordPullError(src)
+					metrics.RecordPullError(src, errorReason(selectErr))
 					return p.failureResult(target, fmt.Errorf("resolve platform image %s: %w", src, selectErr))
 				}
 				selectedFromIndex = true
 			} else {
 				logRegistryAuthError(log, err, "pull")
-				metrics.RecordPullError(src)
+				metrics.RecordPullError(src, errorReason(err))
 				return p.failureResult(target, fmt.Errorf("pull %s: %w", src, err))
 			}
 		} else if desc.MediaType.IsIndex() {
@@ -771,6 +1020,7 @@ func (p *pusher) Mirror(ctx context.Context, src string, meta Metadata) error {
 	}
 
 	metrics.RecordPullSuccess(src)
+	metrics.ObserveStage(metrics.StagePull, time.Since(pullStart))
 
 	log.V(1).Info("finished pulling image from source")
 	log.V(1).Info("pull progress update", "percentage", "100%")
@@ -781,10 +1031,12 @@ func (p *pusher) Mirror(ctx context.Context, src string, meta Metadata) error {
 		if newRepo != repo {
 			newTarget, newTargetRef, buildErr := buildTarget(newRepo)
 			if buildErr != nil {
-				metrics.RecordPullError(src)
+				metrics.RecordPullError(src, errorReason(buildErr))
 				return p.failureResult(target, fmt.Errorf("parse target %s: %w", newRepo, buildErr))
 			}
 
+			p.recordReference(newTarget)
+			p.inventory.setTarget(key, newTarget)
 			reassignedLog := baseLog.WithValues("target", newTarget)
 			skip, reassignErr := p.reassignProcessing(target, newTarget, reassignedLog)
 			if reassignErr != nil {
@@ -799,6 +1051,7 @@ func (p *pusher) Mirror(ctx context.Context, src string, meta Metadata) error {
 			targetRef = newTargetRef
 			currentTarget = newTarget
 			log = reassignedLog
+			span.SetAttributes(attribute.String("copycat.target", target))
 		}
 	}
 
@@ -809,7 +1062,7 @@ func (p *pusher) Mirror(ctx context.Context, src string, meta Metadata) error {
 		srcDigest, err = img.Digest()
 	}
 	if err != nil {
-		metrics.RecordPullError(src)
+		metrics.RecordPullError(src, errorReason(err))
 		return p.failureResult(target, fmt.Errorf("digest %s: %w", src, err))
 	}
 
@@ -822,9 +1075,13 @@ func (p *pusher) Mirror(ctx context.Context, src string, meta Metadata) error {
 	}
 
 	// Skip if image already exists in target registry with the same digest.
-	headCtx, cancelHead := p.operationContext(ctx)
+	headStart := time.Now()
+	headCtx, headSpan := startStage(ctx, "target_head", attribute.String("copycat.reference", targetRef.String()))
+	headCtx, cancelHead := p.operationContext(headCtx)
 	headDesc, headErr := remoteHeadFunc(targetRef, remote.WithAuth(auth), remote.WithContext(headCtx), remote.WithTransport(p.targetTransport))
 	cancelHead()
+	endSpan(headSpan, unexpectedHeadError(headErr))
+	metrics.ObserveStage(metrics.StageHead, time.Since(headStart))
 	if headErr == nil {
 		if headDesc.Digest == srcDigest {
 			if p.dryRun {
@@ -832,6 +1089,8 @@ func (p *pusher) Mirror(ctx context.Context, src string, meta Metadata) error {
 			} else {
 				log.V(1).Info("image already present at target", "digest", srcDigest.String())
 			}
+			p.markMirrored(key, target, desc.Digest.String(), headDesc.Digest.String())
+			metrics.RecordMirrorSuccess(target)
 			return nil
 		}
 
@@ -843,7 +1102,7 @@ func (p *pusher) Mirror(ctx context.Context, src string, meta Metadata) error {
 			} else if !p.allowDifferentDigestRepush {
 				err := fmt.Errorf("target image %s exists with digest %s, refusing to overwrite with source digest %s", target, headDesc.Digest.String(), srcDigest.String())
 				log.Error(err, "digest mismatch detected")
-				metrics.RecordPushError(target)
+				metrics.RecordPushError(target, metrics.ReasonDigestMismatch)
 				return p.failureResult(target, err)
 			} else {
 				log.V(1).Info("image already present with different digest, updating per configuration", "currentDigest", headDesc.Digest.String(), "sourceDigest", srcDigest.String())
@@ -855,12 +1114,15 @@ func (p *pusher) Mirror(ctx context.Context, src string, meta Metadata) error {
 		// continue to push
 	} else if headErr != nil {
 		logRegistryAuthError(log, headErr, "target existence check")
-		metrics.RecordPushError(target)
+		metrics.RecordPushError(target, errorReason(headErr))
 		return p.failureResult(target, fmt.Errorf("check %s: %w", target, headErr))
 	}
 
-	if err := p.target.EnsureRepository(ctx, repo); err != nil {
-		metrics.RecordPushError(target)
+	ensureCtx, ensureSpan := startStage(ctx, "ensure_repository", attribute.String("copycat.repository", repo))
+	err = p.target.EnsureRepository(ensureCtx, repo)
+	endSpan(ensureSpan, err)
+	if err != nil {
+		metrics.RecordPushError(target, errorReason(err))
 		return p.failureResult(target, fmt.Errorf("ensure repo %s: %w", repo, err))
 	}
 
@@ -871,8 +1133,18 @@ func (p *pusher) Mirror(ctx context.Context, src string, meta Metadata) error {
 	log.Info("pushing image to target", "digest", srcDigest.String())
 	log.V(1).Info("push progress update", "percentage", "0%")
 
-	err = p.withRetry(ctx, log, "push", func() error {
-		pushCtx, cancelPush := p.operationContext(ctx)
+	var mounts *repositoryMounts
+	pushStart := time.Now()
+	pushStageCtx, pushSpan := startStage(ctx, "push",
+		attribute.String("copycat.source.digest", srcDigest.String()),
+		attribute.Bool("copycat.index", pushIndex),
+	)
+	attempts := 0
+	err = p.withRetry(pushStageCtx, log, "push", func() error {
+		attempts++
+		attemptCtx, attemptSpan := startStage(pushStageCtx, "push_attempt", attribute.Int("copycat.attempt", attempts))
+		pushCtx, cancelPush := p.operationContext(attemptCtx)
+		mounts = p.blobs.forRepository(targetRef.Context())
 
 		updates := make(chan v1.Update, 16)
 		var progressWG sync.WaitGroup
@@ -886,7 +1158,7 @@ func (p *pusher) Mirror(ctx context.Context, src string, meta Metadata) error {
 		if pushIndex {
 			writeErr = remoteWriteIndexFunc(
 				targetRef,
-				idx,
+				mounts.imageIndex(p.layers.imageIndex(idx)),
 				remote.WithAuth(auth),
 				remote.WithContext(pushCtx),
 				remote.WithTransport(p.targetTransport),
@@ -895,7 +1167,7 @@ func (p *pusher) Mirror(ctx context.Context, src string, meta Metadata) error {
 		} else {
 			writeErr = remoteWriteFunc(
 				targetRef,
-				img,
+				mounts.image(p.layers.image(img)),
 				remote.WithAuth(auth),
 				remote.WithContext(pushCtx),
 				remote.WithTransport(p.targetTransport),
@@ -904,16 +1176,26 @@ func (p *pusher) Mirror(ctx context.Context, src string, meta Metadata) error {
 		}
 		cancelPush()
 		progressWG.Wait()
+		endSpan(attemptSpan, writeErr)
 		return writeErr
 	})
+	pushSpan.SetAttributes(attribute.Int("copycat.attempts", attempts))
+	endSpan(pushSpan, err)
+	metrics.ObserveStage(metrics.StagePush, time.Since(pushStart))
 	if err != nil {
 		logRegistryAuthError(log, err, "push")
-		metrics.RecordPushError(target)
+		metrics.RecordPushError(target, errorReason(err))
 		return p.failureResult(target, fmt.Errorf("push %s: %w", target, err))
 	}
+	mounts.commit()
+	if mountable := mounts.mountCandidates(); mountable > 0 {
+		log.V(1).Info("mounted shared layers from other target repositories where the registry allowed it", "layers", mountable)
+	}
 
 	targetDigest := srcDigest
-	verifyCtx, cancelVerify := p.operationContext(ctx)
+	verifyStart := time.Now()
+	verifyCtx, verifySpan := startStage(ctx, "verify", attribute.String("copycat.reference", targetRef.String()))
+	verifyCtx, cancelVerify := p.operationContext(verifyCtx)
 	verifyDesc, verifyErr := remoteHeadFunc(
 		targetRef,
 		remote.WithAuth(auth),
@@ -921,6 +1203,8 @@ func (p *pusher) Mirror(ctx context.Context, src string, meta Metadata) error {
 		remote.WithTransport(p.targetTransport),
 	)
 	cancelVerify()
+	endSpan(verifySpan, verifyErr)
+	metrics.ObserveStage(metrics.StageVerify, time.Since(verifyStart))
 	switch {
 	case verifyErr == nil:
 		targetDigest = verifyDesc.Digest
@@ -941,6 +1225,8 @@ func (p *pusher) Mirror(ctx context.Context, src string, meta Metadata) error {
 		log.Info("finished pushing image", "digest", targetDigest.String())
 	}
 
+	span.SetAttributes(attribute.String("copycat.target.digest", targetDigest.String()))
+	p.markMirrored(key, target, desc.Digest.String(), targetDigest.String())
 	metrics.RecordPushSuccess(target)
 	return nil
 }
@@ -1057,6 +1343,11 @@ func (p *pusher) ResetCooldown() (int, bool) {
 	defer p.mu.Unlock()
 
 	cleared := len(p.failed)
+	// Every in-memory failure is also persisted, but persisted failures are only loaded into
+	// memory once their target is mirrored again.
+	if persisted := p.state.clearFailures(); persisted > cleared {
+		cleared = persisted
+	}
 	if cleared == 0 {
 		return 0, true
 	}
@@ -1064,6 +1355,7 @@ func (p *pusher) ResetCooldown() (int, bool) {
 	for target := range p.failed {
 		delete(p.failed, target)
 	}
+	p.updateStateGauges()
 
 	return cleared, true
 }
@@ -1153,13 +1445,58 @@ func isRetryableRegistryError(err error) bool {
 		strings.Contains(msg, "server closed idle connection")
 }
 
+// errorReason classifies a registry error for the reason label of the error metrics.
+func errorReason(err error) string {
+	if err == nil {
+		return metrics.ReasonOther
+	}
+	if _, ok := detectRegistryAuthError(err); ok {
+		return metrics.ReasonAuth
+	}
+	var transportErr *remotetransport.Error
+	if errors.As(err, &transportErr) {
+		if transportErr.StatusCode == http.StatusTooManyRequests {
+			return metrics.ReasonRateLimited
+		}
+		if transportErr.StatusCode == http.StatusNotFound {
+			return metrics.ReasonNotFound
+		}
+		for _, diag := range transportErr.Errors {
+			switch diag.Code {
+			case remotetransport.TooManyRequestsErrorCode:
+				return metrics.ReasonRateLimited
+			case remotetransport.ManifestUnknownErrorCode, remotetransport.BlobUnknownErrorCode, remotetransport.NameUnknownErrorCode:
+				return metrics.ReasonNotFound
+			}
+		}
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return metrics.ReasonTimeout
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return metrics.ReasonTimeout
+	}
+	return metrics.ReasonOther
+}
+
+func (p *pusher) recordReference(target string) {
+	if p.recorder != nil {
+		p.recorder.RecordReference(target)
+	}
+}
+
 func (p *pusher) beginProcessing(target string, log logr.Logger) (bool, error) {
 	log.V(1).Info("evaluating processing state for target")
 
 	p.mu.Lock()
 	defer p.mu.Unlock()
+	defer p.updateStateGauges()
+	// The image is mirrored now, so it no longer waits for a digest.
+	delete(p.awaitingDigest, target)
 
 	if p.failureCooldown > 0 {
+		p.adoptPersistedFailure(target)
 		if lastFailure, ok := p.failed[target]; ok {
 			retryAt := lastFailure.Add(p.failureCooldown)
 			now := p.now()
@@ -1169,6 +1506,7 @@ func (p *pusher) beginProcessing(target string, log logr.Logger) (bool, error) {
 				return false, err
 			}
 			delete(p.failed, target)
+			p.state.clearFailure(target)
 		}
 	}
 
@@ -1185,6 +1523,17 @@ func (p *pusher) beginProcessing(target string, log logr.Logger) (bool, error) {
 	return false, nil
 }
 
+// adoptPersistedFailure restores a failure remembered by the state store from a previous run so
+// the cooldown survives restarts. Callers must hold p.mu.
+func (p *pusher) adoptPersistedFailure(target string) {
+	if _, ok := p.failed[target]; ok {
+		return
+	}
+	if failedAt, ok := p.state.failedAt(target); ok {
+		p.failed[target] = failedAt
+	}
+}
+
 func (p *pusher) finishProcessing(target string) {
 	if strings.TrimSpace(target) == "" {
 		return
@@ -1192,9 +1541,51 @@ func (p *pusher) finishProcessing(target string) {
 
 	p.mu.Lock()
 	delete(p.pushed, target)
+	p.updateStateGauges()
 	p.mu.Unlock()
 }
 
+func (p *pusher) currentTime() time.Time {
+	if p.now == nil {
+		return time.Now()
+	}
+	return p.now()
+}
+
+// awaitingDigestTTL drops images from the awaiting digest gauge that were not requested again,
+// for example because their Pod was deleted before it reported a digest.
+const awaitingDigestTTL = time.Hour
+
+func (p *pusher) markAwaitingDigest(target string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.awaitingDigest == nil {
+		p.awaitingDigest = make(map[string]time.Time)
+	}
+	p.awaitingDigest[target] = p.currentTime()
+	p.updateStateGauges()
+}
+
+// updateStateGauges publishes the number of images in flight, in cooldown and waiting for a
+// digest. Callers must hold p.mu.
+func (p *pusher) updateStateGauges() {
+	now := p.currentTime()
+	cooldowns := 0
+	for _, failedAt := range p.failed {
+		if now.Before(failedAt.Add(p.failureCooldown)) {
+			cooldowns++
+		}
+	}
+	for target, seen := range p.awaitingDigest {
+		if now.Sub(seen) > awaitingDigestTTL {
+			delete(p.awaitingDigest, target)
+		}
+	}
+	metrics.SetInFlight(len(p.pushed))
+	metrics.SetCooldownEntries(cooldowns)
+	metrics.SetAwaitingDigest(len(p.awaitingDigest))
+}
+
 func (p *pusher) reassignProcessing(oldTarget, newTarget string, log logr.Logger) (bool, error) {
 	if oldTarget == newTarget {
 		return false, nil
@@ -1204,8 +1595,10 @@ func (p *pusher) reassignProcessing(oldTarget, newTarget string, log logr.Logger
 
 	p.mu.Lock()
 	defer p.mu.Unlock()
+	defer p.updateStateGauges()
 
 	if p.failureCooldown > 0 {
+		p.adoptPersistedFailure(newTarget)
 		if lastFailure, ok := p.failed[newTarget]; ok {
 			retryAt := lastFailure.Add(p.failureCooldown)
 			now := p.now()
@@ -1216,6 +1609,7 @@ func (p *pusher) reassignProcessing(oldTarget, newTarget string, log logr.Logger
 				return false, err
 			}
 			delete(p.failed, newTarget)
+			p.state.clearFailure(newTarget)
 		}
 		if lastFailure, ok := p.failed[oldTarget]; ok {
 			p.failed[newTarget] = lastFailure
@@ -1252,7 +1646,9 @@ func (p *pusher) failureResult(target string, cause error) error {
 			p.failed = make(map[string]time.Time)
 		}
 		p.failed[target] = now
+		p.state.markFailed(target, now, retryAt, cause.Error())
 	}
+	p.updateStateGauges()
 	p.mu.Unlock()
 
 	if p.failureCooldown > 0 {
@@ -1367,14 +1763,31 @@ func specFromPlatform(platform *v1.Platform) (platformSpec, bool) {
 }
 
 func (p *pusher) desiredPlatforms(metaPlatform *v1.Platform) []platformSpec {
-	desired := make([]platformSpec, 0, len(p.mirrorPlatforms)+1)
-	seen := make(map[string]struct{}, len(p.mirrorPlatforms)+1)
+	return mergePlatforms(metaPlatform, p.mirrorPlatforms)
+}
+
+// platformsFor returns the mirror platforms of meta, or the configured ones when meta does not
+// override them.
+func (p *pusher) platformsFor(logger logr.Logger, meta Metadata) ([]platformSpec, map[string]struct{}) {
+	if len(meta.Platforms) == 0 {
+		return p.mirrorPlatforms, p.mirrorPlatformSet
+	}
+	if parsed, set := parseMirrorPlatforms(logger, meta.Platforms); len(parsed) > 0 {
+		return parsed, set
+	}
+	return p.mirrorPlatforms, p.mirrorPlatformSet
+}
+
+// mergePlatforms returns the platform of the node first, followed by the mirror platforms.
+func mergePlatforms(metaPlatform *v1.Platform, mirrorPlatforms []platformSpec) []platformSpec {
+	desired := make([]platformSpec, 0, len(mirrorPlatforms)+1)
+	seen := make(map[string]struct{}, len(mirrorPlatforms)+1)
 	if spec, ok := specFromPlatform(metaPlatform); ok {
 		key := spec.key()
 		desired = append(desired, spec)
 		seen[key] = struct{}{}
 	}
-	for _, spec := range p.mirrorPlatforms {
+	for _, spec := range mirrorPlatforms {
 		key := spec.key()
 		if _, ok := seen[key]; ok {
 			continue
@@ -258,7 +258,7 @@ func TestMirrorRecordsPullErrorMetric(t *testing.T) {
 		t.Fatalf("expected pull error from Mirror")
 	}
 
-	got := counterValue(t, metrics.PullErrorCounter().WithLabelValues("docker.io"))
+	got := counterValue(t, metrics.PullErrorCounter().WithLabelValues("docker.io", metrics.ReasonOther))
 	if got != 1 {
 		t.Fatalf("expected pull_error_total to increment once, got %v", got)
 	}
@@ -461,7 +461,7 @@ func TestMirrorRecordsPushErrorMetric(t *testing.T) {
 		t.Fatalf("expected push error from Mirror")
 	}
 
-	got := counterValue(t, metrics.PushErrorCounter().WithLabelValues("example.com"))
+	got := counterValue(t, metrics.PushErrorCounter().WithLabelValues("example.com", metrics.ReasonAuth))
 	if got != 1 {
 		t.Fatalf("expected push_error_total to increment once, got %v", got)
 	}
@@ -525,14 +525,8 @@ func TestNewPusherSeparatesSourceAndTargetTransportSecurity(t *testing.T) {
 		t.Fatalf("expected *pusher, got %T", p)
 	}
 
-	sourceTransport, ok := impl.sourceTransport.(*http.Transport)
-	if !ok {
-		t.Fatalf("expected source transport to be *http.Transport, got %T", impl.sourceTransport)
-	}
-	targetTransport, ok := impl.targetTransport.(*http.Transport)
-	if !ok {
-		t.Fatalf("expected target transport to be *http.Transport, got %T", impl.targetTransport)
-	}
+	sourceTransport := baseTransport(t, impl.sourceTransport)
+	targetTransport := baseTransport(t, impl.targetTransport)
 
 	if sourceTransport.TLSClientConfig == nil || sourceTransport.TLSClientConfig.InsecureSkipVerify {
 		t.Fatalf("expected source transport to keep TLS verification enabled")
@@ -542,6 +536,25 @@ func TestNewPusherSeparatesSourceAndTargetTransportSecurity(t *testing.T) {
 	}
 }
 
+// baseTransport returns the *http.Transport below the metering, throttling and tracing wrappers.
+func baseTransport(t *testing.T, rt http.RoundTripper) *http.Transport {
+	t.Helper()
+	for {
+		switch wrapped := rt.(type) {
+		case *http.Transport:
+			return wrapped
+		case *meteredTransport:
+			rt = wrapped.inner
+		case *throttledTransport:
+			rt = wrapped.inner
+		case *tracedTransport:
+			rt = wrapped.inner
+		default:
+			t.Fatalf("expected transport to wrap *http.Transport, got %T", rt)
+		}
+	}
+}
+
 func TestParsePlatformSpecDefaultsToLinux(t *testing.T) {
 	spec, err := parsePlatformSpec("amd64")
 	if err != nil {
@@ -584,6 +597,25 @@ func TestDesiredPlatformsPrioritizesNode(t *testing.T) {
 	}
 }
 
+func TestPlatformsForHonoursMetadataOverride(t *testing.T) {
+	configured := []platformSpec{{Architecture: "amd64", OS: "linux"}}
+	p := &pusher{mirrorPlatforms: configured}
+
+	if got, _ := p.platformsFor(testr.New(t), Metadata{}); !reflect.DeepEqual(got, configured) {
+		t.Fatalf("expected configured platforms without override, got %#v", got)
+	}
+	got, set := p.platformsFor(testr.New(t), Metadata{Platforms: []string{"linux/arm64", "arm64"}})
+	if len(got) != 1 || got[0].Architecture != "arm64" {
+		t.Fatalf("expected overridden platform, got %#v", got)
+	}
+	if _, ok := set["linux/arm64"]; !ok {
+		t.Fatalf("expected override in platform set, got %v", set)
+	}
+	if err := ValidatePlatforms([]string{"linux/amd64", "linux/"}); err == nil {
+		t.Fatalf("expected platform without architecture to be rejected")
+	}
+}
+
 func counterValue(t *testing.T, c prometheus.Counter) float64 {
 	t.Helper()
 	metric := &dto.Metric{}
@@ -743,6 +775,90 @@ func TestMirrorSkipsWithoutPodDigestWhenDigestPullEnabled(t *testing.T) {
 	}
 }
 
+func TestMirrorTracksImagesAwaitingPodDigest(t *testing.T) {
+	metrics.Reset()
+	t.Cleanup(metrics.Reset)
+	now := time.Now()
+	p := &pusher{
+		target:       fakeTarget{},
+		transform:    util.CleanRepoName,
+		pullByDigest: true,
+		logger:       testr.New(t),
+		keychain:     NewStaticKeychain(nil),
+		pushed:       make(map[string]struct{}),
+		failed:       make(map[string]time.Time),
+		now:          func() time.Time { return now },
+	}
+
+	if err := p.Mirror(context.Background(), "docker.io/library/nginx:1.28", Metadata{}); err != nil {
+		t.Fatalf("expected skip without error, got %v", err)
+	}
+	if got := gaugeValue(t, metrics.AwaitingDigestGauge()); got != 1 {
+		t.Fatalf("expected one image awaiting a digest, got %v", got)
+	}
+
+	now = now.Add(2 * awaitingDigestTTL)
+	p.mu.Lock()
+	p.updateStateGauges()
+	p.mu.Unlock()
+	if got := gaugeValue(t, metrics.AwaitingDigestGauge()); got != 0 {
+		t.Fatalf("expected images not requested again to expire, got %v", got)
+	}
+}
+
+func TestErrorReason(t *testing.T) {
+	cases := map[string]error{
+		metrics.ReasonAuth:        &remotetransport.Error{StatusCode: http.StatusUnauthorized},
+		metrics.ReasonNotFound:    fmt.Errorf("describe: %w", &remotetransport.Error{Errors: []remotetransport.Diagnostic{{Code: remotetransport.ManifestUnknownErrorCode}}}),
+		metrics.ReasonRateLimited: &remotetransport.Error{StatusCode: http.StatusTooManyRequests},
+		metrics.ReasonTimeout:     fmt.Errorf("push: %w", context.DeadlineExceeded),
+		metrics.ReasonOther:       errors.New("boom"),
+	}
+	for want, err := range cases {
+		if got := errorReason(err); got != want {
+			t.Fatalf("expected reason %q for %v, got %q", want, err, got)
+		}
+	}
+}
+
+func gaugeValue(t *testing.T, g prometheus.Gauge) float64 {
+	t.Helper()
+	metric := &dto.Metric{}
+	if err := g.Write(metric); err != nil {
+		t.Fatalf("failed to read gauge: %v", err)
+	}
+	return metric.GetGauge().GetValue()
+}
+
+func TestMirrorMetadataDigestPullOverride(t *testing.T) {
+	t.Cleanup(metrics.Reset)
+	p := &pusher{
+		target:         fakeTarget{prefix: "$namespace"},
+		transform:      util.CleanRepoName,
+		pullByDigest:   true,
+		logger:         testr.New(t),
+		keychain:       NewStaticKeychain(nil),
+		pushed:         make(map[string]struct{}),
+		failed:         make(map[string]time.Time),
+		now:            time.Now,
+		requestTimeout: 0,
+	}
+
+	originalGet := remoteGetFunc
+	pulled := ""
+	remoteGetFunc = func(ref name.Reference, _ ...remote.Option) (*remote.Descriptor, error) {
+		pulled = ref.String()
+		return nil, errors.New("stop after resolving the pull reference")
+	}
+	t.Cleanup(func() { remoteGetFunc = originalGet })
+
+	disabled := false
+	_ = p.Mirror(context.Background(), "docker.io/library/nginx:1.29", Metadata{Namespace: "default", DigestPull: &disabled})
+	if pulled != "docker.io/library/nginx:1.29" {
+		t.Fatalf("expected tag pull when digestPull is overridden, got %q", pulled)
+	}
+}
+
 func TestMirrorSkipsLoggingPushWhenDigestAlreadyPresent(t *testing.T) {
 	digest := "sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
 	normalized := fmt.Sprintf("docker.io/library/alpine@%s", digest)
@@ -0,0 +1,410 @@
+package mirror
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"go.opentelemetry.io/otel/trace"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// DefaultMirrorWorkers is the size of the global mirror worker pool when none is configured.
+const DefaultMirrorWorkers = 4
+
+// Delays before an enqueued image that failed without a cooldown is queued again. The delay
+// doubles with every failed attempt, and the image is dropped after mirrorRetryAttempts failures
+// until a workload requests it again.
+const (
+	mirrorRetryBaseDelay = 5 * time.Second
+	mirrorRetryMaxDelay  = 10 * time.Minute
+	mirrorRetryAttempts  = 10
+)
+
+// AsyncPusher is a Pusher that can also queue an image without waiting for the result.
+type AsyncPusher interface {
+	Pusher
+	// Enqueue schedules src for mirroring on behalf of requester and returns immediately. ctx
+	// only provides the logger and the span the mirror is traced below.
+	Enqueue(ctx context.Context, src string, meta Metadata, requester string)
+}
+
+// jobKeyer is implemented by pushers that can tell which requests lead to the same work.
+type jobKeyer interface {
+	jobKey(src string, meta Metadata) (string, bool)
+}
+
+// followUpQueuer is implemented by pushers that queue further images after a mirror, such as
+// upcoming versions. enqueue runs the image through via instead of the queue's pusher.
+type followUpQueuer interface {
+	useQueue(enqueue func(ctx context.Context, via Pusher, src string, meta Metadata))
+}
+
+// mirrorRetry is a failed job waiting to be queued again on behalf of requesters.
+type mirrorRetry struct {
+	requesters map[string]struct{}
+}
+
+type mirrorJob struct {
+	key        string
+	src        string
+	meta       Metadata
+	via        Pusher
+	log        logr.Logger
+	span       trace.SpanContext
+	requesters map[string]struct{}
+	done       chan struct{}
+	err        error
+}
+
+// MirrorQueue is a manager runnable that mirrors images through a fixed pool of workers. Requests
+// for the same image are coalesced into a single job, whether the job is still waiting or already
+// running, and its result is returned to every waiting caller.
+type MirrorQueue struct {
+	inner      Pusher
+	workers    int
+	logger     logr.Logger
+	retryDelay func(attempt int) time.Duration
+
+	mu       sync.Mutex
+	ctx      context.Context
+	jobs     map[string]*mirrorJob
+	pending  []*mirrorJob
+	attempts map[string]int
+	retries  map[*mirrorRetry]struct{}
+	wake     chan struct{}
+}
+
+var _ AsyncPusher = (*MirrorQueue)(nil)
+
+// NewMirrorQueue returns a queue that runs inner.Mirror on workers goroutines once started.
+func NewMirrorQueue(inner Pusher, workers int, logger logr.Logger) *MirrorQueue {
+	if workers <= 0 {
+		workers = DefaultMirrorWorkers
+	}
+	if logger.GetSink() == nil {
+		logger = ctrl.Log.WithName("mirror").WithName("queue")
+	} else {
+		logger = logger.WithName("queue")
+	}
+	q := &MirrorQueue{
+		inner:      inner,
+		workers:    workers,
+		logger:     logger,
+		retryDelay: mirrorRetryDelay,
+		jobs:       make(map[string]*mirrorJob),
+		attempts:   make(map[string]int),
+		retries:    make(map[*mirrorRetry]struct{}),
+		wake:       make(chan struct{}, 1),
+	}
+	if f, ok := inner.(followUpQueuer); ok {
+		f.useQueue(func(ctx context.Context, via Pusher, src string, meta Metadata) {
+			q.submit(ctx, via, src, meta)
+		})
+	}
+	return q
+}
+
+// Start runs the worker pool until ctx is cancelled.
+func (q *MirrorQueue) Start(ctx context.Context) error {
+	q.mu.Lock()
+	q.ctx = ctx
+	q.mu.Unlock()
+	q.logger.Info("starting mirror workers", "workers", q.workers)
+
+	var wg sync.WaitGroup
+	for i := 0; i < q.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			q.work(ctx)
+		}()
+	}
+	wg.Wait()
+	return nil
+}
+
+// Mirror queues src and waits until it has been mirrored or ctx is cancelled.
+func (q *MirrorQueue) Mirror(ctx context.Context, src string, meta Metadata) error {
+	job := q.submit(ctx, nil, src, meta)
+	select {
+	case <-job.done:
+		return job.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Enqueue queues src without waiting. When mirroring fails, the image is queued again, which
+// replaces the requeue of the reconciler that asked for it: after a cooldown once it expires, and
+// after any other failure with a delay that doubles, up to mirrorRetryAttempts times. Retries
+// stop once every requester has been forgotten.
+func (q *MirrorQueue) Enqueue(ctx context.Context, src string, meta Metadata, requester string) {
+	q.submit(ctx, nil, src, meta, requester)
+}
+
+func (q *MirrorQueue) DryRun() bool {
+	return q.inner.DryRun()
+}
+
+func (q *MirrorQueue) DryPull() bool {
+	return q.inner.DryPull()
+}
+
+func (q *MirrorQueue) ResetCooldown() (int, bool) {
+	return q.inner.ResetCooldown()
+}
+
+func (q *MirrorQueue) Cooldowns() []CooldownEntry {
+	return q.inner.Cooldowns()
+}
+
+func (q *MirrorQueue) ResetCooldowns(sel CooldownSelector) (int, bool, error) {
+	return q.inner.ResetCooldowns(sel)
+}
+
+// Images lists the inventory of the wrapped pusher, if it keeps one.
+func (q *MirrorQueue) Images() []ImageRecord {
+	if inv, ok := q.inner.(ImageInventory); ok {
+		return inv.Images()
+	}
+	return nil
+}
+
+// Image returns the inventory records of ref from the wrapped pusher, if it keeps one.
+func (q *MirrorQueue) Image(ref string) []ImageRecord {
+	if inv, ok := q.inner.(ImageInventory); ok {
+		return inv.Image(ref)
+	}
+	return nil
+}
+
+// ImageFor returns the inventory record of ref for meta from the wrapped pusher, if it keeps one.
+func (q *MirrorQueue) ImageFor(ref string, meta Metadata) (ImageRecord, bool) {
+	if inv, ok := q.inner.(ImageInventory); ok {
+		return inv.ImageFor(ref, meta)
+	}
+	return ImageRecord{}, false
+}
+
+// ForgetWorkload removes a deleted workload from the requesters of queued and failed jobs, so
+// that images nobody requests any more are not retried, and drops its references from the
+// inventory of the wrapped pusher.
+func (q *MirrorQueue) ForgetWorkload(namespace, name string) {
+	requester := namespace + "/" + name
+	q.mu.Lock()
+	for _, job := range q.jobs {
+		delete(job.requesters, requester)
+	}
+	for retry := range q.retries {
+		delete(retry.requesters, requester)
+	}
+	q.mu.Unlock()
+	if f, ok := q.inner.(WorkloadForgetter); ok {
+		f.ForgetWorkload(namespace, name)
+	}
+}
+
+// Len returns the number of queued and running jobs.
+func (q *MirrorQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.jobs)
+}
+
+func (q *MirrorQueue) key(src string, meta Metadata) string {
+	if k, ok := q.inner.(jobKeyer); ok {
+		if key, ok := k.jobKey(src, meta); ok {
+			return key
+		}
+	}
+	return strings.Join([]string{src, meta.Namespace, meta.PodName, meta.ContainerName, meta.ImageID, meta.OS, meta.Architecture, strings.Join(meta.Platforms, ",")}, "|")
+}
+
+// submit queues src on behalf of requesters, or joins the job already queued for it. A job runs
+// through via, or the queue's pusher when via is nil.
+func (q *MirrorQueue) submit(ctx context.Context, via Pusher, src string, meta Metadata, requesters ...string) *mirrorJob {
+	key := q.key(src, meta)
+	if r, ok := q.inner.(requestRecorder); ok {
+		r.recordRequest(src, meta)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	job, ok := q.jobs[key]
+	if !ok {
+		job = &mirrorJob{
+			key:        key,
+			src:        src,
+			meta:       meta,
+			via:        via,
+			log:        logr.FromContextOrDiscard(ctx),
+			span:       trace.SpanContextFromContext(ctx),
+			requesters: make(map[string]struct{}),
+			done:       make(chan struct{}),
+		}
+		q.jobs[key] = job
+		q.pending = append(q.pending, job)
+		select {
+		case q.wake <- struct{}{}:
+		default:
+		}
+	} else {
+		q.logger.V(1).Info("joining queued mirror of image", "source", src, "requesters", requesters)
+	}
+	for _, requester := range requesters {
+		if requester != "" {
+			job.requesters[requester] = struct{}{}
+		}
+	}
+	return job
+}
+
+func (q *MirrorQueue) next(ctx context.Context) *mirrorJob {
+	for {
+		q.mu.Lock()
+		if len(q.pending) > 0 {
+			job := q.pending[0]
+			q.pending[0] = nil
+			q.pending = q.pending[1:]
+			more := len(q.pending) > 0
+			q.mu.Unlock()
+			if more {
+				// Pass the wake-up on so idle workers pick up the remaining jobs.
+				select {
+				case q.wake <- struct{}{}:
+				default:
+				}
+			}
+			return job
+		}
+		q.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-q.wake:
+		}
+	}
+}
+
+func (q *MirrorQueue) work(ctx context.Context) {
+	for {
+		job := q.next(ctx)
+		if job == nil {
+			return
+		}
+		jobCtx := ctx
+		if job.log.GetSink() != nil {
+			jobCtx = logr.NewContext(ctx, job.log)
+		}
+		// Trace the mirror below the reconcile that queued it, even though that span has ended.
+		if job.span.IsValid() {
+			jobCtx = trace.ContextWithSpanContext(jobCtx, job.span)
+		}
+		pusher := q.inner
+		if job.via != nil {
+			pusher = job.via
+		}
+		err := pusher.Mirror(jobCtx, job.src, job.meta)
+		q.finish(job, err)
+	}
+}
+
+func (q *MirrorQueue) finish(job *mirrorJob, err error) {
+	var retryErr *RetryError
+	cooldown := errors.As(err, &retryErr)
+
+	q.mu.Lock()
+	delete(q.jobs, job.key)
+	requesters := make([]string, 0, len(job.requesters))
+	for requester := range job.requesters {
+		requesters = append(requesters, requester)
+	}
+	attempt := 0
+	if err == nil || cooldown || len(requesters) == 0 {
+		delete(q.attempts, job.key)
+	} else {
+		q.attempts[job.key]++
+		attempt = q.attempts[job.key]
+		if attempt >= mirrorRetryAttempts {
+			delete(q.attempts, job.key)
+		}
+	}
+	q.mu.Unlock()
+
+	job.err = err
+	close(job.done)
+
+	if err == nil || len(requesters) == 0 {
+		return
+	}
+	if cooldown {
+		q.logger.V(1).Info("queueing image again after cooldown", "source", job.src, "retryAt", retryErr.RetryAt, "requesters", len(requesters))
+		// The retry carries no requesters, so it is retried again only if a workload asks for the
+		// image in the meantime.
+		q.retryAfter(job, time.Until(retryErr.RetryAt), requesters, false)
+		return
+	}
+	if attempt >= mirrorRetryAttempts {
+		// The workloads are mirrored again on their next reconcile, such as the periodic resync.
+		q.logger.Error(err, "giving up on failed image until it is requested again", "source", job.src, "attempts", attempt, "requesters", requesters)
+		return
+	}
+	delay := q.retryDelay(attempt)
+	q.logger.V(1).Info("queueing failed image again", "source", job.src, "attempt", attempt, "delay", delay, "requesters", len(requesters))
+	// Without a cooldown nothing else retries the image, so the retry keeps its requesters, like a
+	// reconciler requeued with backoff.
+	q.retryAfter(job, delay, requesters, true)
+}
+
+// retryAfter queues job again once delay has passed, on behalf of requesters if keep is set. The
+// retry is dropped if the queue has stopped or every requester was forgotten by then.
+func (q *MirrorQueue) retryAfter(job *mirrorJob, delay time.Duration, requesters []string, keep bool) {
+	if delay < 0 {
+		delay = 0
+	}
+	retry := &mirrorRetry{requesters: make(map[string]struct{}, len(requesters))}
+	for _, requester := range requesters {
+		retry.requesters[requester] = struct{}{}
+	}
+	q.mu.Lock()
+	q.retries[retry] = struct{}{}
+	q.mu.Unlock()
+	time.AfterFunc(delay, func() {
+		q.mu.Lock()
+		ctx := q.ctx
+		delete(q.retries, retry)
+		remaining := make([]string, 0, len(retry.requesters))
+		for requester := range retry.requesters {
+			remaining = append(remaining, requester)
+		}
+		q.mu.Unlock()
+		if ctx != nil && ctx.Err() != nil {
+			return
+		}
+		if len(remaining) == 0 {
+			q.logger.V(1).Info("dropping retry of image no workload requests any more", "source", job.src)
+			return
+		}
+		if !keep {
+			remaining = nil
+		}
+		retryCtx := context.Background()
+		if job.log.GetSink() != nil {
+			retryCtx = logr.NewContext(retryCtx, job.log)
+		}
+		q.submit(retryCtx, job.via, job.src, job.meta, remaining...)
+	})
+}
+
+// mirrorRetryDelay returns the delay before the given failed attempt is retried.
+func mirrorRetryDelay(attempt int) time.Duration {
+	delay := mirrorRetryBaseDelay
+	for i := 1; i < attempt && delay < mirrorRetryMaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, mirrorRetryMaxDelay)
+}
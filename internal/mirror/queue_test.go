@@ -0,0 +1,204 @@
+package mirror
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr/testr"
+)
+
+type blockingPusher struct {
+	release chan struct{}
+	calls   atomic.Int32
+	err     error
+}
+
+func (p *blockingPusher) Mirror(context.Context, string, Metadata) error {
+	p.calls.Add(1)
+	<-p.release
+	return p.err
+}
+
+func (*blockingPusher) DryRun() bool               { return false }
+func (*blockingPusher) DryPull() bool              { return false }
+func (*blockingPusher) ResetCooldown() (int, bool) { return 0, false }
+func (*blockingPusher) Cooldowns() []CooldownEntry { return nil }
+func (*blockingPusher) ResetCooldowns(CooldownSelector) (int, bool, error) {
+	return 0, false, nil
+}
+
+func startQueue(t *testing.T, q *MirrorQueue) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = q.Start(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+func TestMirrorQueueCoalescesConcurrentRequests(t *testing.T) {
+	inner := &blockingPusher{release: make(chan struct{}), err: errors.New("push failed")}
+	q := NewMirrorQueue(inner, 2, testr.New(t))
+	startQueue(t, q)
+	released := false
+	t.Cleanup(func() {
+		if !released {
+			close(inner.release)
+		}
+	})
+
+	ctx := context.Background()
+	meta := Metadata{Namespace: "default", PodName: "web"}
+	first := q.submit(ctx, nil, "docker.io/library/nginx:1.25", meta)
+	waitFor(t, func() bool { return inner.calls.Load() == 1 })
+
+	// Requests arriving while the image is being mirrored join the running job.
+	second := q.submit(ctx, nil, "docker.io/library/nginx:1.25", meta, "default/web")
+	if first != second {
+		t.Fatalf("expected requests for the same image to share a job")
+	}
+	if _, ok := first.requesters["default/web"]; !ok {
+		t.Fatalf("expected requester to be recorded, got %v", first.requesters)
+	}
+	close(inner.release)
+	released = true
+
+	<-first.done
+	if !errors.Is(first.err, inner.err) {
+		t.Fatalf("expected every caller to receive the shared result, got %v", first.err)
+	}
+	if calls := inner.calls.Load(); calls != 1 {
+		t.Fatalf("expected one mirror for all requests, got %d", calls)
+	}
+	waitFor(t, func() bool { return q.Len() == 0 })
+}
+
+func TestMirrorQueueRetriesQueuedImagesAfterCooldown(t *testing.T) {
+	release := make(chan struct{})
+	close(release)
+	inner := &blockingPusher{release: release, err: &RetryError{Cause: ErrInCooldown, RetryAt: time.Now().Add(10 * time.Millisecond)}}
+	q := NewMirrorQueue(inner, 1, testr.New(t))
+	startQueue(t, q)
+
+	q.Enqueue(context.Background(), "docker.io/library/nginx:1.25", Metadata{}, "default/web")
+
+	// The first attempt fails with a cooldown and is retried once it expires. The retry has no
+	// requesters, so it is not retried again.
+	waitFor(t, func() bool { return inner.calls.Load() == 2 })
+	time.Sleep(50 * time.Millisecond)
+	if calls := inner.calls.Load(); calls != 2 {
+		t.Fatalf("expected exactly one retry, got %d calls", calls)
+	}
+}
+
+func TestMirrorQueueRetriesOtherFailuresWithBackoff(t *testing.T) {
+	release := make(chan struct{})
+	close(release)
+	inner := &blockingPusher{release: release, err: errors.New("unauthorized")}
+	q := NewMirrorQueue(inner, 1, testr.New(t))
+	var delays []int
+	q.retryDelay = func(attempt int) time.Duration {
+		delays = append(delays, attempt)
+		if attempt == 3 {
+			inner.err = nil
+		}
+		return time.Millisecond
+	}
+	startQueue(t, q)
+
+	// Without a cooldown the image is retried on behalf of its requester until it succeeds.
+	q.Enqueue(context.Background(), "docker.io/library/nginx:1.25", Metadata{}, "default/web")
+	waitFor(t, func() bool { return inner.calls.Load() == 4 })
+	time.Sleep(50 * time.Millisecond)
+	if calls := inner.calls.Load(); calls != 4 {
+		t.Fatalf("expected retries to stop after the first success, got %d calls", calls)
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.attempts) != 0 || !reflect.DeepEqual(delays, []int{1, 2, 3}) {
+		t.Fatalf("expected growing attempts that are reset on success, got %v and %v", delays, q.attempts)
+	}
+
+	if got := []time.Duration{mirrorRetryDelay(1), mirrorRetryDelay(2), mirrorRetryDelay(20)}; !reflect.DeepEqual(got, []time.Duration{mirrorRetryBaseDelay, 2 * mirrorRetryBaseDelay, mirrorRetryMaxDelay}) {
+		t.Fatalf("unexpected retry delays %v", got)
+	}
+}
+
+func TestMirrorQueueGivesUpAfterRetryAttempts(t *testing.T) {
+	release := make(chan struct{})
+	close(release)
+	inner := &blockingPusher{release: release, err: errors.New("manifest unknown")}
+	q := NewMirrorQueue(inner, 1, testr.New(t))
+	q.retryDelay = func(int) time.Duration { return time.Millisecond }
+	startQueue(t, q)
+
+	q.Enqueue(context.Background(), "docker.io/library/nginx:0.0.0", Metadata{}, "default/web")
+	waitFor(t, func() bool { return inner.calls.Load() == mirrorRetryAttempts })
+	time.Sleep(50 * time.Millisecond)
+	if calls := inner.calls.Load(); calls != mirrorRetryAttempts {
+		t.Fatalf("expected the image to be dropped after %d attempts, got %d calls", mirrorRetryAttempts, calls)
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.attempts) != 0 || len(q.retries) != 0 || len(q.jobs) != 0 {
+		t.Fatalf("expected no state to be left for the dropped image, got %v attempts, %d retries, %d jobs", q.attempts, len(q.retries), len(q.jobs))
+	}
+}
+
+func TestMirrorQueueStopsRetryingForgottenWorkloads(t *testing.T) {
+	release := make(chan struct{})
+	close(release)
+	inner := &blockingPusher{release: release, err: errors.New("unauthorized")}
+	q := NewMirrorQueue(inner, 1, testr.New(t))
+	q.retryDelay = func(int) time.Duration { return 50 * time.Millisecond }
+	startQueue(t, q)
+
+	q.Enqueue(context.Background(), "ghcr.io/acme/private:1", Metadata{}, "shop/web")
+	waitFor(t, func() bool {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		return len(q.retries) == 1
+	})
+	q.ForgetWorkload("shop", "web")
+	time.Sleep(100 * time.Millisecond)
+	if calls := inner.calls.Load(); calls != 1 {
+		t.Fatalf("expected no retry after the workload was deleted, got %d calls", calls)
+	}
+}
+
+func TestPusherJobKeyIgnoresWorkloadMetadataWithoutDigestPull(t *testing.T) {
+	p := NewPusher(fakeTarget{}, false, false, nil, testr.New(t), nil, 0, 0, false, nil, nil, true, nil, nil).(*pusher)
+
+	deployment, _ := p.jobKey("nginx:1.25", Metadata{Namespace: "default", PodName: "web"})
+	pod, _ := p.jobKey("nginx:1.25", Metadata{Namespace: "default", PodName: "web-5d8f-x2x", ImageID: "docker.io/library/nginx@sha256:abc", Architecture: "amd64", OS: "linux"})
+	if deployment != pod {
+		t.Fatalf("expected the same job for a Deployment and its Pod, got %q and %q", deployment, pod)
+	}
+
+	prefixed := NewPusher(fakeTarget{prefix: "$namespace"}, false, false, nil, testr.New(t), nil, 0, 0, false, nil, nil, true, nil, nil).(*pusher)
+	a, _ := prefixed.jobKey("nginx:1.25", Metadata{Namespace: "a"})
+	b, _ := prefixed.jobKey("nginx:1.25", Metadata{Namespace: "b"})
+	if a == b {
+		t.Fatalf("expected different target repositories to be separate jobs, got %q", a)
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("condition not met before deadline")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,451 @@
+package mirror
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/google/go-containerregistry/pkg/name"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// State store defaults.
+const (
+	DefaultStateTTL           = 24 * time.Hour
+	DefaultStateFlushInterval = time.Minute
+)
+
+// TargetState is what copycat remembers about a target reference across restarts.
+type TargetState struct {
+	// Target is the reference the image was pushed to when the architecture of the image moved it
+	// away from the reference the state is kept under.
+	Target        string    `json:"target,omitempty"`
+	SourceDigest  string    `json:"sourceDigest,omitempty"`
+	TargetDigest  string    `json:"targetDigest,omitempty"`
+	MirroredAt    time.Time `json:"mirroredAt,omitzero"`
+	FailedAt      time.Time `json:"failedAt,omitzero"`
+	RetryAt       time.Time `json:"retryAt,omitzero"`
+	FailureReason string    `json:"failureReason,omitempty"`
+}
+
+// StateStore persists target state keyed by target reference.
+type StateStore interface {
+	Load(ctx context.Context) (map[string]TargetState, error)
+	Save(ctx context.Context, state map[string]TargetState) error
+}
+
+// StateCache keeps the known digests and failures of target references in memory and writes them
+// to a StateStore so they survive restarts and leader failovers. Mirrored digests spare the source
+// registry for the TTL; afterwards the registries are checked again.
+type StateCache struct {
+	store         StateStore
+	ttl           time.Duration
+	flushInterval time.Duration
+	logger        logr.Logger
+	now           func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]TargetState
+	dirty   bool
+}
+
+// NewStateCache returns a cache backed by store. It loads and flushes state when started as a
+// manager runnable.
+func NewStateCache(store StateStore, ttl, flushInterval time.Duration, logger logr.Logger) *StateCache {
+	if ttl <= 0 {
+		ttl = DefaultStateTTL
+	}
+	if flushInterval <= 0 {
+		flushInterval = DefaultStateFlushInterval
+	}
+	if logger.GetSink() == nil {
+		logger = ctrl.Log.WithName("mirror").WithName("state")
+	} else {
+		logger = logger.WithName("state")
+	}
+	return &StateCache{
+		store:         store,
+		ttl:           ttl,
+		flushInterval: flushInterval,
+		logger:        logger,
+		now:           time.Now,
+		entries:       make(map[string]TargetState),
+	}
+}
+
+// Start loads the persisted state and flushes changes every flush interval and on shutdown.
+func (c *StateCache) Start(ctx context.Context) error {
+	if err := c.load(ctx); err != nil {
+		// Without the previous state copycat only repeats registry checks, so keep going.
+		c.logger.Error(err, "unable to load mirror state; starting empty")
+	}
+	ticker := time.NewTicker(c.flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			flushCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			if err := c.flush(flushCtx); err != nil {
+				c.logger.Error(err, "unable to save mirror state on shutdown")
+			}
+			return nil
+		case <-ticker.C:
+			if err := c.flush(ctx); err != nil {
+				c.logger.Error(err, "unable to save mirror state")
+			}
+		}
+	}
+}
+
+func (c *StateCache) load(ctx context.Context) error {
+	loaded, err := c.store.Load(ctx)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for target, entry := range loaded {
+		// Entries recorded since startup are newer than anything persisted.
+		if _, ok := c.entries[target]; !ok {
+			c.entries[target] = entry
+		}
+	}
+	c.logger.Info("loaded mirror state", "targets", len(loaded))
+	return nil
+}
+
+func (c *StateCache) flush(ctx context.Context) error {
+	c.mu.Lock()
+	if !c.dirty {
+		c.mu.Unlock()
+		return nil
+	}
+	cutoff := c.now().Add(-c.ttl)
+	snapshot := make(map[string]TargetState, len(c.entries))
+	for target, entry := range c.entries {
+		if entry.MirroredAt.Before(cutoff) && entry.FailedAt.Before(cutoff) {
+			delete(c.entries, target)
+			continue
+		}
+		snapshot[target] = entry
+	}
+	c.dirty = false
+	c.mu.Unlock()
+
+	if err := c.store.Save(ctx, snapshot); err != nil {
+		c.mu.Lock()
+		c.dirty = true
+		c.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// knownDigest reports whether target was mirrored from sourceDigest within the TTL, and returns
+// the reference the image was pushed to together with its digest at the target.
+func (c *StateCache) knownDigest(target, sourceDigest string) (pushed, targetDigest string, ok bool) {
+	if c == nil || sourceDigest == "" {
+		return "", "", false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[target]
+	if !ok || entry.SourceDigest != sourceDigest || entry.TargetDigest == "" || c.now().Sub(entry.MirroredAt) >= c.ttl {
+		return "", "", false
+	}
+	pushed = target
+	if entry.Target != "" {
+		pushed = entry.Target
+	}
+	return pushed, entry.TargetDigest, true
+}
+
+// forget drops what is remembered about target, and about references whose image was pushed to
+// it, for example when the target registry no longer has it.
+func (c *StateCache) forget(target string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, entry := range c.entries {
+		if key == target || entry.Target == target {
+			delete(c.entries, key)
+			c.dirty = true
+		}
+	}
+}
+
+// ForgetImages drops the entries of the tags and digests in identifiers of the target repository,
+// which garbage collection removed, so that they are mirrored again once a workload references
+// them.
+func (c *StateCache) ForgetImages(repository string, identifiers []string) {
+	if c == nil || len(identifiers) == 0 {
+		return
+	}
+	ids := make(map[string]struct{}, len(identifiers))
+	for _, id := range identifiers {
+		ids[id] = struct{}{}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	forgotten := 0
+	removed := func(target string) bool {
+		ref, err := name.ParseReference(target, name.WeakValidation)
+		if err != nil || ref.Context().RepositoryStr() != repository {
+			return false
+		}
+		_, ok := ids[ref.Identifier()]
+		return ok
+	}
+	for target, entry := range c.entries {
+		if removed(target) || (entry.Target != "" && removed(entry.Target)) {
+			delete(c.entries, target)
+			forgotten++
+		}
+	}
+	if forgotten > 0 {
+		c.dirty = true
+	}
+}
+
+// markMirrored remembers that pushed holds the image mirrored from sourceDigest. requested is the
+// reference the image was looked up under before its architecture was known; it is remembered too
+// when it differs from pushed.
+func (c *StateCache) markMirrored(pushed, requested, sourceDigest, targetDigest string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	c.entries[pushed] = TargetState{SourceDigest: sourceDigest, TargetDigest: targetDigest, MirroredAt: now}
+	if requested != "" && requested != pushed {
+		c.entries[requested] = TargetState{Target: pushed, SourceDigest: sourceDigest, TargetDigest: targetDigest, MirroredAt: now}
+	}
+	c.dirty = true
+}
+
+func (c *StateCache) markFailed(target string, at, retryAt time.Time, reason string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry := c.entries[target]
+	entry.FailedAt = at
+	entry.RetryAt = retryAt
+	entry.FailureReason = reason
+	c.entries[target] = entry
+	c.dirty = true
+}
+
+// lookup returns what is remembered about target.
+func (c *StateCache) lookup(target string) (TargetState, bool) {
+	if c == nil {
+		return TargetState{}, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[target]
+	return entry, ok
+}
+
+// failures returns the remembered failures by target.
+func (c *StateCache) failures() map[string]TargetState {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out := make(map[string]TargetState)
+	for target, entry := range c.entries {
+		if !entry.FailedAt.IsZero() {
+			out[target] = entry
+		}
+	}
+	return out
+}
+
+// failedAt returns when target last failed, if a failure is remembered.
+func (c *StateCache) failedAt(target string) (time.Time, bool) {
+	if c == nil {
+		return time.Time{}, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[target]
+	if !ok || entry.FailedAt.IsZero() {
+		return time.Time{}, false
+	}
+	return entry.FailedAt, true
+}
+
+func (c *StateCache) clearFailure(target string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if entry, ok := c.entries[target]; ok && !entry.FailedAt.IsZero() {
+		entry.FailedAt = time.Time{}
+		entry.RetryAt = time.Time{}
+		entry.FailureReason = ""
+		c.entries[target] = entry
+		c.dirty = true
+	}
+}
+
+// clearFailures forgets every failure and returns how many were cleared.
+func (c *StateCache) clearFailures() int {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cleared := 0
+	for target, entry := range c.entries {
+		if entry.FailedAt.IsZero() {
+			continue
+		}
+		entry.FailedAt = time.Time{}
+		entry.RetryAt = time.Time{}
+		entry.FailureReason = ""
+		c.entries[target] = entry
+		cleared++
+	}
+	if cleared > 0 {
+		c.dirty = true
+	}
+	return cleared
+}
+
+// FileStateStore keeps state in a JSON file, for example on a persistent volume.
+type FileStateStore struct {
+	Path string
+}
+
+func (s FileStateStore) Load(context.Context) (map[string]TargetState, error) {
+	b, err := os.ReadFile(s.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return map[string]TargetState{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	state := map[string]TargetState{}
+	if err := json.Unmarshal(b, &state); err != nil {
+		return nil, fmt.Errorf("decode %s: %w", s.Path, err)
+	}
+	return state, nil
+}
+
+// Save writes the state to a temporary file and renames it so readers never see partial content.
+func (s FileStateStore) Save(_ context.Context, state map[string]TargetState) error {
+	b, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.Path), filepath.Base(s.Path)+".*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(b); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), s.Path)
+}
+
+// configMapStateKey holds the gzip compressed JSON state so thousands of targets fit into the
+// 1 MiB ConfigMap size limit.
+const configMapStateKey = "state.json.gz"
+
+// ConfigMapStateStore keeps state in a ConfigMap so that it follows the leader across nodes
+// without a persistent volume.
+type ConfigMapStateStore struct {
+	Client    kubernetes.Interface
+	Namespace string
+	Name      string
+}
+
+func (s ConfigMapStateStore) Load(ctx context.Context) (map[string]TargetState, error) {
+	cm, err := s.Client.CoreV1().ConfigMaps(s.Namespace).Get(ctx, s.Name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return map[string]TargetState{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get configmap %s/%s: %w", s.Namespace, s.Name, err)
+	}
+	raw, ok := cm.BinaryData[configMapStateKey]
+	if !ok {
+		return map[string]TargetState{}, nil
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("decode configmap %s/%s: %w", s.Namespace, s.Name, err)
+	}
+	defer func() { _ = zr.Close() }()
+	state := map[string]TargetState{}
+	if err := json.NewDecoder(zr).Decode(&state); err != nil {
+		return nil, fmt.Errorf("decode configmap %s/%s: %w", s.Namespace, s.Name, err)
+	}
+	return state, nil
+}
+
+func (s ConfigMapStateStore) Save(ctx context.Context, state map[string]TargetState) error {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if err := json.NewEncoder(zw).Encode(state); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+
+	configMaps := s.Client.CoreV1().ConfigMaps(s.Namespace)
+	cm, err := configMaps.Get(ctx, s.Name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		cm = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      s.Name,
+				Namespace: s.Namespace,
+				Labels:    map[string]string{"app": "k8s-copycat"},
+			},
+			BinaryData: map[string][]byte{configMapStateKey: buf.Bytes()},
+		}
+		if _, err := configMaps.Create(ctx, cm, metav1.CreateOptions{}); err != nil {
+			return fmt.Errorf("create configmap %s/%s: %w", s.Namespace, s.Name, err)
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("get configmap %s/%s: %w", s.Namespace, s.Name, err)
+	}
+	if cm.BinaryData == nil {
+		cm.BinaryData = map[string][]byte{}
+	}
+	cm.BinaryData[configMapStateKey] = buf.Bytes()
+	if _, err := configMaps.Update(ctx, cm, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("update configmap %s/%s: %w", s.Namespace, s.Name, err)
+	}
+	return nil
+}
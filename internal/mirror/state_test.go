@@ -0,0 +1,277 @@
+package mirror
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	remotetransport "github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestStateCacheRoundTripThroughFileStore(t *testing.T) {
+	store := FileStateStore{Path: filepath.Join(t.TempDir(), "state.json")}
+	now := time.Now()
+	cache := NewStateCache(store, time.Hour, time.Minute, testr.New(t))
+	cache.now = func() time.Time { return now }
+
+	cache.markMirrored("example.com/app:1", "", "sha256:src", "sha256:dst")
+	cache.markFailed("example.com/app:2", now, now.Add(time.Hour), "pull failed")
+	if err := cache.flush(context.Background()); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+
+	restored := NewStateCache(store, time.Hour, time.Minute, testr.New(t))
+	restored.now = func() time.Time { return now.Add(time.Minute) }
+	if err := restored.load(context.Background()); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if !known(restored, "example.com/app:1", "sha256:src") {
+		t.Fatalf("expected mirrored digest to survive a restart")
+	}
+	if known(restored, "example.com/app:1", "sha256:other") {
+		t.Fatalf("expected a different source digest to be unknown")
+	}
+	failedAt, ok := restored.failedAt("example.com/app:2")
+	if !ok || !failedAt.Equal(now) {
+		t.Fatalf("expected failure at %v, got %v (found %t)", now, failedAt, ok)
+	}
+	if entry := restored.entries["example.com/app:2"]; entry.FailureReason != "pull failed" {
+		t.Fatalf("expected failure reason to be persisted, got %q", entry.FailureReason)
+	}
+}
+
+func TestStateCacheExpiresEntries(t *testing.T) {
+	store := FileStateStore{Path: filepath.Join(t.TempDir(), "state.json")}
+	now := time.Now()
+	cache := NewStateCache(store, time.Hour, time.Minute, testr.New(t))
+	cache.now = func() time.Time { return now }
+	cache.markMirrored("example.com/app:1", "", "sha256:src", "sha256:dst")
+
+	now = now.Add(2 * time.Hour)
+	if known(cache, "example.com/app:1", "sha256:src") {
+		t.Fatalf("expected digest to be re-checked after the TTL")
+	}
+	if err := cache.flush(context.Background()); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+	if len(cache.entries) != 0 {
+		t.Fatalf("expected expired entries to be pruned, got %v", cache.entries)
+	}
+}
+
+func TestStateCacheLoadKeepsNewerEntries(t *testing.T) {
+	store := FileStateStore{Path: filepath.Join(t.TempDir(), "state.json")}
+	if err := store.Save(context.Background(), map[string]TargetState{
+		"example.com/app:1": {SourceDigest: "sha256:old", TargetDigest: "sha256:old", MirroredAt: time.Now()},
+	}); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	cache := NewStateCache(store, time.Hour, time.Minute, testr.New(t))
+	cache.markMirrored("example.com/app:1", "", "sha256:new", "sha256:new")
+	if err := cache.load(context.Background()); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if got := cache.entries["example.com/app:1"].SourceDigest; got != "sha256:new" {
+		t.Fatalf("expected entry recorded since startup to win, got %s", got)
+	}
+}
+
+func TestConfigMapStateStoreRoundTrip(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	store := ConfigMapStateStore{Client: client, Namespace: "k8s-copycat", Name: "k8s-copycat-state"}
+	ctx := context.Background()
+
+	state, err := store.Load(ctx)
+	if err != nil {
+		t.Fatalf("load missing configmap: %v", err)
+	}
+	if len(state) != 0 {
+		t.Fatalf("expected empty state, got %v", state)
+	}
+
+	for _, digest := range []string{"sha256:a", "sha256:b"} {
+		if err := store.Save(ctx, map[string]TargetState{"example.com/app:1": {SourceDigest: digest, TargetDigest: digest}}); err != nil {
+			t.Fatalf("save: %v", err)
+		}
+	}
+
+	state, err = store.Load(ctx)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if got := state["example.com/app:1"].SourceDigest; got != "sha256:b" {
+		t.Fatalf("expected updated state, got %v", state)
+	}
+}
+
+func known(cache *StateCache, target, sourceDigest string) bool {
+	_, _, ok := cache.knownDigest(target, sourceDigest)
+	return ok
+}
+
+func TestMirrorSkipsDigestKnownFromState(t *testing.T) {
+	digest := "sha256:" + strings.Repeat("a", 64)
+	hash, _ := v1.NewHash(digest)
+	var heads []string
+	originalHead := remoteHeadFunc
+	remoteHeadFunc = func(ref name.Reference, _ ...remote.Option) (*v1.Descriptor, error) {
+		heads = append(heads, ref.String())
+		if ref.Context().RegistryStr() != "example.com" {
+			return nil, errors.New("unexpected source registry request")
+		}
+		return &v1.Descriptor{Digest: hash}, nil
+	}
+	t.Cleanup(func() { remoteHeadFunc = originalHead })
+	originalGet := remoteGetFunc
+	remoteGetFunc = func(name.Reference, ...remote.Option) (*remote.Descriptor, error) {
+		return nil, errors.New("unexpected registry request")
+	}
+	t.Cleanup(func() { remoteGetFunc = originalGet })
+
+	state := NewStateCache(FileStateStore{Path: filepath.Join(t.TempDir(), "state.json")}, time.Hour, time.Minute, testr.New(t))
+	state.markMirrored("example.com/library/nginx:1.25", "", digest, digest)
+
+	p := NewPusher(fakeTarget{}, false, false, nil, testr.New(t), nil, 0, time.Hour, true, nil, nil, true, nil, nil, WithStateCache(state))
+	err := p.Mirror(context.Background(), "docker.io/library/nginx:1.25", Metadata{ImageID: "docker.io/library/nginx@" + digest})
+	if err != nil {
+		t.Fatalf("expected known digest to be skipped, got %v", err)
+	}
+	if len(heads) != 1 || heads[0] != "example.com/library/nginx:1.25" {
+		t.Fatalf("expected a single HEAD of the target to confirm the known digest, got %v", heads)
+	}
+}
+
+func TestMirrorRemirrorsKnownDigestDeletedFromTarget(t *testing.T) {
+	digest := "sha256:" + strings.Repeat("e", 64)
+	var targetGone bool
+	originalHead := remoteHeadFunc
+	remoteHeadFunc = func(name.Reference, ...remote.Option) (*v1.Descriptor, error) {
+		targetGone = true
+		return nil, &remotetransport.Error{StatusCode: http.StatusNotFound}
+	}
+	t.Cleanup(func() { remoteHeadFunc = originalHead })
+	var pulled bool
+	originalGet := remoteGetFunc
+	remoteGetFunc = func(name.Reference, ...remote.Option) (*remote.Descriptor, error) {
+		pulled = true
+		return nil, errors.New("source unavailable")
+	}
+	t.Cleanup(func() { remoteGetFunc = originalGet })
+
+	state := NewStateCache(FileStateStore{Path: filepath.Join(t.TempDir(), "state.json")}, time.Hour, time.Minute, testr.New(t))
+	state.markMirrored("example.com/library/nginx:1.25", "", digest, digest)
+
+	p := NewPusher(fakeTarget{}, false, false, nil, testr.New(t), nil, 0, time.Hour, true, nil, nil, true, nil, nil, WithStateCache(state))
+	if err := p.Mirror(context.Background(), "docker.io/library/nginx:1.25", Metadata{ImageID: "docker.io/library/nginx@" + digest}); err == nil {
+		t.Fatalf("expected the image deleted from the target to be mirrored again")
+	}
+	if !targetGone || !pulled {
+		t.Fatalf("expected the target to be checked and the source to be pulled again")
+	}
+	if known(state, "example.com/library/nginx:1.25", digest) {
+		t.Fatalf("expected the state of the deleted image to be forgotten")
+	}
+}
+
+func TestStateCacheFindsImagePushedToArchitectureTarget(t *testing.T) {
+	cache := NewStateCache(FileStateStore{Path: filepath.Join(t.TempDir(), "state.json")}, time.Hour, time.Minute, testr.New(t))
+	cache.markMirrored("example.com/amd64/nginx:1.25", "example.com//nginx:1.25", "sha256:src", "sha256:dst")
+
+	pushed, targetDigest, ok := cache.knownDigest("example.com//nginx:1.25", "sha256:src")
+	if !ok || pushed != "example.com/amd64/nginx:1.25" || targetDigest != "sha256:dst" {
+		t.Fatalf("expected the requested target to resolve to the pushed one, got %q %q %v", pushed, targetDigest, ok)
+	}
+	if !known(cache, "example.com/amd64/nginx:1.25", "sha256:src") {
+		t.Fatalf("expected the pushed target to be remembered")
+	}
+
+	cache.forget("example.com/amd64/nginx:1.25")
+	if len(cache.entries) != 0 {
+		t.Fatalf("expected forgetting the pushed target to drop the requested one too, got %v", cache.entries)
+	}
+}
+
+func TestStateCacheForgetsRemovedImages(t *testing.T) {
+	digest := "sha256:" + strings.Repeat("b", 64)
+	cache := NewStateCache(FileStateStore{Path: filepath.Join(t.TempDir(), "state.json")}, time.Hour, time.Minute, testr.New(t))
+	for _, target := range []string{"example.com/mirrors/nginx:1.24.0", "example.com/mirrors/nginx@" + digest, "example.com/mirrors/nginx:1.25.3", "example.com/other/nginx:1.24.0"} {
+		cache.markMirrored(target, "", "sha256:src", "sha256:dst")
+	}
+	cache.dirty = false
+
+	cache.ForgetImages("mirrors/nginx", []string{digest, "1.24.0"})
+	if len(cache.entries) != 2 {
+		t.Fatalf("expected two entries to be forgotten, got %v", cache.entries)
+	}
+	if _, ok := cache.lookup("example.com/mirrors/nginx:1.24.0"); ok {
+		t.Fatalf("expected the removed tag to be forgotten")
+	}
+	if _, ok := cache.lookup("example.com/mirrors/nginx:1.25.3"); !ok {
+		t.Fatalf("expected other tags of the repository to be kept")
+	}
+	if _, ok := cache.lookup("example.com/other/nginx:1.24.0"); !ok {
+		t.Fatalf("expected other repositories to be kept")
+	}
+	if !cache.dirty {
+		t.Fatalf("expected the change to be flushed")
+	}
+}
+
+func TestMirrorForgetsStateWhenTargetIsMissing(t *testing.T) {
+	originalHead := remoteHeadFunc
+	remoteHeadFunc = func(name.Reference, ...remote.Option) (*v1.Descriptor, error) {
+		return nil, &remotetransport.Error{StatusCode: http.StatusNotFound}
+	}
+	t.Cleanup(func() { remoteHeadFunc = originalHead })
+	originalGet := remoteGetFunc
+	remoteGetFunc = func(name.Reference, ...remote.Option) (*remote.Descriptor, error) {
+		return nil, errors.New("source unavailable")
+	}
+	t.Cleanup(func() { remoteGetFunc = originalGet })
+
+	old, running := "sha256:"+strings.Repeat("a", 64), "sha256:"+strings.Repeat("c", 64)
+	state := NewStateCache(FileStateStore{Path: filepath.Join(t.TempDir(), "state.json")}, time.Hour, time.Minute, testr.New(t))
+	state.markMirrored("example.com/library/nginx:1.25", "", old, old)
+
+	p := NewPusher(fakeTarget{}, false, false, nil, testr.New(t), nil, 0, time.Hour, true, nil, nil, true, nil, nil, WithStateCache(state))
+	if err := p.Mirror(context.Background(), "docker.io/library/nginx:1.25", Metadata{ImageID: "docker.io/library/nginx@" + running}); err == nil {
+		t.Fatalf("expected the unavailable source to fail the mirror")
+	}
+	if entry, ok := state.lookup("example.com/library/nginx:1.25"); ok && entry.SourceDigest != "" {
+		t.Fatalf("expected the state entry of a missing target to be forgotten, got %+v", entry)
+	}
+}
+
+func TestBeginProcessingHonoursPersistedCooldown(t *testing.T) {
+	now := time.Now()
+	target := "example.com/repo:tag"
+	state := NewStateCache(FileStateStore{Path: filepath.Join(t.TempDir(), "state.json")}, time.Hour, time.Minute, testr.New(t))
+	state.markFailed(target, now.Add(-30*time.Minute), now.Add(30*time.Minute), "pull failed")
+	p := &pusher{
+		pushed:          make(map[string]struct{}),
+		failed:          make(map[string]time.Time),
+		failureCooldown: time.Hour,
+		state:           state,
+		now:             func() time.Time { return now },
+	}
+
+	if _, err := p.beginProcessing(target, testr.New(t)); !errors.Is(err, ErrInCooldown) {
+		t.Fatalf("expected persisted failure to keep the target in cooldown, got %v", err)
+	}
+
+	if cleared, enabled := p.ResetCooldown(); !enabled || cleared != 1 {
+		t.Fatalf("expected one cleared cooldown, got %d (enabled %t)", cleared, enabled)
+	}
+	if _, ok := state.failedAt(target); ok {
+		t.Fatalf("expected reset to clear the persisted failure")
+	}
+}
@@ -0,0 +1,87 @@
+package mirror
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/google/go-containerregistry/pkg/name"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// StaticImageMirrorer is a manager runnable that mirrors a fixed list of images that no workload
+// has to reference, such as disaster recovery bootstrap images or break-glass debug tools.
+type StaticImageMirrorer struct {
+	pusher   Pusher
+	images   []string
+	interval time.Duration
+	logger   logr.Logger
+}
+
+// NewStaticImageMirrorer mirrors images through pusher at startup and then every interval. A zero
+// interval mirrors them only once.
+func NewStaticImageMirrorer(pusher Pusher, images []string, interval time.Duration, logger logr.Logger) *StaticImageMirrorer {
+	if logger.GetSink() == nil {
+		logger = ctrl.Log.WithName("mirror").WithName("static-images")
+	} else {
+		logger = logger.WithName("static-images")
+	}
+	return &StaticImageMirrorer{
+		pusher:   pusher,
+		images:   images,
+		interval: interval,
+		logger:   logger,
+	}
+}
+
+// ValidateStaticImages reports image references that cannot be parsed.
+func ValidateStaticImages(images []string) error {
+	var errs []error
+	for _, image := range images {
+		if _, err := name.ParseReference(strings.TrimSpace(image), name.WeakValidation); err != nil {
+			errs = append(errs, fmt.Errorf("static image %q: %w", image, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Start mirrors the static images once and then on the configured interval until ctx is cancelled.
+func (s *StaticImageMirrorer) Start(ctx context.Context) error {
+	s.MirrorAll(ctx)
+	if s.interval <= 0 {
+		return nil
+	}
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			s.MirrorAll(ctx)
+		}
+	}
+}
+
+// MirrorAll mirrors every static image and returns the number of images that failed.
+func (s *StaticImageMirrorer) MirrorAll(ctx context.Context) int {
+	// Static images are not tied to a Pod, so there is no digest to pin to; references that
+	// carry a digest are pulled by that digest anyway.
+	digestPull := false
+	meta := Metadata{DigestPull: &digestPull}
+	failed := 0
+	for _, image := range s.images {
+		if ctx.Err() != nil {
+			return failed
+		}
+		if err := s.pusher.Mirror(ctx, image, meta); err != nil {
+			failed++
+			s.logger.Error(err, "unable to mirror static image", "image", image)
+		}
+	}
+	s.logger.V(1).Info("mirrored static images", "images", len(s.images), "failed", failed)
+	return failed
+}
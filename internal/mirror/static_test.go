@@ -0,0 +1,48 @@
+package mirror
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/go-logr/logr/testr"
+)
+
+type failingMirror struct {
+	recordingMirror
+	fail map[string]bool
+}
+
+func (f *failingMirror) Mirror(ctx context.Context, src string, meta Metadata) error {
+	_ = f.recordingMirror.Mirror(ctx, src, meta)
+	if f.fail[src] {
+		return errors.New("boom")
+	}
+	return nil
+}
+
+func TestStaticImageMirrorerMirrorsEveryImage(t *testing.T) {
+	inner := &failingMirror{fail: map[string]bool{"busybox:1.36": true}}
+	images := []string{"busybox:1.36", "ghcr.io/acme/bootstrap:v2", "nicolaka/netshoot@sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"}
+	m := NewStaticImageMirrorer(inner, images, 0, testr.New(t))
+
+	if failed := m.MirrorAll(context.Background()); failed != 1 {
+		t.Fatalf("expected one failure, got %d", failed)
+	}
+	if !reflect.DeepEqual(inner.calls, images) {
+		t.Fatalf("expected every static image to be mirrored, got %v", inner.calls)
+	}
+	if meta := inner.metas[0]; meta.DigestPull == nil || *meta.DigestPull || meta.Namespace != "" {
+		t.Fatalf("unexpected static image metadata: %+v", meta)
+	}
+}
+
+func TestValidateStaticImages(t *testing.T) {
+	if err := ValidateStaticImages([]string{"busybox:1.36", "ghcr.io/acme/bootstrap:v2"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := ValidateStaticImages([]string{"busybox:1.36", "Invalid//Image:"}); err == nil {
+		t.Fatal("expected invalid reference to be rejected")
+	}
+}
@@ -0,0 +1,219 @@
+package mirror
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// DefaultRepositorySyncInterval is used when a repository sync does not declare an interval.
+const DefaultRepositorySyncInterval = time.Hour
+
+// RepositorySync mirrors every tag of a source repository whose name matches Include and does
+// not match Exclude, independent of any workload. Both expressions are unanchored regular
+// expressions; an empty Include selects every tag. The repository is synced at startup and then
+// every Interval; a zero Interval syncs only once.
+type RepositorySync struct {
+	Repository string
+	Include    string
+	Exclude    string
+	Interval   time.Duration
+}
+
+type repositorySync struct {
+	repo     name.Repository
+	include  *regexp.Regexp
+	exclude  *regexp.Regexp
+	interval time.Duration
+}
+
+// RepositorySyncer is a manager runnable that keeps complete copies of the configured
+// repositories by listing their tags and mirroring them through a Pusher.
+type RepositorySyncer struct {
+	pusher         Pusher
+	repos          []repositorySync
+	keychain       authn.Keychain
+	transport      http.RoundTripper
+	requestTimeout time.Duration
+	logger         logr.Logger
+}
+
+// NewRepositorySyncer validates repos and returns a runnable that syncs them through pusher.
+func NewRepositorySyncer(pusher Pusher, repos []RepositorySync, keychain authn.Keychain, requestTimeout time.Duration, logger logr.Logger) (*RepositorySyncer, error) {
+	parsed := make([]repositorySync, 0, len(repos))
+	for _, repo := range repos {
+		r, err := parseRepositorySync(repo)
+		if err != nil {
+			return nil, err
+		}
+		parsed = append(parsed, r)
+	}
+	if logger.GetSink() == nil {
+		logger = ctrl.Log.WithName("mirror").WithName("repository-sync")
+	} else {
+		logger = logger.WithName("repository-sync")
+	}
+	if keychain == nil {
+		keychain = NewStaticKeychain(nil)
+	}
+	return &RepositorySyncer{
+		pusher:         pusher,
+		repos:          parsed,
+		keychain:       keychain,
+		transport:      sourceTransportOf(pusher),
+		requestTimeout: requestTimeout,
+		logger:         logger,
+	}, nil
+}
+
+// ValidateRepositorySyncs reports repository syncs that cannot be parsed or are declared twice.
+func ValidateRepositorySyncs(repos []RepositorySync) error {
+	var errs []error
+	seen := make(map[string]struct{}, len(repos))
+	for _, repo := range repos {
+		r, err := parseRepositorySync(repo)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if _, dup := seen[r.repo.Name()]; dup {
+			errs = append(errs, fmt.Errorf("repository sync %s declared more than once", r.repo.Name()))
+			continue
+		}
+		seen[r.repo.Name()] = struct{}{}
+	}
+	return errors.Join(errs...)
+}
+
+func parseRepositorySync(repo RepositorySync) (repositorySync, error) {
+	raw := strings.TrimSpace(repo.Repository)
+	if raw == "" {
+		return repositorySync{}, fmt.Errorf("repository sync: repository is required")
+	}
+	ref, err := name.NewRepository(raw, name.WeakValidation)
+	if err != nil {
+		return repositorySync{}, fmt.Errorf("repository sync %q: %w", raw, err)
+	}
+	r := repositorySync{repo: ref, interval: repo.Interval}
+	if r.interval < 0 {
+		return repositorySync{}, fmt.Errorf("repository sync %q: interval must not be negative", raw)
+	}
+	if expr := strings.TrimSpace(repo.Include); expr != "" {
+		if r.include, err = regexp.Compile(expr); err != nil {
+			return repositorySync{}, fmt.Errorf("repository sync %q: invalid include %q: %w", raw, expr, err)
+		}
+	}
+	if expr := strings.TrimSpace(repo.Exclude); expr != "" {
+		if r.exclude, err = regexp.Compile(expr); err != nil {
+			return repositorySync{}, fmt.Errorf("repository sync %q: invalid exclude %q: %w", raw, expr, err)
+		}
+	}
+	return r, nil
+}
+
+func (r repositorySync) selectTags(tags []string) []string {
+	var out []string
+	for _, tag := range tags {
+		if r.include != nil && !r.include.MatchString(tag) {
+			continue
+		}
+		if r.exclude != nil && r.exclude.MatchString(tag) {
+			continue
+		}
+		out = append(out, tag)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Start syncs every repository once and then on its interval until ctx is cancelled.
+func (s *RepositorySyncer) Start(ctx context.Context) error {
+	if s.pusher.DryPull() {
+		// Listing tags would contact the source registry.
+		s.logger.Info("dry pull enabled; repository sync disabled", "repositories", len(s.repos))
+		<-ctx.Done()
+		return nil
+	}
+	var wg sync.WaitGroup
+	for _, repo := range s.repos {
+		wg.Add(1)
+		go func(repo repositorySync) {
+			defer wg.Done()
+			s.run(ctx, repo)
+		}(repo)
+	}
+	wg.Wait()
+	return nil
+}
+
+func (s *RepositorySyncer) run(ctx context.Context, repo repositorySync) {
+	s.syncRepository(ctx, repo)
+	if repo.interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(repo.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.syncRepository(ctx, repo)
+		}
+	}
+}
+
+// syncRepository lists the repository's tags and mirrors the selected ones. It returns the number
+// of tags that were mirrored successfully.
+func (s *RepositorySyncer) syncRepository(ctx context.Context, repo repositorySync) int {
+	log := s.logger.WithValues("repository", repo.repo.Name())
+	listCtx := ctx
+	if s.requestTimeout > 0 {
+		var cancel context.CancelFunc
+		listCtx, cancel = context.WithTimeout(ctx, s.requestTimeout)
+		defer cancel()
+	}
+	tags, err := remoteListFunc(repo.repo,
+		remote.WithContext(listCtx),
+		remote.WithAuthFromKeychain(s.keychain),
+		remote.WithTransport(s.transport),
+	)
+	if err != nil {
+		logRegistryAuthError(log, err, "list tags")
+		log.Error(err, "unable to list tags for repository sync")
+		return 0
+	}
+	selected := repo.selectTags(tags)
+	log.Info("syncing repository", "tags", len(tags), "selected", len(selected))
+
+	// Synced tags are not tied to a Pod, so there is no digest to pin to.
+	digestPull := false
+	meta := Metadata{DigestPull: &digestPull}
+	mirrored, failed := 0, 0
+	for _, tag := range selected {
+		if ctx.Err() != nil {
+			return mirrored
+		}
+		src := repo.repo.Tag(tag).String()
+		if err := s.pusher.Mirror(ctx, src, meta); err != nil {
+			failed++
+			log.Error(err, "unable to mirror synced tag", "image", src)
+			continue
+		}
+		mirrored++
+	}
+	log.Info("repository sync finished", "mirrored", mirrored, "failed", failed)
+	return mirrored
+}
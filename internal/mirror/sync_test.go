@@ -0,0 +1,70 @@
+package mirror
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr/testr"
+)
+
+func TestRepositorySyncerMirrorsSelectedTags(t *testing.T) {
+	stubRemoteList(t, []string{"3.20", "3.19", "3.19.1", "edge", "3.19-rc1", "latest"})
+	inner := &recordingMirror{}
+	syncer, err := NewRepositorySyncer(inner, []RepositorySync{
+		{Repository: "library/alpine", Include: `^3\.`, Exclude: `-rc`},
+	}, nil, 0, testr.New(t))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if mirrored := syncer.syncRepository(context.Background(), syncer.repos[0]); mirrored != 3 {
+		t.Fatalf("expected three mirrored tags, got %d", mirrored)
+	}
+	expected := []string{
+		"index.docker.io/library/alpine:3.19",
+		"index.docker.io/library/alpine:3.19.1",
+		"index.docker.io/library/alpine:3.20",
+	}
+	if !reflect.DeepEqual(inner.calls, expected) {
+		t.Fatalf("unexpected mirrored images: %v", inner.calls)
+	}
+	if meta := inner.metas[0]; meta.DigestPull == nil || *meta.DigestPull {
+		t.Fatalf("expected synced tags to be pulled by tag, got %+v", meta)
+	}
+}
+
+func TestRepositorySyncerSharesSourceTransport(t *testing.T) {
+	p := NewPusher(fakeTarget{}, false, false, nil, testr.New(t), nil, 0, 0, false, nil, nil, false, nil, nil).(*pusher)
+	syncer, err := NewRepositorySyncer(p, []RepositorySync{{Repository: "library/alpine"}}, nil, 0, testr.New(t))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// Tag lists go through the pusher's bandwidth limits and transfer metrics.
+	if syncer.transport != p.sourceTransport {
+		t.Fatalf("expected the syncer to use the source transport of the pusher")
+	}
+}
+
+func TestValidateRepositorySyncs(t *testing.T) {
+	if err := ValidateRepositorySyncs([]RepositorySync{{Repository: "ghcr.io/acme/operator", Include: `^v\d+`}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	invalid := []RepositorySync{
+		{Repository: ""},
+		{Repository: "alpine", Include: "("},
+		{Repository: "alpine", Interval: -1},
+		{Repository: "docker.io/library/busybox"},
+		{Repository: "busybox"},
+	}
+	err := ValidateRepositorySyncs(invalid)
+	if err == nil {
+		t.Fatal("expected validation errors")
+	}
+	for _, want := range []string{"repository is required", "invalid include", "must not be negative", "declared more than once"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Fatalf("expected %q in %v", want, err)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package mirror
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	remotetransport "github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName identifies the spans of the mirror package. The global tracer provider is a no-op
+// unless tracing is configured, so spans cost next to nothing by default.
+const tracerName = "github.com/matzegebbe/k8s-copycat/internal/mirror"
+
+func tracer() trace.Tracer {
+	return otel.Tracer(tracerName)
+}
+
+// startStage starts a span for one stage of a mirror below the span in ctx.
+func startStage(ctx context.Context, stage string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return tracer().Start(ctx, "mirror."+stage, trace.WithAttributes(attrs...))
+}
+
+// endSpan marks span as failed when err is set and ends it.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// unexpectedHeadError drops the not found error of a HEAD request, which only means the image
+// still has to be mirrored.
+func unexpectedHeadError(err error) error {
+	var te *remotetransport.Error
+	if errors.As(err, &te) && te.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	return err
+}
+
+// traceTransport wraps rt so that every registry request becomes a client span below the stage
+// that issued it. Trace headers are not sent, registries are third parties.
+func traceTransport(rt http.RoundTripper) http.RoundTripper {
+	return &tracedTransport{
+		inner: rt,
+		traced: otelhttp.NewTransport(rt,
+			otelhttp.WithPropagators(propagation.NewCompositeTextMapPropagator()),
+			otelhttp.WithSpanNameFormatter(func(_ string, req *http.Request) string {
+				return "HTTP " + req.Method
+			}),
+		),
+	}
+}
+
+type tracedTransport struct {
+	inner  http.RoundTripper
+	traced http.RoundTripper
+}
+
+func (t *tracedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.traced.RoundTrip(req)
+}
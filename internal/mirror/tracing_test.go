@@ -0,0 +1,134 @@
+package mirror
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/matzegebbe/k8s-copycat/pkg/metrics"
+)
+
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+	return recorder
+}
+
+func spanByName(t *testing.T, spans []sdktrace.ReadOnlySpan, name string) sdktrace.ReadOnlySpan {
+	t.Helper()
+	for _, span := range spans {
+		if span.Name() == name {
+			return span
+		}
+	}
+	t.Fatalf("expected span %q to be recorded", name)
+	return nil
+}
+
+func spanAttribute(span sdktrace.ReadOnlySpan, key attribute.Key) string {
+	for _, kv := range span.Attributes() {
+		if kv.Key == key {
+			return kv.Value.Emit()
+		}
+	}
+	return ""
+}
+
+func TestMirrorRecordsStageSpans(t *testing.T) {
+	metrics.Reset()
+	t.Cleanup(metrics.Reset)
+	recorder := recordSpans(t)
+
+	originalHead := remoteHeadFunc
+	remoteHeadFunc = func(name.Reference, ...remote.Option) (*v1.Descriptor, error) {
+		return &v1.Descriptor{}, nil
+	}
+	t.Cleanup(func() { remoteHeadFunc = originalHead })
+	originalGet := remoteGetFunc
+	remoteGetFunc = func(name.Reference, ...remote.Option) (*remote.Descriptor, error) {
+		return nil, errors.New("pull failed")
+	}
+	t.Cleanup(func() { remoteGetFunc = originalGet })
+
+	p := NewPusher(fakeTarget{}, false, false, nil, testr.New(t), nil, 0, 0, true, nil, nil, true, nil, nil)
+	source := "docker.io/library/nginx@sha256:" + strings.Repeat("a", 64)
+	if err := p.Mirror(context.Background(), source, Metadata{Namespace: "apps", PodName: "web"}); err == nil {
+		t.Fatalf("expected error from Mirror when source pull fails")
+	}
+
+	spans := recorder.Ended()
+	root := spanByName(t, spans, "mirror")
+	if root.Status().Code != codes.Error {
+		t.Fatalf("expected mirror span to be marked as failed, got %v", root.Status())
+	}
+	if got := spanAttribute(root, "copycat.source"); got != source {
+		t.Fatalf("expected source attribute %q, got %q", source, got)
+	}
+	if got := spanAttribute(root, "copycat.target"); !strings.HasPrefix(got, "example.com/") {
+		t.Fatalf("expected target attribute in target registry, got %q", got)
+	}
+	if got := spanAttribute(root, "k8s.namespace.name"); got != "apps" {
+		t.Fatalf("expected namespace attribute, got %q", got)
+	}
+
+	head := spanByName(t, spans, "mirror.target_head")
+	if head.Status().Code == codes.Error {
+		t.Fatalf("expected successful target head span, got %v", head.Status())
+	}
+	resolve := spanByName(t, spans, "mirror.resolve_descriptor")
+	if resolve.Status().Code != codes.Error {
+		t.Fatalf("expected failed descriptor fetch to be recorded, got %v", resolve.Status())
+	}
+	for _, child := range []sdktrace.ReadOnlySpan{head, resolve} {
+		if child.Parent().SpanID() != root.SpanContext().SpanID() {
+			t.Fatalf("expected %s to be a child of the mirror span", child.Name())
+		}
+	}
+}
+
+func TestTraceTransportRecordsRequestsWithoutPropagatingContext(t *testing.T) {
+	recorder := recordSpans(t)
+
+	var traceparent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+
+	ctx, parent := tracer().Start(context.Background(), "mirror")
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, server.URL+"/v2/", nil)
+	if err != nil {
+		t.Fatalf("build request: %v", err)
+	}
+	resp, err := traceTransport(http.DefaultTransport).RoundTrip(req)
+	if err != nil {
+		t.Fatalf("round trip: %v", err)
+	}
+	_ = resp.Body.Close()
+	parent.End()
+
+	if traceparent != "" {
+		t.Fatalf("expected no trace headers to be sent to the registry, got %q", traceparent)
+	}
+	span := spanByName(t, recorder.Ended(), "HTTP HEAD")
+	if span.Parent().SpanID() != parent.SpanContext().SpanID() {
+		t.Fatalf("expected request span to be a child of the mirror span")
+	}
+}
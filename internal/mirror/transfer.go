@@ -0,0 +1,74 @@
+package mirror
+
+import (
+	"context"
+	"io"
+	"net/http"
+
+	"github.com/matzegebbe/k8s-copycat/pkg/metrics"
+)
+
+// transferDirection tells downloads from source registries apart from uploads to the target.
+type transferDirection int
+
+const (
+	transferPull transferDirection = iota
+	transferPush
+)
+
+type transferRegistryKey struct{}
+
+// withTransferRegistry attributes the downloads of ctx to the source registry, because blob
+// downloads are often redirected to storage hosts of another name.
+func withTransferRegistry(ctx context.Context, registry string) context.Context {
+	return context.WithValue(ctx, transferRegistryKey{}, registry)
+}
+
+// transferRegistry returns the registry a request counts towards: the source registry recorded
+// in its context for downloads, the requested host otherwise.
+func transferRegistry(req *http.Request, d transferDirection) string {
+	if d == transferPull {
+		if reg, ok := req.Context().Value(transferRegistryKey{}).(string); ok && reg != "" {
+			return reg
+		}
+	}
+	return normalizeBandwidthRegistry(req.URL.Host)
+}
+
+// meterTransport wraps rt so that the bodies transferred in direction d are counted per registry.
+func meterTransport(rt http.RoundTripper, d transferDirection) http.RoundTripper {
+	return &meteredTransport{inner: rt, direction: d}
+}
+
+type meteredTransport struct {
+	inner     http.RoundTripper
+	direction transferDirection
+}
+
+func (t *meteredTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	registry := transferRegistry(req, t.direction)
+	if t.direction == transferPush {
+		if req.Body != nil && req.Body != http.NoBody {
+			req = req.Clone(req.Context())
+			req.Body = &meteredBody{ReadCloser: req.Body, add: func(n int) { metrics.AddPushedBytes(registry, n) }}
+		}
+		return t.inner.RoundTrip(req)
+	}
+	resp, err := t.inner.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+	resp.Body = &meteredBody{ReadCloser: resp.Body, add: func(n int) { metrics.AddPulledBytes(registry, n) }}
+	return resp, nil
+}
+
+type meteredBody struct {
+	io.ReadCloser
+	add func(int)
+}
+
+func (b *meteredBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.add(n)
+	return n, err
+}
@@ -0,0 +1,48 @@
+package mirror
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/matzegebbe/k8s-copycat/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMeteredTransportCountsBytesPerRegistry(t *testing.T) {
+	metrics.Reset()
+	t.Cleanup(metrics.Reset)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		_, _ = io.WriteString(w, strings.Repeat("x", 1000))
+	}))
+	defer server.Close()
+
+	pull := &http.Client{Transport: meterTransport(http.DefaultTransport, transferPull)}
+	req, _ := http.NewRequestWithContext(withTransferRegistry(context.Background(), "docker.io"), http.MethodGet, server.URL, nil)
+	resp, err := pull.Do(req)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	push := &http.Client{Transport: meterTransport(http.DefaultTransport, transferPush)}
+	resp, err = push.Post(server.URL, "application/octet-stream", strings.NewReader(strings.Repeat("y", 300)))
+	if err != nil {
+		t.Fatalf("post: %v", err)
+	}
+	resp.Body.Close()
+
+	if got := testutil.ToFloat64(metrics.PulledBytesCounter().WithLabelValues("docker.io")); got != 1000 {
+		t.Fatalf("expected 1000 pulled bytes for docker.io, got %v", got)
+	}
+	host := strings.TrimPrefix(server.URL, "http://")
+	if got := testutil.ToFloat64(metrics.PushedBytesCounter().WithLabelValues(host)); got != 300 {
+		t.Fatalf("expected 300 pushed bytes for %s, got %v", host, got)
+	}
+}
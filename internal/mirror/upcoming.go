@@ -0,0 +1,390 @@
+package mirror
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	"github.com/matzegebbe/k8s-copycat/pkg/util"
+)
+
+// Upcoming version scopes limit how far ahead Next reaches.
+const (
+	UpcomingScopePatch = "patch"
+	UpcomingScopeMinor = "minor"
+	UpcomingScopeMajor = "major"
+)
+
+// upcomingTagListTTL bounds how often upstream tag lists are fetched per repository.
+const upcomingTagListTTL = time.Hour
+
+// UpcomingVersionRule selects images whose newer semver tags are mirrored ahead of time.
+// Registry matches the source registry exactly (Docker Hub is docker.io); Image matches
+// registry/repository either as a glob or as a regular expression wrapped in slashes. The
+// first matching rule wins. Next mirrors the N closest newer versions within Scope, Constraint
+// mirrors every newer version satisfying it; when both are set, Next applies after filtering.
+type UpcomingVersionRule struct {
+	Registry   string
+	Image      string
+	Next       int
+	Scope      string
+	Constraint string
+}
+
+type upcomingRule struct {
+	registry   string
+	glob       string
+	re         *regexp.Regexp
+	next       int
+	scope      string
+	constraint *util.VersionConstraint
+}
+
+type tagList struct {
+	tags    []string
+	fetched time.Time
+}
+
+// upcomingPusher mirrors newer semver tags of running images through the wrapped Pusher so
+// the version a rollout is about to use survives an upstream outage.
+type upcomingPusher struct {
+	Pusher
+	rules          []upcomingRule
+	keychain       authn.Keychain
+	transport      http.RoundTripper
+	requestTimeout time.Duration
+	logger         logr.Logger
+	now            func() time.Time
+	// enqueue is set by the mirror queue wrapping the pusher, so that upcoming versions are
+	// queued instead of being mirrored on the worker that mirrored the running version.
+	enqueue func(ctx context.Context, via Pusher, src string, meta Metadata)
+
+	mu   sync.Mutex
+	tags map[string]tagList
+}
+
+// NewUpcomingVersionPusher wraps inner so that, after mirroring an image with a semver tag,
+// newer tags selected by the first matching rule are mirrored as well.
+func NewUpcomingVersionPusher(inner Pusher, rules []UpcomingVersionRule, keychain authn.Keychain, requestTimeout time.Duration, logger logr.Logger) (Pusher, error) {
+	if len(rules) == 0 {
+		return inner, nil
+	}
+	parsed := make([]upcomingRule, 0, len(rules))
+	for i, rule := range rules {
+		r, err := parseUpcomingRule(rule)
+		if err != nil {
+			return nil, fmt.Errorf("upcoming version rule %d: %w", i, err)
+		}
+		parsed = append(parsed, r)
+	}
+	if logger.GetSink() == nil {
+		logger = ctrl.Log.WithName("mirror").WithName("upcoming")
+	} else {
+		logger = logger.WithName("upcoming")
+	}
+	if keychain == nil {
+		keychain = NewStaticKeychain(nil)
+	}
+	return &upcomingPusher{
+		Pusher:         inner,
+		rules:          parsed,
+		keychain:       keychain,
+		transport:      sourceTransportOf(inner),
+		requestTimeout: requestTimeout,
+		logger:         logger,
+		now:            time.Now,
+		tags:           make(map[string]tagList),
+	}, nil
+}
+
+// ValidateUpcomingVersionRules reports rules that cannot be parsed.
+func ValidateUpcomingVersionRules(rules []UpcomingVersionRule) error {
+	var errs []error
+	for i, rule := range rules {
+		if _, err := parseUpcomingRule(rule); err != nil {
+			errs = append(errs, fmt.Errorf("upcoming version rule %d: %w", i, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func parseUpcomingRule(rule UpcomingVersionRule) (upcomingRule, error) {
+	r := upcomingRule{
+		registry: normalizeUpcomingRegistry(rule.Registry),
+		next:     rule.Next,
+		scope:    strings.ToLower(strings.TrimSpace(rule.Scope)),
+	}
+	image := strings.TrimSpace(rule.Image)
+	switch {
+	case len(image) >= 2 && strings.HasPrefix(image, "/") && strings.HasSuffix(image, "/"):
+		re, err := regexp.Compile(image[1 : len(image)-1])
+		if err != nil {
+			return upcomingRule{}, fmt.Errorf("invalid image regex %q: %w", image, err)
+		}
+		r.re = re
+	case image != "":
+		if _, err := path.Match(image, ""); err != nil {
+			return upcomingRule{}, fmt.Errorf("invalid image pattern %q: %w", image, err)
+		}
+		r.glob = image
+	}
+	if r.registry == "" && r.glob == "" && r.re == nil {
+		return upcomingRule{}, fmt.Errorf("registry or image is required")
+	}
+	if r.next < 0 {
+		return upcomingRule{}, fmt.Errorf("next must not be negative")
+	}
+	switch r.scope {
+	case "":
+		r.scope = UpcomingScopeMinor
+	case UpcomingScopePatch, UpcomingScopeMinor, UpcomingScopeMajor:
+	default:
+		return upcomingRule{}, fmt.Errorf("unsupported scope %q (use patch, minor or major)", rule.Scope)
+	}
+	if c := strings.TrimSpace(rule.Constraint); c != "" {
+		constraint, err := util.ParseVersionConstraint(c)
+		if err != nil {
+			return upcomingRule{}, err
+		}
+		r.constraint = &constraint
+	}
+	if r.next == 0 && r.constraint == nil {
+		return upcomingRule{}, fmt.Errorf("next or constraint is required")
+	}
+	return r, nil
+}
+
+func normalizeUpcomingRegistry(registry string) string {
+	reg := strings.ToLower(strings.TrimSpace(registry))
+	if reg == name.DefaultRegistry || reg == "registry-1.docker.io" {
+		return "docker.io"
+	}
+	return reg
+}
+
+func (r upcomingRule) matches(registry, image string) bool {
+	if r.registry != "" && r.registry != registry {
+		return false
+	}
+	switch {
+	case r.re != nil:
+		return r.re.MatchString(image)
+	case r.glob != "":
+		ok, _ := path.Match(r.glob, image)
+		return ok
+	default:
+		return true
+	}
+}
+
+// selectUpcoming returns the newer tags of current selected by the rule, closest first.
+func (r upcomingRule) selectUpcoming(current util.Version, tags []string) []string {
+	var candidates []util.Version
+	for _, tag := range tags {
+		v, ok := util.ParseVersion(tag)
+		if !ok || !v.SameShape(current) || v.Compare(current) <= 0 {
+			continue
+		}
+		if r.constraint != nil && !r.constraint.Matches(v) {
+			continue
+		}
+		if r.next > 0 {
+			if v.Major != current.Major && r.scope != UpcomingScopeMajor {
+				continue
+			}
+			if v.Minor != current.Minor && r.scope == UpcomingScopePatch {
+				continue
+			}
+		}
+		candidates = append(candidates, v)
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].Compare(candidates[j]) < 0 })
+	if r.next > 0 && len(candidates) > r.next {
+		candidates = candidates[:r.next]
+	}
+	out := make([]string, 0, len(candidates))
+	for _, v := range candidates {
+		out = append(out, v.Original)
+	}
+	return out
+}
+
+func (p *upcomingPusher) jobKey(src string, meta Metadata) (string, bool) {
+	if k, ok := p.Pusher.(jobKeyer); ok {
+		return k.jobKey(src, meta)
+	}
+	return "", false
+}
+
+func (p *upcomingPusher) recordRequest(src string, meta Metadata) {
+	if r, ok := p.Pusher.(requestRecorder); ok {
+		r.recordRequest(src, meta)
+	}
+}
+
+func (p *upcomingPusher) Images() []ImageRecord {
+	if inv, ok := p.Pusher.(ImageInventory); ok {
+		return inv.Images()
+	}
+	return nil
+}
+
+func (p *upcomingPusher) Image(ref string) []ImageRecord {
+	if inv, ok := p.Pusher.(ImageInventory); ok {
+		return inv.Image(ref)
+	}
+	return nil
+}
+
+func (p *upcomingPusher) ImageFor(ref string, meta Metadata) (ImageRecord, bool) {
+	if inv, ok := p.Pusher.(ImageInventory); ok {
+		return inv.ImageFor(ref, meta)
+	}
+	return ImageRecord{}, false
+}
+
+func (p *upcomingPusher) ForgetWorkload(namespace, name string) {
+	if f, ok := p.Pusher.(WorkloadForgetter); ok {
+		f.ForgetWorkload(namespace, name)
+	}
+}
+
+func (p *upcomingPusher) useQueue(enqueue func(ctx context.Context, via Pusher, src string, meta Metadata)) {
+	p.enqueue = enqueue
+}
+
+func (p *upcomingPusher) Mirror(ctx context.Context, src string, meta Metadata) error {
+	if err := p.Pusher.Mirror(ctx, src, meta); err != nil {
+		// Upcoming versions would most likely fail the same way, and a cooldown retries them.
+		return err
+	}
+	p.mirrorUpcoming(ctx, src, meta)
+	return nil
+}
+
+func (p *upcomingPusher) mirrorUpcoming(ctx context.Context, src string, meta Metadata) {
+	if p.DryPull() {
+		// Listing tags would contact the source registry.
+		return
+	}
+	tagRef, ok := parseTagReference(src)
+	if !ok {
+		return
+	}
+	current, ok := util.ParseVersion(tagRef.TagStr())
+	if !ok {
+		return
+	}
+	registry := normalizeUpcomingRegistry(tagRef.Context().RegistryStr())
+	image := registry + "/" + tagRef.Context().RepositoryStr()
+	rule, ok := p.ruleFor(registry, image)
+	if !ok {
+		return
+	}
+	log := p.logger.WithValues("image", src)
+
+	tags, err := p.listTags(ctx, tagRef.Context())
+	if err != nil {
+		logRegistryAuthError(log, err, "list tags")
+		log.Error(err, "unable to list upstream tags for upcoming versions")
+		return
+	}
+	upcoming := rule.selectUpcoming(current, tags)
+	if len(upcoming) == 0 {
+		log.V(1).Info("no upcoming versions to mirror", "current", current.String())
+		return
+	}
+	log.V(1).Info("mirroring upcoming versions", "current", current.String(), "upcoming", upcoming)
+
+	// Upcoming tags are not running anywhere yet, so there is no pod digest to pin to.
+	upcomingMeta := meta
+	upcomingMeta.ImageID = ""
+	digestPull := false
+	upcomingMeta.DigestPull = &digestPull
+	for _, tag := range upcoming {
+		if ctx.Err() != nil {
+			return
+		}
+		ref := tagRef.Context().Tag(tag).String()
+		if p.enqueue != nil {
+			// Mirrored through the wrapped pusher, so that upcoming versions do not look further ahead.
+			p.enqueue(ctx, p.Pusher, ref, upcomingMeta)
+			continue
+		}
+		if err := p.Pusher.Mirror(ctx, ref, upcomingMeta); err != nil {
+			log.Error(err, "unable to mirror upcoming version", "upcoming", ref)
+		}
+	}
+}
+
+func parseTagReference(src string) (name.Tag, bool) {
+	ref, err := name.ParseReference(src, name.WeakValidation)
+	if err != nil {
+		return name.Tag{}, false
+	}
+	if tag, ok := ref.(name.Tag); ok {
+		return tag, true
+	}
+	// Pinned references such as image:1.2.3@sha256:... still carry a usable tag.
+	if idx := strings.Index(src, "@"); idx > 0 {
+		stripped := src[:idx]
+		if !strings.Contains(stripped[strings.LastIndex(stripped, "/")+1:], ":") {
+			return name.Tag{}, false
+		}
+		if tag, err := name.NewTag(stripped, name.WeakValidation); err == nil {
+			return tag, true
+		}
+	}
+	return name.Tag{}, false
+}
+
+func (p *upcomingPusher) ruleFor(registry, image string) (upcomingRule, bool) {
+	for _, rule := range p.rules {
+		if rule.matches(registry, image) {
+			return rule, true
+		}
+	}
+	return upcomingRule{}, false
+}
+
+func (p *upcomingPusher) listTags(ctx context.Context, repo name.Repository) ([]string, error) {
+	key := repo.Name()
+	p.mu.Lock()
+	cached, ok := p.tags[key]
+	p.mu.Unlock()
+	if ok && p.now().Sub(cached.fetched) < upcomingTagListTTL {
+		return cached.tags, nil
+	}
+
+	listCtx := ctx
+	if p.requestTimeout > 0 {
+		var cancel context.CancelFunc
+		listCtx, cancel = context.WithTimeout(ctx, p.requestTimeout)
+		defer cancel()
+	}
+	tags, err := remoteListFunc(repo,
+		remote.WithContext(listCtx),
+		remote.WithAuthFromKeychain(p.keychain),
+		remote.WithTransport(p.transport),
+	)
+	if err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	p.tags[key] = tagList{tags: tags, fetched: p.now()}
+	p.mu.Unlock()
+	return tags, nil
+}
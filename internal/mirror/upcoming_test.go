@@ -0,0 +1,180 @@
+package mirror
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+type recordingMirror struct {
+	dryPull bool
+	err     error
+	calls   []string
+	metas   []Metadata
+}
+
+func (r *recordingMirror) Mirror(_ context.Context, src string, meta Metadata) error {
+	r.calls = append(r.calls, src)
+	r.metas = append(r.metas, meta)
+	return r.err
+}
+
+func (*recordingMirror) DryRun() bool { return false }
+
+func (r *recordingMirror) DryPull() bool { return r.dryPull }
+
+func (*recordingMirror) ResetCooldown() (int, bool) { return 0, false }
+func (*recordingMirror) Cooldowns() []CooldownEntry { return nil }
+func (*recordingMirror) ResetCooldowns(CooldownSelector) (int, bool, error) {
+	return 0, false, nil
+}
+
+func stubRemoteList(t *testing.T, tags []string) *int {
+	t.Helper()
+	calls := 0
+	original := remoteListFunc
+	remoteListFunc = func(name.Repository, ...remote.Option) ([]string, error) {
+		calls++
+		return tags, nil
+	}
+	t.Cleanup(func() { remoteListFunc = original })
+	return &calls
+}
+
+func TestUpcomingVersionPusherMirrorsNextVersions(t *testing.T) {
+	listCalls := stubRemoteList(t, []string{"1.25.2", "1.25.3", "1.25.4", "1.25.5", "1.25.6", "1.26.0", "1.25.4-alpine", "latest", "2.0.0"})
+	inner := &recordingMirror{}
+	pusher, err := NewUpcomingVersionPusher(inner, []UpcomingVersionRule{
+		{Image: "docker.io/library/nginx", Next: 2, Scope: UpcomingScopePatch},
+	}, nil, time.Second, testr.New(t))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	meta := Metadata{Namespace: "default", PodName: "web", ImageID: "docker.io/library/nginx@sha256:abc"}
+	if err := pusher.Mirror(context.Background(), "nginx:1.25.3", meta); err != nil {
+		t.Fatalf("unexpected mirror error: %v", err)
+	}
+	expected := []string{"nginx:1.25.3", "index.docker.io/library/nginx:1.25.4", "index.docker.io/library/nginx:1.25.5"}
+	if !reflect.DeepEqual(inner.calls, expected) {
+		t.Fatalf("unexpected mirrored images: %v", inner.calls)
+	}
+	upcomingMeta := inner.metas[1]
+	if upcomingMeta.ImageID != "" || upcomingMeta.DigestPull == nil || *upcomingMeta.DigestPull {
+		t.Fatalf("expected upcoming versions to be pulled by tag, got %+v", upcomingMeta)
+	}
+	if upcomingMeta.Namespace != "default" || upcomingMeta.PodName != "web" {
+		t.Fatalf("expected workload metadata to be kept, got %+v", upcomingMeta)
+	}
+
+	if err := pusher.Mirror(context.Background(), "nginx:1.25.3", meta); err != nil {
+		t.Fatalf("unexpected mirror error: %v", err)
+	}
+	if *listCalls != 1 {
+		t.Fatalf("expected tag list to be cached, got %d list calls", *listCalls)
+	}
+}
+
+func TestUpcomingVersionPusherHonoursConstraintAndRuleMatching(t *testing.T) {
+	stubRemoteList(t, []string{"v1.24.0", "v1.25.0", "v1.25.1", "v1.30.2", "v2.0.0"})
+	inner := &recordingMirror{}
+	pusher, err := NewUpcomingVersionPusher(inner, []UpcomingVersionRule{
+		{Registry: "ghcr.io", Constraint: ">=1.25 <2"},
+	}, nil, 0, testr.New(t))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := pusher.Mirror(context.Background(), "ghcr.io/acme/api:v1.24.0", Metadata{}); err != nil {
+		t.Fatalf("unexpected mirror error: %v", err)
+	}
+	expected := []string{"ghcr.io/acme/api:v1.24.0", "ghcr.io/acme/api:v1.25.0", "ghcr.io/acme/api:v1.25.1", "ghcr.io/acme/api:v1.30.2"}
+	if !reflect.DeepEqual(inner.calls, expected) {
+		t.Fatalf("unexpected mirrored images: %v", inner.calls)
+	}
+
+	inner.calls = nil
+	if err := pusher.Mirror(context.Background(), "quay.io/acme/api:v1.24.0", Metadata{}); err != nil {
+		t.Fatalf("unexpected mirror error: %v", err)
+	}
+	if len(inner.calls) != 1 {
+		t.Fatalf("expected images from other registries to be mirrored alone, got %v", inner.calls)
+	}
+}
+
+func TestUpcomingVersionPusherQueuesUpcomingVersions(t *testing.T) {
+	stubRemoteList(t, []string{"1.25.3", "1.25.4", "1.25.5"})
+	inner := &recordingMirror{}
+	pusher, err := NewUpcomingVersionPusher(inner, []UpcomingVersionRule{{Registry: "docker.io", Next: 2}}, nil, 0, testr.New(t))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	q := NewMirrorQueue(pusher, 1, testr.New(t))
+	startQueue(t, q)
+
+	if err := q.Mirror(context.Background(), "nginx:1.25.3", Metadata{}); err != nil {
+		t.Fatalf("unexpected mirror error: %v", err)
+	}
+	waitFor(t, func() bool { return q.Len() == 0 })
+	// The single worker mirrors the upcoming versions as separate jobs, which do not look further
+	// ahead themselves.
+	expected := []string{"nginx:1.25.3", "index.docker.io/library/nginx:1.25.4", "index.docker.io/library/nginx:1.25.5"}
+	if !reflect.DeepEqual(inner.calls, expected) {
+		t.Fatalf("unexpected mirrored images: %v", inner.calls)
+	}
+}
+
+func TestUpcomingVersionPusherSkipsAfterFailedMirror(t *testing.T) {
+	listCalls := stubRemoteList(t, []string{"1.0.0", "1.0.1"})
+	inner := &recordingMirror{err: errors.New("pull failed")}
+	pusher, err := NewUpcomingVersionPusher(inner, []UpcomingVersionRule{{Registry: "docker.io", Next: 1}}, nil, 0, testr.New(t))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := pusher.Mirror(context.Background(), "busybox:1.0.0", Metadata{}); !errors.Is(err, inner.err) {
+		t.Fatalf("expected the mirror error, got %v", err)
+	}
+	if *listCalls != 0 || len(inner.calls) != 1 {
+		t.Fatalf("expected no upcoming versions after a failed mirror, got %d list calls and %v", *listCalls, inner.calls)
+	}
+}
+
+func TestUpcomingVersionPusherSkipsWithDryPull(t *testing.T) {
+	listCalls := stubRemoteList(t, []string{"1.0.0", "1.0.1"})
+	inner := &recordingMirror{dryPull: true}
+	pusher, err := NewUpcomingVersionPusher(inner, []UpcomingVersionRule{{Registry: "docker.io", Next: 1}}, nil, 0, testr.New(t))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := pusher.Mirror(context.Background(), "busybox:1.0.0", Metadata{}); err != nil {
+		t.Fatalf("unexpected mirror error: %v", err)
+	}
+	if *listCalls != 0 || len(inner.calls) != 1 {
+		t.Fatalf("expected dry pull to avoid listing tags, got %d list calls and %v", *listCalls, inner.calls)
+	}
+}
+
+func TestValidateUpcomingVersionRules(t *testing.T) {
+	valid := []UpcomingVersionRule{{Image: "/^docker\\.io/library/.*/", Next: 1}, {Registry: "ghcr.io", Constraint: "~1.25"}}
+	if err := ValidateUpcomingVersionRules(valid); err != nil {
+		t.Fatalf("unexpected validation error: %v", err)
+	}
+	invalid := [][]UpcomingVersionRule{
+		{{Next: 1}},
+		{{Registry: "docker.io"}},
+		{{Registry: "docker.io", Next: 1, Scope: "weekly"}},
+		{{Registry: "docker.io", Constraint: ">=abc"}},
+		{{Image: "/([/", Next: 1}},
+	}
+	for _, rules := range invalid {
+		if err := ValidateUpcomingVersionRules(rules); err == nil {
+			t.Errorf("expected %+v to be rejected", rules)
+		}
+	}
+}
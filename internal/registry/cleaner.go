@@ -0,0 +1,28 @@
+package registry
+
+import (
+	"context"
+	"time"
+)
+
+// Image is a manifest stored in a target repository.
+type Image struct {
+	Digest string
+	Tags   []string
+	// PushedAt is zero when the registry does not report push times.
+	PushedAt time.Time
+}
+
+// Cleaner is implemented by targets that can list and delete mirrored images.
+type Cleaner interface {
+	Repositories(ctx context.Context) ([]string, error)
+	Images(ctx context.Context, repository string) ([]Image, error)
+	// DeleteImage removes the manifest and every tag pointing to it.
+	DeleteImage(ctx context.Context, repository string, image Image) error
+}
+
+// Untagger is implemented by cleaners that can remove individual tags without deleting the
+// manifest they point to.
+type Untagger interface {
+	Untag(ctx context.Context, repository string, tags []string) error
+}
@@ -1,6 +1,16 @@
 package registry
 
-import "context"
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
 
 type DockerConfig struct {
 	Registry   string
@@ -20,3 +30,79 @@ func (d *dockerClient) BasicAuth(ctx context.Context) (string, string, error) {
 	return d.cfg.Username, d.cfg.Password, nil
 }
 func (d *dockerClient) Insecure() bool { return d.cfg.Insecure }
+
+// host returns the registry host; a configured registry may carry a path such as a Harbor project.
+func (d *dockerClient) host() string {
+	host, _, _ := strings.Cut(strings.TrimSuffix(d.cfg.Registry, "/"), "/")
+	return host
+}
+
+func (d *dockerClient) nameOptions() []name.Option {
+	opts := []name.Option{name.WeakValidation}
+	if d.cfg.Insecure {
+		opts = append(opts, name.Insecure)
+	}
+	return opts
+}
+
+func (d *dockerClient) remoteOptions(ctx context.Context) []remote.Option {
+	auth := authn.Anonymous
+	if d.cfg.Username != "" || d.cfg.Password != "" {
+		auth = &authn.Basic{Username: d.cfg.Username, Password: d.cfg.Password}
+	}
+	opts := []remote.Option{remote.WithContext(ctx), remote.WithAuth(auth)}
+	if d.cfg.Insecure {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+		opts = append(opts, remote.WithTransport(transport))
+	}
+	return opts
+}
+
+// Repositories lists the registry catalog. Registries that disable the catalog API return an error.
+func (d *dockerClient) Repositories(ctx context.Context) ([]string, error) {
+	reg, err := name.NewRegistry(d.host(), d.nameOptions()...)
+	if err != nil {
+		return nil, err
+	}
+	return remote.Catalog(ctx, reg, d.remoteOptions(ctx)...)
+}
+
+// Images groups the repository's tags by digest. The registry API does not report push times.
+func (d *dockerClient) Images(ctx context.Context, repository string) ([]Image, error) {
+	repo, err := name.NewRepository(d.host()+"/"+repository, d.nameOptions()...)
+	if err != nil {
+		return nil, err
+	}
+	opts := d.remoteOptions(ctx)
+	tags, err := remote.List(repo, opts...)
+	if err != nil {
+		return nil, err
+	}
+	byDigest := make(map[string]int)
+	var out []Image
+	for _, tag := range tags {
+		desc, err := remote.Head(repo.Tag(tag), opts...)
+		if err != nil {
+			return nil, fmt.Errorf("resolve %s:%s: %w", repository, tag, err)
+		}
+		digest := desc.Digest.String()
+		if idx, ok := byDigest[digest]; ok {
+			out[idx].Tags = append(out[idx].Tags, tag)
+			continue
+		}
+		byDigest[digest] = len(out)
+		out = append(out, Image{Digest: digest, Tags: []string{tag}})
+	}
+	return out, nil
+}
+
+// DeleteImage deletes the manifest by digest, which removes every tag pointing to it. The registry
+// must allow deletes (REGISTRY_STORAGE_DELETE_ENABLED for the distribution registry).
+func (d *dockerClient) DeleteImage(ctx context.Context, repository string, image Image) error {
+	ref, err := name.NewDigest(d.host()+"/"+repository+"@"+image.Digest, d.nameOptions()...)
+	if err != nil {
+		return err
+	}
+	return remote.Delete(ref, d.remoteOptions(ctx)...)
+}
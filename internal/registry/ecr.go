@@ -124,3 +124,87 @@ func (c *ecrClient) BasicAuth(ctx context.Context) (username, password string, e
 	}
 	return parts[0], parts[1], nil
 }
+
+// batchDeleteLimit is the maximum number of image IDs accepted by BatchDeleteImage.
+const batchDeleteLimit = 100
+
+func (c *ecrClient) Repositories(ctx context.Context) ([]string, error) {
+	input := &ecr.DescribeRepositoriesInput{}
+	if c.cfg.AccountID != "" {
+		input.RegistryId = aws.String(c.cfg.AccountID)
+	}
+	var out []string
+	pages := ecr.NewDescribeRepositoriesPaginator(c.client, input)
+	for pages.HasMorePages() {
+		page, err := pages.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, repo := range page.Repositories {
+			out = append(out, aws.ToString(repo.RepositoryName))
+		}
+	}
+	return out, nil
+}
+
+func (c *ecrClient) Images(ctx context.Context, repository string) ([]Image, error) {
+	input := &ecr.DescribeImagesInput{RepositoryName: aws.String(repository)}
+	if c.cfg.AccountID != "" {
+		input.RegistryId = aws.String(c.cfg.AccountID)
+	}
+	var out []Image
+	pages := ecr.NewDescribeImagesPaginator(c.client, input)
+	for pages.HasMorePages() {
+		page, err := pages.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, detail := range page.ImageDetails {
+			out = append(out, Image{
+				Digest:   aws.ToString(detail.ImageDigest),
+				Tags:     detail.ImageTags,
+				PushedAt: aws.ToTime(detail.ImagePushedAt),
+			})
+		}
+	}
+	return out, nil
+}
+
+func (c *ecrClient) DeleteImage(ctx context.Context, repository string, image Image) error {
+	return c.batchDelete(ctx, repository, []types.ImageIdentifier{{ImageDigest: aws.String(image.Digest)}})
+}
+
+// Untag removes tags from their images; ECR deletes an image once its last tag is removed.
+func (c *ecrClient) Untag(ctx context.Context, repository string, tags []string) error {
+	ids := make([]types.ImageIdentifier, 0, len(tags))
+	for _, tag := range tags {
+		ids = append(ids, types.ImageIdentifier{ImageTag: aws.String(tag)})
+	}
+	return c.batchDelete(ctx, repository, ids)
+}
+
+func (c *ecrClient) batchDelete(ctx context.Context, repository string, ids []types.ImageIdentifier) error {
+	var errs []error
+	for start := 0; start < len(ids); start += batchDeleteLimit {
+		end := min(start+batchDeleteLimit, len(ids))
+		input := &ecr.BatchDeleteImageInput{RepositoryName: aws.String(repository), ImageIds: ids[start:end]}
+		if c.cfg.AccountID != "" {
+			input.RegistryId = aws.String(c.cfg.AccountID)
+		}
+		out, err := c.client.BatchDeleteImage(ctx, input)
+		if err != nil {
+			return err
+		}
+		for _, failure := range out.Failures {
+			id := ""
+			if failure.ImageId != nil {
+				id = aws.ToString(failure.ImageId.ImageTag)
+				if id == "" {
+					id = aws.ToString(failure.ImageId.ImageDigest)
+				}
+			}
+			errs = append(errs, fmt.Errorf("delete %s:%s: %s: %s", repository, id, failure.FailureCode, aws.ToString(failure.FailureReason)))
+		}
+	}
+	return errors.Join(errs...)
+}
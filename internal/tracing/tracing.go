@@ -0,0 +1,121 @@
+// Package tracing exports the OpenTelemetry spans of copycat to an OTLP collector.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+const (
+	// ProtocolGRPC exports spans with OTLP over gRPC, usually to port 4317.
+	ProtocolGRPC = "grpc"
+	// ProtocolHTTP exports spans with OTLP over HTTP, usually to port 4318.
+	ProtocolHTTP = "http/protobuf"
+
+	// DefaultServiceName is reported as service.name unless OTEL_SERVICE_NAME is set.
+	DefaultServiceName = "k8s-copycat"
+)
+
+// Config selects the OTLP collector spans are exported to. Tracing is disabled when Endpoint is
+// empty. Endpoint is either host:port or a URL; an http:// URL implies Insecure, and HTTP URLs
+// without a path are sent to /v1/traces.
+type Config struct {
+	Endpoint    string
+	Protocol    string
+	Insecure    bool
+	SampleRatio float64
+	ServiceName string
+}
+
+// Enabled reports whether spans are exported.
+func (c Config) Enabled() bool {
+	return strings.TrimSpace(c.Endpoint) != ""
+}
+
+// Validate reports an unknown protocol or a sample ratio outside of [0, 1].
+func (c Config) Validate() error {
+	switch c.Protocol {
+	case "", ProtocolGRPC, ProtocolHTTP:
+	default:
+		return fmt.Errorf("unsupported protocol %q, use %q or %q", c.Protocol, ProtocolGRPC, ProtocolHTTP)
+	}
+	if c.SampleRatio < 0 || c.SampleRatio > 1 {
+		return fmt.Errorf("sample ratio must be between 0 and 1")
+	}
+	return nil
+}
+
+// Setup installs a global tracer provider exporting to the collector of cfg and returns the
+// function that flushes and stops it. Without an endpoint the global no-op provider is kept.
+func Setup(ctx context.Context, cfg Config) (func(context.Context) error, error) {
+	if !cfg.Enabled() {
+		return func(context.Context) error { return nil }, nil
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	exporter, err := newExporter(ctx, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("create OTLP exporter: %w", err)
+	}
+	serviceName := cfg.ServiceName
+	if serviceName == "" {
+		serviceName = DefaultServiceName
+	}
+	// Attributes from OTEL_RESOURCE_ATTRIBUTES and OTEL_SERVICE_NAME take precedence.
+	res, err := resource.New(ctx,
+		resource.WithAttributes(attribute.String("service.name", serviceName)),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+		resource.WithHost(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("detect tracing resource: %w", err)
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+func newExporter(ctx context.Context, cfg Config) (sdktrace.SpanExporter, error) {
+	endpoint := strings.TrimSpace(cfg.Endpoint)
+	isURL := strings.Contains(endpoint, "://")
+	if cfg.Protocol == ProtocolHTTP {
+		opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(endpoint)}
+		if isURL {
+			u, err := url.Parse(endpoint)
+			if err != nil {
+				return nil, fmt.Errorf("parse endpoint: %w", err)
+			}
+			if strings.Trim(u.Path, "/") == "" {
+				u.Path = "/v1/traces"
+			}
+			opts = []otlptracehttp.Option{otlptracehttp.WithEndpointURL(u.String())}
+		}
+		if cfg.Insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		return otlptracehttp.New(ctx, opts...)
+	}
+	opts := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(endpoint)}
+	if isURL {
+		opts = []otlptracegrpc.Option{otlptracegrpc.WithEndpointURL(endpoint)}
+	}
+	if cfg.Insecure {
+		opts = append(opts, otlptracegrpc.WithInsecure())
+	}
+	return otlptracegrpc.New(ctx, opts...)
+}
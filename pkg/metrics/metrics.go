@@ -2,6 +2,7 @@ package metrics
 
 import (
 	"strings"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
@@ -25,7 +26,7 @@ var (
 			Name:      "pull_error_total",
 			Help:      "Total number of failed image pulls performed by k8s-copycat.",
 		},
-		[]string{"registry"},
+		[]string{"registry", "reason"},
 	)
 
 	pushSuccess = prometheus.NewCounterVec(
@@ -45,12 +46,123 @@ var (
 			Name:      "push_error_total",
 			Help:      "Total number of failed image pushes performed by k8s-copycat.",
 		},
+		[]string{"registry", "reason"},
+	)
+
+	pulledBytes = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "k8s_copycat",
+			Subsystem: "registry",
+			Name:      "pulled_bytes_total",
+			Help:      "Total number of bytes downloaded from source registries.",
+		},
+		[]string{"registry"},
+	)
+
+	pushedBytes = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "k8s_copycat",
+			Subsystem: "registry",
+			Name:      "pushed_bytes_total",
+			Help:      "Total number of bytes uploaded to target registries.",
+		},
 		[]string{"registry"},
 	)
+
+	lastSuccess = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "k8s_copycat",
+			Subsystem: "registry",
+			Name:      "last_success_timestamp_seconds",
+			Help:      "Unix time at which an image was last pushed to or found up to date in the target registry.",
+		},
+		[]string{"registry"},
+	)
+
+	stageDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: "k8s_copycat",
+			Subsystem: "mirror",
+			Name:      "stage_duration_seconds",
+			Help:      "Duration of the stages of mirroring an image.",
+			Buckets:   []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300, 600},
+		},
+		[]string{"stage"},
+	)
+
+	inFlight = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: "k8s_copycat",
+			Subsystem: "mirror",
+			Name:      "in_flight",
+			Help:      "Number of images currently being mirrored.",
+		},
+	)
+
+	cooldownEntries = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: "k8s_copycat",
+			Subsystem: "mirror",
+			Name:      "cooldown_entries",
+			Help:      "Number of target images waiting for their failure cooldown to expire.",
+		},
+	)
+
+	awaitingDigest = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: "k8s_copycat",
+			Subsystem: "mirror",
+			Name:      "awaiting_digest",
+			Help:      "Number of target images skipped until their Pod reports an image digest.",
+		},
+	)
+
+	driftImages = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "k8s_copycat",
+			Subsystem: "audit",
+			Name:      "images",
+			Help:      "Number of images of watched workloads by drift status in the last drift audit.",
+		},
+		[]string{"status"},
+	)
+
+	driftAuditTimestamp = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: "k8s_copycat",
+			Subsystem: "audit",
+			Name:      "last_run_timestamp_seconds",
+			Help:      "Unix time at which the last drift audit finished.",
+		},
+	)
+)
+
+// Mirror stages observed by ObserveStage.
+const (
+	StageResolve = "resolve"
+	StagePull    = "pull"
+	StageHead    = "head"
+	StagePush    = "push"
+	StageVerify  = "verify"
+)
+
+// Reasons of pull and push errors.
+const (
+	ReasonAuth           = "auth"
+	ReasonNotFound       = "not_found"
+	ReasonDigestMismatch = "digest_mismatch"
+	ReasonTimeout        = "timeout"
+	ReasonRateLimited    = "rate_limited"
+	ReasonOther          = "other"
 )
 
 func init() {
-	ctrlmetrics.Registry.MustRegister(pullSuccess, pullError, pushSuccess, pushError)
+	ctrlmetrics.Registry.MustRegister(
+		pullSuccess, pullError, pushSuccess, pushError,
+		pulledBytes, pushedBytes, lastSuccess, stageDuration,
+		inFlight, cooldownEntries, awaitingDigest,
+		driftImages, driftAuditTimestamp,
+	)
 }
 
 // recordMetric increments the given counter for the provided image.
@@ -93,19 +205,91 @@ func RecordPullSuccess(image string) {
 	recordMetric(pullSuccess, image)
 }
 
-// RecordPullError increments the pull error counter for the provided image.
-func RecordPullError(image string) {
-	recordMetric(pullError, image)
+// RecordPullError increments the pull error counter for the provided image and reason.
+func RecordPullError(image, reason string) {
+	recordError(pullError, image, reason)
 }
 
-// RecordPushSuccess increments the push success counter for the provided image.
+// RecordPushSuccess increments the push success counter for the provided image and records the
+// time of the success.
 func RecordPushSuccess(image string) {
 	recordMetric(pushSuccess, image)
+	RecordMirrorSuccess(image)
+}
+
+// RecordPushError increments the push error counter for the provided image and reason.
+func RecordPushError(image, reason string) {
+	recordError(pushError, image, reason)
+}
+
+func recordError(counter *prometheus.CounterVec, image, reason string) {
+	registry := registryLabel(image)
+	if registry == "" {
+		return
+	}
+	if reason == "" {
+		reason = ReasonOther
+	}
+	counter.WithLabelValues(registry, reason).Inc()
+}
+
+// RecordMirrorSuccess records that image is up to date in its registry, whether it was pushed or
+// already present.
+func RecordMirrorSuccess(image string) {
+	registry := registryLabel(image)
+	if registry == "" {
+		return
+	}
+	lastSuccess.WithLabelValues(registry).SetToCurrentTime()
+}
+
+// AddPulledBytes adds n bytes downloaded from registry.
+func AddPulledBytes(registry string, n int) {
+	if registry == "" || n <= 0 {
+		return
+	}
+	pulledBytes.WithLabelValues(registry).Add(float64(n))
+}
+
+// AddPushedBytes adds n bytes uploaded to registry.
+func AddPushedBytes(registry string, n int) {
+	if registry == "" || n <= 0 {
+		return
+	}
+	pushedBytes.WithLabelValues(registry).Add(float64(n))
+}
+
+// ObserveStage records how long a mirror stage took.
+func ObserveStage(stage string, d time.Duration) {
+	stageDuration.WithLabelValues(stage).Observe(d.Seconds())
+}
+
+// SetInFlight sets the number of images currently being mirrored.
+func SetInFlight(n int) {
+	inFlight.Set(float64(n))
+}
+
+// SetCooldownEntries sets the number of target images in failure cooldown.
+func SetCooldownEntries(n int) {
+	cooldownEntries.Set(float64(n))
+}
+
+// SetAwaitingDigest sets the number of target images waiting for a Pod image digest.
+func SetAwaitingDigest(n int) {
+	awaitingDigest.Set(float64(n))
+}
+
+// SetDriftImages replaces the number of images by drift status with counts.
+func SetDriftImages(counts map[string]int) {
+	driftImages.Reset()
+	for status, n := range counts {
+		driftImages.WithLabelValues(status).Set(float64(n))
+	}
 }
 
-// RecordPushError increments the push error counter for the provided image.
-func RecordPushError(image string) {
-	recordMetric(pushError, image)
+// SetDriftAuditTimestamp records when a drift audit finished.
+func SetDriftAuditTimestamp(t time.Time) {
+	driftAuditTimestamp.Set(float64(t.Unix()))
 }
 
 // Reset clears internal metrics state. It is intended for use in tests only.
@@ -114,6 +298,15 @@ func Reset() {
 	pullError.Reset()
 	pushSuccess.Reset()
 	pushError.Reset()
+	pulledBytes.Reset()
+	pushedBytes.Reset()
+	lastSuccess.Reset()
+	stageDuration.Reset()
+	inFlight.Set(0)
+	cooldownEntries.Set(0)
+	awaitingDigest.Set(0)
+	driftImages.Reset()
+	driftAuditTimestamp.Set(0)
 }
 
 // PullSuccessCounter returns the underlying prometheus counter for pull successes.
@@ -139,3 +332,57 @@ func PushSuccessCounter() *prometheus.CounterVec {
 func PushErrorCounter() *prometheus.CounterVec {
 	return pushError
 }
+
+// PulledBytesCounter returns the underlying prometheus counter for downloaded bytes.
+// It is exposed for tests and advanced integrations that need direct access to the metric.
+func PulledBytesCounter() *prometheus.CounterVec {
+	return pulledBytes
+}
+
+// PushedBytesCounter returns the underlying prometheus counter for uploaded bytes.
+// It is exposed for tests and advanced integrations that need direct access to the metric.
+func PushedBytesCounter() *prometheus.CounterVec {
+	return pushedBytes
+}
+
+// LastSuccessGauge returns the underlying prometheus gauge for the last success per registry.
+// It is exposed for tests and advanced integrations that need direct access to the metric.
+func LastSuccessGauge() *prometheus.GaugeVec {
+	return lastSuccess
+}
+
+// StageDurationHistogram returns the underlying prometheus histogram for mirror stages.
+// It is exposed for tests and advanced integrations that need direct access to the metric.
+func StageDurationHistogram() *prometheus.HistogramVec {
+	return stageDuration
+}
+
+// InFlightGauge returns the underlying prometheus gauge for images being mirrored.
+// It is exposed for tests and advanced integrations that need direct access to the metric.
+func InFlightGauge() prometheus.Gauge {
+	return inFlight
+}
+
+// CooldownEntriesGauge returns the underlying prometheus gauge for targets in cooldown.
+// It is exposed for tests and advanced integrations that need direct access to the metric.
+func CooldownEntriesGauge() prometheus.Gauge {
+	return cooldownEntries
+}
+
+// AwaitingDigestGauge returns the underlying prometheus gauge for targets awaiting a digest.
+// It is exposed for tests and advanced integrations that need direct access to the metric.
+func AwaitingDigestGauge() prometheus.Gauge {
+	return awaitingDigest
+}
+
+// DriftImagesGauge returns the underlying prometheus gauge for images by drift status.
+// It is exposed for tests and advanced integrations that need direct access to the metric.
+func DriftImagesGauge() *prometheus.GaugeVec {
+	return driftImages
+}
+
+// DriftAuditTimestampGauge returns the underlying prometheus gauge for the last drift audit.
+// It is exposed for tests and advanced integrations that need direct access to the metric.
+func DriftAuditTimestampGauge() prometheus.Gauge {
+	return driftAuditTimestamp
+}
@@ -2,6 +2,7 @@ package metrics
 
 import (
 	"testing"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus/testutil"
 )
@@ -23,9 +24,9 @@ func TestRecordPullErrorIncrementsCounter(t *testing.T) {
 	Reset()
 
 	image := "registry.io/library/alpine:latest"
-	RecordPullError(image)
+	RecordPullError(image, ReasonNotFound)
 
-	if got := testutil.ToFloat64(PullErrorCounter().WithLabelValues("registry.io")); got != 1 {
+	if got := testutil.ToFloat64(PullErrorCounter().WithLabelValues("registry.io", ReasonNotFound)); got != 1 {
 		t.Fatalf("expected pull error counter to be 1, got %v", got)
 	}
 }
@@ -47,9 +48,9 @@ func TestRecordPushErrorIncrementsCounter(t *testing.T) {
 	Reset()
 
 	image := "registry.internal/prod/app@sha256:deadbeef"
-	RecordPushError(image)
+	RecordPushError(image, "")
 
-	if got := testutil.ToFloat64(PushErrorCounter().WithLabelValues("registry.internal")); got != 1 {
+	if got := testutil.ToFloat64(PushErrorCounter().WithLabelValues("registry.internal", ReasonOther)); got != 1 {
 		t.Fatalf("expected push error counter to be 1, got %v", got)
 	}
 }
@@ -59,9 +60,9 @@ func TestRecordIgnoresEmptyImage(t *testing.T) {
 	Reset()
 
 	RecordPullSuccess("")
-	RecordPullError("")
+	RecordPullError("", ReasonAuth)
 	RecordPushSuccess("")
-	RecordPushError("")
+	RecordPushError("", ReasonAuth)
 
 	if count := testutil.CollectAndCount(PullSuccessCounter()); count != 0 {
 		t.Fatalf("expected pull counter to remain empty, got %d samples", count)
@@ -88,3 +89,49 @@ func TestRegistryLabelHandlesSchemesAndPorts(t *testing.T) {
 		t.Fatalf("expected registry.internal:5000 registry label, got %q", got)
 	}
 }
+
+func TestRecordPushSuccessSetsLastSuccessTimestamp(t *testing.T) {
+	t.Cleanup(Reset)
+	Reset()
+
+	before := float64(time.Now().Unix())
+	RecordPushSuccess("registry.internal/prod/app:1.0.0")
+
+	if got := testutil.ToFloat64(LastSuccessGauge().WithLabelValues("registry.internal")); got < before {
+		t.Fatalf("expected last success timestamp to be set, got %v", got)
+	}
+}
+
+func TestByteCountersIgnoreEmptyRegistry(t *testing.T) {
+	t.Cleanup(Reset)
+	Reset()
+
+	AddPulledBytes("docker.io", 512)
+	AddPulledBytes("", 512)
+	AddPushedBytes("registry.internal", 0)
+
+	if got := testutil.ToFloat64(PulledBytesCounter().WithLabelValues("docker.io")); got != 512 {
+		t.Fatalf("expected 512 pulled bytes, got %v", got)
+	}
+	if count := testutil.CollectAndCount(PulledBytesCounter()); count != 1 {
+		t.Fatalf("expected a single pulled bytes series, got %d", count)
+	}
+	if count := testutil.CollectAndCount(PushedBytesCounter()); count != 0 {
+		t.Fatalf("expected no pushed bytes series, got %d", count)
+	}
+}
+
+func TestSetDriftImagesReplacesCounts(t *testing.T) {
+	t.Cleanup(Reset)
+	Reset()
+
+	SetDriftImages(map[string]int{"in_sync": 3, "missing": 1})
+	SetDriftImages(map[string]int{"in_sync": 4, "source_gone": 0})
+
+	if got := testutil.ToFloat64(DriftImagesGauge().WithLabelValues("in_sync")); got != 4 {
+		t.Fatalf("expected 4 images in sync, got %v", got)
+	}
+	if count := testutil.CollectAndCount(DriftImagesGauge()); count != 2 {
+		t.Fatalf("expected the previous audit's statuses to be dropped, got %d series", count)
+	}
+}
@@ -13,8 +13,12 @@ type PodImage struct {
 	Image         string
 	ContainerName string
 	ImageID       string
+	PullPolicy    corev1.PullPolicy
 }
 
+// VolumeContainerPrefix marks synthetic container names used for image volumes.
+const VolumeContainerPrefix = "volume:"
+
 func ImagesFromPodSpec(spec *corev1.PodSpec) []PodImage {
 	if spec == nil {
 		return nil
@@ -22,24 +26,32 @@ func ImagesFromPodSpec(spec *corev1.PodSpec) []PodImage {
 
 	out := make([]PodImage, 0, len(spec.InitContainers)+len(spec.Containers)+len(spec.EphemeralContainers))
 
-	add := func(name, img string) {
+	add := func(name, img string, policy corev1.PullPolicy) {
 		img = strings.TrimSpace(img)
 		name = strings.TrimSpace(name)
 		if img == "" {
 			return
 		}
-		out = append(out, PodImage{Image: img, ContainerName: name})
+		out = append(out, PodImage{Image: img, ContainerName: name, PullPolicy: policy})
 	}
 
 	for _, c := range spec.InitContainers {
-		add(c.Name, c.Image)
+		add(c.Name, c.Image, c.ImagePullPolicy)
 	}
 	for _, c := range spec.Containers {
-		add(c.Name, c.Image)
+		add(c.Name, c.Image, c.ImagePullPolicy)
 	}
 	// Ephemeral containers (don’t forget these)
 	for _, ec := range spec.EphemeralContainers {
-		add(ec.Name, ec.Image)
+		add(ec.Name, ec.Image, ec.ImagePullPolicy)
+	}
+	// Image volumes mount OCI artifacts (models, config bundles) and are attributed to a
+	// synthetic "volume:<name>" container.
+	for _, v := range spec.Volumes {
+		if v.Image == nil {
+			continue
+		}
+		add(VolumeContainerPrefix+v.Name, v.Image.Reference, v.Image.PullPolicy)
 	}
 
 	return out
@@ -70,9 +82,29 @@ func ImagesFromPod(pod *corev1.Pod) []PodImage {
 		}
 	}
 
+	// Image volumes report their resolved digest on the status of every container mounting them.
+	collectVolumes := func(statuses []corev1.ContainerStatus) {
+		for _, st := range statuses {
+			for _, mount := range st.VolumeMounts {
+				if mount.VolumeStatus == nil || mount.VolumeStatus.Image == nil {
+					continue
+				}
+				id := normalizeImageID(mount.VolumeStatus.Image.ImageRef)
+				key := VolumeContainerPrefix + strings.TrimSpace(mount.Name)
+				if id == "" || statusByName[key] != "" {
+					continue
+				}
+				statusByName[key] = id
+			}
+		}
+	}
+
 	collect(pod.Status.InitContainerStatuses)
 	collect(pod.Status.ContainerStatuses)
 	collect(pod.Status.EphemeralContainerStatuses)
+	collectVolumes(pod.Status.InitContainerStatuses)
+	collectVolumes(pod.Status.ContainerStatuses)
+	collectVolumes(pod.Status.EphemeralContainerStatuses)
 
 	for i := range images {
 		if id, ok := statusByName[images[i].ContainerName]; ok {
@@ -47,6 +47,74 @@ func TestImagesFromPodSpecIncludesContainerNames(t *testing.T) {
 	}
 }
 
+func TestImagesFromPodSpecIncludesImageVolumes(t *testing.T) {
+	spec := &corev1.PodSpec{
+		Containers: []corev1.Container{{
+			Name:            "server",
+			Image:           "vllm/vllm-openai:v0.9.0",
+			ImagePullPolicy: corev1.PullIfNotPresent,
+		}},
+		Volumes: []corev1.Volume{{
+			Name:         "model",
+			VolumeSource: corev1.VolumeSource{Image: &corev1.ImageVolumeSource{Reference: "registry.example.com/models/llama:3", PullPolicy: corev1.PullAlways}},
+		}, {
+			Name:         "cache",
+			VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+		}, {
+			Name:         "empty",
+			VolumeSource: corev1.VolumeSource{Image: &corev1.ImageVolumeSource{}},
+		}},
+	}
+
+	images := ImagesFromPodSpec(spec)
+	expected := []PodImage{
+		{ContainerName: "server", Image: "vllm/vllm-openai:v0.9.0", PullPolicy: corev1.PullIfNotPresent},
+		{ContainerName: "volume:model", Image: "registry.example.com/models/llama:3", PullPolicy: corev1.PullAlways},
+	}
+	if len(images) != len(expected) {
+		t.Fatalf("expected %d images, got %+v", len(expected), images)
+	}
+	for i, want := range expected {
+		if images[i] != want {
+			t.Fatalf("index %d: expected %+v, got %+v", i, want, images[i])
+		}
+	}
+}
+
+func TestImagesFromPodResolvesImageVolumeDigests(t *testing.T) {
+	pod := &corev1.Pod{
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{Name: "app", Image: "nginx:1"}},
+			Volumes: []corev1.Volume{{
+				Name:         "bundle",
+				VolumeSource: corev1.VolumeSource{Image: &corev1.ImageVolumeSource{Reference: "registry.example.com/config/bundle:v2"}},
+			}},
+		},
+		Status: corev1.PodStatus{
+			ContainerStatuses: []corev1.ContainerStatus{{
+				Name:    "app",
+				ImageID: "docker.io/library/nginx@sha256:def",
+				VolumeMounts: []corev1.VolumeMountStatus{{
+					Name:         "bundle",
+					MountPath:    "/etc/bundle",
+					VolumeStatus: &corev1.VolumeStatus{Image: &corev1.ImageVolumeStatus{ImageRef: "registry.example.com/config/bundle@sha256:abc"}},
+				}},
+			}},
+		},
+	}
+
+	images := ImagesFromPod(pod)
+	if len(images) != 2 {
+		t.Fatalf("expected 2 images, got %+v", images)
+	}
+	if images[1].ContainerName != "volume:bundle" || images[1].ImageID != "registry.example.com/config/bundle@sha256:abc" {
+		t.Fatalf("unexpected image volume entry: %+v", images[1])
+	}
+	if images[0].ImageID != "docker.io/library/nginx@sha256:def" {
+		t.Fatalf("unexpected container imageID: %q", images[0].ImageID)
+	}
+}
+
 func TestCleanRepoNameStripsInvalidCharactersAndLength(t *testing.T) {
 	repo := "Quay.io/Cilium/cilium-envoy:v1@sha256:318eff387835ca2717baab42a84f35a83a5f9e7d519253df87269f80b9ff0171"
 	cleaned := CleanRepoName(repo)
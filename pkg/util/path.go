@@ -23,6 +23,30 @@ type compiledMapping struct {
 // mappings and then cleans the result for use in target registries. The first
 // matching rule wins.
 func NewRepoPathTransformer(mappings []PathMapping) func(string) string {
+	compiled := compileMappings(mappings)
+	return func(p string) string {
+		for _, m := range compiled {
+			if mapped, ok := m.apply(p); ok {
+				p = mapped
+				break
+			}
+		}
+		return CleanRepoName(p)
+	}
+}
+
+// MatchPathMapping returns the first of mappings that applies to path, the
+// rule NewRepoPathTransformer would use.
+func MatchPathMapping(mappings []PathMapping, path string) (PathMapping, bool) {
+	for _, m := range compileMappings(mappings) {
+		if _, ok := m.apply(path); ok {
+			return m.PathMapping, true
+		}
+	}
+	return PathMapping{}, false
+}
+
+func compileMappings(mappings []PathMapping) []compiledMapping {
 	compiled := make([]compiledMapping, 0, len(mappings))
 	for _, m := range mappings {
 		cm := compiledMapping{PathMapping: m}
@@ -36,23 +60,22 @@ func NewRepoPathTransformer(mappings []PathMapping) func(string) string {
 		}
 		compiled = append(compiled, cm)
 	}
-	return func(p string) string {
-		for _, m := range compiled {
-			if m.Regex {
-				if m.re.MatchString(p) {
-					p = m.re.ReplaceAllString(p, m.To)
-					break
-				}
-				continue
-			}
-			if strings.HasPrefix(p, m.From) {
-				p = strings.TrimPrefix(p, m.From)
-				if m.To != "" {
-					p = strings.TrimSuffix(m.To, "/") + "/" + p
-				}
-				break
-			}
+	return compiled
+}
+
+func (m compiledMapping) apply(p string) (string, bool) {
+	if m.Regex {
+		if !m.re.MatchString(p) {
+			return p, false
 		}
-		return CleanRepoName(p)
+		return m.re.ReplaceAllString(p, m.To), true
+	}
+	if !strings.HasPrefix(p, m.From) {
+		return p, false
+	}
+	p = strings.TrimPrefix(p, m.From)
+	if m.To != "" {
+		p = strings.TrimSuffix(m.To, "/") + "/" + p
 	}
+	return p, true
 }
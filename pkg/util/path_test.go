@@ -16,3 +16,18 @@ func TestNewRepoPathTransformer(t *testing.T) {
 		t.Fatalf("regex mapping failed: got %q", got)
 	}
 }
+
+func TestMatchPathMapping(t *testing.T) {
+	mappings := []PathMapping{
+		{From: "old/", To: "new/"},
+		{From: "^legacy/(.*)", To: "modern/$1", Regex: true},
+	}
+
+	m, ok := MatchPathMapping(mappings, "legacy/service")
+	if !ok || m.From != "^legacy/(.*)" {
+		t.Fatalf("expected regex rule to match, got %+v (%t)", m, ok)
+	}
+	if _, ok := MatchPathMapping(mappings, "library/nginx"); ok {
+		t.Fatalf("expected no rule to match library/nginx")
+	}
+}
@@ -0,0 +1,251 @@
+package util
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var versionTagPattern = regexp.MustCompile(`^v?(\d+)(?:\.(\d+))?(?:\.(\d+))?(?:-([0-9A-Za-z][0-9A-Za-z._-]*))?$`)
+
+// Version is a semantic version parsed from an image tag such as v1.25.3 or 1.25.3-alpine.
+// Parts records how many numeric components the tag carried so floating tags like 1.25 are
+// only compared with other two-component tags. Suffix holds everything after the first dash,
+// which for image tags is usually a variant (alpine, bookworm) rather than a pre-release.
+type Version struct {
+	Major    int
+	Minor    int
+	Patch    int
+	Parts    int
+	Suffix   string
+	Original string
+}
+
+// ParseVersion parses an image tag as a semantic version.
+func ParseVersion(tag string) (Version, bool) {
+	trimmed := strings.TrimSpace(tag)
+	m := versionTagPattern.FindStringSubmatch(trimmed)
+	if m == nil {
+		return Version{}, false
+	}
+	v := Version{Original: trimmed, Suffix: m[4], Parts: 1}
+	var err error
+	if v.Major, err = strconv.Atoi(m[1]); err != nil {
+		return Version{}, false
+	}
+	if m[2] != "" {
+		if v.Minor, err = strconv.Atoi(m[2]); err != nil {
+			return Version{}, false
+		}
+		v.Parts = 2
+	}
+	if m[3] != "" {
+		if v.Patch, err = strconv.Atoi(m[3]); err != nil {
+			return Version{}, false
+		}
+		v.Parts = 3
+	}
+	return v, true
+}
+
+// Compare orders versions by their numeric components and then by suffix.
+func (v Version) Compare(o Version) int {
+	switch {
+	case v.Major != o.Major:
+		return compareInt(v.Major, o.Major)
+	case v.Minor != o.Minor:
+		return compareInt(v.Minor, o.Minor)
+	case v.Patch != o.Patch:
+		return compareInt(v.Patch, o.Patch)
+	default:
+		return strings.Compare(v.Suffix, o.Suffix)
+	}
+}
+
+// SameShape reports whether both tags use the same number of components and the same suffix,
+// which keeps 1.25-alpine from being compared with 1.26.0 or 1.26-bookworm.
+func (v Version) SameShape(o Version) bool {
+	return v.Parts == o.Parts && v.Suffix == o.Suffix
+}
+
+func (v Version) String() string {
+	if v.Original != "" {
+		return v.Original
+	}
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+func compareInt(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// VersionConstraint is a parsed constraint such as "~1.25", "^2", ">=1.25 <2" or
+// ">=1.2, <1.4 || >=2". Terms within an alternative must all match; alternatives are
+// separated by "||". Suffixes are ignored when evaluating constraints.
+type VersionConstraint struct {
+	raw          string
+	alternatives [][]versionTerm
+}
+
+type versionTerm struct {
+	op    string
+	bound Version
+	parts int
+}
+
+// ParseVersionConstraint parses a constraint expression.
+func ParseVersionConstraint(expr string) (VersionConstraint, error) {
+	c := VersionConstraint{raw: strings.TrimSpace(expr)}
+	if c.raw == "" {
+		return c, fmt.Errorf("empty version constraint")
+	}
+	for _, alt := range strings.Split(c.raw, "||") {
+		fields := strings.Fields(strings.ReplaceAll(alt, ",", " "))
+		var terms []versionTerm
+		for i := 0; i < len(fields); i++ {
+			field := fields[i]
+			// Allow whitespace between operator and version, e.g. ">= 1.25".
+			if strings.Trim(field, "<>=!~^") == "" && i+1 < len(fields) {
+				field += fields[i+1]
+				i++
+			}
+			term, err := parseVersionTerm(field)
+			if err != nil {
+				return VersionConstraint{}, fmt.Errorf("parse constraint %q: %w", c.raw, err)
+			}
+			terms = append(terms, term)
+		}
+		if len(terms) == 0 {
+			return VersionConstraint{}, fmt.Errorf("parse constraint %q: empty alternative", c.raw)
+		}
+		c.alternatives = append(c.alternatives, terms)
+	}
+	return c, nil
+}
+
+func parseVersionTerm(field string) (versionTerm, error) {
+	op := ""
+	for _, candidate := range []string{">=", "<=", "!=", ">", "<", "=", "~", "^"} {
+		if strings.HasPrefix(field, candidate) {
+			op = candidate
+			break
+		}
+	}
+	value := strings.TrimSpace(strings.TrimPrefix(field, op))
+	// Treat x/* wildcards as a partial version: 1.25.x behaves like 1.25.
+	segments := strings.Split(strings.TrimPrefix(value, "v"), ".")
+	kept := segments[:0]
+	for _, seg := range segments {
+		if seg == "x" || seg == "X" || seg == "*" {
+			break
+		}
+		kept = append(kept, seg)
+	}
+	if len(kept) == 0 {
+		if op == "" || op == "=" {
+			return versionTerm{op: "*"}, nil
+		}
+		return versionTerm{}, fmt.Errorf("missing version in %q", field)
+	}
+	bound, ok := ParseVersion(strings.Join(kept, "."))
+	if !ok || bound.Suffix != "" {
+		return versionTerm{}, fmt.Errorf("invalid version %q", value)
+	}
+	if op == "" {
+		op = "="
+	}
+	return versionTerm{op: op, bound: bound, parts: bound.Parts}, nil
+}
+
+// Matches reports whether v satisfies the constraint.
+func (c VersionConstraint) Matches(v Version) bool {
+	for _, terms := range c.alternatives {
+		matched := true
+		for _, term := range terms {
+			if !term.matches(v) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+func (c VersionConstraint) String() string {
+	return c.raw
+}
+
+func (t versionTerm) matches(v Version) bool {
+	if t.op == "*" {
+		return true
+	}
+	cmp := compareNumeric(v, t.bound)
+	switch t.op {
+	case ">":
+		return cmp > 0 && !t.samePrefix(v)
+	case ">=":
+		return cmp >= 0 || t.samePrefix(v)
+	case "<":
+		return cmp < 0 && !t.samePrefix(v)
+	case "<=":
+		return cmp <= 0 || t.samePrefix(v)
+	case "=":
+		return t.samePrefix(v)
+	case "!=":
+		return !t.samePrefix(v)
+	case "~":
+		// ~1.25.3 := >=1.25.3 <1.26; ~1.25 := >=1.25 <1.26; ~1 := >=1 <2
+		if cmp < 0 && !t.samePrefix(v) {
+			return false
+		}
+		if t.parts == 1 {
+			return v.Major == t.bound.Major
+		}
+		return v.Major == t.bound.Major && v.Minor == t.bound.Minor
+	case "^":
+		// ^1.25.3 := >=1.25.3 <2; ^0.3 := >=0.3 <0.4; ^0.0.3 := =0.0.3
+		if cmp < 0 && !t.samePrefix(v) {
+			return false
+		}
+		switch {
+		case t.bound.Major != 0 || t.parts == 1:
+			return v.Major == t.bound.Major
+		case t.bound.Minor != 0 || t.parts == 2:
+			return v.Major == 0 && v.Minor == t.bound.Minor
+		default:
+			return v.Major == 0 && v.Minor == 0 && v.Patch == t.bound.Patch
+		}
+	}
+	return false
+}
+
+// samePrefix reports whether v matches every component present in a partial bound, so
+// "=1.25" matches 1.25.7 and "<1.25" excludes it.
+func (t versionTerm) samePrefix(v Version) bool {
+	if v.Major != t.bound.Major {
+		return false
+	}
+	if t.parts >= 2 && v.Minor != t.bound.Minor {
+		return false
+	}
+	if t.parts >= 3 && v.Patch != t.bound.Patch {
+		return false
+	}
+	return true
+}
+
+func compareNumeric(a, b Version) int {
+	a.Suffix, b.Suffix = "", ""
+	return a.Compare(b)
+}
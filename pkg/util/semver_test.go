@@ -0,0 +1,78 @@
+package util
+
+import "testing"
+
+func TestParseVersion(t *testing.T) {
+	cases := []struct {
+		tag    string
+		ok     bool
+		parts  int
+		suffix string
+	}{
+		{"1.25.3", true, 3, ""},
+		{"v1.25", true, 2, ""},
+		{"7", true, 1, ""},
+		{"1.25.3-alpine", true, 3, "alpine"},
+		{"1.27.0-bookworm-slim", true, 3, "bookworm-slim"},
+		{"latest", false, 0, ""},
+		{"1.2.3.4", false, 0, ""},
+		{"sha-abc123", false, 0, ""},
+	}
+	for _, tc := range cases {
+		v, ok := ParseVersion(tc.tag)
+		if ok != tc.ok {
+			t.Fatalf("ParseVersion(%q) ok = %v, want %v", tc.tag, ok, tc.ok)
+		}
+		if !ok {
+			continue
+		}
+		if v.Parts != tc.parts || v.Suffix != tc.suffix || v.String() != tc.tag {
+			t.Fatalf("ParseVersion(%q) = %+v", tc.tag, v)
+		}
+	}
+}
+
+func TestVersionConstraintMatches(t *testing.T) {
+	cases := []struct {
+		constraint string
+		version    string
+		want       bool
+	}{
+		{"~1.25", "1.25.9", true},
+		{"~1.25", "1.26.0", false},
+		{"~1.25.3", "1.25.2", false},
+		{"^1.25", "1.99.0", true},
+		{"^1.25", "2.0.0", false},
+		{"^0.3", "0.4.0", false},
+		{">=1.25 <2", "1.30.1", true},
+		{">=1.25 <2", "2.0.0", false},
+		{">= 1.25, < 1.27", "1.26.4", true},
+		{"<1.25", "1.25.1", false},
+		{"1.25.x", "1.25.4", true},
+		{"1.25.x", "1.26.0", false},
+		{"<1.2 || >=3", "3.1.0", true},
+		{"<1.2 || >=3", "2.0.0", false},
+		{"!=1.25.1", "1.25.1-alpine", false},
+	}
+	for _, tc := range cases {
+		c, err := ParseVersionConstraint(tc.constraint)
+		if err != nil {
+			t.Fatalf("ParseVersionConstraint(%q): %v", tc.constraint, err)
+		}
+		v, ok := ParseVersion(tc.version)
+		if !ok {
+			t.Fatalf("ParseVersion(%q) failed", tc.version)
+		}
+		if got := c.Matches(v); got != tc.want {
+			t.Errorf("%q matches %q = %v, want %v", tc.constraint, tc.version, got, tc.want)
+		}
+	}
+}
+
+func TestParseVersionConstraintRejectsInvalidInput(t *testing.T) {
+	for _, expr := range []string{"", ">=", "~abc", ">=1.2-rc1", "||"} {
+		if _, err := ParseVersionConstraint(expr); err == nil {
+			t.Errorf("expected %q to be rejected", expr)
+		}
+	}
+}